@@ -0,0 +1,115 @@
+// Package fees prices deposits, payouts and payments from a fee schedule and
+// builds the ledger legs that collect the fees.
+package fees
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"os"
+
+	tbPb "protobufs/gen/go/tigerbeetle-service"
+
+	tbt "github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+const (
+	REVENUE_ACCOUNT_ID = "2"
+
+	FLOW_DEPOSIT = "deposit"
+	FLOW_PAYOUT  = "payout"
+	FLOW_PAYMENT = "payment"
+
+	BasisPointsPerUnit = 10_000
+)
+
+// FeeRule is charged as Flat plus PercentBps of the amount, rounded up to the
+// next minor unit and clamped to [Min, Max]. A missing Max means no cap.
+type FeeRule struct {
+	Flat       uint64  `json:"flat"`
+	PercentBps uint64  `json:"percent_bps"`
+	Min        uint64  `json:"min"`
+	Max        *uint64 `json:"max"`
+}
+
+type FlowFees struct {
+	Default FeeRule            `json:"default"`
+	Tiers   map[string]FeeRule `json:"tiers"`
+}
+
+// FeeSchedule maps a flow to its fee rules. Flows missing from the schedule
+// are free.
+type FeeSchedule map[string]FlowFees
+
+func LoadFeeSchedule(path string) (FeeSchedule, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read fee schedule: %w", err)
+	}
+
+	schedule := FeeSchedule{}
+	if err := json.Unmarshal(content, &schedule); err != nil {
+		return nil, fmt.Errorf("parse fee schedule: %w", err)
+	}
+
+	for flow, fees := range schedule {
+		if err := fees.Default.validate(); err != nil {
+			return nil, fmt.Errorf("flow %s: %w", flow, err)
+		}
+		for tier, rule := range fees.Tiers {
+			if err := rule.validate(); err != nil {
+				return nil, fmt.Errorf("flow %s, tier %s: %w", flow, tier, err)
+			}
+		}
+	}
+
+	return schedule, nil
+}
+
+func (rule FeeRule) validate() error {
+	if rule.PercentBps > BasisPointsPerUnit {
+		return fmt.Errorf("percent_bps %d exceeds %d", rule.PercentBps, BasisPointsPerUnit)
+	}
+	if rule.Max != nil && *rule.Max < rule.Min {
+		return fmt.Errorf("max %d is below min %d", *rule.Max, rule.Min)
+	}
+	return nil
+}
+
+func (schedule FeeSchedule) Rule(flow, tier string) FeeRule {
+	fees, ok := schedule[flow]
+	if !ok {
+		return FeeRule{}
+	}
+	if rule, ok := fees.Tiers[tier]; ok {
+		return rule
+	}
+	return fees.Default
+}
+
+func (rule FeeRule) Fee(amount uint64) uint64 {
+	hi, lo := bits.Mul64(amount, rule.PercentBps)
+	percentage, remainder := bits.Div64(hi, lo, BasisPointsPerUnit)
+	if remainder > 0 {
+		percentage++
+	}
+
+	fee := rule.Flat + percentage
+	if fee < rule.Min {
+		fee = rule.Min
+	}
+	if rule.Max != nil && fee > *rule.Max {
+		fee = *rule.Max
+	}
+	return fee
+}
+
+// Leg moves the fee from the user into the revenue account.
+func Leg(userId string, fee uint64, kind tbPb.LinkedTransferKind) *tbPb.LinkedTransfer {
+	return &tbPb.LinkedTransfer{
+		CreditAccountId: userId,
+		DebitAccountId:  REVENUE_ACCOUNT_ID,
+		Amount:          tbt.ToUint128(fee).String(),
+		Kind:            kind,
+	}
+}
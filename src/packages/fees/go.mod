@@ -0,0 +1,5 @@
+module fees
+
+go 1.25.4
+
+require github.com/tigerbeetle/tigerbeetle-go v0.16.62
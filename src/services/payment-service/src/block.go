@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+
+	"payment-service/src/lib"
+	userPb "protobufs/gen/go/user-service"
+
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// checkNotBlocked refuses payments to a recipient who has blocked the sender.
+// The sender gets the same error as for a risk block, so the block stays
+// private.
+func (s *PaymentServiceServer) checkNotBlocked(ctx context.Context, tracer oteltrace.Tracer, fromUserId, toUserId string) error {
+	ctx, blockSpan := tracer.Start(ctx, lib.EVENT_BLOCK_CHECK)
+	defer blockSpan.End()
+
+	status, err := s.userServiceClient.GetBlockStatus(ctx, &userPb.GetBlockStatusRequest{
+		UserId:      toUserId,
+		OtherUserId: fromUserId,
+	})
+	if err != nil {
+		blockSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	if status.Blocked {
+		blockSpan.AddEvent(lib.EVENT_BLOCKED, oteltrace.WithAttributes(
+			attribute.String(lib.ATTR_USER_ID, toUserId),
+		))
+		return lib.ErrPaymentBlocked
+	}
+
+	return nil
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"time"
+
+	"fees"
+	"payment-service/src/lib"
+	"payment-service/src/repo"
+	"payment-service/src/risk"
+	pb "protobufs/gen/go/payment-service"
+	tbPb "protobufs/gen/go/tigerbeetle-service"
+	userPb "protobufs/gen/go/user-service"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	tbt "github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+	"google.golang.org/grpc/status"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func (s *PaymentServiceServer) resolveRecipient(ctx context.Context, recipient string) (string, error) {
+	var user *userPb.User
+	var err error
+	if lib.IsPhoneNumber(recipient) {
+		user, err = s.userServiceClient.GetUserByPhoneNumber(ctx, &userPb.GetUserByPhoneNumberRequest{
+			PhoneNumber: recipient,
+		})
+	} else {
+		user, err = s.userServiceClient.GetUserById(ctx, &userPb.GetUserByIdRequest{
+			UserId: recipient,
+		})
+	}
+	if err != nil {
+		if status.Convert(err).Message() == lib.ErrNotFound.Error() {
+			return "", lib.ErrRecipientNotFound
+		}
+		slog.Error("Failed to resolve bulk payment recipient", "error", err)
+		return "", lib.ErrUnexpected
+	}
+	return user.UserId, nil
+}
+
+func (s *PaymentServiceServer) CreateBulkPayment(ctx context.Context, req *pb.CreateBulkPaymentRequest) (*pb.BulkPaymentBatch, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.FromUserId),
+	)
+
+	ctx, parseSpan := tracer.Start(ctx, lib.EVENT_BULK_PARSE)
+	defer parseSpan.End()
+
+	parsedRows, err := lib.ParseBulkPaymentCsv(req.Csv)
+	if err != nil {
+		parseSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "csv"),
+		))
+		return nil, err
+	}
+
+	parseSpan.SetAttributes(
+		attribute.Int(lib.ATTR_BULK_ROW_COUNT, len(parsedRows)),
+	)
+	parseSpan.End()
+
+	ctx, resolveSpan := tracer.Start(ctx, lib.EVENT_BULK_RESOLVE_RECIPIENT)
+	defer resolveSpan.End()
+
+	recipients := map[string]string{}
+	rows := make([]repo.BulkPaymentRow, len(parsedRows))
+	validRows := 0
+	totalAmount := uint64(0)
+	for i, parsedRow := range parsedRows {
+		row := repo.BulkPaymentRow{
+			RowNumber: int64(parsedRow.RowNumber),
+			Recipient: parsedRow.Recipient,
+			Amount:    int64(parsedRow.Amount),
+			Memo:      parsedRow.Memo,
+			Status:    lib.BULK_ROW_STATUS_PENDING,
+		}
+
+		rowErr := parsedRow.Error
+		if rowErr == nil {
+			toUserId, ok := recipients[parsedRow.Recipient]
+			if !ok {
+				toUserId, err = s.resolveRecipient(ctx, parsedRow.Recipient)
+				if err == lib.ErrUnexpected {
+					resolveSpan.RecordError(err)
+					return nil, err
+				}
+				rowErr = err
+				recipients[parsedRow.Recipient] = toUserId
+			}
+			if rowErr == nil && toUserId == "" {
+				rowErr = lib.ErrRecipientNotFound
+			}
+			if rowErr == nil && toUserId == req.FromUserId {
+				rowErr = lib.ErrInvalidRecipient
+			}
+			if rowErr == nil {
+				row.ToUserId = &toUserId
+			}
+		}
+
+		if rowErr != nil {
+			message := rowErr.Error()
+			row.Status = lib.BULK_ROW_STATUS_INVALID
+			row.Error = &message
+		} else {
+			validRows++
+			if totalAmount > math.MaxInt64-parsedRow.Amount {
+				resolveSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+					attribute.String("field", "amount"),
+				))
+				return nil, lib.ErrInvalidAmount
+			}
+			totalAmount += parsedRow.Amount
+		}
+		rows[i] = row
+	}
+
+	resolveSpan.SetAttributes(
+		attribute.Int(lib.ATTR_BULK_VALID_ROWS, validRows),
+	)
+	resolveSpan.End()
+
+	batchId, err := uuid.NewV7()
+	if err != nil {
+		span.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+
+	batch := repo.BulkPaymentBatch{
+		BatchId:    batchId.String(),
+		FromUserId: req.FromUserId,
+		Status:     lib.BULK_BATCH_STATUS_PROCESSING,
+	}
+	if validRows == 0 {
+		batch.Status = lib.BULK_BATCH_STATUS_REJECTED
+	} else if s.requiresConfirmation(totalAmount) {
+		batch.Status = lib.BULK_BATCH_STATUS_AWAITING_CONFIRMATION
+	}
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_BULK_BATCH_ID, batch.BatchId),
+	)
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_BULK_CREATE)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryInsertBulkPaymentBatch),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{batch.BatchId, batch.FromUserId, batch.Status}),
+	)
+
+	err = repo.CreateBulkPaymentBatch(ctx, s.db, batch, rows)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	dbSpan.End()
+
+	return s.getBulkPaymentBatch(ctx, tracer, batch.BatchId, req.FromUserId)
+}
+
+// ConfirmBulkPayment redeems one confirmation for the whole batch, bound to
+// the batch id and its total, and hands the batch to the worker. Batches
+// whose total is above the confirmation threshold wait for it.
+func (s *PaymentServiceServer) ConfirmBulkPayment(ctx context.Context, req *pb.ConfirmBulkPaymentRequest) (*pb.BulkPaymentBatch, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_BULK_BATCH_ID, req.BatchId),
+	)
+
+	batch, err := s.getBulkPaymentBatch(ctx, tracer, req.BatchId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if batch.Status != lib.BULK_BATCH_STATUS_AWAITING_CONFIRMATION {
+		span.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "batchId"),
+		))
+		return nil, lib.ErrUnacceptableRequest
+	}
+
+	confirmationReq := &userPb.RedeemPaymentConfirmationRequest{
+		ConfirmationToken: req.ConfirmationToken,
+		FromUserId:        req.UserId,
+		BulkBatchId:       &req.BatchId,
+		Amount:            batch.TotalAmount,
+	}
+	err = s.redeemConfirmation(ctx, tracer, confirmationReq)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, confirmSpan := tracer.Start(ctx, lib.EVENT_BULK_CONFIRM)
+	defer confirmSpan.End()
+
+	confirmSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryUpdateBulkPaymentBatchStatus),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.BatchId, lib.BULK_BATCH_STATUS_AWAITING_CONFIRMATION, lib.BULK_BATCH_STATUS_PROCESSING}),
+	)
+
+	err = repo.UpdateBulkPaymentBatchStatus(ctx, s.db, req.BatchId, lib.BULK_BATCH_STATUS_AWAITING_CONFIRMATION, lib.BULK_BATCH_STATUS_PROCESSING)
+	if err != nil && err != lib.ErrNotFound {
+		confirmSpan.RecordError(err)
+		s.releaseConfirmation(ctx, tracer, confirmationReq)
+		return nil, err
+	}
+	confirmSpan.End()
+
+	return s.getBulkPaymentBatch(ctx, tracer, req.BatchId, req.UserId)
+}
+
+// prepareBulkPayment runs the checks every payment goes through on each
+// pending row and gives the rows that pass their ledger ids and fees. Rows
+// the checks refuse fail on their own; the rest go out together. Confirmation
+// is handled once for the batch by ConfirmBulkPayment.
+func (s *PaymentServiceServer) prepareBulkPayment(ctx context.Context, tracer oteltrace.Tracer, batch repo.BulkPaymentBatch, rows []repo.BulkPaymentRow) error {
+	ctx, prepareSpan := tracer.Start(ctx, lib.EVENT_BULK_PREPARE)
+	defer prepareSpan.End()
+
+	for i, row := range rows {
+		req := &pb.CreatePaymentRequest{
+			FromUserId: batch.FromUserId,
+			ToUserId:   *row.ToUserId,
+			Amount:     uint64(row.Amount),
+			Memo:       row.Memo,
+		}
+
+		var fee uint64
+		err := s.checkNotBlocked(ctx, tracer, req.FromUserId, req.ToUserId)
+		if err == nil {
+			var screening risk.Result
+			screening, err = s.screenPayment(ctx, tracer, req)
+			if err == nil && screening.Verdict == risk.VerdictHold {
+				err = lib.ErrPaymentRequiresReview
+			}
+		}
+		if err == nil {
+			fee, err = s.quoteFee(ctx, tracer, req.FromUserId, req.Amount)
+		}
+		if err == lib.ErrUnexpected {
+			prepareSpan.RecordError(err)
+			return err
+		}
+
+		if err != nil {
+			message := err.Error()
+			row.Status = lib.BULK_ROW_STATUS_FAILED
+			row.Error = &message
+
+			prepareSpan.AddEvent(lib.EVENT_BULK_ROW_FAILED, oteltrace.WithAttributes(
+				attribute.Int64("row", row.RowNumber),
+				attribute.String("error", message),
+			))
+		} else {
+			transferId := tbt.ID().String()
+			row.TransferId = &transferId
+			if fee > 0 {
+				feeAmount := int64(fee)
+				feeTransferId := tbt.ID().String()
+				row.FeeAmount = &feeAmount
+				row.FeeTransferId = &feeTransferId
+			}
+		}
+		rows[i] = row
+	}
+
+	prepareSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryPrepareBulkPaymentRow),
+	)
+
+	err := repo.PrepareBulkPaymentRows(ctx, s.db, batch.BatchId, rows)
+	if err != nil {
+		prepareSpan.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+// transferExists tells whether the ledger already holds the transfer.
+func (s *PaymentServiceServer) transferExists(ctx context.Context, transferId string) (bool, error) {
+	_, err := s.tigerbeetleServiceClient.LookupTransfer(ctx, &tbPb.TransferId{
+		TransferId: transferId,
+	})
+	if err != nil {
+		if status.Convert(err).Message() == lib.ErrNotFound.Error() {
+			return false, nil
+		}
+		slog.Error("Failed to look up transfer", "error", err)
+		return false, lib.ErrUnexpected
+	}
+	return true, nil
+}
+
+// failBulkPayment fails every row that was about to be paid with the same
+// error and completes the batch.
+func (s *PaymentServiceServer) failBulkPayment(ctx context.Context, batchId string, rows []repo.BulkPaymentRow, cause error) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin bulk payment transaction", "error", err)
+		return lib.ErrUnexpected
+	}
+	defer tx.Rollback()
+
+	message := cause.Error()
+	for _, row := range rows {
+		row.Status = lib.BULK_ROW_STATUS_FAILED
+		row.Error = &message
+		row.TransferId = nil
+		row.FeeAmount = nil
+		row.FeeTransferId = nil
+
+		err = repo.UpdateBulkPaymentRow(ctx, tx, batchId, row)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = repo.CompleteBulkPaymentBatch(ctx, tx, batchId)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.Error("Failed to commit bulk payment batch", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+// executeBulkPayment pays every prepared row of the batch as one linked
+// chain, so either all of them go out or none do. The chain uses the ids
+// stored on the rows, which makes a second attempt after a crash safe: if
+// the ledger already has the chain, only the records are written.
+func (s *PaymentServiceServer) executeBulkPayment(ctx context.Context, tracer oteltrace.Tracer, batch repo.BulkPaymentBatch) error {
+	ctx, executeSpan := tracer.Start(ctx, lib.EVENT_BULK_EXECUTE)
+	defer executeSpan.End()
+
+	executeSpan.SetAttributes(
+		attribute.String(lib.ATTR_BULK_BATCH_ID, batch.BatchId),
+	)
+
+	rows, err := repo.GetBulkPaymentRows(ctx, s.db, batch.BatchId)
+	if err != nil {
+		executeSpan.RecordError(err)
+		return err
+	}
+
+	unprepared := []repo.BulkPaymentRow{}
+	for _, row := range rows {
+		if row.Status == lib.BULK_ROW_STATUS_PENDING && row.TransferId == nil {
+			unprepared = append(unprepared, row)
+		}
+	}
+	if len(unprepared) > 0 {
+		err = s.prepareBulkPayment(ctx, tracer, batch, unprepared)
+		if err != nil {
+			return err
+		}
+		rows, err = repo.GetBulkPaymentRows(ctx, s.db, batch.BatchId)
+		if err != nil {
+			executeSpan.RecordError(err)
+			return err
+		}
+	}
+
+	payable := []repo.BulkPaymentRow{}
+	amounts := []uint64{}
+	transfers := []*tbPb.LinkedTransfer{}
+	for _, row := range rows {
+		if row.Status != lib.BULK_ROW_STATUS_PENDING || row.TransferId == nil {
+			continue
+		}
+		payable = append(payable, row)
+		amounts = append(amounts, uint64(row.Amount))
+		transfers = append(transfers, &tbPb.LinkedTransfer{
+			CreditAccountId: batch.FromUserId,
+			DebitAccountId:  *row.ToUserId,
+			Amount:          tbt.ToUint128(uint64(row.Amount)).String(),
+			TransferId:      row.TransferId,
+		})
+		if row.FeeTransferId != nil {
+			feeTransfer := fees.Leg(batch.FromUserId, uint64(*row.FeeAmount), tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_POSTED)
+			feeTransfer.TransferId = row.FeeTransferId
+			transfers = append(transfers, feeTransfer)
+		}
+	}
+
+	executeSpan.SetAttributes(
+		attribute.Int(lib.ATTR_BULK_VALID_ROWS, len(payable)),
+	)
+
+	if len(payable) == 0 {
+		err = repo.CompleteBulkPaymentBatch(ctx, s.db, batch.BatchId)
+		if err != nil {
+			executeSpan.RecordError(err)
+		}
+		return err
+	}
+
+	applied, err := s.transferExists(ctx, *payable[0].TransferId)
+	if err != nil {
+		executeSpan.RecordError(err)
+		return err
+	}
+
+	var tx *sqlx.Tx
+	if applied {
+		tx, err = s.db.BeginTxx(ctx, nil)
+		if err != nil {
+			executeSpan.RecordError(err)
+			return lib.ErrUnexpected
+		}
+	} else {
+		tx, err = s.checkPaymentLimits(ctx, tracer, batch.FromUserId, amounts...)
+		if err == lib.ErrUnexpected {
+			return err
+		}
+		if err != nil {
+			return s.failBulkPayment(ctx, batch.BatchId, payable, err)
+		}
+
+		_, err = s.tigerbeetleServiceClient.CreateLinkedTransfers(
+			ctx,
+			&tbPb.CreateLinkedTransfersRequest{
+				Transfers: transfers,
+			},
+		)
+		if err != nil {
+			applied, rejected := s.checkFailedChain(ctx, tracer, *payable[0].TransferId, err)
+			if !applied {
+				tx.Rollback()
+				executeSpan.RecordError(err)
+				// Unless the ledger rejected the chain it may still have
+				// applied it, so that is left for the next attempt to sort out.
+				if !rejected {
+					return lib.ErrUnexpected
+				}
+				return s.failBulkPayment(ctx, batch.BatchId, payable, errors.New(status.Convert(err).Message()))
+			}
+		}
+	}
+	defer tx.Rollback()
+
+	for _, row := range payable {
+		err = s.insertTransfer(ctx, tracer, tx, lib.TRANSFER_STATUS_DONE, *row.TransferId, batch.FromUserId, *row.ToUserId, uint64(row.Amount), row.Memo, nil)
+		if err != nil {
+			return err
+		}
+		if row.FeeTransferId != nil {
+			err = s.recordFee(ctx, tracer, tx, *row.FeeTransferId, *row.TransferId, batch.FromUserId, uint64(*row.FeeAmount))
+			if err != nil {
+				return err
+			}
+		}
+
+		row.Status = lib.BULK_ROW_STATUS_POSTED
+		err = repo.UpdateBulkPaymentRow(ctx, tx, batch.BatchId, row)
+		if err != nil {
+			executeSpan.RecordError(err)
+			return err
+		}
+	}
+
+	err = repo.CompleteBulkPaymentBatch(ctx, tx, batch.BatchId)
+	if err != nil {
+		executeSpan.RecordError(err)
+		return err
+	}
+
+	return s.commitPayment(ctx, tracer, tx)
+}
+
+// sweepBulkPayments leases batches that are ready to run, including ones
+// whose previous worker stopped half way, and executes them.
+func (s *PaymentServiceServer) sweepBulkPayments(ctx context.Context) {
+	tracer := otel.Tracer(lib.ServiceName)
+
+	ctx, sweepSpan := tracer.Start(ctx, lib.EVENT_BULK_SWEEP)
+	defer sweepSpan.End()
+
+	batches, err := repo.GetClaimableBulkPaymentBatches(ctx, s.db, lib.BulkPaymentWorkerBatchSize)
+	if err != nil {
+		sweepSpan.RecordError(err)
+		return
+	}
+
+	for _, batch := range batches {
+		claimed, err := repo.ClaimBulkPaymentBatch(ctx, s.db, batch.BatchId, lib.BulkPaymentWorkerLease)
+		if err != nil {
+			sweepSpan.RecordError(err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		err = s.executeBulkPayment(ctx, tracer, batch)
+		if err != nil {
+			slog.Error("Failed to execute bulk payment", "batch", batch.BatchId, "error", err)
+		}
+	}
+}
+
+func (s *PaymentServiceServer) runBulkPaymentWorker(ctx context.Context) {
+	ticker := time.NewTicker(lib.BulkPaymentWorkerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweepBulkPayments(ctx)
+		}
+	}
+}
+
+func (s *PaymentServiceServer) getBulkPaymentBatch(ctx context.Context, tracer oteltrace.Tracer, batchId, userId string) (*pb.BulkPaymentBatch, error) {
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_BULK_GET)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryGetBulkPaymentBatch),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{batchId, userId}),
+	)
+
+	batch, rows, err := repo.GetBulkPaymentBatch(ctx, s.db, batchId, userId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	dbSpan.End()
+
+	return repo.DbBulkPaymentBatchToPb(batch, rows), nil
+}
+
+func (s *PaymentServiceServer) GetBulkPaymentBatch(ctx context.Context, req *pb.GetBulkPaymentBatchRequest) (*pb.BulkPaymentBatch, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_BULK_BATCH_ID, req.BatchId),
+	)
+
+	return s.getBulkPaymentBatch(ctx, tracer, req.BatchId, req.UserId)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"payment-service/src/lib"
+	pb "protobufs/gen/go/payment-service"
+	userPb "protobufs/gen/go/user-service"
+
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+func (s *PaymentServiceServer) requiresConfirmation(amount uint64) bool {
+	return amount > s.config.ConfirmationThreshold
+}
+
+// paymentConfirmation is the confirmation a single payment has to present,
+// bound to its recipient and amount.
+func paymentConfirmation(req *pb.CreatePaymentRequest) *userPb.RedeemPaymentConfirmationRequest {
+	confirmation := &userPb.RedeemPaymentConfirmationRequest{
+		FromUserId: req.FromUserId,
+		ToUserId:   req.ToUserId,
+		Amount:     req.Amount,
+	}
+	if req.ConfirmationToken != nil {
+		confirmation.ConfirmationToken = *req.ConfirmationToken
+	}
+	return confirmation
+}
+
+// redeemConfirmation has user-service check and consume the payer's
+// confirmation token, which is bound to either the recipient or the bulk
+// batch, and to the amount.
+func (s *PaymentServiceServer) redeemConfirmation(ctx context.Context, tracer oteltrace.Tracer, confirmation *userPb.RedeemPaymentConfirmationRequest) error {
+	ctx, confirmationSpan := tracer.Start(ctx, lib.EVENT_CONFIRMATION_REDEEM)
+	defer confirmationSpan.End()
+
+	confirmationSpan.SetAttributes(
+		attribute.Int64(lib.ATTR_CONFIRMATION_THRESHOLD, int64(s.config.ConfirmationThreshold)),
+	)
+
+	if confirmation.ConfirmationToken == "" {
+		confirmationSpan.AddEvent(lib.EVENT_CONFIRMATION_MISSING)
+		return lib.ErrConfirmationRequired
+	}
+
+	_, err := s.userServiceClient.RedeemPaymentConfirmation(ctx, confirmation)
+	if err != nil {
+		if status.Convert(err).Message() == lib.ErrConfirmationInvalid.Error() {
+			confirmationSpan.AddEvent(lib.EVENT_CONFIRMATION_REJECTED)
+			return lib.ErrConfirmationInvalid
+		}
+		confirmationSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	return nil
+}
+
+// releaseConfirmation hands a redeemed confirmation back when the payment
+// fails before any money has moved, so the payer can retry it. Failures are
+// only logged, since the caller is already returning an error of its own.
+func (s *PaymentServiceServer) releaseConfirmation(ctx context.Context, tracer oteltrace.Tracer, confirmation *userPb.RedeemPaymentConfirmationRequest) {
+	ctx, releaseSpan := tracer.Start(context.WithoutCancel(ctx), lib.EVENT_CONFIRMATION_RELEASE)
+	defer releaseSpan.End()
+
+	_, err := s.userServiceClient.ReleasePaymentConfirmation(ctx, confirmation)
+	if err != nil {
+		releaseSpan.RecordError(err)
+		slog.Error("Failed to release payment confirmation", "from", confirmation.FromUserId, "to", confirmation.ToUserId, "batch", confirmation.GetBulkBatchId(), "error", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+
+	"payment-service/src/lib"
+	"payment-service/src/repo"
+	pb "protobufs/gen/go/payment-service"
+
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// RevokeUserPayments winds down what could still move money for a deleted
+// user: active payment links are revoked, held escrows are refunded to the
+// payer, bulk batches awaiting confirmation are rejected and the round-up
+// rule is disabled. Each step only touches what is still live, so the call
+// can be repeated until it succeeds.
+func (s *PaymentServiceServer) RevokeUserPayments(ctx context.Context, req *pb.RevokeUserPaymentsRequest) (*pb.RevokeUserPaymentsResponse, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	ctx, revokeSpan := tracer.Start(ctx, lib.EVENT_USER_PAYMENTS_REVOKE)
+	defer revokeSpan.End()
+
+	revokeSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryRevokeUserPaymentLinks),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	linksRevoked, err := repo.RevokeUserPaymentLinks(ctx, s.db, req.UserId)
+	if err != nil {
+		revokeSpan.RecordError(err)
+		return nil, err
+	}
+
+	escrows, err := repo.GetUserHeldEscrows(ctx, s.db, req.UserId)
+	if err != nil {
+		revokeSpan.RecordError(err)
+		return nil, err
+	}
+
+	revokeSpan.SetAttributes(
+		attribute.Int(lib.ATTR_ESCROW_COUNT, len(escrows)),
+	)
+
+	escrowsRefunded := 0
+	for _, escrow := range escrows {
+		_, err := s.resolveEscrow(ctx, tracer, escrow, lib.ESCROW_STATUS_REFUNDED)
+		if err == lib.ErrEscrowNotHeld {
+			continue
+		}
+		if err != nil {
+			revokeSpan.RecordError(err)
+			return nil, err
+		}
+		escrowsRefunded++
+	}
+
+	batchesRejected, err := repo.RejectUserBulkPaymentBatches(ctx, s.db, req.UserId)
+	if err != nil {
+		revokeSpan.RecordError(err)
+		return nil, err
+	}
+
+	roundUpRulesDisabled, err := repo.DisableRoundUpRule(ctx, s.db, req.UserId)
+	if err != nil {
+		revokeSpan.RecordError(err)
+		return nil, err
+	}
+	revokeSpan.End()
+
+	return &pb.RevokeUserPaymentsResponse{
+		PaymentLinksRevoked:  uint32(linksRevoked),
+		EscrowsRefunded:      uint32(escrowsRefunded),
+		BulkPaymentsRejected: uint32(batchesRejected),
+		RoundUpRuleDisabled:  roundUpRulesDisabled > 0,
+	}, nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"fees"
+	"payment-service/src/lib"
+	"payment-service/src/repo"
+	"payment-service/src/risk"
+	pb "protobufs/gen/go/payment-service"
+	tbPb "protobufs/gen/go/tigerbeetle-service"
+
+	"github.com/jmoiron/sqlx"
+	tbt "github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+func (s *PaymentServiceServer) CreateEscrowPayment(ctx context.Context, req *pb.CreateEscrowPaymentRequest) (*pb.Escrow, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	amount := tbt.ToUint128(req.Amount).String()
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_TB_DEBIT_ACCOUNT_ID, req.ToUserId),
+		attribute.String(lib.ATTR_TB_CREDIT_ACCOUNT_ID, req.FromUserId),
+		attribute.String(lib.ATTR_TB_TRANSFER_AMOUNT, amount),
+	)
+
+	ctx, validateSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_VALIDATE)
+	defer validateSpan.End()
+
+	memo, err := lib.NormalizeMemo(req.Memo)
+	if err != nil {
+		validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "memo"),
+		))
+		return nil, err
+	}
+	deadlineDuration, deadlineAction, err := lib.ResolveEscrowDeadline(req.DeadlineHours, req.DeadlineAction)
+	if err != nil {
+		validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "deadline"),
+		))
+		return nil, err
+	}
+	if req.FromUserId == req.ToUserId {
+		validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "toUserId"),
+		))
+		return nil, lib.ErrUnacceptableRequest
+	}
+	validateSpan.End()
+
+	paymentReq := &pb.CreatePaymentRequest{
+		FromUserId:        req.FromUserId,
+		ToUserId:          req.ToUserId,
+		Amount:            req.Amount,
+		Memo:              req.Memo,
+		ConfirmationToken: req.ConfirmationToken,
+	}
+	auth, err := s.authorizePayment(ctx, tracer, paymentReq)
+	if err != nil {
+		return nil, err
+	}
+	defer auth.limitTx.Rollback()
+
+	// An escrow already keeps the funds pending, so there is no review
+	// queue for it. Payments the risk rules would hold have to go through
+	// CreatePayment instead.
+	if auth.screening.Verdict == risk.VerdictHold {
+		span.AddEvent(lib.EVENT_RISK_HELD)
+		s.releaseAuthorization(ctx, tracer, auth, paymentReq)
+		return nil, lib.ErrEscrowRequiresReview
+	}
+
+	transferId := tbt.ID().String()
+	transfers := []*tbPb.LinkedTransfer{
+		{
+			CreditAccountId: req.FromUserId,
+			DebitAccountId:  req.ToUserId,
+			Amount:          amount,
+			Kind:            tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_PENDING,
+			TransferId:      &transferId,
+		},
+	}
+	transferIds := []string{transferId}
+	if auth.fee > 0 {
+		feeTransferId := tbt.ID().String()
+		feeLeg := fees.Leg(req.FromUserId, auth.fee, tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_PENDING)
+		feeLeg.TransferId = &feeTransferId
+		transfers = append(transfers, feeLeg)
+		transferIds = append(transferIds, feeTransferId)
+	}
+
+	deadline := time.Now().Add(deadlineDuration)
+
+	err = s.recordPendingPayment(ctx, tracer, auth, paymentReq, func(tx *sqlx.Tx) error {
+		return s.recordEscrow(ctx, tracer, tx, req, memo, transferIds, auth.fee, deadline, deadlineAction)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.submitPayment(ctx, tracer, auth, paymentReq, lib.EVENT_TB_CREATE_PENDING_TRANSFER, transfers)
+	if err != nil {
+		return nil, err
+	}
+
+	escrow, err := repo.GetEscrow(ctx, s.db, transferId)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.DbEscrowToPbEscrow(escrow), nil
+}
+
+// recordEscrow writes the transfer, the escrow and its fee in the same
+// transaction, so the escrow is either fully recorded or not at all.
+func (s *PaymentServiceServer) recordEscrow(ctx context.Context, tracer oteltrace.Tracer, limitTx *sqlx.Tx, req *pb.CreateEscrowPaymentRequest, memo *string, transferIds []string, fee uint64, deadline time.Time, deadlineAction string) error {
+	transferId := transferIds[0]
+
+	err := s.insertTransfer(ctx, tracer, limitTx, lib.TRANSFER_STATUS_PENDING, transferId, req.FromUserId, req.ToUserId, req.Amount, memo, nil)
+	if err != nil {
+		return err
+	}
+
+	ctx, escrowSpan := tracer.Start(ctx, lib.EVENT_ESCROW_CREATE)
+	defer escrowSpan.End()
+
+	escrowSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryInsertEscrow),
+		attribute.String(lib.ATTR_ESCROW_ID, transferId),
+		attribute.String(lib.ATTR_ESCROW_DEADLINE, deadline.UTC().Format(time.RFC3339)),
+		attribute.String(lib.ATTR_ESCROW_DEADLINE_ACTION, deadlineAction),
+	)
+
+	err = repo.CreateEscrow(ctx, limitTx, transferId, deadline, deadlineAction)
+	if err != nil {
+		escrowSpan.RecordError(err)
+		return err
+	}
+	escrowSpan.End()
+
+	if fee > 0 {
+		err = s.recordFee(ctx, tracer, limitTx, transferIds[1], transferId, req.FromUserId, fee)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *PaymentServiceServer) getEscrow(ctx context.Context, tracer oteltrace.Tracer, escrowId string) (repo.Escrow, error) {
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_ESCROW_GET)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryGetEscrow),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{escrowId}),
+	)
+
+	escrow, err := repo.GetEscrow(ctx, s.db, escrowId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return escrow, err
+	}
+	if escrow.Status != lib.ESCROW_STATUS_HELD {
+		return escrow, lib.ErrEscrowNotHeld
+	}
+
+	return escrow, nil
+}
+
+// resolveEscrow posts or voids the pending transfer behind the escrow, and
+// its fee, before recording the new status, so a failed ledger call leaves
+// the escrow held. When the ledger reports the transfer as already posted or
+// voided, an earlier attempt got that far without recording it, and the row
+// is brought in line with the ledger.
+func (s *PaymentServiceServer) resolveEscrow(ctx context.Context, tracer oteltrace.Tracer, escrow repo.Escrow, resolution string) (*pb.Escrow, error) {
+	ctx, resolveSpan := tracer.Start(ctx, lib.EVENT_ESCROW_RESOLVE)
+	defer resolveSpan.End()
+
+	resolveSpan.SetAttributes(
+		attribute.String(lib.ATTR_ESCROW_ID, escrow.TigerbeetleTransferId),
+		attribute.String(lib.ATTR_ESCROW_STATUS, resolution),
+	)
+
+	kind := tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_POST_PENDING
+	if resolution == lib.ESCROW_STATUS_REFUNDED {
+		kind = tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_VOID_PENDING
+	}
+
+	transfers, err := s.pendingPaymentTransfers(ctx, tracer, escrow.TigerbeetleTransferId, escrow.FromUserId, escrow.ToUserId, escrow.Amount, kind)
+	if err != nil {
+		resolveSpan.RecordError(err)
+		return nil, err
+	}
+
+	ledgerResolution := resolution
+	_, err = s.tigerbeetleServiceClient.CreateLinkedTransfers(
+		ctx,
+		&tbPb.CreateLinkedTransfersRequest{
+			Transfers: transfers,
+		},
+	)
+	if err != nil {
+		switch status.Convert(err).Message() {
+		case lib.ErrPendingTransferAlreadyPosted.Error():
+			ledgerResolution = lib.ESCROW_STATUS_RELEASED
+		case lib.ErrPendingTransferAlreadyVoided.Error():
+			ledgerResolution = lib.ESCROW_STATUS_REFUNDED
+		default:
+			resolveSpan.RecordError(err)
+			return nil, err
+		}
+		resolveSpan.AddEvent(lib.EVENT_ESCROW_RECONCILE, oteltrace.WithAttributes(
+			attribute.String(lib.ATTR_ESCROW_STATUS, ledgerResolution),
+		))
+	}
+
+	resolveSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryResolveEscrow),
+	)
+
+	err = repo.ResolveEscrow(ctx, s.db, escrow.TigerbeetleTransferId, ledgerResolution)
+	if err != nil {
+		resolveSpan.RecordError(err)
+		return nil, err
+	}
+	if ledgerResolution != resolution {
+		return nil, lib.ErrEscrowNotHeld
+	}
+
+	resolved, err := repo.GetEscrow(ctx, s.db, escrow.TigerbeetleTransferId)
+	if err != nil {
+		resolveSpan.RecordError(err)
+		return nil, err
+	}
+	resolveSpan.End()
+
+	return repo.DbEscrowToPbEscrow(resolved), nil
+}
+
+func (s *PaymentServiceServer) ReleaseEscrow(ctx context.Context, req *pb.EscrowActionRequest) (*pb.Escrow, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_ESCROW_ID, req.EscrowId),
+	)
+
+	escrow, err := s.getEscrow(ctx, tracer, req.EscrowId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the payer can confirm delivery and release the funds.
+	if escrow.FromUserId != req.UserId {
+		if escrow.ToUserId != req.UserId {
+			return nil, lib.ErrNotFound
+		}
+		return nil, lib.ErrNotAllowed
+	}
+
+	amountUint128, err := tbt.HexStringToUint128(escrow.Amount)
+	if err != nil {
+		span.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	amountBig := amountUint128.BigInt()
+
+	// Releasing is what pays the recipient, so above the threshold it needs
+	// its own confirmation, just like a direct payment.
+	confirmationReq := paymentConfirmation(&pb.CreatePaymentRequest{
+		FromUserId:        escrow.FromUserId,
+		ToUserId:          escrow.ToUserId,
+		Amount:            amountBig.Uint64(),
+		ConfirmationToken: req.ConfirmationToken,
+	})
+	confirmed := s.requiresConfirmation(confirmationReq.Amount)
+	if confirmed {
+		err = s.redeemConfirmation(ctx, tracer, confirmationReq)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resolved, err := s.resolveEscrow(ctx, tracer, escrow, lib.ESCROW_STATUS_RELEASED)
+	if err != nil && confirmed {
+		s.releaseConfirmation(ctx, tracer, confirmationReq)
+	}
+	return resolved, err
+}
+
+func (s *PaymentServiceServer) RefundEscrow(ctx context.Context, req *pb.EscrowActionRequest) (*pb.Escrow, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_ESCROW_ID, req.EscrowId),
+	)
+
+	escrow, err := s.getEscrow(ctx, tracer, req.EscrowId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the payee can give the funds back before the deadline.
+	if escrow.ToUserId != req.UserId {
+		if escrow.FromUserId != req.UserId {
+			return nil, lib.ErrNotFound
+		}
+		return nil, lib.ErrNotAllowed
+	}
+
+	return s.resolveEscrow(ctx, tracer, escrow, lib.ESCROW_STATUS_REFUNDED)
+}
+
+func (s *PaymentServiceServer) sweepExpiredEscrows(ctx context.Context) {
+	tracer := otel.Tracer(lib.ServiceName)
+
+	ctx, sweepSpan := tracer.Start(ctx, lib.EVENT_ESCROW_SWEEP)
+	defer sweepSpan.End()
+
+	escrows, err := repo.GetExpiredEscrows(ctx, s.db, lib.EscrowWorkerBatchSize)
+	if err != nil {
+		sweepSpan.RecordError(err)
+		return
+	}
+
+	sweepSpan.SetAttributes(
+		attribute.Int(lib.ATTR_ESCROW_COUNT, len(escrows)),
+	)
+
+	for _, escrow := range escrows {
+		status := lib.ESCROW_STATUS_RELEASED
+		if escrow.DeadlineAction == lib.ESCROW_ACTION_REFUND {
+			status = lib.ESCROW_STATUS_REFUNDED
+		}
+
+		_, err := s.resolveEscrow(ctx, tracer, escrow, status)
+		if err != nil && err != lib.ErrEscrowNotHeld {
+			slog.Error("Failed to resolve expired escrow", "escrow", escrow.TigerbeetleTransferId, "error", err)
+		}
+	}
+}
+
+func (s *PaymentServiceServer) runEscrowWorker(ctx context.Context) {
+	ticker := time.NewTicker(lib.EscrowWorkerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweepExpiredEscrows(ctx)
+		}
+	}
+}
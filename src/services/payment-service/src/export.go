@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"payment-service/src/lib"
+	"payment-service/src/repo"
+	pb "protobufs/gen/go/payment-service"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// exportSection loads one section of the user's payment data and sends it as
+// indented JSON, the format of the other files in the export.
+func exportSection[T any](ctx context.Context, tracer oteltrace.Tracer, db *sqlx.DB, stream grpc.ServerStreamingServer[pb.ExportSection], userId, name, description, query string, load func(context.Context, *sqlx.DB, string) ([]T, error)) error {
+	ctx, sectionSpan := tracer.Start(ctx, lib.EVENT_EXPORT_SECTION)
+	defer sectionSpan.End()
+
+	sectionSpan.SetAttributes(
+		attribute.String(lib.ATTR_EXPORT_SECTION, name),
+		attribute.String(lib.ATTR_DB_QUERY, query),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{userId}),
+	)
+
+	rows, err := load(ctx, db, userId)
+	if err != nil {
+		sectionSpan.RecordError(err)
+		return err
+	}
+
+	sectionSpan.SetAttributes(
+		attribute.Int(lib.ATTR_EXPORT_RECORD_COUNT, len(rows)),
+	)
+
+	content, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		sectionSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	return stream.Send(&pb.ExportSection{
+		Name:        name,
+		Description: description,
+		Records:     uint32(len(rows)),
+		Content:     content,
+	})
+}
+
+// ExportUserPaymentData streams what payment-service holds on the user, one
+// section per message, for user-service to add to the user's data export.
+func (s *PaymentServiceServer) ExportUserPaymentData(req *pb.ExportUserPaymentDataRequest, stream grpc.ServerStreamingServer[pb.ExportSection]) error {
+	ctx := stream.Context()
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	sections := []func() error{
+		func() error {
+			return exportSection(ctx, tracer, s.db, stream, req.UserId, lib.EXPORT_FILE_PAYMENT_LINKS,
+				"Payment links, including used, revoked and expired ones", lib.QueryExportPaymentLinks, repo.ExportPaymentLinks)
+		},
+		func() error {
+			return exportSection(ctx, tracer, s.db, stream, req.UserId, lib.EXPORT_FILE_ESCROWS,
+				"Escrow payments sent or received", lib.QueryExportEscrows, repo.ExportEscrows)
+		},
+		func() error {
+			return exportSection(ctx, tracer, s.db, stream, req.UserId, lib.EXPORT_FILE_BULK_PAYMENTS,
+				"Bulk payment batches with their rows", lib.QueryExportBulkPaymentBatches, repo.ExportBulkPaymentBatches)
+		},
+		func() error {
+			return exportSection(ctx, tracer, s.db, stream, req.UserId, lib.EXPORT_FILE_ROUND_UP_RULES,
+				"Round-up rule for saving spare change", lib.QueryGetRoundUpRule, repo.ExportRoundUpRules)
+		},
+		func() error {
+			return exportSection(ctx, tracer, s.db, stream, req.UserId, lib.EXPORT_FILE_ROUND_UPS,
+				"Spare change moved into savings pots", lib.QueryExportRoundUps, repo.ExportRoundUps)
+		},
+		func() error {
+			return exportSection(ctx, tracer, s.db, stream, req.UserId, lib.EXPORT_FILE_PAYMENT_LIMITS,
+				"Limit tier and limits set for the account", lib.QueryExportPaymentLimits, repo.ExportPaymentLimits)
+		},
+		func() error {
+			return exportSection(ctx, tracer, s.db, stream, req.UserId, lib.EXPORT_FILE_PAYMENT_REVIEWS,
+				"Reviews of payments held for checks", lib.QueryExportPaymentReviews, repo.ExportPaymentReviews)
+		},
+	}
+
+	for _, section := range sections {
+		if err := section(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+
+	"fees"
+	"payment-service/src/lib"
+	"payment-service/src/repo"
+
+	"github.com/jmoiron/sqlx"
+
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// quoteFee prices a payment from the payer's tier in the fee schedule.
+func (s *PaymentServiceServer) quoteFee(ctx context.Context, tracer oteltrace.Tracer, userId string, amount uint64) (uint64, error) {
+	ctx, feeSpan := tracer.Start(ctx, lib.EVENT_FEE_QUOTE)
+	defer feeSpan.End()
+
+	limits, err := repo.GetPaymentLimits(ctx, s.db, userId)
+	if err != nil {
+		feeSpan.RecordError(err)
+		return 0, err
+	}
+
+	fee := s.feeSchedule.Rule(fees.FLOW_PAYMENT, limits.Tier).Fee(amount)
+
+	feeSpan.SetAttributes(
+		attribute.String(lib.ATTR_FEE_FLOW, fees.FLOW_PAYMENT),
+		attribute.String(lib.ATTR_FEE_TIER, limits.Tier),
+		attribute.Int64(lib.ATTR_FEE_AMOUNT, int64(fee)),
+	)
+	feeSpan.End()
+
+	return fee, nil
+}
+
+func (s *PaymentServiceServer) recordFee(ctx context.Context, tracer oteltrace.Tracer, db sqlx.ExecerContext, feeTransferId, transferId, userId string, amount uint64) error {
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_FEE_RECORD)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryInsertFee),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{feeTransferId, transferId, userId, fees.FLOW_PAYMENT}),
+	)
+
+	err := repo.CreateFee(ctx, db, feeTransferId, transferId, userId, fees.FLOW_PAYMENT, amount)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return err
+	}
+	dbSpan.End()
+
+	return nil
+}
+
+func (s *PaymentServiceServer) getFeeForTransfer(ctx context.Context, tracer oteltrace.Tracer, transferId string) (*repo.Fee, error) {
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_FEE_GET)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryGetFeeForTransfer),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferId}),
+	)
+
+	fee, err := repo.GetFeeForTransfer(ctx, s.db, transferId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	if fee != nil {
+		dbSpan.SetAttributes(
+			attribute.String(lib.ATTR_FEE_TRANSFER_ID, fee.TigerbeetleTransferId),
+		)
+	}
+	dbSpan.End()
+
+	return fee, nil
+}
@@ -3,17 +3,138 @@ package lib
 const ServiceName = "payment-service"
 
 const (
+	ATTR_USER_ID = "user.id"
+
 	ATTR_TB_TRANSFER_ID       = "tb.transfer.id"
 	ATTR_TB_TRANSFER_AMOUNT   = "tb.transfer.amount"
 	ATTR_TB_DEBIT_ACCOUNT_ID  = "tb.debit_account.id"
 	ATTR_TB_CREDIT_ACCOUNT_ID = "tb.credit_account.id"
 
+	ATTR_PAYMENT_HAS_MEMO     = "payment.has_memo"
+	ATTR_PAYMENT_REFERENCE    = "payment.reference"
+	ATTR_PAYMENT_SEARCH_LIMIT = "payment.search.limit"
+	ATTR_PAYMENT_COUNT        = "payment.count"
+
+	ATTR_LIMIT_TIER      = "limit.tier"
+	ATTR_LIMIT_NAME      = "limit.name"
+	ATTR_LIMIT_REMAINING = "limit.remaining"
+	ATTR_KYC_STATUS      = "kyc.status"
+
+	ATTR_CONFIRMATION_THRESHOLD = "confirmation.threshold"
+
+	ATTR_RISK_VERDICT         = "risk.verdict"
+	ATTR_RISK_TRIGGERED_RULES = "risk.triggered_rules"
+	ATTR_REVIEW_REVIEWER      = "review.reviewer"
+	ATTR_REVIEW_STATUS        = "review.status"
+	ATTR_REVIEW_COUNT         = "review.count"
+
+	ATTR_ESCROW_ID              = "escrow.id"
+	ATTR_ESCROW_STATUS          = "escrow.status"
+	ATTR_ESCROW_DEADLINE        = "escrow.deadline"
+	ATTR_ESCROW_DEADLINE_ACTION = "escrow.deadline_action"
+	ATTR_ESCROW_COUNT           = "escrow.count"
+
+	ATTR_BULK_BATCH_ID   = "bulk.batch.id"
+	ATTR_BULK_ROW_COUNT  = "bulk.row.count"
+	ATTR_BULK_VALID_ROWS = "bulk.row.valid"
+
+	ATTR_ROUND_UP_POT_ID      = "round_up.pot.id"
+	ATTR_ROUND_UP_AMOUNT      = "round_up.amount"
+	ATTR_ROUND_UP_TRANSFER_ID = "round_up.transfer.id"
+
+	ATTR_PAYMENT_LINK_ID         = "payment_link.id"
+	ATTR_PAYMENT_LINK_SINGLE_USE = "payment_link.single_use"
+
+	ATTR_FEE_FLOW        = "fee.flow"
+	ATTR_FEE_TIER        = "fee.tier"
+	ATTR_FEE_AMOUNT      = "fee.amount"
+	ATTR_FEE_TRANSFER_ID = "fee.transfer.id"
+
+	ATTR_EXPORT_SECTION      = "export.section"
+	ATTR_EXPORT_RECORD_COUNT = "export.record_count"
+
 	ATTR_DB_QUERY         = "db.query"
 	ATTR_DB_ARGS          = "db.args"
 	ATTR_DB_ROWS_AFFECTED = "db.rows_affected"
 )
 
 const (
-	EVENT_TB_CREATE_TRANSFER = "tb.transfer.create"
-	EVENT_DB_CREATE_TRANSFER = "db.transfer.create"
+	EVENT_TB_CREATE_TRANSFER         = "tb.transfer.create"
+	EVENT_TB_CREATE_LINKED_TRANSFERS = "tb.transfer.linked.create"
+	EVENT_TB_CREATE_PENDING_TRANSFER = "tb.transfer.pending.create"
+	EVENT_TB_POST_PENDING_TRANSFER   = "tb.transfer.pending.post"
+	EVENT_TB_VOID_PENDING_TRANSFER   = "tb.transfer.pending.void"
+	EVENT_TB_LOOKUP_FAILED_CHAIN     = "tb.transfer.linked.lookup"
+	EVENT_DB_CREATE_TRANSFER         = "db.transfer.create"
+	EVENT_DB_COMPLETE_TRANSFER       = "db.transfer.complete"
+	EVENT_DB_DISCARD_TRANSFER        = "db.transfer.discard"
+	EVENT_DB_COMMIT_PAYMENT          = "db.payment.commit"
+
+	EVENT_PAYMENT_VALIDATE  = "payment.validate"
+	EVENT_PAYMENT_SEARCH    = "payment.search"
+	EVENT_PAYMENT_PENDING   = "payment.pending"
+	EVENT_PAYMENT_SWEEP     = "payment.sweep"
+	EVENT_VALIDATION_FAILED = "validation.failed"
+
+	EVENT_LIMIT_CHECK    = "limit.check"
+	EVENT_LIMIT_GET      = "limit.get"
+	EVENT_LIMIT_SET      = "limit.set"
+	EVENT_LIMIT_EXCEEDED = "limit.exceeded"
+	EVENT_LIMIT_KYC_CAP  = "limit.kyc_cap"
+
+	EVENT_CONFIRMATION_REDEEM   = "confirmation.redeem"
+	EVENT_CONFIRMATION_MISSING  = "confirmation.missing"
+	EVENT_CONFIRMATION_REJECTED = "confirmation.rejected"
+	EVENT_CONFIRMATION_RELEASE  = "confirmation.release"
+
+	EVENT_BLOCK_CHECK   = "block.check"
+	EVENT_BLOCKED       = "block.blocked"
+	EVENT_RISK_EVALUATE = "risk.evaluate"
+	EVENT_RISK_BLOCKED  = "risk.blocked"
+	EVENT_RISK_HELD     = "risk.held"
+
+	EVENT_REVIEW_CREATE  = "review.create"
+	EVENT_REVIEW_LIST    = "review.list"
+	EVENT_REVIEW_CLAIM   = "review.claim"
+	EVENT_REVIEW_RELEASE = "review.release"
+	EVENT_REVIEW_UPDATE  = "review.update"
+	EVENT_REVIEW_SWEEP   = "review.sweep"
+
+	EVENT_ESCROW_CREATE    = "escrow.create"
+	EVENT_ESCROW_GET       = "escrow.get"
+	EVENT_ESCROW_RESOLVE   = "escrow.resolve"
+	EVENT_ESCROW_SWEEP     = "escrow.sweep"
+	EVENT_ESCROW_RECONCILE = "escrow.reconcile"
+
+	EVENT_BULK_PARSE             = "bulk.parse"
+	EVENT_BULK_RESOLVE_RECIPIENT = "bulk.recipient.resolve"
+	EVENT_BULK_CREATE            = "bulk.create"
+	EVENT_BULK_GET               = "bulk.get"
+	EVENT_BULK_CONFIRM           = "bulk.confirm"
+	EVENT_BULK_SWEEP             = "bulk.sweep"
+	EVENT_BULK_PREPARE           = "bulk.prepare"
+	EVENT_BULK_EXECUTE           = "bulk.execute"
+	EVENT_BULK_ROW_FAILED        = "bulk.row.failed"
+
+	EVENT_ROUND_UP_PREPARE     = "round_up.prepare"
+	EVENT_ROUND_UP_POT_MISSING = "round_up.pot_missing"
+	EVENT_ROUND_UP_RECORD      = "round_up.record"
+	EVENT_ROUND_UP_RULE_GET    = "round_up.rule.get"
+	EVENT_ROUND_UP_RULE_SET    = "round_up.rule.set"
+	EVENT_ROUND_UP_SUMMARY     = "round_up.summary"
+
+	EVENT_PAYMENT_LINK_VALIDATE = "payment_link.validate"
+	EVENT_PAYMENT_LINK_CREATE   = "payment_link.create"
+	EVENT_PAYMENT_LINK_REVOKE   = "payment_link.revoke"
+	EVENT_PAYMENT_LINK_VERIFY   = "payment_link.verify"
+	EVENT_PAYMENT_LINK_EXPIRED  = "payment_link.expired"
+	EVENT_PAYMENT_LINK_INACTIVE = "payment_link.inactive"
+
+	EVENT_FEE_QUOTE  = "fee.quote"
+	EVENT_FEE_RECORD = "fee.record"
+	EVENT_FEE_GET    = "fee.get"
+
+	EVENT_EXPORT_SECTION = "export.section"
+
+	EVENT_USER_PAYMENTS_REVOKE = "user_payments.revoke"
 )
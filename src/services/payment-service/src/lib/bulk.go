@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MaxBulkPaymentRows = 1000
+
+	BULK_BATCH_STATUS_AWAITING_CONFIRMATION = "awaiting_confirmation"
+	BULK_BATCH_STATUS_PROCESSING            = "processing"
+	BULK_BATCH_STATUS_COMPLETED             = "completed"
+	BULK_BATCH_STATUS_REJECTED              = "rejected"
+
+	BULK_ROW_STATUS_INVALID = "invalid"
+	BULK_ROW_STATUS_PENDING = "pending"
+	BULK_ROW_STATUS_POSTED  = "posted"
+	BULK_ROW_STATUS_FAILED  = "failed"
+
+	// BulkPaymentWorkerLease is how long a worker owns a batch it claimed.
+	// A batch whose worker died is picked up again once the lease runs out.
+	BulkPaymentWorkerInterval  = 5 * time.Second
+	BulkPaymentWorkerBatchSize = 10
+	BulkPaymentWorkerLease     = 5 * time.Minute
+)
+
+type BulkPaymentRow struct {
+	RowNumber uint32
+	Recipient string
+	Amount    uint64
+	Memo      *string
+	Error     error
+}
+
+// ParseAmount converts a decimal amount such as "12.50" into minor units.
+// Amounts are stored as signed 64-bit integers, so larger ones are refused.
+func ParseAmount(value string) (uint64, error) {
+	whole, fraction, hasFraction := strings.Cut(strings.TrimSpace(value), ".")
+	if len(whole) == 0 || (hasFraction && (len(fraction) == 0 || len(fraction) > 2)) {
+		return 0, ErrInvalidAmount
+	}
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+
+	units, err := strconv.ParseUint(whole+fraction, 10, 64)
+	if err != nil || units == 0 || units > math.MaxInt64 {
+		return 0, ErrInvalidAmount
+	}
+	return units, nil
+}
+
+// ParseBulkPaymentCsv reads rows of recipient, amount and an optional memo.
+// A header row is skipped when present. Row level problems are reported on
+// the row itself so the caller can show every error at once.
+func ParseBulkPaymentCsv(content []byte) ([]BulkPaymentRow, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	rows := []BulkPaymentRow{}
+	line := uint32(0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, ErrInvalidCsv
+			}
+			return nil, ErrUnexpected
+		}
+
+		if line == 1 && len(record) >= 2 && strings.EqualFold(strings.TrimSpace(record[1]), "amount") {
+			continue
+		}
+
+		rows = append(rows, parseBulkPaymentRecord(line, record))
+		if len(rows) > MaxBulkPaymentRows {
+			return nil, ErrTooManyRows
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, ErrInvalidCsv
+	}
+	return rows, nil
+}
+
+func parseBulkPaymentRecord(line uint32, record []string) BulkPaymentRow {
+	row := BulkPaymentRow{RowNumber: line}
+
+	if len(record) < 2 || len(record) > 3 {
+		row.Error = ErrInvalidCsv
+		return row
+	}
+
+	row.Recipient = strings.TrimSpace(record[0])
+	if len(row.Recipient) == 0 {
+		row.Error = ErrInvalidRecipient
+		return row
+	}
+
+	amount, err := ParseAmount(record[1])
+	if err != nil {
+		row.Error = err
+		return row
+	}
+	row.Amount = amount
+
+	if len(record) == 3 {
+		memo, err := NormalizeMemo(&record[2])
+		if err != nil {
+			row.Error = err
+			return row
+		}
+		row.Memo = memo
+	}
+
+	return row
+}
+
+func IsPhoneNumber(recipient string) bool {
+	return strings.HasPrefix(recipient, "+")
+}
@@ -3,13 +3,30 @@ package lib
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
+// Payments above this many minor units need a confirmation token unless
+// PAYMENT_SERVICE_CONFIRMATION_THRESHOLD says otherwise.
+const DefaultConfirmationThreshold = 500_00
+
+// Held payments that nobody reviews are rejected after this long unless
+// PAYMENT_SERVICE_HELD_PAYMENT_MAX_AGE_HOURS says otherwise.
+const DefaultHeldPaymentMaxAge = 7 * 24 * time.Hour
+
 type Configuration struct {
 	PaymentServicePort        string
 	TigerbeetleServiceUrl     string
+	UserServiceUrl            string
 	PaymentServiceDatabaseDsn string
 	OtelExporterOtlpEndpoint  string
+	RiskRulesPath             string
+	FeeSchedulePath           string
+	PaymentLinkSecret         string
+	PaymentLinkBaseUrl        string
+	ConfirmationThreshold     uint64
+	HeldPaymentMaxAge         time.Duration
 }
 
 func GetEnv(envName string) string {
@@ -21,10 +38,35 @@ func GetEnv(envName string) string {
 }
 
 func ParseConfiguration() *Configuration {
+	confirmationThreshold := uint64(DefaultConfirmationThreshold)
+	if value := os.Getenv("PAYMENT_SERVICE_CONFIRMATION_THRESHOLD"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid PAYMENT_SERVICE_CONFIRMATION_THRESHOLD: %s", value)
+		}
+		confirmationThreshold = parsed
+	}
+
+	heldPaymentMaxAge := DefaultHeldPaymentMaxAge
+	if value := os.Getenv("PAYMENT_SERVICE_HELD_PAYMENT_MAX_AGE_HOURS"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || parsed == 0 {
+			log.Fatalf("Invalid PAYMENT_SERVICE_HELD_PAYMENT_MAX_AGE_HOURS: %s", value)
+		}
+		heldPaymentMaxAge = time.Duration(parsed) * time.Hour
+	}
+
 	return &Configuration{
 		PaymentServicePort:        GetEnv("PAYMENT_SERVICE_PORT"),
 		TigerbeetleServiceUrl:     GetEnv("PAYMENT_SERVICE_TIGERBEETLE_SERVICE_URL"),
+		UserServiceUrl:            GetEnv("PAYMENT_SERVICE_USER_SERVICE_URL"),
 		PaymentServiceDatabaseDsn: GetEnv("PAYMENT_SERVICE_DATABASE_DSN"),
 		OtelExporterOtlpEndpoint:  GetEnv("PAYMENT_SERVICE_OTEL_EXPORTER_OTLP_ENDPOINT"),
+		RiskRulesPath:             GetEnv("PAYMENT_SERVICE_RISK_RULES_PATH"),
+		FeeSchedulePath:           GetEnv("PAYMENT_SERVICE_FEE_SCHEDULE_PATH"),
+		PaymentLinkSecret:         GetEnv("PAYMENT_SERVICE_PAYMENT_LINK_SECRET"),
+		PaymentLinkBaseUrl:        GetEnv("PAYMENT_SERVICE_PAYMENT_LINK_BASE_URL"),
+		ConfirmationThreshold:     confirmationThreshold,
+		HeldPaymentMaxAge:         heldPaymentMaxAge,
 	}
 }
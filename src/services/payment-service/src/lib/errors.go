@@ -0,0 +1,36 @@
+package lib
+
+import "errors"
+
+var (
+	ErrUnexpected            = errors.New("UNEXPECTED_ERROR")
+	ErrNotFound              = errors.New("NOT_FOUND")
+	ErrUnacceptableRequest   = errors.New("UNACCEPTABLE")
+	ErrInvalidReference      = errors.New("INVALID_REFERENCE")
+	ErrMemoTooLong           = errors.New("MEMO_TOO_LONG")
+	ErrUnknownLimitTier      = errors.New("UNKNOWN_LIMIT_TIER")
+	ErrPaymentBlocked        = errors.New("PAYMENT_BLOCKED")
+	ErrAlreadyReviewed       = errors.New("ALREADY_REVIEWED")
+	ErrInvalidEscrowDeadline = errors.New("INVALID_ESCROW_DEADLINE")
+	ErrEscrowNotHeld         = errors.New("ESCROW_NOT_HELD")
+	ErrEscrowRequiresReview  = errors.New("ESCROW_REQUIRES_REVIEW")
+	ErrPaymentRequiresReview = errors.New("PAYMENT_REQUIRES_REVIEW")
+	ErrPaymentPending        = errors.New("PAYMENT_PENDING")
+	ErrNotAllowed            = errors.New("NOT_ALLOWED")
+	ErrInvalidCsv            = errors.New("INVALID_CSV")
+	ErrTooManyRows           = errors.New("TOO_MANY_ROWS")
+	ErrInvalidAmount         = errors.New("INVALID_AMOUNT")
+	ErrInvalidRecipient      = errors.New("INVALID_RECIPIENT")
+	ErrRecipientNotFound     = errors.New("RECIPIENT_NOT_FOUND")
+	ErrInvalidPaymentLink    = errors.New("INVALID_PAYMENT_LINK")
+	ErrPaymentLinkExpired    = errors.New("PAYMENT_LINK_EXPIRED")
+	ErrPaymentLinkInactive   = errors.New("PAYMENT_LINK_INACTIVE")
+	ErrConfirmationRequired  = errors.New("PAYMENT_CONFIRMATION_REQUIRED")
+	ErrConfirmationInvalid   = errors.New("PAYMENT_CONFIRMATION_INVALID")
+
+	ErrPendingTransferAlreadyPosted = errors.New("PENDING_TRANSFER_ALREADY_POSTED")
+	ErrPendingTransferAlreadyVoided = errors.New("PENDING_TRANSFER_ALREADY_VOIDED")
+	ErrTransferExists               = errors.New("TRANSFER_EXISTS")
+	ErrNotEnoughFunds               = errors.New("NOT_ENOUGH_FUNDS")
+	ErrInvalidLedgerRequest         = errors.New("INVALID_REQUEST")
+)
@@ -0,0 +1,39 @@
+package lib
+
+import "time"
+
+const (
+	ESCROW_STATUS_HELD     = "held"
+	ESCROW_STATUS_RELEASED = "released"
+	ESCROW_STATUS_REFUNDED = "refunded"
+
+	ESCROW_ACTION_RELEASE = "release"
+	ESCROW_ACTION_REFUND  = "refund"
+
+	DefaultEscrowDeadline       = 14 * 24 * time.Hour
+	MaxEscrowDeadline           = 90 * 24 * time.Hour
+	DefaultEscrowDeadlineAction = ESCROW_ACTION_RELEASE
+
+	EscrowWorkerInterval  = time.Minute
+	EscrowWorkerBatchSize = 100
+)
+
+func ResolveEscrowDeadline(hours *uint32, action *string) (time.Duration, string, error) {
+	deadline := DefaultEscrowDeadline
+	if hours != nil {
+		deadline = time.Duration(*hours) * time.Hour
+	}
+	if deadline <= 0 || deadline > MaxEscrowDeadline {
+		return 0, "", ErrInvalidEscrowDeadline
+	}
+
+	deadlineAction := DefaultEscrowDeadlineAction
+	if action != nil {
+		deadlineAction = *action
+	}
+	if deadlineAction != ESCROW_ACTION_RELEASE && deadlineAction != ESCROW_ACTION_REFUND {
+		return 0, "", ErrInvalidEscrowDeadline
+	}
+
+	return deadline, deadlineAction, nil
+}
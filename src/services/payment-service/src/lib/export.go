@@ -0,0 +1,19 @@
+package lib
+
+import "fmt"
+
+const (
+	EXPORT_FILE_PAYMENT_LINKS   = "payment_links.json"
+	EXPORT_FILE_ESCROWS         = "escrows.json"
+	EXPORT_FILE_BULK_PAYMENTS   = "bulk_payments.json"
+	EXPORT_FILE_ROUND_UP_RULES  = "round_up_rules.json"
+	EXPORT_FILE_ROUND_UPS       = "round_ups.json"
+	EXPORT_FILE_PAYMENT_LIMITS  = "payment_limits.json"
+	EXPORT_FILE_PAYMENT_REVIEWS = "payment_reviews.json"
+)
+
+// FormatMinorUnits renders minor units as a decimal amount such as "12.50",
+// the way user-service writes amounts into data exports.
+func FormatMinorUnits(amount uint64) string {
+	return fmt.Sprintf("%d.%02d", amount/MinorUnitsPerUnit, amount%MinorUnitsPerUnit)
+}
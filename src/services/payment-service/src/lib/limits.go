@@ -0,0 +1,193 @@
+package lib
+
+import (
+	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultLimitTier = "standard"
+
+	DailyLimitWindow   = 24 * time.Hour
+	MonthlyLimitWindow = 30 * 24 * time.Hour
+
+	KYC_STATUS_VERIFIED = "verified"
+)
+
+const (
+	LIMIT_PER_TRANSACTION = "per_transaction"
+	LIMIT_DAILY_AMOUNT    = "daily_amount"
+	LIMIT_MONTHLY_AMOUNT  = "monthly_amount"
+	LIMIT_DAILY_COUNT     = "daily_count"
+	LIMIT_MONTHLY_COUNT   = "monthly_count"
+)
+
+type PaymentLimits struct {
+	Tier           string
+	PerTransaction uint64
+	DailyAmount    uint64
+	MonthlyAmount  uint64
+	DailyCount     uint64
+	MonthlyCount   uint64
+	KycCapped      bool
+}
+
+// Amounts are in minor currency units.
+var LimitTiers = map[string]PaymentLimits{
+	"basic": {
+		Tier:           "basic",
+		PerTransaction: 1_000_00,
+		DailyAmount:    2_000_00,
+		MonthlyAmount:  5_000_00,
+		DailyCount:     20,
+		MonthlyCount:   200,
+	},
+	"standard": {
+		Tier:           "standard",
+		PerTransaction: 5_000_00,
+		DailyAmount:    10_000_00,
+		MonthlyAmount:  50_000_00,
+		DailyCount:     50,
+		MonthlyCount:   500,
+	},
+	"premium": {
+		Tier:           "premium",
+		PerTransaction: 20_000_00,
+		DailyAmount:    50_000_00,
+		MonthlyAmount:  200_000_00,
+		DailyCount:     200,
+		MonthlyCount:   2000,
+	},
+}
+
+// UnverifiedPaymentLimits caps the limits of every tier until the user's
+// identity is verified.
+var UnverifiedPaymentLimits = PaymentLimits{
+	PerTransaction: 100_00,
+	DailyAmount:    250_00,
+	MonthlyAmount:  1_000_00,
+	DailyCount:     10,
+	MonthlyCount:   50,
+}
+
+// Cap lowers each limit to the one in caps, keeping the tier.
+func (limits PaymentLimits) Cap(caps PaymentLimits) PaymentLimits {
+	limits.PerTransaction = min(limits.PerTransaction, caps.PerTransaction)
+	limits.DailyAmount = min(limits.DailyAmount, caps.DailyAmount)
+	limits.MonthlyAmount = min(limits.MonthlyAmount, caps.MonthlyAmount)
+	limits.DailyCount = min(limits.DailyCount, caps.DailyCount)
+	limits.MonthlyCount = min(limits.MonthlyCount, caps.MonthlyCount)
+	return limits
+}
+
+type LimitOverrides struct {
+	Tier           *string
+	PerTransaction *uint64
+	DailyAmount    *uint64
+	MonthlyAmount  *uint64
+	DailyCount     *uint64
+	MonthlyCount   *uint64
+}
+
+func ResolvePaymentLimits(overrides LimitOverrides) (PaymentLimits, error) {
+	tier := DefaultLimitTier
+	if overrides.Tier != nil {
+		tier = *overrides.Tier
+	}
+
+	limits, ok := LimitTiers[tier]
+	if !ok {
+		return PaymentLimits{}, ErrUnknownLimitTier
+	}
+
+	if overrides.PerTransaction != nil {
+		limits.PerTransaction = *overrides.PerTransaction
+	}
+	if overrides.DailyAmount != nil {
+		limits.DailyAmount = *overrides.DailyAmount
+	}
+	if overrides.MonthlyAmount != nil {
+		limits.MonthlyAmount = *overrides.MonthlyAmount
+	}
+	if overrides.DailyCount != nil {
+		limits.DailyCount = *overrides.DailyCount
+	}
+	if overrides.MonthlyCount != nil {
+		limits.MonthlyCount = *overrides.MonthlyCount
+	}
+
+	return limits, nil
+}
+
+type LimitUsage struct {
+	DailyAmount   uint64
+	MonthlyAmount uint64
+	DailyCount    uint64
+	MonthlyCount  uint64
+}
+
+func Remaining(limit, used uint64) uint64 {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+// Check checks payments that go out together: each one against the per
+// transaction limit, their sum against the amount limits and their number
+// against the count limits.
+func (limits PaymentLimits) Check(usage LimitUsage, amounts ...uint64) error {
+	total := uint64(0)
+	for _, amount := range amounts {
+		if amount > limits.PerTransaction {
+			return &LimitExceededError{Limit: LIMIT_PER_TRANSACTION, Remaining: limits.PerTransaction}
+		}
+		total += amount
+	}
+	count := uint64(len(amounts))
+
+	if remaining := Remaining(limits.DailyAmount, usage.DailyAmount); total > remaining {
+		return &LimitExceededError{Limit: LIMIT_DAILY_AMOUNT, Remaining: remaining}
+	}
+	if remaining := Remaining(limits.MonthlyAmount, usage.MonthlyAmount); total > remaining {
+		return &LimitExceededError{Limit: LIMIT_MONTHLY_AMOUNT, Remaining: remaining}
+	}
+	if remaining := Remaining(limits.DailyCount, usage.DailyCount); count > remaining {
+		return &LimitExceededError{Limit: LIMIT_DAILY_COUNT, Remaining: remaining}
+	}
+	if remaining := Remaining(limits.MonthlyCount, usage.MonthlyCount); count > remaining {
+		return &LimitExceededError{Limit: LIMIT_MONTHLY_COUNT, Remaining: remaining}
+	}
+	return nil
+}
+
+// LimitExceededError carries the exhausted limit and the allowance left on it
+// to the caller as gRPC error details.
+type LimitExceededError struct {
+	Limit     string
+	Remaining uint64
+}
+
+func (e *LimitExceededError) Error() string {
+	return "LIMIT_EXCEEDED"
+}
+
+func (e *LimitExceededError) GRPCStatus() *status.Status {
+	st := status.New(codes.ResourceExhausted, e.Error())
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: e.Error(),
+		Domain: ServiceName,
+		Metadata: map[string]string{
+			"limit":     e.Limit,
+			"remaining": strconv.FormatUint(e.Remaining, 10),
+		},
+	})
+	if err != nil {
+		return st
+	}
+	return detailed
+}
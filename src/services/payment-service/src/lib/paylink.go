@@ -0,0 +1,81 @@
+package lib
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	PAYMENT_LINK_STATUS_ACTIVE  = "active"
+	PAYMENT_LINK_STATUS_USED    = "used"
+	PAYMENT_LINK_STATUS_REVOKED = "revoked"
+
+	MaxPaymentLinkLifetime = 365 * 24 * time.Hour
+)
+
+// PaymentLinkClaims is the signed content of a payment link token. Amount is
+// nil for open links where the payer chooses how much to send.
+type PaymentLinkClaims struct {
+	LinkId    string  `json:"lid"`
+	ToUserId  string  `json:"to"`
+	Amount    *uint64 `json:"amt,omitempty"`
+	Memo      *string `json:"memo,omitempty"`
+	SingleUse bool    `json:"su,omitempty"`
+	ExpiresAt *int64  `json:"exp,omitempty"`
+}
+
+func (claims PaymentLinkClaims) Expired(now time.Time) bool {
+	return claims.ExpiresAt != nil && now.Unix() >= *claims.ExpiresAt
+}
+
+// SignPaymentLink encodes the claims as base64url JSON followed by an
+// HMAC-SHA256 signature over the encoded part.
+func SignPaymentLink(secret []byte, claims PaymentLinkClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(paymentLinkSignature(secret, encoded)), nil
+}
+
+func VerifyPaymentLink(secret []byte, token string) (PaymentLinkClaims, error) {
+	claims := PaymentLinkClaims{}
+
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return claims, ErrInvalidPaymentLink
+	}
+	decodedSignature, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return claims, ErrInvalidPaymentLink
+	}
+	if !hmac.Equal(decodedSignature, paymentLinkSignature(secret, encoded)) {
+		return claims, ErrInvalidPaymentLink
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return claims, ErrInvalidPaymentLink
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, ErrInvalidPaymentLink
+	}
+
+	return claims, nil
+}
+
+func paymentLinkSignature(secret []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+func PaymentLinkUrl(baseUrl, token string) string {
+	return strings.TrimRight(baseUrl, "/") + "/" + token
+}
@@ -2,7 +2,464 @@ package lib
 
 var (
 	QueryInsertTransfer = `
-	insert into banking.transfers  (tigerbeetle_transfer_id, from_user_id, to_user_id, amount)
-	values ($1, $2, $3, $4)
+	insert into banking.transfers  (tigerbeetle_transfer_id, from_user_id, to_user_id, amount, memo, reference, status)
+	values ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	QueryCompleteTransfer = `
+	update banking.transfers
+	set status = 'done'
+	where tigerbeetle_transfer_id = $1 and status = 'pending'
+	`
+
+	QueryLockPendingTransfer = `
+	select tigerbeetle_transfer_id
+	from banking.transfers
+	where tigerbeetle_transfer_id = $1 and status = 'pending'
+	for update
+	`
+
+	// A discarded payment takes every record written alongside its transfer
+	// with it. Nothing else points at a transfer while it is pending.
+	QueryDeletePendingTransferFees = `
+	delete from banking.fees
+	where transfer_id = $1
+	`
+
+	QueryDeletePendingTransferRoundUps = `
+	delete from banking.round_ups
+	where payment_transfer_id = $1
+	`
+
+	QueryDeletePendingTransferReview = `
+	delete from banking.payment_reviews
+	where tigerbeetle_transfer_id = $1
+	`
+
+	QueryDeletePendingTransferEscrow = `
+	delete from banking.escrows
+	where tigerbeetle_transfer_id = $1
+	`
+
+	QueryDeletePendingTransfer = `
+	delete from banking.transfers
+	where tigerbeetle_transfer_id = $1 and status = 'pending'
+	`
+
+	QueryGetStalePendingTransfers = `
+	select tigerbeetle_transfer_id
+	from banking.transfers
+	where status = 'pending' and created_at <= now() - $1::interval
+	order by created_at asc
+	limit $2
+	`
+
+	// Payments still waiting for the ledger are left out until they are done.
+	QuerySearchPayments = `
+	select tigerbeetle_transfer_id, from_user_id, to_user_id, amount, memo, reference, created_at
+	from banking.transfers
+	where (from_user_id = $1 or to_user_id = $1)
+		and status = 'done'
+		and (strpos(lower(memo), lower($2)) > 0 or reference = $3)
+	order by created_at desc
+	limit $4
+	`
+
+	QueryGetPaymentLimitOverrides = `
+	select tier, per_transaction, daily_amount, monthly_amount, daily_count, monthly_count
+	from banking.payment_limits
+	where user_id = $1
+	`
+
+	QueryLockPaymentLimitOverrides = `
+	select tier, per_transaction, daily_amount, monthly_amount, daily_count, monthly_count
+	from banking.payment_limits
+	where user_id = $1
+	for update
+	`
+
+	QueryEnsurePaymentLimitsRow = `
+	insert into banking.payment_limits (user_id)
+	values ($1)
+	on conflict (user_id) do nothing
+	`
+
+	// Only the overrides given in the request change, the others are kept.
+	QueryUpsertPaymentLimitOverrides = `
+	insert into banking.payment_limits
+		(user_id, tier, per_transaction, daily_amount, monthly_amount, daily_count, monthly_count)
+	values ($1, $2, $3, $4, $5, $6, $7)
+	on conflict (user_id) do update
+		set tier = coalesce(excluded.tier, payment_limits.tier),
+			per_transaction = coalesce(excluded.per_transaction, payment_limits.per_transaction),
+			daily_amount = coalesce(excluded.daily_amount, payment_limits.daily_amount),
+			monthly_amount = coalesce(excluded.monthly_amount, payment_limits.monthly_amount),
+			daily_count = coalesce(excluded.daily_count, payment_limits.daily_count),
+			monthly_count = coalesce(excluded.monthly_count, payment_limits.monthly_count),
+			updated_at = now()
+	`
+
+	QueryGetRecentOutgoingPayments = `
+	select amount, created_at > now() - $3::interval as within_day
+	from banking.transfers
+	where from_user_id = $1
+		and created_at > now() - $2::interval
+		and not exists (
+			select 1 from banking.payment_reviews
+			where payment_reviews.tigerbeetle_transfer_id = transfers.tigerbeetle_transfer_id
+				and payment_reviews.status = 'rejected'
+		)
+		and not exists (
+			select 1 from banking.escrows
+			where escrows.tigerbeetle_transfer_id = transfers.tigerbeetle_transfer_id
+				and escrows.status = 'refunded'
+		)
+	`
+
+	QueryCountPaymentsToCounterparty = `
+	select count(*)
+	from banking.transfers
+	where from_user_id = $1 and to_user_id = $2
+		and not exists (
+			select 1 from banking.payment_reviews
+			where payment_reviews.tigerbeetle_transfer_id = transfers.tigerbeetle_transfer_id
+				and payment_reviews.status != 'approved'
+		)
+		and not exists (
+			select 1 from banking.escrows
+			where escrows.tigerbeetle_transfer_id = transfers.tigerbeetle_transfer_id
+				and escrows.status != 'released'
+		)
+	`
+
+	QueryCountRecentPayments = `
+	select count(*)
+	from banking.transfers
+	where from_user_id = $1
+		and created_at > now() - $2::interval
+		and not exists (
+			select 1 from banking.payment_reviews
+			where payment_reviews.tigerbeetle_transfer_id = transfers.tigerbeetle_transfer_id
+				and payment_reviews.status != 'approved'
+		)
+		and not exists (
+			select 1 from banking.escrows
+			where escrows.tigerbeetle_transfer_id = transfers.tigerbeetle_transfer_id
+				and escrows.status != 'released'
+		)
+	`
+
+	QueryInsertPaymentReview = `
+	insert into banking.payment_reviews (tigerbeetle_transfer_id, triggered_rules, status)
+	values ($1, $2, 'held')
+	`
+
+	QueryListHeldPayments = `
+	select payment_reviews.tigerbeetle_transfer_id, transfers.from_user_id, transfers.to_user_id, transfers.amount,
+		payment_reviews.triggered_rules, payment_reviews.status, payment_reviews.created_at,
+		payment_reviews.reviewed_at, payment_reviews.reviewer
+	from banking.payment_reviews
+	join banking.transfers on transfers.tigerbeetle_transfer_id = payment_reviews.tigerbeetle_transfer_id
+	where payment_reviews.status in ('held', 'approving', 'rejecting')
+		and transfers.status = 'done'
+	order by payment_reviews.created_at asc
+	limit $1
+	`
+
+	QueryGetHeldPayment = `
+	select payment_reviews.tigerbeetle_transfer_id, transfers.from_user_id, transfers.to_user_id, transfers.amount,
+		payment_reviews.triggered_rules, payment_reviews.status, payment_reviews.created_at,
+		payment_reviews.reviewed_at, payment_reviews.reviewer
+	from banking.payment_reviews
+	join banking.transfers on transfers.tigerbeetle_transfer_id = payment_reviews.tigerbeetle_transfer_id
+	where payment_reviews.tigerbeetle_transfer_id = $1
+		and transfers.status = 'done'
+	`
+
+	QueryClaimPaymentReview = `
+	with claimed as (
+		update banking.payment_reviews
+		set status = $2, reviewer = $3
+		where tigerbeetle_transfer_id = $1 and status in ('held', $2)
+		returning tigerbeetle_transfer_id, triggered_rules, status, created_at, reviewed_at, reviewer
+	)
+	select claimed.tigerbeetle_transfer_id, transfers.from_user_id, transfers.to_user_id, transfers.amount,
+		claimed.triggered_rules, claimed.status, claimed.created_at, claimed.reviewed_at, claimed.reviewer
+	from claimed
+	join banking.transfers on transfers.tigerbeetle_transfer_id = claimed.tigerbeetle_transfer_id
+	`
+
+	QueryReleasePaymentReview = `
+	update banking.payment_reviews
+	set status = 'held', reviewer = null
+	where tigerbeetle_transfer_id = $1 and status = $2
+	`
+
+	QueryUpdatePaymentReview = `
+	update banking.payment_reviews
+	set status = $3, reviewed_at = now()
+	where tigerbeetle_transfer_id = $1 and status = $2
+	`
+
+	// Reviews stuck in rejecting are picked up again, so an interrupted
+	// expiry is finished. Approving ones are left to their reviewer.
+	QueryGetExpiredHeldPayments = `
+	select payment_reviews.tigerbeetle_transfer_id, transfers.from_user_id, transfers.to_user_id, transfers.amount,
+		payment_reviews.triggered_rules, payment_reviews.status, payment_reviews.created_at,
+		payment_reviews.reviewed_at, payment_reviews.reviewer
+	from banking.payment_reviews
+	join banking.transfers on transfers.tigerbeetle_transfer_id = payment_reviews.tigerbeetle_transfer_id
+	where payment_reviews.status in ('held', 'rejecting')
+		and transfers.status = 'done'
+		and payment_reviews.created_at <= now() - $1::interval
+	order by payment_reviews.created_at asc
+	limit $2
+	`
+
+	QueryInsertEscrow = `
+	insert into banking.escrows (tigerbeetle_transfer_id, status, deadline, deadline_action)
+	values ($1, 'held', $2, $3)
+	`
+
+	QueryGetEscrow = `
+	select escrows.tigerbeetle_transfer_id, transfers.from_user_id, transfers.to_user_id, transfers.amount,
+		transfers.memo, escrows.status, escrows.deadline, escrows.deadline_action, escrows.created_at,
+		escrows.resolved_at, fees.amount as fee_amount
+	from banking.escrows
+	join banking.transfers on transfers.tigerbeetle_transfer_id = escrows.tigerbeetle_transfer_id
+	left join banking.fees on fees.transfer_id = escrows.tigerbeetle_transfer_id
+	where escrows.tigerbeetle_transfer_id = $1
+	`
+
+	QueryGetExpiredEscrows = `
+	select escrows.tigerbeetle_transfer_id, transfers.from_user_id, transfers.to_user_id, transfers.amount,
+		transfers.memo, escrows.status, escrows.deadline, escrows.deadline_action, escrows.created_at,
+		escrows.resolved_at, fees.amount as fee_amount
+	from banking.escrows
+	join banking.transfers on transfers.tigerbeetle_transfer_id = escrows.tigerbeetle_transfer_id
+	left join banking.fees on fees.transfer_id = escrows.tigerbeetle_transfer_id
+	where escrows.status = 'held' and escrows.deadline <= now()
+	order by escrows.deadline asc
+	limit $1
+	`
+
+	QueryResolveEscrow = `
+	update banking.escrows
+	set status = $2, resolved_at = now()
+	where tigerbeetle_transfer_id = $1 and status = 'held'
+	`
+
+	QueryInsertBulkPaymentBatch = `
+	insert into banking.bulk_payment_batches (batch_id, from_user_id, status)
+	values ($1, $2, $3)
+	`
+
+	QueryInsertBulkPaymentRow = `
+	insert into banking.bulk_payment_rows
+		(batch_id, row_number, recipient, to_user_id, amount, memo, status, error)
+	values ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	QueryGetBulkPaymentBatch = `
+	select batch_id, from_user_id, status, created_at, completed_at
+	from banking.bulk_payment_batches
+	where batch_id = $1 and from_user_id = $2
+	`
+
+	QueryGetBulkPaymentRows = `
+	select row_number, recipient, to_user_id, amount, memo, status, error, transfer_id,
+		fee_amount, fee_transfer_id
+	from banking.bulk_payment_rows
+	where batch_id = $1
+	order by row_number asc
+	`
+
+	QueryUpdateBulkPaymentRow = `
+	update banking.bulk_payment_rows
+	set status = $3, error = $4, transfer_id = $5, fee_amount = $6, fee_transfer_id = $7
+	where batch_id = $1 and row_number = $2
+	`
+
+	QueryPrepareBulkPaymentRow = `
+	update banking.bulk_payment_rows
+	set status = $3, error = $4, transfer_id = $5, fee_amount = $6, fee_transfer_id = $7
+	where batch_id = $1 and row_number = $2 and status = 'pending' and transfer_id is null
+	`
+
+	QueryUpdateBulkPaymentBatchStatus = `
+	update banking.bulk_payment_batches
+	set status = $3
+	where batch_id = $1 and status = $2
+	`
+
+	QueryGetClaimableBulkPaymentBatches = `
+	select batch_id, from_user_id, status, created_at, completed_at
+	from banking.bulk_payment_batches
+	where status = 'processing' and (locked_until is null or locked_until < now())
+	order by created_at asc
+	limit $1
+	`
+
+	QueryClaimBulkPaymentBatch = `
+	update banking.bulk_payment_batches
+	set locked_until = now() + $2::interval
+	where batch_id = $1 and status = 'processing' and (locked_until is null or locked_until < now())
+	`
+
+	QueryCompleteBulkPaymentBatch = `
+	update banking.bulk_payment_batches
+	set status = 'completed', completed_at = now(), locked_until = null
+	where batch_id = $1
+	`
+
+	QueryGetRoundUpRule = `
+	select user_id, pot_id, round_to, multiplier, enabled, updated_at
+	from banking.round_up_rules
+	where user_id = $1
+	`
+
+	QueryUpsertRoundUpRule = `
+	insert into banking.round_up_rules (user_id, pot_id, round_to, multiplier, enabled)
+	values ($1, $2, $3, $4, $5)
+	on conflict (user_id) do update
+		set pot_id = $2, round_to = $3, multiplier = $4, enabled = $5, updated_at = now()
+	returning user_id, pot_id, round_to, multiplier, enabled, updated_at
+	`
+
+	QueryInsertRoundUp = `
+	insert into banking.round_ups (tigerbeetle_transfer_id, payment_transfer_id, user_id, pot_id, amount)
+	values ($1, $2, $3, $4, $5)
+	`
+
+	QueryGetRoundUpSummary = `
+	select coalesce(sum(amount), 0) as total_saved, count(*) as round_up_count
+	from banking.round_ups
+	where user_id = $1 and created_at >= $2 and created_at < $3
+	`
+
+	QueryInsertFee = `
+	insert into banking.fees (tigerbeetle_transfer_id, transfer_id, user_id, flow, amount)
+	values ($1, $2, $3, $4, $5)
+	`
+
+	QueryGetFeeForTransfer = `
+	select tigerbeetle_transfer_id, transfer_id, user_id, flow, amount
+	from banking.fees
+	where transfer_id = $1
+	`
+
+	QueryInsertPaymentLink = `
+	insert into banking.payment_links (link_id, user_id, amount, memo, single_use, expires_at, status)
+	values ($1, $2, $3, $4, $5, $6, 'active')
+	returning link_id, user_id, amount, memo, single_use, expires_at, status, transfer_id, created_at
+	`
+
+	QueryGetPaymentLink = `
+	select link_id, user_id, amount, memo, single_use, expires_at, status, transfer_id, created_at
+	from banking.payment_links
+	where link_id = $1
+	`
+
+	QueryClaimPaymentLink = `
+	update banking.payment_links
+	set status = 'used', used_at = now()
+	where link_id = $1 and status = 'active'
+	`
+
+	QueryReleasePaymentLink = `
+	update banking.payment_links
+	set status = 'active', used_at = null
+	where link_id = $1 and status = 'used' and transfer_id is null
+	`
+
+	QuerySetPaymentLinkTransfer = `
+	update banking.payment_links
+	set transfer_id = $2
+	where link_id = $1
+	`
+
+	QueryRevokePaymentLink = `
+	update banking.payment_links
+	set status = 'revoked', revoked_at = now()
+	where link_id = $1 and user_id = $2 and status = 'active'
+	returning link_id, user_id, amount, memo, single_use, expires_at, status, transfer_id, created_at
+	`
+
+	QueryExportPaymentLinks = `
+	select link_id, amount, memo, single_use, expires_at, status, transfer_id, created_at, used_at, revoked_at
+	from banking.payment_links
+	where user_id = $1
+	order by created_at asc
+	`
+
+	QueryExportEscrows = `
+	select escrows.tigerbeetle_transfer_id, transfers.from_user_id, transfers.to_user_id, transfers.amount,
+		transfers.memo, escrows.status, escrows.deadline, escrows.deadline_action, escrows.created_at,
+		escrows.resolved_at, fees.amount as fee_amount
+	from banking.escrows
+	join banking.transfers on transfers.tigerbeetle_transfer_id = escrows.tigerbeetle_transfer_id
+	left join banking.fees on fees.transfer_id = escrows.tigerbeetle_transfer_id
+	where transfers.from_user_id = $1 or transfers.to_user_id = $1
+	order by escrows.created_at asc
+	`
+
+	QueryExportBulkPaymentBatches = `
+	select batch_id, from_user_id, status, created_at, completed_at
+	from banking.bulk_payment_batches
+	where from_user_id = $1
+	order by created_at asc
+	`
+
+	QueryExportRoundUps = `
+	select tigerbeetle_transfer_id, payment_transfer_id, pot_id, amount, created_at
+	from banking.round_ups
+	where user_id = $1
+	order by created_at asc
+	`
+
+	QueryExportPaymentLimits = `
+	select tier, per_transaction, daily_amount, monthly_amount, daily_count, monthly_count, updated_at
+	from banking.payment_limits
+	where user_id = $1
+	`
+
+	// Reviewers and the rules that triggered a hold are left out, since
+	// they describe the risk controls rather than the user.
+	QueryExportPaymentReviews = `
+	select payment_reviews.tigerbeetle_transfer_id, payment_reviews.status, payment_reviews.created_at,
+		payment_reviews.reviewed_at
+	from banking.payment_reviews
+	join banking.transfers on transfers.tigerbeetle_transfer_id = payment_reviews.tigerbeetle_transfer_id
+	where transfers.from_user_id = $1
+	order by payment_reviews.created_at asc
+	`
+
+	QueryRevokeUserPaymentLinks = `
+	update banking.payment_links
+	set status = 'revoked', revoked_at = now()
+	where user_id = $1 and status = 'active'
+	`
+
+	QueryGetUserHeldEscrows = `
+	select escrows.tigerbeetle_transfer_id, transfers.from_user_id, transfers.to_user_id, transfers.amount,
+		transfers.memo, escrows.status, escrows.deadline, escrows.deadline_action, escrows.created_at,
+		escrows.resolved_at, fees.amount as fee_amount
+	from banking.escrows
+	join banking.transfers on transfers.tigerbeetle_transfer_id = escrows.tigerbeetle_transfer_id
+	left join banking.fees on fees.transfer_id = escrows.tigerbeetle_transfer_id
+	where escrows.status = 'held' and (transfers.from_user_id = $1 or transfers.to_user_id = $1)
+	order by escrows.created_at asc
+	`
+
+	QueryRejectUserBulkPaymentBatches = `
+	update banking.bulk_payment_batches
+	set status = 'rejected'
+	where from_user_id = $1 and status = 'awaiting_confirmation'
+	`
+
+	QueryDisableRoundUpRule = `
+	update banking.round_up_rules
+	set enabled = false, updated_at = now()
+	where user_id = $1 and enabled
 	`
 )
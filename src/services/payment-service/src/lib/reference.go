@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxMemoLength matches the unstructured SEPA remittance information field.
+	MaxMemoLength = 140
+
+	maxCreditorReferenceLength = 25
+	minNationalReferenceLength = 4
+	maxNationalReferenceLength = 20
+)
+
+func NormalizeMemo(memo *string) (*string, error) {
+	if memo == nil {
+		return nil, nil
+	}
+
+	trimmed := strings.TrimSpace(*memo)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+	if utf8.RuneCountInString(trimmed) > MaxMemoLength {
+		return nil, ErrMemoTooLong
+	}
+
+	return &trimmed, nil
+}
+
+// NormalizeReference accepts ISO 11649 creditor references (RFxx...) and Finnish national
+// reference numbers.
+func NormalizeReference(reference *string) (*string, error) {
+	if reference == nil {
+		return nil, nil
+	}
+
+	normalized := strings.ToUpper(strings.Join(strings.Fields(*reference), ""))
+	if len(normalized) == 0 {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(normalized, "RF") {
+		if !isValidCreditorReference(normalized) {
+			return nil, ErrInvalidReference
+		}
+		return &normalized, nil
+	}
+
+	if !isValidNationalReference(normalized) {
+		return nil, ErrInvalidReference
+	}
+	return &normalized, nil
+}
+
+func isValidCreditorReference(reference string) bool {
+	if len(reference) < 5 || len(reference) > maxCreditorReferenceLength {
+		return false
+	}
+	if !isDigits(reference[2:4]) {
+		return false
+	}
+
+	rearranged := reference[4:] + reference[:4]
+
+	var numeric strings.Builder
+	for _, char := range rearranged {
+		switch {
+		case char >= '0' && char <= '9':
+			numeric.WriteRune(char)
+		case char >= 'A' && char <= 'Z':
+			numeric.WriteString(big.NewInt(int64(char-'A') + 10).String())
+		default:
+			return false
+		}
+	}
+
+	value, ok := new(big.Int).SetString(numeric.String(), 10)
+	if !ok {
+		return false
+	}
+	return new(big.Int).Mod(value, big.NewInt(97)).Int64() == 1
+}
+
+func isValidNationalReference(reference string) bool {
+	if len(reference) < minNationalReferenceLength || len(reference) > maxNationalReferenceLength {
+		return false
+	}
+	if !isDigits(reference) {
+		return false
+	}
+
+	weights := []int{7, 3, 1}
+	base := reference[:len(reference)-1]
+	sum := 0
+	for i := range len(base) {
+		digit := int(base[len(base)-1-i] - '0')
+		sum += digit * weights[i%len(weights)]
+	}
+	checkDigit := (10 - sum%10) % 10
+
+	return checkDigit == int(reference[len(reference)-1]-'0')
+}
+
+func isDigits(str string) bool {
+	for _, char := range str {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package lib
+
+import "time"
+
+const (
+	MinorUnitsPerUnit        = 100
+	DefaultRoundUpMultiplier = 1
+	MaxRoundUpMultiplier     = 10
+
+	RoundUpSummaryMonthLayout = "2006-01"
+)
+
+var RoundUpIncrements = []uint32{1, 5, 10}
+
+func ValidateRoundUpRule(roundTo uint32, multiplier uint32) error {
+	if multiplier == 0 || multiplier > MaxRoundUpMultiplier {
+		return ErrUnacceptableRequest
+	}
+	for _, increment := range RoundUpIncrements {
+		if roundTo == increment {
+			return nil
+		}
+	}
+	return ErrUnacceptableRequest
+}
+
+// RoundUpAmount returns the spare change needed to bring amount up to the next
+// multiple of roundTo whole units, scaled by multiplier. Payments that are
+// already a multiple are not rounded.
+func RoundUpAmount(amount uint64, roundTo uint32, multiplier uint32) uint64 {
+	increment := uint64(roundTo) * MinorUnitsPerUnit
+	remainder := amount % increment
+	if remainder == 0 {
+		return 0
+	}
+	return (increment - remainder) * uint64(multiplier)
+}
+
+func ParseRoundUpSummaryMonth(month *string, now time.Time) (time.Time, time.Time, error) {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if month != nil {
+		parsed, err := time.Parse(RoundUpSummaryMonthLayout, *month)
+		if err != nil {
+			return time.Time{}, time.Time{}, ErrUnacceptableRequest
+		}
+		start = parsed
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
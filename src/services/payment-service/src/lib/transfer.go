@@ -0,0 +1,15 @@
+package lib
+
+import "time"
+
+const (
+	TRANSFER_STATUS_PENDING = "pending"
+	TRANSFER_STATUS_DONE    = "done"
+
+	// Payments are recorded as pending before their chain is sent to the
+	// ledger. Ones still pending after PendingPaymentGracePeriod lost track
+	// of their outcome, and the worker settles them by looking them up.
+	PendingPaymentWorkerInterval  = time.Minute
+	PendingPaymentWorkerBatchSize = 100
+	PendingPaymentGracePeriod     = 5 * time.Minute
+)
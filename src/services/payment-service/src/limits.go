@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+
+	"payment-service/src/lib"
+	"payment-service/src/repo"
+	pb "protobufs/gen/go/payment-service"
+	userPb "protobufs/gen/go/user-service"
+
+	"github.com/jmoiron/sqlx"
+
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// kycVerified asks user-service whether the user is verified. Payments are
+// refused when the status cannot be read.
+func (s *PaymentServiceServer) kycVerified(ctx context.Context, tracer oteltrace.Tracer, userId string) (bool, error) {
+	ctx, kycSpan := tracer.Start(ctx, lib.EVENT_LIMIT_KYC_CAP)
+	defer kycSpan.End()
+
+	kyc, err := s.userServiceClient.GetKycStatus(ctx, &userPb.GetKycStatusRequest{UserId: userId})
+	if err != nil {
+		kycSpan.RecordError(err)
+		return false, lib.ErrUnexpected
+	}
+
+	kycSpan.SetAttributes(
+		attribute.String(lib.ATTR_KYC_STATUS, kyc.Status),
+	)
+
+	return kyc.Status == lib.KYC_STATUS_VERIFIED, nil
+}
+
+// capUnverifiedLimits applies UnverifiedPaymentLimits unless the user is
+// verified.
+func capUnverifiedLimits(limits lib.PaymentLimits, verified bool) lib.PaymentLimits {
+	if !verified {
+		limits = limits.Cap(lib.UnverifiedPaymentLimits)
+		limits.KycCapped = true
+	}
+	return limits
+}
+
+// checkPaymentLimits checks the payments against the payer's limits while
+// holding their limits row. The returned transaction keeps holding it, and
+// the caller records the transfers on it with insertTransfer, so concurrent
+// payments from the same user cannot exceed the limits together. The KYC
+// status is read before the row is locked, so no remote call happens while
+// the lock is held.
+func (s *PaymentServiceServer) checkPaymentLimits(ctx context.Context, tracer oteltrace.Tracer, userId string, amounts ...uint64) (*sqlx.Tx, error) {
+	verified, err := s.kycVerified(ctx, tracer, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, limitSpan := tracer.Start(ctx, lib.EVENT_LIMIT_CHECK)
+	defer limitSpan.End()
+
+	limitSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryLockPaymentLimitOverrides),
+	)
+
+	tx, limits, err := repo.LockPaymentLimits(ctx, s.db, userId)
+	if err != nil {
+		limitSpan.RecordError(err)
+		return nil, err
+	}
+	limits = capUnverifiedLimits(limits, verified)
+	usage, err := repo.GetLimitUsage(ctx, tx, userId)
+	if err != nil {
+		tx.Rollback()
+		limitSpan.RecordError(err)
+		return nil, err
+	}
+
+	limitSpan.SetAttributes(
+		attribute.String(lib.ATTR_LIMIT_TIER, limits.Tier),
+	)
+
+	err = limits.Check(usage, amounts...)
+	if err != nil {
+		tx.Rollback()
+		if limitErr, ok := err.(*lib.LimitExceededError); ok {
+			limitSpan.AddEvent(lib.EVENT_LIMIT_EXCEEDED, oteltrace.WithAttributes(
+				attribute.String(lib.ATTR_LIMIT_NAME, limitErr.Limit),
+				attribute.Int64(lib.ATTR_LIMIT_REMAINING, int64(limitErr.Remaining)),
+			))
+		}
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+func (s *PaymentServiceServer) GetPaymentLimits(ctx context.Context, req *pb.GetPaymentLimitsRequest) (*pb.PaymentLimits, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_LIMIT_GET)
+	defer dbSpan.End()
+
+	limits, err := repo.GetPaymentLimits(ctx, s.db, req.UserId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	verified, err := s.kycVerified(ctx, tracer, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	limits = capUnverifiedLimits(limits, verified)
+	usage, err := repo.GetLimitUsage(ctx, s.db, req.UserId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_LIMIT_TIER, limits.Tier),
+	)
+	dbSpan.End()
+
+	return repo.PaymentLimitsToPb(limits, usage), nil
+}
+
+func (s *PaymentServiceServer) SetUserPaymentLimits(ctx context.Context, req *pb.SetUserPaymentLimitsRequest) (*pb.PaymentLimits, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	overrides := lib.LimitOverrides{
+		Tier:           req.Tier,
+		PerTransaction: req.PerTransaction,
+		DailyAmount:    req.DailyAmount,
+		MonthlyAmount:  req.MonthlyAmount,
+		DailyCount:     req.DailyCount,
+		MonthlyCount:   req.MonthlyCount,
+	}
+
+	_, err := lib.ResolvePaymentLimits(overrides)
+	if err != nil {
+		span.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "tier"),
+		))
+		return nil, err
+	}
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_LIMIT_SET)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryUpsertPaymentLimitOverrides),
+	)
+
+	err = repo.SetPaymentLimitOverrides(ctx, s.db, req.UserId, overrides)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+
+	limits, err := repo.GetPaymentLimits(ctx, s.db, req.UserId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_LIMIT_TIER, limits.Tier),
+	)
+
+	usage, err := repo.GetLimitUsage(ctx, s.db, req.UserId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	dbSpan.End()
+
+	verified, err := s.kycVerified(ctx, tracer, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	limits = capUnverifiedLimits(limits, verified)
+
+	return repo.PaymentLimitsToPb(limits, usage), nil
+}
@@ -2,15 +2,16 @@ package main
 
 import (
 	"context"
+	"fees"
 	"fmt"
 	"log"
 	"log/slog"
 	"net"
 	"payment-service/src/lib"
+	"payment-service/src/risk"
 	pb "protobufs/gen/go/payment-service"
 	tbPb "protobufs/gen/go/tigerbeetle-service"
-
-	tbt "github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+	userPb "protobufs/gen/go/user-service"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
@@ -19,13 +20,11 @@ import (
 
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
-	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 type PaymentServiceServer struct {
@@ -35,6 +34,10 @@ type PaymentServiceServer struct {
 	config                       *lib.Configuration
 	tigerbeetleServiceClient     tbPb.TigerbeetleServiceClient
 	tigerbeetleServiceConnection *grpc.ClientConn
+	userServiceClient            userPb.UserServiceClient
+	userServiceConnection        *grpc.ClientConn
+	riskEngine                   *risk.Engine
+	feeSchedule                  fees.FeeSchedule
 }
 
 func initTracer(config *lib.Configuration) func() {
@@ -71,66 +74,6 @@ func initTracer(config *lib.Configuration) func() {
 	}
 }
 
-func (s *PaymentServiceServer) CreatePayment(ctx context.Context, req *pb.CreatePaymentRequest) (*pb.CreatePaymentResponse, error) {
-	span := oteltrace.SpanFromContext(ctx)
-	tracer := span.TracerProvider().Tracer(lib.ServiceName)
-
-	amount := tbt.ToUint128(req.Amount).String()
-
-	span.SetAttributes(
-		attribute.String(lib.ATTR_TB_DEBIT_ACCOUNT_ID, req.ToUserId),
-		attribute.String(lib.ATTR_TB_CREDIT_ACCOUNT_ID, req.FromUserId),
-		attribute.String(lib.ATTR_TB_TRANSFER_AMOUNT, amount),
-	)
-
-	ctx, createTransferSpan := tracer.Start(ctx, lib.EVENT_TB_CREATE_TRANSFER)
-	defer createTransferSpan.End()
-
-	transferResp, err := s.tigerbeetleServiceClient.CreateTransfer(
-		ctx,
-		&tbPb.CreateTransferRequest{
-			CreditAccountId: req.FromUserId,
-			DebitAccountId:  req.ToUserId,
-			Amount:          amount,
-		},
-	)
-	if err != nil {
-		createTransferSpan.RecordError(err)
-		return nil, err
-	}
-
-	createTransferSpan.SetAttributes(
-		attribute.String(lib.ATTR_TB_TRANSFER_ID, transferResp.TransferId),
-	)
-	createTransferSpan.End()
-
-	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_DB_CREATE_TRANSFER)
-	defer dbSpan.End()
-
-	dbSpan.SetAttributes(
-		attribute.String(lib.ATTR_DB_QUERY, lib.QueryInsertTransfer),
-		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferResp.TransferId, req.FromUserId, req.ToUserId, amount}),
-	)
-
-	result, err := s.db.ExecContext(ctx, lib.QueryInsertTransfer, transferResp.TransferId, req.FromUserId, req.ToUserId, amount)
-	if err != nil {
-		dbSpan.RecordError(err)
-		return nil, err
-	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		dbSpan.RecordError(err)
-		return nil, err
-	}
-
-	dbSpan.SetAttributes(
-		attribute.Int64(lib.ATTR_DB_ROWS_AFFECTED, rowsAffected),
-	)
-	dbSpan.End()
-
-	return &pb.CreatePaymentResponse{}, nil
-}
-
 func newServer(config *lib.Configuration) *PaymentServiceServer {
 	db, err := sqlx.Connect("postgres", config.PaymentServiceDatabaseDsn)
 	if err != nil {
@@ -150,11 +93,32 @@ func newServer(config *lib.Configuration) *PaymentServiceServer {
 	tigerbeetleClient := tbPb.NewTigerbeetleServiceClient(conn)
 	log.Println("Connected to tiger beetle service.")
 
+	userConn, err := grpc.NewClient(config.UserServiceUrl, opts...)
+	if err != nil {
+		log.Fatalf("Failed to connect to the user service: %v", err)
+	}
+	userClient := userPb.NewUserServiceClient(userConn)
+	log.Println("Connected to user service.")
+
+	riskEngine, err := risk.LoadEngine(config.RiskRulesPath)
+	if err != nil {
+		log.Fatalf("Failed to load risk rules: %v", err)
+	}
+
+	feeSchedule, err := fees.LoadFeeSchedule(config.FeeSchedulePath)
+	if err != nil {
+		log.Fatalf("Failed to load fee schedule: %v", err)
+	}
+
 	s := &PaymentServiceServer{
 		db:                           db,
 		config:                       config,
 		tigerbeetleServiceClient:     tigerbeetleClient,
 		tigerbeetleServiceConnection: conn,
+		userServiceClient:            userClient,
+		userServiceConnection:        userConn,
+		riskEngine:                   riskEngine,
+		feeSchedule:                  feeSchedule,
 	}
 
 	return s
@@ -179,6 +143,14 @@ func main() {
 	server := newServer(config)
 	defer server.db.Close()
 	defer server.tigerbeetleServiceConnection.Close()
+	defer server.userServiceConnection.Close()
+
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	go server.runEscrowWorker(workerCtx)
+	go server.runBulkPaymentWorker(workerCtx)
+	go server.runHeldPaymentWorker(workerCtx)
+	go server.runPendingPaymentWorker(workerCtx)
 
 	pb.RegisterPaymentServiceServer(grpcServer, server)
 	slog.Info("Service ready to accept connections", "service", lib.ServiceName, "port", config.PaymentServicePort)
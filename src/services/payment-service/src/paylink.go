@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"payment-service/src/lib"
+	"payment-service/src/repo"
+	pb "protobufs/gen/go/payment-service"
+	userPb "protobufs/gen/go/user-service"
+
+	"github.com/google/uuid"
+	tbt "github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+	"google.golang.org/grpc/status"
+
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// renderPaymentLink signs the link and attaches its token, URL and QR
+// payload. The token is derived from the stored link, so it can be rendered
+// again later without being stored. The QR code encodes the signed URL, which
+// any phone camera opens. An EPC bank transfer payload would need incoming
+// transfers to be matched back to the link first.
+func (s *PaymentServiceServer) renderPaymentLink(link repo.PaymentLink) (*pb.PaymentLink, error) {
+	token, err := lib.SignPaymentLink([]byte(s.config.PaymentLinkSecret), link.Claims())
+	if err != nil {
+		slog.Error("Failed to sign payment link", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	url := lib.PaymentLinkUrl(s.config.PaymentLinkBaseUrl, token)
+
+	pbLink := repo.DbPaymentLinkToPbPaymentLink(link)
+
+	pbLink.Token = &token
+	pbLink.Url = &url
+	pbLink.QrPayload = &url
+	return pbLink, nil
+}
+
+func (s *PaymentServiceServer) CreatePaymentLink(ctx context.Context, req *pb.CreatePaymentLinkRequest) (*pb.PaymentLink, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.Bool(lib.ATTR_PAYMENT_LINK_SINGLE_USE, req.SingleUse),
+	)
+
+	ctx, validateSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_LINK_VALIDATE)
+	defer validateSpan.End()
+
+	memo, err := lib.NormalizeMemo(req.Memo)
+	if err != nil {
+		validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "memo"),
+		))
+		return nil, err
+	}
+	if req.Amount != nil && *req.Amount == 0 {
+		validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "amount"),
+		))
+		return nil, lib.ErrInvalidAmount
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInHours != nil {
+		lifetime := time.Duration(*req.ExpiresInHours) * time.Hour
+		if lifetime <= 0 || lifetime > lib.MaxPaymentLinkLifetime {
+			validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+				attribute.String("field", "expiresInHours"),
+			))
+			return nil, lib.ErrUnacceptableRequest
+		}
+		// Expiry is signed with second precision.
+		expiry := time.Now().Add(lifetime).Truncate(time.Second)
+		expiresAt = &expiry
+	}
+	validateSpan.End()
+
+	_, err = s.userServiceClient.GetUserById(ctx, &userPb.GetUserByIdRequest{
+		UserId: req.UserId,
+	})
+	if err != nil {
+		span.RecordError(err)
+		if status.Convert(err).Message() == lib.ErrNotFound.Error() {
+			return nil, lib.ErrNotFound
+		}
+		return nil, lib.ErrUnexpected
+	}
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_LINK_CREATE)
+	defer dbSpan.End()
+
+	linkId := uuid.NewString()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryInsertPaymentLink),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{linkId, req.UserId}),
+		attribute.String(lib.ATTR_PAYMENT_LINK_ID, linkId),
+	)
+
+	link, err := repo.CreatePaymentLink(ctx, s.db, linkId, req.UserId, req.Amount, memo, req.SingleUse, expiresAt)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	dbSpan.End()
+
+	return s.renderPaymentLink(link)
+}
+
+func (s *PaymentServiceServer) RevokePaymentLink(ctx context.Context, req *pb.RevokePaymentLinkRequest) (*pb.PaymentLink, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_PAYMENT_LINK_ID, req.LinkId),
+	)
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_LINK_REVOKE)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryRevokePaymentLink),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.LinkId, req.UserId}),
+	)
+
+	link, err := repo.RevokePaymentLink(ctx, s.db, req.LinkId, req.UserId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	dbSpan.End()
+
+	return repo.DbPaymentLinkToPbPaymentLink(link), nil
+}
+
+// PayLink pays the recipient embedded in a signed payment link. Open links
+// take the amount from the payer, fixed links only accept their own amount.
+func (s *PaymentServiceServer) PayLink(ctx context.Context, req *pb.PayLinkRequest) (*pb.CreatePaymentResponse, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.FromUserId),
+	)
+
+	ctx, verifySpan := tracer.Start(ctx, lib.EVENT_PAYMENT_LINK_VERIFY)
+	defer verifySpan.End()
+
+	claims, err := lib.VerifyPaymentLink([]byte(s.config.PaymentLinkSecret), req.Token)
+	if err != nil {
+		verifySpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "token"),
+		))
+		return nil, err
+	}
+
+	verifySpan.SetAttributes(
+		attribute.String(lib.ATTR_PAYMENT_LINK_ID, claims.LinkId),
+	)
+
+	if claims.Expired(time.Now()) {
+		verifySpan.AddEvent(lib.EVENT_PAYMENT_LINK_EXPIRED)
+		return nil, lib.ErrPaymentLinkExpired
+	}
+
+	link, err := repo.GetPaymentLink(ctx, s.db, claims.LinkId)
+	if err != nil {
+		verifySpan.RecordError(err)
+		if err == lib.ErrNotFound {
+			return nil, lib.ErrInvalidPaymentLink
+		}
+		return nil, err
+	}
+	if link.UserId != claims.ToUserId {
+		verifySpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "token"),
+		))
+		return nil, lib.ErrInvalidPaymentLink
+	}
+	if link.Status != lib.PAYMENT_LINK_STATUS_ACTIVE {
+		verifySpan.AddEvent(lib.EVENT_PAYMENT_LINK_INACTIVE)
+		return nil, lib.ErrPaymentLinkInactive
+	}
+
+	amount := claims.Amount
+	if amount == nil {
+		amount = req.Amount
+	}
+	if amount == nil || *amount == 0 || (req.Amount != nil && *req.Amount != *amount) {
+		verifySpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "amount"),
+		))
+		return nil, lib.ErrInvalidAmount
+	}
+	if req.FromUserId == claims.ToUserId {
+		verifySpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "fromUserId"),
+		))
+		return nil, lib.ErrUnacceptableRequest
+	}
+	verifySpan.End()
+
+	if claims.SingleUse {
+		err = repo.ClaimPaymentLink(ctx, s.db, claims.LinkId)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+	}
+
+	transferId := tbt.ID().String()
+	resp, err := s.createPayment(ctx, &pb.CreatePaymentRequest{
+		FromUserId:        req.FromUserId,
+		ToUserId:          claims.ToUserId,
+		Amount:            *amount,
+		Memo:              claims.Memo,
+		Reference:         req.Reference,
+		ConfirmationToken: req.ConfirmationToken,
+	}, transferId)
+	if err != nil {
+		if claims.SingleUse && s.nothingPosted(ctx, tracer, transferId) {
+			if releaseErr := repo.ReleasePaymentLink(ctx, s.db, claims.LinkId); releaseErr != nil {
+				span.RecordError(releaseErr)
+			}
+		}
+		return nil, err
+	}
+
+	if claims.SingleUse {
+		err = repo.SetPaymentLinkTransfer(ctx, s.db, claims.LinkId, resp.TransferId)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// nothingPosted tells whether the ledger has no transfer with transferId,
+// so a single-use link whose payment failed can be used again. When the
+// lookup fails the link stays used, since the payment may have moved money.
+func (s *PaymentServiceServer) nothingPosted(ctx context.Context, tracer oteltrace.Tracer, transferId string) bool {
+	ctx, lookupSpan := tracer.Start(context.WithoutCancel(ctx), lib.EVENT_TB_LOOKUP_FAILED_CHAIN)
+	defer lookupSpan.End()
+
+	lookupSpan.SetAttributes(
+		attribute.String(lib.ATTR_TB_TRANSFER_ID, transferId),
+	)
+
+	exists, err := s.transferExists(ctx, transferId)
+	if err != nil {
+		lookupSpan.RecordError(err)
+		return false
+	}
+	return !exists
+}
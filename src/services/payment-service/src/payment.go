@@ -0,0 +1,525 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"fees"
+	"payment-service/src/lib"
+	"payment-service/src/repo"
+	"payment-service/src/risk"
+	pb "protobufs/gen/go/payment-service"
+	tbPb "protobufs/gen/go/tigerbeetle-service"
+
+	"github.com/jmoiron/sqlx"
+	tbt "github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+
+	paymentStatusPosted = "posted"
+	paymentStatusHeld   = "held"
+)
+
+func (s *PaymentServiceServer) CreatePayment(ctx context.Context, req *pb.CreatePaymentRequest) (*pb.CreatePaymentResponse, error) {
+	return s.createPayment(ctx, req, tbt.ID().String())
+}
+
+// createPayment pays with transferId as the payment's ledger id, so a caller
+// that chose it can look the payment up when it fails.
+func (s *PaymentServiceServer) createPayment(ctx context.Context, req *pb.CreatePaymentRequest, transferId string) (*pb.CreatePaymentResponse, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	amount := tbt.ToUint128(req.Amount).String()
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_TB_DEBIT_ACCOUNT_ID, req.ToUserId),
+		attribute.String(lib.ATTR_TB_CREDIT_ACCOUNT_ID, req.FromUserId),
+		attribute.String(lib.ATTR_TB_TRANSFER_AMOUNT, amount),
+	)
+
+	ctx, validateSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_VALIDATE)
+	defer validateSpan.End()
+
+	memo, err := lib.NormalizeMemo(req.Memo)
+	if err != nil {
+		validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "memo"),
+		))
+		return nil, err
+	}
+	reference, err := lib.NormalizeReference(req.Reference)
+	if err != nil {
+		validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "reference"),
+		))
+		return nil, err
+	}
+
+	validateSpan.SetAttributes(
+		attribute.Bool(lib.ATTR_PAYMENT_HAS_MEMO, memo != nil),
+	)
+	if reference != nil {
+		validateSpan.SetAttributes(
+			attribute.String(lib.ATTR_PAYMENT_REFERENCE, *reference),
+		)
+	}
+	validateSpan.End()
+
+	// The round-up reads the pot from user-service, so it is prepared before
+	// authorizePayment locks the payer's limits. Held payments ignore it.
+	roundUpRule, roundUpAmount, err := s.prepareRoundUp(ctx, tracer, req.FromUserId, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := s.authorizePayment(ctx, tracer, req)
+	if err != nil {
+		return nil, err
+	}
+	defer auth.limitTx.Rollback()
+
+	if auth.screening.Verdict == risk.VerdictHold {
+		return s.holdPayment(ctx, tracer, auth, req, transferId, memo, reference)
+	}
+
+	return s.postPayment(ctx, tracer, auth, req, transferId, memo, reference, roundUpRule, roundUpAmount)
+}
+
+// paymentAuthorization is what a payment that passed authorizePayment may
+// go ahead with. limitTx holds the payer's limits until the payment's
+// pending records are committed with recordPendingPayment.
+type paymentAuthorization struct {
+	limitTx   *sqlx.Tx
+	screening risk.Result
+	fee       uint64
+	confirmed bool
+}
+
+// authorizePayment runs every check that has to pass before money leaves
+// the payer's account: step-up confirmation, blocks, risk rules, the fee
+// quote and limits. Every way of paying someone goes through it, so none of
+// them can be used to skip a check. The limits are checked last, so the lock
+// on the payer's limits is only taken once every remote call is done.
+func (s *PaymentServiceServer) authorizePayment(ctx context.Context, tracer oteltrace.Tracer, req *pb.CreatePaymentRequest) (paymentAuthorization, error) {
+	if s.requiresConfirmation(req.Amount) && req.ConfirmationToken == nil {
+		return paymentAuthorization{}, lib.ErrConfirmationRequired
+	}
+
+	err := s.checkNotBlocked(ctx, tracer, req.FromUserId, req.ToUserId)
+	if err != nil {
+		return paymentAuthorization{}, err
+	}
+
+	screening, err := s.screenPayment(ctx, tracer, req)
+	if err != nil {
+		return paymentAuthorization{}, err
+	}
+
+	fee, err := s.quoteFee(ctx, tracer, req.FromUserId, req.Amount)
+	if err != nil {
+		return paymentAuthorization{}, err
+	}
+
+	auth := paymentAuthorization{
+		screening: screening,
+		fee:       fee,
+		confirmed: s.requiresConfirmation(req.Amount),
+	}
+
+	// Redeemed after the checks above so a payment they reject does not use
+	// up the confirmation. One the limits reject gets it back.
+	if auth.confirmed {
+		err = s.redeemConfirmation(ctx, tracer, paymentConfirmation(req))
+		if err != nil {
+			return paymentAuthorization{}, err
+		}
+	}
+
+	auth.limitTx, err = s.checkPaymentLimits(ctx, tracer, req.FromUserId, req.Amount)
+	if err != nil {
+		s.releaseAuthorization(ctx, tracer, auth, req)
+		return paymentAuthorization{}, err
+	}
+
+	return auth, nil
+}
+
+// releaseAuthorization gives back the confirmation authorizePayment redeemed.
+// Callers only use it while no money has moved for the payment.
+func (s *PaymentServiceServer) releaseAuthorization(ctx context.Context, tracer oteltrace.Tracer, auth paymentAuthorization, req *pb.CreatePaymentRequest) {
+	if auth.confirmed {
+		s.releaseConfirmation(ctx, tracer, paymentConfirmation(req))
+	}
+}
+
+// recordPendingPayment writes the payment's records with record and commits
+// them as pending before anything is sent to the ledger. The commit also
+// releases the lock on the payer's limits, and the pending transfer keeps
+// counting towards them. If the records cannot be committed nothing has
+// moved, so the authorization is given back.
+func (s *PaymentServiceServer) recordPendingPayment(ctx context.Context, tracer oteltrace.Tracer, auth paymentAuthorization, req *pb.CreatePaymentRequest, record func(tx *sqlx.Tx) error) error {
+	err := record(auth.limitTx)
+	if err == nil {
+		err = s.commitPayment(ctx, tracer, auth.limitTx)
+	}
+	if err != nil {
+		s.releaseAuthorization(ctx, tracer, auth, req)
+		return err
+	}
+	return nil
+}
+
+// submitPayment sends the chain of a payment recorded by
+// recordPendingPayment and marks its records done. The first leg carries the
+// payment's transfer id. When the ledger rejected the chain, the records are
+// discarded and the authorization is given back. When its outcome cannot be
+// told, the records stay pending for the pending payment worker to reconcile,
+// and lib.ErrPaymentPending is returned so the payment is not simply retried.
+func (s *PaymentServiceServer) submitPayment(ctx context.Context, tracer oteltrace.Tracer, auth paymentAuthorization, req *pb.CreatePaymentRequest, event string, transfers []*tbPb.LinkedTransfer, attributes ...attribute.KeyValue) error {
+	transferId := *transfers[0].TransferId
+
+	ctx, ledgerSpan := tracer.Start(ctx, event)
+	defer ledgerSpan.End()
+
+	ledgerSpan.SetAttributes(
+		attribute.String(lib.ATTR_TB_TRANSFER_ID, transferId),
+	)
+	ledgerSpan.SetAttributes(attributes...)
+
+	_, err := s.tigerbeetleServiceClient.CreateLinkedTransfers(
+		ctx,
+		&tbPb.CreateLinkedTransfersRequest{
+			Transfers: transfers,
+		},
+	)
+	if err != nil {
+		ledgerSpan.RecordError(err)
+		applied, rejected := s.checkFailedChain(ctx, tracer, transferId, err)
+		if rejected {
+			s.discardPayment(ctx, tracer, transferId)
+			s.releaseAuthorization(ctx, tracer, auth, req)
+			return err
+		}
+		if !applied {
+			ledgerSpan.AddEvent(lib.EVENT_PAYMENT_PENDING)
+			return lib.ErrPaymentPending
+		}
+	}
+	ledgerSpan.End()
+
+	s.completePayment(ctx, tracer, transferId)
+	return nil
+}
+
+// completePayment marks the records of a payment the ledger applied as done.
+// Failures are only logged, since the money has moved either way and the
+// pending payment worker finishes the records later.
+func (s *PaymentServiceServer) completePayment(ctx context.Context, tracer oteltrace.Tracer, transferId string) {
+	ctx, dbSpan := tracer.Start(context.WithoutCancel(ctx), lib.EVENT_DB_COMPLETE_TRANSFER)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryCompleteTransfer),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferId}),
+	)
+
+	err := repo.CompleteTransfer(ctx, s.db, transferId)
+	if err != nil {
+		dbSpan.RecordError(err)
+	}
+}
+
+// discardPayment deletes the pending records of a payment the ledger does
+// not have. Failures are only logged, since the pending payment worker
+// discards the records later.
+func (s *PaymentServiceServer) discardPayment(ctx context.Context, tracer oteltrace.Tracer, transferId string) {
+	ctx, dbSpan := tracer.Start(context.WithoutCancel(ctx), lib.EVENT_DB_DISCARD_TRANSFER)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryDeletePendingTransfer),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferId}),
+	)
+
+	err := repo.DiscardPendingTransfer(ctx, s.db, transferId)
+	if err != nil {
+		dbSpan.RecordError(err)
+	}
+}
+
+// checkFailedChain tells whether a chain that CreateLinkedTransfers failed on
+// is on the ledger anyway. Only the ledger's own rejections say for certain
+// that it is not. A timeout, a transport error or an unexpected error can
+// come after the chain was applied, so then its first transfer is looked up
+// by the id the caller chose for it. When the lookup fails too, neither
+// applied nor rejected is set.
+func (s *PaymentServiceServer) checkFailedChain(ctx context.Context, tracer oteltrace.Tracer, transferId string, chainErr error) (applied bool, rejected bool) {
+	switch status.Convert(chainErr).Message() {
+	case lib.ErrNotEnoughFunds.Error(), lib.ErrInvalidLedgerRequest.Error():
+		return false, true
+	case lib.ErrTransferExists.Error():
+		return true, false
+	}
+
+	ctx, lookupSpan := tracer.Start(context.WithoutCancel(ctx), lib.EVENT_TB_LOOKUP_FAILED_CHAIN)
+	defer lookupSpan.End()
+
+	lookupSpan.SetAttributes(
+		attribute.String(lib.ATTR_TB_TRANSFER_ID, transferId),
+	)
+
+	exists, err := s.transferExists(ctx, transferId)
+	if err != nil {
+		lookupSpan.RecordError(err)
+		return false, false
+	}
+	return exists, !exists
+}
+
+// postPayment moves the payment, the spare change into the savings pot and
+// the fee into the revenue account as one linked chain, so no leg can land
+// without the others. The ledger ids are chosen up front, and every record is
+// committed as pending before the chain is sent, so a payment that moved
+// money always has a record to reconcile against.
+func (s *PaymentServiceServer) postPayment(ctx context.Context, tracer oteltrace.Tracer, auth paymentAuthorization, req *pb.CreatePaymentRequest, transferId string, memo, reference *string, roundUpRule *repo.RoundUpRule, roundUpAmount uint64) (*pb.CreatePaymentResponse, error) {
+	transfers := []*tbPb.LinkedTransfer{
+		{
+			CreditAccountId: req.FromUserId,
+			DebitAccountId:  req.ToUserId,
+			Amount:          tbt.ToUint128(req.Amount).String(),
+			TransferId:      &transferId,
+		},
+	}
+	resp := &pb.CreatePaymentResponse{
+		TransferId: transferId,
+		Status:     paymentStatusPosted,
+	}
+
+	if roundUpRule != nil {
+		roundUpTransferId := tbt.ID().String()
+		transfers = append(transfers, &tbPb.LinkedTransfer{
+			CreditAccountId: req.FromUserId,
+			DebitAccountId:  roundUpRule.PotId,
+			Amount:          tbt.ToUint128(roundUpAmount).String(),
+			TransferId:      &roundUpTransferId,
+		})
+		resp.RoundUpAmount = &roundUpAmount
+		resp.RoundUpTransferId = &roundUpTransferId
+	}
+
+	fee := auth.fee
+	if fee > 0 {
+		feeTransferId := tbt.ID().String()
+		feeLeg := fees.Leg(req.FromUserId, fee, tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_POSTED)
+		feeLeg.TransferId = &feeTransferId
+		transfers = append(transfers, feeLeg)
+		resp.FeeAmount = &fee
+		resp.FeeTransferId = &feeTransferId
+	}
+
+	err := s.recordPendingPayment(ctx, tracer, auth, req, func(tx *sqlx.Tx) error {
+		return s.recordPayment(ctx, tracer, tx, req, memo, reference, roundUpRule, resp)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.submitPayment(ctx, tracer, auth, req, lib.EVENT_TB_CREATE_LINKED_TRANSFERS, transfers,
+		attribute.String(lib.ATTR_ROUND_UP_TRANSFER_ID, resp.GetRoundUpTransferId()),
+		attribute.String(lib.ATTR_FEE_TRANSFER_ID, resp.GetFeeTransferId()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// recordPayment writes the transfer, its round-up and its fee on the
+// transaction from checkPaymentLimits, using the ledger ids in resp.
+func (s *PaymentServiceServer) recordPayment(ctx context.Context, tracer oteltrace.Tracer, limitTx *sqlx.Tx, req *pb.CreatePaymentRequest, memo, reference *string, roundUpRule *repo.RoundUpRule, resp *pb.CreatePaymentResponse) error {
+	err := s.insertTransfer(ctx, tracer, limitTx, lib.TRANSFER_STATUS_PENDING, resp.TransferId, req.FromUserId, req.ToUserId, req.Amount, memo, reference)
+	if err != nil {
+		return err
+	}
+
+	if roundUpRule != nil {
+		err = s.recordRoundUp(ctx, tracer, limitTx, *resp.RoundUpTransferId, resp.TransferId, req.FromUserId, roundUpRule.PotId, *resp.RoundUpAmount)
+		if err != nil {
+			return err
+		}
+	}
+
+	if resp.FeeAmount != nil {
+		err = s.recordFee(ctx, tracer, limitTx, *resp.FeeTransferId, resp.TransferId, req.FromUserId, *resp.FeeAmount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertTransfer records the transfer on the given transaction. Payments
+// record it as pending before the ledger is called, and the caller commits
+// it with the rest of the payment's records.
+func (s *PaymentServiceServer) insertTransfer(ctx context.Context, tracer oteltrace.Tracer, tx *sqlx.Tx, transferStatus, transferId, fromUserId, toUserId string, amount uint64, memo, reference *string) error {
+	amountHex := tbt.ToUint128(amount).String()
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_DB_CREATE_TRANSFER)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryInsertTransfer),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferId, fromUserId, toUserId, amountHex, transferStatus}),
+	)
+
+	result, err := tx.ExecContext(ctx, lib.QueryInsertTransfer, transferId, fromUserId, toUserId, amountHex, memo, reference, transferStatus)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		dbSpan.RecordError(err)
+		return err
+	}
+
+	dbSpan.SetAttributes(
+		attribute.Int64(lib.ATTR_DB_ROWS_AFFECTED, rowsAffected),
+	)
+	dbSpan.End()
+
+	return nil
+}
+
+// commitPayment commits every record written for the payment at once and
+// releases the lock checkPaymentLimits took on the payer's limits.
+func (s *PaymentServiceServer) commitPayment(ctx context.Context, tracer oteltrace.Tracer, limitTx *sqlx.Tx) error {
+	_, commitSpan := tracer.Start(ctx, lib.EVENT_DB_COMMIT_PAYMENT)
+	defer commitSpan.End()
+
+	err := limitTx.Commit()
+	if err != nil {
+		commitSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	return nil
+}
+
+func (s *PaymentServiceServer) SearchPayments(ctx context.Context, req *pb.SearchPaymentsRequest) (*pb.SearchPaymentsResponse, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	query := strings.TrimSpace(req.Query)
+	if len(query) == 0 {
+		span.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "query"),
+		))
+		return nil, lib.ErrUnacceptableRequest
+	}
+
+	limit := uint32(defaultSearchLimit)
+	if req.Limit != nil {
+		limit = min(*req.Limit, maxSearchLimit)
+	}
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.Int64(lib.ATTR_PAYMENT_SEARCH_LIMIT, int64(limit)),
+	)
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_SEARCH)
+	defer dbSpan.End()
+
+	referenceQuery := strings.ToUpper(strings.Join(strings.Fields(query), ""))
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QuerySearchPayments),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId, "***", referenceQuery}),
+	)
+
+	payments := []repo.Payment{}
+	err := s.db.SelectContext(ctx, &payments, lib.QuerySearchPayments, req.UserId, query, referenceQuery, limit)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+
+	dbSpan.SetAttributes(
+		attribute.Int(lib.ATTR_PAYMENT_COUNT, len(payments)),
+	)
+	dbSpan.End()
+
+	pbPayments := make([]*pb.Payment, len(payments))
+	for i, payment := range payments {
+		pbPayments[i] = repo.DbPaymentToPbPayment(payment)
+	}
+
+	return &pb.SearchPaymentsResponse{
+		Payments: pbPayments,
+	}, nil
+}
+
+// runPendingPaymentWorker settles payments that stayed pending because the
+// outcome of their chain could not be told, by looking their transfer up on
+// the ledger.
+func (s *PaymentServiceServer) runPendingPaymentWorker(ctx context.Context) {
+	ticker := time.NewTicker(lib.PendingPaymentWorkerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweepPendingPayments(ctx)
+		}
+	}
+}
+
+func (s *PaymentServiceServer) sweepPendingPayments(ctx context.Context) {
+	tracer := otel.Tracer(lib.ServiceName)
+
+	ctx, sweepSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_SWEEP)
+	defer sweepSpan.End()
+
+	sweepSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryGetStalePendingTransfers),
+	)
+
+	transferIds, err := repo.GetStalePendingTransfers(ctx, s.db, lib.PendingPaymentGracePeriod, lib.PendingPaymentWorkerBatchSize)
+	if err != nil {
+		sweepSpan.RecordError(err)
+		return
+	}
+
+	sweepSpan.SetAttributes(
+		attribute.Int(lib.ATTR_PAYMENT_COUNT, len(transferIds)),
+	)
+
+	for _, transferId := range transferIds {
+		exists, err := s.transferExists(ctx, transferId)
+		if err != nil {
+			slog.Error("Failed to look up pending payment", "transfer", transferId, "error", err)
+			continue
+		}
+		if exists {
+			s.completePayment(ctx, tracer, transferId)
+		} else {
+			s.discardPayment(ctx, tracer, transferId)
+		}
+	}
+}
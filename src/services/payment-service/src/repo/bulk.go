@@ -0,0 +1,266 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"payment-service/src/lib"
+	pb "protobufs/gen/go/payment-service"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type BulkPaymentBatch struct {
+	BatchId     string     `db:"batch_id"`
+	FromUserId  string     `db:"from_user_id"`
+	Status      string     `db:"status"`
+	CreatedAt   time.Time  `db:"created_at"`
+	CompletedAt *time.Time `db:"completed_at"`
+}
+
+// BulkPaymentRow carries the ledger ids and fee for its transfer once the
+// batch has been prepared, so a batch that is picked up again after a
+// restart submits exactly the same transfers.
+type BulkPaymentRow struct {
+	RowNumber     int64   `db:"row_number"`
+	Recipient     string  `db:"recipient"`
+	ToUserId      *string `db:"to_user_id"`
+	Amount        int64   `db:"amount"`
+	Memo          *string `db:"memo"`
+	Status        string  `db:"status"`
+	Error         *string `db:"error"`
+	TransferId    *string `db:"transfer_id"`
+	FeeAmount     *int64  `db:"fee_amount"`
+	FeeTransferId *string `db:"fee_transfer_id"`
+}
+
+func CreateBulkPaymentBatch(ctx context.Context, db *sqlx.DB, batch BulkPaymentBatch, rows []BulkPaymentRow) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin bulk payment transaction", "error", err)
+		return lib.ErrUnexpected
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, lib.QueryInsertBulkPaymentBatch, batch.BatchId, batch.FromUserId, batch.Status)
+	if err != nil {
+		slog.Error("Failed to create bulk payment batch", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	for _, row := range rows {
+		_, err = tx.ExecContext(
+			ctx,
+			lib.QueryInsertBulkPaymentRow,
+			batch.BatchId,
+			row.RowNumber,
+			row.Recipient,
+			row.ToUserId,
+			row.Amount,
+			row.Memo,
+			row.Status,
+			row.Error,
+		)
+		if err != nil {
+			slog.Error("Failed to create bulk payment row", "error", err)
+			return lib.ErrUnexpected
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.Error("Failed to commit bulk payment batch", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+func GetBulkPaymentBatch(ctx context.Context, db *sqlx.DB, batchId, userId string) (BulkPaymentBatch, []BulkPaymentRow, error) {
+	batch := BulkPaymentBatch{}
+	err := db.GetContext(ctx, &batch, lib.QueryGetBulkPaymentBatch, batchId, userId)
+	if err == sql.ErrNoRows {
+		return batch, nil, lib.ErrNotFound
+	}
+	if err != nil {
+		slog.Error("Failed to get bulk payment batch", "error", err)
+		return batch, nil, lib.ErrUnexpected
+	}
+
+	rows, err := GetBulkPaymentRows(ctx, db, batchId)
+	if err != nil {
+		return batch, nil, err
+	}
+
+	return batch, rows, nil
+}
+
+func GetBulkPaymentRows(ctx context.Context, db *sqlx.DB, batchId string) ([]BulkPaymentRow, error) {
+	rows := []BulkPaymentRow{}
+	err := db.SelectContext(ctx, &rows, lib.QueryGetBulkPaymentRows, batchId)
+	if err != nil {
+		slog.Error("Failed to get bulk payment rows", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return rows, nil
+}
+
+func UpdateBulkPaymentRow(ctx context.Context, db sqlx.ExecerContext, batchId string, row BulkPaymentRow) error {
+	_, err := db.ExecContext(ctx, lib.QueryUpdateBulkPaymentRow, batchId, row.RowNumber, row.Status, row.Error, row.TransferId, row.FeeAmount, row.FeeTransferId)
+	if err != nil {
+		slog.Error("Failed to update bulk payment row", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+// PrepareBulkPaymentRows stores the outcome of the checks and the ledger ids
+// for the rows in one transaction. Rows that were already prepared keep what
+// they have, so callers re-read the rows afterwards.
+func PrepareBulkPaymentRows(ctx context.Context, db *sqlx.DB, batchId string, rows []BulkPaymentRow) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin bulk payment transaction", "error", err)
+		return lib.ErrUnexpected
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		_, err = tx.ExecContext(ctx, lib.QueryPrepareBulkPaymentRow, batchId, row.RowNumber, row.Status, row.Error, row.TransferId, row.FeeAmount, row.FeeTransferId)
+		if err != nil {
+			slog.Error("Failed to prepare bulk payment row", "error", err)
+			return lib.ErrUnexpected
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.Error("Failed to commit bulk payment rows", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+// UpdateBulkPaymentBatchStatus moves the batch from one status to another.
+// It fails with lib.ErrNotFound when the batch is not in the expected status.
+func UpdateBulkPaymentBatchStatus(ctx context.Context, db *sqlx.DB, batchId, from, to string) error {
+	result, err := db.ExecContext(ctx, lib.QueryUpdateBulkPaymentBatchStatus, batchId, from, to)
+	if err != nil {
+		slog.Error("Failed to update bulk payment batch", "error", err)
+		return lib.ErrUnexpected
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to update bulk payment batch", "error", err)
+		return lib.ErrUnexpected
+	}
+	if rowsAffected == 0 {
+		return lib.ErrNotFound
+	}
+	return nil
+}
+
+// RejectUserBulkPaymentBatches rejects the batches still awaiting the user's
+// confirmation. Batches already processing are left to the worker.
+func RejectUserBulkPaymentBatches(ctx context.Context, db *sqlx.DB, userId string) (int64, error) {
+	result, err := db.ExecContext(ctx, lib.QueryRejectUserBulkPaymentBatches, userId)
+	if err != nil {
+		slog.Error("Failed to reject user bulk payment batches", "error", err)
+		return 0, lib.ErrUnexpected
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to reject user bulk payment batches", "error", err)
+		return 0, lib.ErrUnexpected
+	}
+	return rowsAffected, nil
+}
+
+func GetClaimableBulkPaymentBatches(ctx context.Context, db *sqlx.DB, limit int) ([]BulkPaymentBatch, error) {
+	batches := []BulkPaymentBatch{}
+	err := db.SelectContext(ctx, &batches, lib.QueryGetClaimableBulkPaymentBatches, limit)
+	if err != nil {
+		slog.Error("Failed to get claimable bulk payment batches", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return batches, nil
+}
+
+// ClaimBulkPaymentBatch leases the batch to the calling worker. It reports
+// false when another worker holds an unexpired lease on it.
+func ClaimBulkPaymentBatch(ctx context.Context, db *sqlx.DB, batchId string, lease time.Duration) (bool, error) {
+	result, err := db.ExecContext(ctx, lib.QueryClaimBulkPaymentBatch, batchId, fmt.Sprintf("%d seconds", int(lease.Seconds())))
+	if err != nil {
+		slog.Error("Failed to claim bulk payment batch", "error", err)
+		return false, lib.ErrUnexpected
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to claim bulk payment batch", "error", err)
+		return false, lib.ErrUnexpected
+	}
+	return rowsAffected > 0, nil
+}
+
+func CompleteBulkPaymentBatch(ctx context.Context, db sqlx.ExecerContext, batchId string) error {
+	_, err := db.ExecContext(ctx, lib.QueryCompleteBulkPaymentBatch, batchId)
+	if err != nil {
+		slog.Error("Failed to complete bulk payment batch", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+func DbBulkPaymentBatchToPb(batch BulkPaymentBatch, rows []BulkPaymentRow) *pb.BulkPaymentBatch {
+	pbBatch := &pb.BulkPaymentBatch{
+		BatchId:    batch.BatchId,
+		FromUserId: batch.FromUserId,
+		Status:     batch.Status,
+		TotalRows:  uint32(len(rows)),
+		Rows:       make([]*pb.BulkPaymentRow, len(rows)),
+		CreatedAt:  batch.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if batch.CompletedAt != nil {
+		completedAt := batch.CompletedAt.UTC().Format(time.RFC3339)
+		pbBatch.CompletedAt = &completedAt
+	}
+
+	for i, row := range rows {
+		switch row.Status {
+		case lib.BULK_ROW_STATUS_INVALID:
+		case lib.BULK_ROW_STATUS_PENDING:
+			pbBatch.ValidRows++
+			pbBatch.TotalAmount += uint64(row.Amount)
+		case lib.BULK_ROW_STATUS_FAILED:
+			pbBatch.ValidRows++
+			pbBatch.ProcessedRows++
+			pbBatch.FailedRows++
+			pbBatch.TotalAmount += uint64(row.Amount)
+		default:
+			pbBatch.ValidRows++
+			pbBatch.ProcessedRows++
+			pbBatch.TotalAmount += uint64(row.Amount)
+		}
+
+		var feeAmount *uint64
+		if row.FeeAmount != nil {
+			amount := uint64(*row.FeeAmount)
+			feeAmount = &amount
+		}
+
+		pbBatch.Rows[i] = &pb.BulkPaymentRow{
+			RowNumber:  uint32(row.RowNumber),
+			Recipient:  row.Recipient,
+			ToUserId:   row.ToUserId,
+			Amount:     uint64(row.Amount),
+			Memo:       row.Memo,
+			Status:     row.Status,
+			Error:      row.Error,
+			TransferId: row.TransferId,
+			FeeAmount:  feeAmount,
+		}
+	}
+
+	return pbBatch
+}
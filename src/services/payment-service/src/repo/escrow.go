@@ -0,0 +1,113 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"payment-service/src/lib"
+	pb "protobufs/gen/go/payment-service"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Escrow struct {
+	TigerbeetleTransferId string     `db:"tigerbeetle_transfer_id"`
+	FromUserId            string     `db:"from_user_id"`
+	ToUserId              string     `db:"to_user_id"`
+	Amount                string     `db:"amount"`
+	Memo                  *string    `db:"memo"`
+	Status                string     `db:"status"`
+	Deadline              time.Time  `db:"deadline"`
+	DeadlineAction        string     `db:"deadline_action"`
+	CreatedAt             time.Time  `db:"created_at"`
+	ResolvedAt            *time.Time `db:"resolved_at"`
+	FeeAmount             *int64     `db:"fee_amount"`
+}
+
+func CreateEscrow(ctx context.Context, db sqlx.ExecerContext, transferId string, deadline time.Time, deadlineAction string) error {
+	_, err := db.ExecContext(ctx, lib.QueryInsertEscrow, transferId, deadline, deadlineAction)
+	if err != nil {
+		slog.Error("Failed to create escrow", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+func GetEscrow(ctx context.Context, db *sqlx.DB, transferId string) (Escrow, error) {
+	escrow := Escrow{}
+	err := db.GetContext(ctx, &escrow, lib.QueryGetEscrow, transferId)
+	if err == sql.ErrNoRows {
+		return escrow, lib.ErrNotFound
+	}
+	if err != nil {
+		slog.Error("Failed to get escrow", "error", err)
+		return escrow, lib.ErrUnexpected
+	}
+	return escrow, nil
+}
+
+func GetExpiredEscrows(ctx context.Context, db *sqlx.DB, limit int) ([]Escrow, error) {
+	escrows := []Escrow{}
+	err := db.SelectContext(ctx, &escrows, lib.QueryGetExpiredEscrows, limit)
+	if err != nil {
+		slog.Error("Failed to get expired escrows", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return escrows, nil
+}
+
+func GetUserHeldEscrows(ctx context.Context, db *sqlx.DB, userId string) ([]Escrow, error) {
+	escrows := []Escrow{}
+	err := db.SelectContext(ctx, &escrows, lib.QueryGetUserHeldEscrows, userId)
+	if err != nil {
+		slog.Error("Failed to get user held escrows", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return escrows, nil
+}
+
+func ResolveEscrow(ctx context.Context, db *sqlx.DB, transferId, status string) error {
+	result, err := db.ExecContext(ctx, lib.QueryResolveEscrow, transferId, status)
+	if err != nil {
+		slog.Error("Failed to resolve escrow", "error", err)
+		return lib.ErrUnexpected
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to resolve escrow", "error", err)
+		return lib.ErrUnexpected
+	}
+	if rowsAffected == 0 {
+		return lib.ErrEscrowNotHeld
+	}
+	return nil
+}
+
+func DbEscrowToPbEscrow(escrow Escrow) *pb.Escrow {
+	var resolvedAt *string
+	if escrow.ResolvedAt != nil {
+		formatted := escrow.ResolvedAt.UTC().Format(time.RFC3339)
+		resolvedAt = &formatted
+	}
+
+	var feeAmount *uint64
+	if escrow.FeeAmount != nil {
+		amount := uint64(*escrow.FeeAmount)
+		feeAmount = &amount
+	}
+
+	return &pb.Escrow{
+		EscrowId:       escrow.TigerbeetleTransferId,
+		FromUserId:     escrow.FromUserId,
+		ToUserId:       escrow.ToUserId,
+		Amount:         escrow.Amount,
+		Memo:           escrow.Memo,
+		Status:         escrow.Status,
+		Deadline:       escrow.Deadline.UTC().Format(time.RFC3339),
+		DeadlineAction: escrow.DeadlineAction,
+		CreatedAt:      escrow.CreatedAt.UTC().Format(time.RFC3339),
+		ResolvedAt:     resolvedAt,
+		FeeAmount:      feeAmount,
+	}
+}
@@ -0,0 +1,234 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+	"payment-service/src/lib"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	tbt "github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+// The export rows are encoded as they are for user-service's data export, so
+// they carry json tags. Stored amounts are read into the untagged fields and
+// written out as decimal amounts.
+
+type ExportPaymentLink struct {
+	LinkId      string     `db:"link_id" json:"link_id"`
+	AmountMinor *int64     `db:"amount" json:"-"`
+	Amount      *string    `db:"-" json:"amount"`
+	Memo        *string    `db:"memo" json:"memo"`
+	SingleUse   bool       `db:"single_use" json:"single_use"`
+	ExpiresAt   *time.Time `db:"expires_at" json:"expires_at"`
+	Status      string     `db:"status" json:"status"`
+	TransferId  *string    `db:"transfer_id" json:"transfer_id"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	UsedAt      *time.Time `db:"used_at" json:"used_at"`
+	RevokedAt   *time.Time `db:"revoked_at" json:"revoked_at"`
+}
+
+type ExportEscrow struct {
+	EscrowId       string     `db:"tigerbeetle_transfer_id" json:"escrow_id"`
+	FromUserId     string     `db:"from_user_id" json:"from_user_id"`
+	ToUserId       string     `db:"to_user_id" json:"to_user_id"`
+	AmountHex      string     `db:"amount" json:"-"`
+	Amount         string     `db:"-" json:"amount"`
+	Memo           *string    `db:"memo" json:"memo"`
+	Status         string     `db:"status" json:"status"`
+	Deadline       time.Time  `db:"deadline" json:"deadline"`
+	DeadlineAction string     `db:"deadline_action" json:"deadline_action"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	ResolvedAt     *time.Time `db:"resolved_at" json:"resolved_at"`
+	FeeMinor       *int64     `db:"fee_amount" json:"-"`
+	Fee            *string    `db:"-" json:"fee"`
+}
+
+type ExportBulkPaymentBatch struct {
+	BatchId     string                 `json:"batch_id"`
+	Status      string                 `json:"status"`
+	CreatedAt   time.Time              `json:"created_at"`
+	CompletedAt *time.Time             `json:"completed_at"`
+	Rows        []ExportBulkPaymentRow `json:"rows"`
+}
+
+type ExportBulkPaymentRow struct {
+	RowNumber  int64   `json:"row_number"`
+	Recipient  string  `json:"recipient"`
+	ToUserId   *string `json:"to_user_id"`
+	Amount     string  `json:"amount"`
+	Memo       *string `json:"memo"`
+	Status     string  `json:"status"`
+	Error      *string `json:"error"`
+	TransferId *string `json:"transfer_id"`
+	Fee        *string `json:"fee"`
+}
+
+type ExportRoundUpRule struct {
+	PotId      string    `json:"pot_id"`
+	RoundTo    int64     `json:"round_to"`
+	Multiplier int64     `json:"multiplier"`
+	Enabled    bool      `json:"enabled"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type ExportRoundUp struct {
+	TransferId        string    `db:"tigerbeetle_transfer_id" json:"transfer_id"`
+	PaymentTransferId string    `db:"payment_transfer_id" json:"payment_transfer_id"`
+	PotId             string    `db:"pot_id" json:"pot_id"`
+	AmountMinor       int64     `db:"amount" json:"-"`
+	Amount            string    `db:"-" json:"amount"`
+	CreatedAt         time.Time `db:"created_at" json:"created_at"`
+}
+
+type ExportPaymentLimit struct {
+	Tier                *string   `db:"tier" json:"tier"`
+	PerTransactionMinor *int64    `db:"per_transaction" json:"-"`
+	PerTransaction      *string   `db:"-" json:"per_transaction"`
+	DailyAmountMinor    *int64    `db:"daily_amount" json:"-"`
+	DailyAmount         *string   `db:"-" json:"daily_amount"`
+	MonthlyAmountMinor  *int64    `db:"monthly_amount" json:"-"`
+	MonthlyAmount       *string   `db:"-" json:"monthly_amount"`
+	DailyCount          *int64    `db:"daily_count" json:"daily_count"`
+	MonthlyCount        *int64    `db:"monthly_count" json:"monthly_count"`
+	UpdatedAt           time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type ExportPaymentReview struct {
+	TransferId string     `db:"tigerbeetle_transfer_id" json:"transfer_id"`
+	Status     string     `db:"status" json:"status"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	ReviewedAt *time.Time `db:"reviewed_at" json:"reviewed_at"`
+}
+
+func formatMinorUnitsPtr(amount *int64) *string {
+	if amount == nil {
+		return nil
+	}
+	formatted := lib.FormatMinorUnits(uint64(*amount))
+	return &formatted
+}
+
+func selectExportRows[T any](ctx context.Context, db *sqlx.DB, query, userId string) ([]T, error) {
+	rows := []T{}
+	err := db.SelectContext(ctx, &rows, query, userId)
+	if err != nil {
+		slog.Error("Failed to export user payment data", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return rows, nil
+}
+
+func ExportPaymentLinks(ctx context.Context, db *sqlx.DB, userId string) ([]ExportPaymentLink, error) {
+	links, err := selectExportRows[ExportPaymentLink](ctx, db, lib.QueryExportPaymentLinks, userId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range links {
+		links[i].Amount = formatMinorUnitsPtr(links[i].AmountMinor)
+	}
+	return links, nil
+}
+
+// ExportEscrows returns the escrows the user paid into or is due to receive.
+func ExportEscrows(ctx context.Context, db *sqlx.DB, userId string) ([]ExportEscrow, error) {
+	escrows, err := selectExportRows[ExportEscrow](ctx, db, lib.QueryExportEscrows, userId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range escrows {
+		amount, err := tbt.HexStringToUint128(escrows[i].AmountHex)
+		if err != nil {
+			slog.Error("Failed to parse escrow amount", "error", err)
+			return nil, lib.ErrUnexpected
+		}
+		amountBig := amount.BigInt()
+		escrows[i].Amount = lib.FormatMinorUnits(amountBig.Uint64())
+		escrows[i].Fee = formatMinorUnitsPtr(escrows[i].FeeMinor)
+	}
+	return escrows, nil
+}
+
+// ExportBulkPaymentBatches returns the user's batches with their rows.
+func ExportBulkPaymentBatches(ctx context.Context, db *sqlx.DB, userId string) ([]ExportBulkPaymentBatch, error) {
+	batches, err := selectExportRows[BulkPaymentBatch](ctx, db, lib.QueryExportBulkPaymentBatches, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	exported := make([]ExportBulkPaymentBatch, len(batches))
+	for i, batch := range batches {
+		rows, err := GetBulkPaymentRows(ctx, db, batch.BatchId)
+		if err != nil {
+			return nil, err
+		}
+
+		exportedRows := make([]ExportBulkPaymentRow, len(rows))
+		for j, row := range rows {
+			exportedRows[j] = ExportBulkPaymentRow{
+				RowNumber:  row.RowNumber,
+				Recipient:  row.Recipient,
+				ToUserId:   row.ToUserId,
+				Amount:     lib.FormatMinorUnits(uint64(row.Amount)),
+				Memo:       row.Memo,
+				Status:     row.Status,
+				Error:      row.Error,
+				TransferId: row.TransferId,
+				Fee:        formatMinorUnitsPtr(row.FeeAmount),
+			}
+		}
+
+		exported[i] = ExportBulkPaymentBatch{
+			BatchId:     batch.BatchId,
+			Status:      batch.Status,
+			CreatedAt:   batch.CreatedAt,
+			CompletedAt: batch.CompletedAt,
+			Rows:        exportedRows,
+		}
+	}
+	return exported, nil
+}
+
+func ExportRoundUpRules(ctx context.Context, db *sqlx.DB, userId string) ([]ExportRoundUpRule, error) {
+	rule, err := GetRoundUpRule(ctx, db, userId)
+	if err != nil || rule == nil {
+		return []ExportRoundUpRule{}, err
+	}
+	return []ExportRoundUpRule{{
+		PotId:      rule.PotId,
+		RoundTo:    rule.RoundTo,
+		Multiplier: rule.Multiplier,
+		Enabled:    rule.Enabled,
+		UpdatedAt:  rule.UpdatedAt,
+	}}, nil
+}
+
+func ExportRoundUps(ctx context.Context, db *sqlx.DB, userId string) ([]ExportRoundUp, error) {
+	roundUps, err := selectExportRows[ExportRoundUp](ctx, db, lib.QueryExportRoundUps, userId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range roundUps {
+		roundUps[i].Amount = lib.FormatMinorUnits(uint64(roundUps[i].AmountMinor))
+	}
+	return roundUps, nil
+}
+
+// ExportPaymentLimits returns the user's limit overrides. Users on the
+// defaults of their tier have no row.
+func ExportPaymentLimits(ctx context.Context, db *sqlx.DB, userId string) ([]ExportPaymentLimit, error) {
+	limits, err := selectExportRows[ExportPaymentLimit](ctx, db, lib.QueryExportPaymentLimits, userId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range limits {
+		limits[i].PerTransaction = formatMinorUnitsPtr(limits[i].PerTransactionMinor)
+		limits[i].DailyAmount = formatMinorUnitsPtr(limits[i].DailyAmountMinor)
+		limits[i].MonthlyAmount = formatMinorUnitsPtr(limits[i].MonthlyAmountMinor)
+	}
+	return limits, nil
+}
+
+func ExportPaymentReviews(ctx context.Context, db *sqlx.DB, userId string) ([]ExportPaymentReview, error) {
+	return selectExportRows[ExportPaymentReview](ctx, db, lib.QueryExportPaymentReviews, userId)
+}
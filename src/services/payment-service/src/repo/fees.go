@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"payment-service/src/lib"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Fee struct {
+	TigerbeetleTransferId string `db:"tigerbeetle_transfer_id"`
+	TransferId            string `db:"transfer_id"`
+	UserId                string `db:"user_id"`
+	Flow                  string `db:"flow"`
+	Amount                int64  `db:"amount"`
+}
+
+func CreateFee(ctx context.Context, db sqlx.ExecerContext, feeTransferId, transferId, userId, flow string, amount uint64) error {
+	_, err := db.ExecContext(ctx, lib.QueryInsertFee, feeTransferId, transferId, userId, flow, int64(amount))
+	if err != nil {
+		slog.Error("Failed to record fee", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+// GetFeeForTransfer returns the fee charged alongside the transfer, or nil
+// when the transfer was free.
+func GetFeeForTransfer(ctx context.Context, db *sqlx.DB, transferId string) (*Fee, error) {
+	fee := Fee{}
+	err := db.GetContext(ctx, &fee, lib.QueryGetFeeForTransfer, transferId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("Failed to get fee", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return &fee, nil
+}
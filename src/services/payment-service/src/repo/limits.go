@@ -0,0 +1,176 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"payment-service/src/lib"
+	pb "protobufs/gen/go/payment-service"
+
+	"github.com/jmoiron/sqlx"
+	tbt "github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+type PaymentLimitOverrides struct {
+	Tier           *string `db:"tier"`
+	PerTransaction *int64  `db:"per_transaction"`
+	DailyAmount    *int64  `db:"daily_amount"`
+	MonthlyAmount  *int64  `db:"monthly_amount"`
+	DailyCount     *int64  `db:"daily_count"`
+	MonthlyCount   *int64  `db:"monthly_count"`
+}
+
+func toUint64Ptr(value *int64) *uint64 {
+	if value == nil {
+		return nil
+	}
+	converted := uint64(*value)
+	return &converted
+}
+
+func toInt64Ptr(value *uint64) *int64 {
+	if value == nil {
+		return nil
+	}
+	converted := int64(*value)
+	return &converted
+}
+
+func (o PaymentLimitOverrides) ToLimitOverrides() lib.LimitOverrides {
+	return lib.LimitOverrides{
+		Tier:           o.Tier,
+		PerTransaction: toUint64Ptr(o.PerTransaction),
+		DailyAmount:    toUint64Ptr(o.DailyAmount),
+		MonthlyAmount:  toUint64Ptr(o.MonthlyAmount),
+		DailyCount:     toUint64Ptr(o.DailyCount),
+		MonthlyCount:   toUint64Ptr(o.MonthlyCount),
+	}
+}
+
+func GetPaymentLimits(ctx context.Context, db *sqlx.DB, userId string) (lib.PaymentLimits, error) {
+	overrides := PaymentLimitOverrides{}
+	err := db.GetContext(ctx, &overrides, lib.QueryGetPaymentLimitOverrides, userId)
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("Failed to get payment limit overrides", "error", err)
+		return lib.PaymentLimits{}, lib.ErrUnexpected
+	}
+
+	return lib.ResolvePaymentLimits(overrides.ToLimitOverrides())
+}
+
+// LockPaymentLimits starts a transaction that holds the user's limits row
+// until it ends, so limit checks for the same user run one after another. A
+// row without overrides is created for users who have none yet.
+func LockPaymentLimits(ctx context.Context, db *sqlx.DB, userId string) (*sqlx.Tx, lib.PaymentLimits, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin payment limits transaction", "error", err)
+		return nil, lib.PaymentLimits{}, lib.ErrUnexpected
+	}
+
+	_, err = tx.ExecContext(ctx, lib.QueryEnsurePaymentLimitsRow, userId)
+	if err != nil {
+		tx.Rollback()
+		slog.Error("Failed to create payment limits row", "error", err)
+		return nil, lib.PaymentLimits{}, lib.ErrUnexpected
+	}
+
+	overrides := PaymentLimitOverrides{}
+	err = tx.GetContext(ctx, &overrides, lib.QueryLockPaymentLimitOverrides, userId)
+	if err != nil {
+		tx.Rollback()
+		slog.Error("Failed to lock payment limit overrides", "error", err)
+		return nil, lib.PaymentLimits{}, lib.ErrUnexpected
+	}
+
+	limits, err := lib.ResolvePaymentLimits(overrides.ToLimitOverrides())
+	if err != nil {
+		tx.Rollback()
+		return nil, lib.PaymentLimits{}, err
+	}
+
+	return tx, limits, nil
+}
+
+func SetPaymentLimitOverrides(ctx context.Context, db *sqlx.DB, userId string, overrides lib.LimitOverrides) error {
+	_, err := db.ExecContext(
+		ctx,
+		lib.QueryUpsertPaymentLimitOverrides,
+		userId,
+		overrides.Tier,
+		toInt64Ptr(overrides.PerTransaction),
+		toInt64Ptr(overrides.DailyAmount),
+		toInt64Ptr(overrides.MonthlyAmount),
+		toInt64Ptr(overrides.DailyCount),
+		toInt64Ptr(overrides.MonthlyCount),
+	)
+	if err != nil {
+		slog.Error("Failed to set payment limit overrides", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+type recentPayment struct {
+	Amount    string `db:"amount"`
+	WithinDay bool   `db:"within_day"`
+}
+
+func GetLimitUsage(ctx context.Context, db sqlx.QueryerContext, userId string) (lib.LimitUsage, error) {
+	usage := lib.LimitUsage{}
+
+	payments := []recentPayment{}
+	err := sqlx.SelectContext(
+		ctx,
+		db,
+		&payments,
+		lib.QueryGetRecentOutgoingPayments,
+		userId,
+		fmt.Sprintf("%d hours", int(lib.MonthlyLimitWindow.Hours())),
+		fmt.Sprintf("%d hours", int(lib.DailyLimitWindow.Hours())),
+	)
+	if err != nil {
+		slog.Error("Failed to get recent outgoing payments", "error", err)
+		return usage, lib.ErrUnexpected
+	}
+
+	for _, payment := range payments {
+		amountUint128, err := tbt.HexStringToUint128(payment.Amount)
+		if err != nil {
+			slog.Error("Failed to parse payment amount", "error", err)
+			return usage, lib.ErrUnexpected
+		}
+		amountBig := amountUint128.BigInt()
+		amount := amountBig.Uint64()
+
+		usage.MonthlyAmount += amount
+		usage.MonthlyCount++
+		if payment.WithinDay {
+			usage.DailyAmount += amount
+			usage.DailyCount++
+		}
+	}
+
+	return usage, nil
+}
+
+func toPbLimitUsage(limit, used uint64) *pb.LimitUsage {
+	return &pb.LimitUsage{
+		Limit:     limit,
+		Used:      used,
+		Remaining: lib.Remaining(limit, used),
+	}
+}
+
+func PaymentLimitsToPb(limits lib.PaymentLimits, usage lib.LimitUsage) *pb.PaymentLimits {
+	return &pb.PaymentLimits{
+		Tier:           limits.Tier,
+		PerTransaction: limits.PerTransaction,
+		DailyAmount:    toPbLimitUsage(limits.DailyAmount, usage.DailyAmount),
+		MonthlyAmount:  toPbLimitUsage(limits.MonthlyAmount, usage.MonthlyAmount),
+		DailyCount:     toPbLimitUsage(limits.DailyCount, usage.DailyCount),
+		MonthlyCount:   toPbLimitUsage(limits.MonthlyCount, usage.MonthlyCount),
+		KycCapped:      limits.KycCapped,
+	}
+}
@@ -0,0 +1,148 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"payment-service/src/lib"
+	pb "protobufs/gen/go/payment-service"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type PaymentLink struct {
+	LinkId     string     `db:"link_id"`
+	UserId     string     `db:"user_id"`
+	Amount     *int64     `db:"amount"`
+	Memo       *string    `db:"memo"`
+	SingleUse  bool       `db:"single_use"`
+	ExpiresAt  *time.Time `db:"expires_at"`
+	Status     string     `db:"status"`
+	TransferId *string    `db:"transfer_id"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+func (link PaymentLink) Claims() lib.PaymentLinkClaims {
+	claims := lib.PaymentLinkClaims{
+		LinkId:    link.LinkId,
+		ToUserId:  link.UserId,
+		Amount:    toUint64Ptr(link.Amount),
+		Memo:      link.Memo,
+		SingleUse: link.SingleUse,
+	}
+	if link.ExpiresAt != nil {
+		expiresAt := link.ExpiresAt.Unix()
+		claims.ExpiresAt = &expiresAt
+	}
+	return claims
+}
+
+func CreatePaymentLink(ctx context.Context, db *sqlx.DB, linkId, userId string, amount *uint64, memo *string, singleUse bool, expiresAt *time.Time) (PaymentLink, error) {
+	link := PaymentLink{}
+	err := db.GetContext(ctx, &link, lib.QueryInsertPaymentLink, linkId, userId, toInt64Ptr(amount), memo, singleUse, expiresAt)
+	if err != nil {
+		slog.Error("Failed to create payment link", "error", err)
+		return link, lib.ErrUnexpected
+	}
+	return link, nil
+}
+
+func GetPaymentLink(ctx context.Context, db *sqlx.DB, linkId string) (PaymentLink, error) {
+	link := PaymentLink{}
+	err := db.GetContext(ctx, &link, lib.QueryGetPaymentLink, linkId)
+	if err == sql.ErrNoRows {
+		return link, lib.ErrNotFound
+	}
+	if err != nil {
+		slog.Error("Failed to get payment link", "error", err)
+		return link, lib.ErrUnexpected
+	}
+	return link, nil
+}
+
+// ClaimPaymentLink marks a single-use link as used before the payment is
+// made, so two concurrent payers cannot both redeem it.
+func ClaimPaymentLink(ctx context.Context, db *sqlx.DB, linkId string) error {
+	result, err := db.ExecContext(ctx, lib.QueryClaimPaymentLink, linkId)
+	if err != nil {
+		slog.Error("Failed to claim payment link", "error", err)
+		return lib.ErrUnexpected
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to claim payment link", "error", err)
+		return lib.ErrUnexpected
+	}
+	if rowsAffected == 0 {
+		return lib.ErrPaymentLinkInactive
+	}
+	return nil
+}
+
+func ReleasePaymentLink(ctx context.Context, db *sqlx.DB, linkId string) error {
+	_, err := db.ExecContext(ctx, lib.QueryReleasePaymentLink, linkId)
+	if err != nil {
+		slog.Error("Failed to release payment link", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+func SetPaymentLinkTransfer(ctx context.Context, db *sqlx.DB, linkId, transferId string) error {
+	_, err := db.ExecContext(ctx, lib.QuerySetPaymentLinkTransfer, linkId, transferId)
+	if err != nil {
+		slog.Error("Failed to set payment link transfer", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+func RevokePaymentLink(ctx context.Context, db *sqlx.DB, linkId, userId string) (PaymentLink, error) {
+	link := PaymentLink{}
+	err := db.GetContext(ctx, &link, lib.QueryRevokePaymentLink, linkId, userId)
+	if err == sql.ErrNoRows {
+		return link, lib.ErrPaymentLinkInactive
+	}
+	if err != nil {
+		slog.Error("Failed to revoke payment link", "error", err)
+		return link, lib.ErrUnexpected
+	}
+	return link, nil
+}
+
+// RevokeUserPaymentLinks revokes every active link of the user and returns
+// how many there were.
+func RevokeUserPaymentLinks(ctx context.Context, db *sqlx.DB, userId string) (int64, error) {
+	result, err := db.ExecContext(ctx, lib.QueryRevokeUserPaymentLinks, userId)
+	if err != nil {
+		slog.Error("Failed to revoke user payment links", "error", err)
+		return 0, lib.ErrUnexpected
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to revoke user payment links", "error", err)
+		return 0, lib.ErrUnexpected
+	}
+	return rowsAffected, nil
+}
+
+func DbPaymentLinkToPbPaymentLink(link PaymentLink) *pb.PaymentLink {
+	var expiresAt *string
+	if link.ExpiresAt != nil {
+		formatted := link.ExpiresAt.UTC().Format(time.RFC3339)
+		expiresAt = &formatted
+	}
+
+	return &pb.PaymentLink{
+		LinkId:     link.LinkId,
+		UserId:     link.UserId,
+		Amount:     toUint64Ptr(link.Amount),
+		Memo:       link.Memo,
+		SingleUse:  link.SingleUse,
+		ExpiresAt:  expiresAt,
+		Status:     link.Status,
+		TransferId: link.TransferId,
+		CreatedAt:  link.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
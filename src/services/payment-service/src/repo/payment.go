@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"payment-service/src/lib"
+	pb "protobufs/gen/go/payment-service"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Payment struct {
+	TigerbeetleTransferId string    `db:"tigerbeetle_transfer_id"`
+	FromUserId            string    `db:"from_user_id"`
+	ToUserId              string    `db:"to_user_id"`
+	Amount                string    `db:"amount"`
+	Memo                  *string   `db:"memo"`
+	Reference             *string   `db:"reference"`
+	CreatedAt             time.Time `db:"created_at"`
+}
+
+func DbPaymentToPbPayment(payment Payment) *pb.Payment {
+	return &pb.Payment{
+		TransferId: payment.TigerbeetleTransferId,
+		FromUserId: payment.FromUserId,
+		ToUserId:   payment.ToUserId,
+		Amount:     payment.Amount,
+		Memo:       payment.Memo,
+		Reference:  payment.Reference,
+		CreatedAt:  payment.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func CompleteTransfer(ctx context.Context, db *sqlx.DB, transferId string) error {
+	_, err := db.ExecContext(ctx, lib.QueryCompleteTransfer, transferId)
+	if err != nil {
+		slog.Error("Failed to complete transfer", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+// DiscardPendingTransfer deletes a pending transfer together with its fee,
+// round-up, review and escrow. A transfer that is no longer pending is left
+// alone.
+func DiscardPendingTransfer(ctx context.Context, db *sqlx.DB, transferId string) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin discard transaction", "error", err)
+		return lib.ErrUnexpected
+	}
+	defer tx.Rollback()
+
+	lockedId := ""
+	err = tx.GetContext(ctx, &lockedId, lib.QueryLockPendingTransfer, transferId)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		slog.Error("Failed to lock pending transfer", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	for _, query := range []string{
+		lib.QueryDeletePendingTransferFees,
+		lib.QueryDeletePendingTransferRoundUps,
+		lib.QueryDeletePendingTransferReview,
+		lib.QueryDeletePendingTransferEscrow,
+		lib.QueryDeletePendingTransfer,
+	} {
+		_, err = tx.ExecContext(ctx, query, transferId)
+		if err != nil {
+			slog.Error("Failed to discard pending transfer", "error", err)
+			return lib.ErrUnexpected
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.Error("Failed to commit discarded transfer", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+// GetStalePendingTransfers returns transfers that have been pending for
+// longer than gracePeriod.
+func GetStalePendingTransfers(ctx context.Context, db *sqlx.DB, gracePeriod time.Duration, limit int) ([]string, error) {
+	transferIds := []string{}
+	err := db.SelectContext(ctx, &transferIds, lib.QueryGetStalePendingTransfers, fmt.Sprintf("%d seconds", int(gracePeriod.Seconds())), limit)
+	if err != nil {
+		slog.Error("Failed to get stale pending transfers", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return transferIds, nil
+}
@@ -0,0 +1,199 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"payment-service/src/lib"
+	"payment-service/src/risk"
+	pb "protobufs/gen/go/payment-service"
+	userPb "protobufs/gen/go/user-service"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/status"
+)
+
+type PaymentHistory struct {
+	db *sqlx.DB
+}
+
+func NewPaymentHistory(db *sqlx.DB) *PaymentHistory {
+	return &PaymentHistory{db: db}
+}
+
+func (h *PaymentHistory) CountPaymentsToCounterparty(ctx context.Context, fromUserId, toUserId string) (uint64, error) {
+	var count uint64
+	err := h.db.GetContext(ctx, &count, lib.QueryCountPaymentsToCounterparty, fromUserId, toUserId)
+	if err != nil {
+		slog.Error("Failed to count payments to counterparty", "error", err)
+		return 0, lib.ErrUnexpected
+	}
+	return count, nil
+}
+
+func (h *PaymentHistory) CountRecentPayments(ctx context.Context, fromUserId string, window time.Duration) (uint64, error) {
+	var count uint64
+	err := h.db.GetContext(ctx, &count, lib.QueryCountRecentPayments, fromUserId, fmt.Sprintf("%d minutes", int(window.Minutes())))
+	if err != nil {
+		slog.Error("Failed to count recent payments", "error", err)
+		return 0, lib.ErrUnexpected
+	}
+	return count, nil
+}
+
+type UserSessions struct {
+	client userPb.UserServiceClient
+}
+
+func NewUserSessions(client userPb.UserServiceClient) *UserSessions {
+	return &UserSessions{client: client}
+}
+
+func (u *UserSessions) LatestSession(ctx context.Context, userId string) (*risk.Session, error) {
+	session, err := u.client.GetLatestSession(ctx, &userPb.GetLatestSessionRequest{
+		UserId: userId,
+	})
+	if err != nil {
+		if status.Convert(err).Message() == lib.ErrNotFound.Error() {
+			return nil, nil
+		}
+		slog.Error("Failed to get latest session", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, session.CreatedAt)
+	if err != nil {
+		slog.Error("Failed to parse session timestamp", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return &risk.Session{
+		CreatedAt:   createdAt,
+		Device:      session.Device,
+		KnownDevice: session.KnownDevice,
+	}, nil
+}
+
+type HeldPayment struct {
+	TigerbeetleTransferId string         `db:"tigerbeetle_transfer_id"`
+	FromUserId            string         `db:"from_user_id"`
+	ToUserId              string         `db:"to_user_id"`
+	Amount                string         `db:"amount"`
+	TriggeredRules        pq.StringArray `db:"triggered_rules"`
+	Status                string         `db:"status"`
+	CreatedAt             time.Time      `db:"created_at"`
+	ReviewedAt            *time.Time     `db:"reviewed_at"`
+	Reviewer              *string        `db:"reviewer"`
+}
+
+func CreatePaymentReview(ctx context.Context, db sqlx.ExecerContext, transferId string, triggeredRules []string) error {
+	_, err := db.ExecContext(ctx, lib.QueryInsertPaymentReview, transferId, pq.StringArray(triggeredRules))
+	if err != nil {
+		slog.Error("Failed to create payment review", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+func ListHeldPayments(ctx context.Context, db *sqlx.DB, limit uint32) ([]HeldPayment, error) {
+	payments := []HeldPayment{}
+	err := db.SelectContext(ctx, &payments, lib.QueryListHeldPayments, limit)
+	if err != nil {
+		slog.Error("Failed to list held payments", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return payments, nil
+}
+
+// GetExpiredHeldPayments returns held payments that have waited for a review
+// longer than maxAge.
+func GetExpiredHeldPayments(ctx context.Context, db *sqlx.DB, maxAge time.Duration, limit int) ([]HeldPayment, error) {
+	payments := []HeldPayment{}
+	err := db.SelectContext(ctx, &payments, lib.QueryGetExpiredHeldPayments, fmt.Sprintf("%d seconds", int(maxAge.Seconds())), limit)
+	if err != nil {
+		slog.Error("Failed to get expired held payments", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return payments, nil
+}
+
+func GetHeldPayment(ctx context.Context, db *sqlx.DB, transferId string) (HeldPayment, error) {
+	payment := HeldPayment{}
+	err := db.GetContext(ctx, &payment, lib.QueryGetHeldPayment, transferId)
+	if err == sql.ErrNoRows {
+		return payment, lib.ErrNotFound
+	}
+	if err != nil {
+		slog.Error("Failed to get held payment", "error", err)
+		return payment, lib.ErrUnexpected
+	}
+	return payment, nil
+}
+
+// ClaimPaymentReview moves a held review to claimStatus and returns it. It
+// fails with lib.ErrAlreadyReviewed when another decision got there first.
+func ClaimPaymentReview(ctx context.Context, db *sqlx.DB, transferId, claimStatus, reviewer string) (HeldPayment, error) {
+	payment := HeldPayment{}
+	err := db.GetContext(ctx, &payment, lib.QueryClaimPaymentReview, transferId, claimStatus, reviewer)
+	if err == sql.ErrNoRows {
+		_, err = GetHeldPayment(ctx, db, transferId)
+		if err != nil {
+			return payment, err
+		}
+		return payment, lib.ErrAlreadyReviewed
+	}
+	if err != nil {
+		slog.Error("Failed to claim payment review", "error", err)
+		return payment, lib.ErrUnexpected
+	}
+	return payment, nil
+}
+
+func ReleasePaymentReview(ctx context.Context, db *sqlx.DB, transferId, claimStatus string) error {
+	_, err := db.ExecContext(ctx, lib.QueryReleasePaymentReview, transferId, claimStatus)
+	if err != nil {
+		slog.Error("Failed to release payment review", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+func UpdatePaymentReview(ctx context.Context, db *sqlx.DB, transferId, claimStatus, status string) error {
+	result, err := db.ExecContext(ctx, lib.QueryUpdatePaymentReview, transferId, claimStatus, status)
+	if err != nil {
+		slog.Error("Failed to update payment review", "error", err)
+		return lib.ErrUnexpected
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to update payment review", "error", err)
+		return lib.ErrUnexpected
+	}
+	if rowsAffected == 0 {
+		return lib.ErrAlreadyReviewed
+	}
+	return nil
+}
+
+func DbHeldPaymentToPbHeldPayment(payment HeldPayment) *pb.HeldPayment {
+	var reviewedAt *string
+	if payment.ReviewedAt != nil {
+		formatted := payment.ReviewedAt.UTC().Format(time.RFC3339)
+		reviewedAt = &formatted
+	}
+
+	return &pb.HeldPayment{
+		TransferId:     payment.TigerbeetleTransferId,
+		FromUserId:     payment.FromUserId,
+		ToUserId:       payment.ToUserId,
+		Amount:         payment.Amount,
+		TriggeredRules: payment.TriggeredRules,
+		Status:         payment.Status,
+		CreatedAt:      payment.CreatedAt.UTC().Format(time.RFC3339),
+		ReviewedAt:     reviewedAt,
+		Reviewer:       payment.Reviewer,
+	}
+}
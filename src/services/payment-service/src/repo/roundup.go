@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"payment-service/src/lib"
+	pb "protobufs/gen/go/payment-service"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type RoundUpRule struct {
+	UserId     string    `db:"user_id"`
+	PotId      string    `db:"pot_id"`
+	RoundTo    int64     `db:"round_to"`
+	Multiplier int64     `db:"multiplier"`
+	Enabled    bool      `db:"enabled"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+type RoundUpSummary struct {
+	TotalSaved   int64 `db:"total_saved"`
+	RoundUpCount int64 `db:"round_up_count"`
+}
+
+func GetRoundUpRule(ctx context.Context, db *sqlx.DB, userId string) (*RoundUpRule, error) {
+	rule := RoundUpRule{}
+	err := db.GetContext(ctx, &rule, lib.QueryGetRoundUpRule, userId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("Failed to get round-up rule", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return &rule, nil
+}
+
+func DisableRoundUpRule(ctx context.Context, db *sqlx.DB, userId string) (int64, error) {
+	result, err := db.ExecContext(ctx, lib.QueryDisableRoundUpRule, userId)
+	if err != nil {
+		slog.Error("Failed to disable round-up rule", "error", err)
+		return 0, lib.ErrUnexpected
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to disable round-up rule", "error", err)
+		return 0, lib.ErrUnexpected
+	}
+	return rowsAffected, nil
+}
+
+func SetRoundUpRule(ctx context.Context, db *sqlx.DB, userId, potId string, roundTo, multiplier uint32, enabled bool) (RoundUpRule, error) {
+	rule := RoundUpRule{}
+	err := db.GetContext(ctx, &rule, lib.QueryUpsertRoundUpRule, userId, potId, roundTo, multiplier, enabled)
+	if err != nil {
+		slog.Error("Failed to set round-up rule", "error", err)
+		return rule, lib.ErrUnexpected
+	}
+	return rule, nil
+}
+
+func CreateRoundUp(ctx context.Context, db sqlx.ExecerContext, transferId, paymentTransferId, userId, potId string, amount uint64) error {
+	_, err := db.ExecContext(ctx, lib.QueryInsertRoundUp, transferId, paymentTransferId, userId, potId, int64(amount))
+	if err != nil {
+		slog.Error("Failed to record round-up", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+func GetRoundUpSummary(ctx context.Context, db *sqlx.DB, userId string, start, end time.Time) (RoundUpSummary, error) {
+	summary := RoundUpSummary{}
+	err := db.GetContext(ctx, &summary, lib.QueryGetRoundUpSummary, userId, start, end)
+	if err != nil {
+		slog.Error("Failed to get round-up summary", "error", err)
+		return summary, lib.ErrUnexpected
+	}
+	return summary, nil
+}
+
+func DbRoundUpRuleToPb(rule RoundUpRule) *pb.RoundUpRule {
+	return &pb.RoundUpRule{
+		UserId:     rule.UserId,
+		PotId:      rule.PotId,
+		RoundTo:    uint32(rule.RoundTo),
+		Multiplier: uint32(rule.Multiplier),
+		Enabled:    rule.Enabled,
+		UpdatedAt:  rule.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"fees"
+	"payment-service/src/lib"
+	"payment-service/src/repo"
+	"payment-service/src/risk"
+	pb "protobufs/gen/go/payment-service"
+	tbPb "protobufs/gen/go/tigerbeetle-service"
+
+	"github.com/jmoiron/sqlx"
+	tbt "github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultHeldPaymentsLimit = 50
+	maxHeldPaymentsLimit     = 200
+
+	reviewStatusApproving = "approving"
+	reviewStatusRejecting = "rejecting"
+	reviewStatusApproved  = "approved"
+	reviewStatusRejected  = "rejected"
+
+	// Held payments nobody reviewed in time are rejected under this name.
+	expiryReviewer = "expiry"
+
+	heldPaymentWorkerInterval  = time.Minute
+	heldPaymentWorkerBatchSize = 100
+)
+
+func (s *PaymentServiceServer) screenPayment(ctx context.Context, tracer oteltrace.Tracer, req *pb.CreatePaymentRequest) (risk.Result, error) {
+	ctx, riskSpan := tracer.Start(ctx, lib.EVENT_RISK_EVALUATE)
+	defer riskSpan.End()
+
+	env := risk.Environment{
+		History:  repo.NewPaymentHistory(s.db),
+		Sessions: repo.NewUserSessions(s.userServiceClient),
+		Now:      time.Now(),
+	}
+	payment := risk.Payment{
+		FromUserId: req.FromUserId,
+		ToUserId:   req.ToUserId,
+		Amount:     req.Amount,
+	}
+
+	result, err := s.riskEngine.Evaluate(ctx, env, payment)
+	if err != nil {
+		riskSpan.RecordError(err)
+		return risk.Result{}, lib.ErrUnexpected
+	}
+
+	riskSpan.SetAttributes(
+		attribute.String(lib.ATTR_RISK_VERDICT, result.Verdict.String()),
+		attribute.StringSlice(lib.ATTR_RISK_TRIGGERED_RULES, result.TriggeredRules),
+	)
+
+	if result.Verdict == risk.VerdictBlock {
+		riskSpan.AddEvent(lib.EVENT_RISK_BLOCKED)
+		return result, lib.ErrPaymentBlocked
+	}
+
+	return result, nil
+}
+
+// holdPayment puts the payment and its fee on hold as pending transfers for
+// a reviewer. Like a posted payment, its records are committed as pending
+// before the chain is sent, so a hold on the payer's funds always has a
+// review to resolve it.
+func (s *PaymentServiceServer) holdPayment(ctx context.Context, tracer oteltrace.Tracer, auth paymentAuthorization, req *pb.CreatePaymentRequest, transferId string, memo, reference *string) (*pb.CreatePaymentResponse, error) {
+	transfers := []*tbPb.LinkedTransfer{
+		{
+			CreditAccountId: req.FromUserId,
+			DebitAccountId:  req.ToUserId,
+			Amount:          tbt.ToUint128(req.Amount).String(),
+			Kind:            tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_PENDING,
+			TransferId:      &transferId,
+		},
+	}
+	resp := &pb.CreatePaymentResponse{
+		TransferId: transferId,
+		Status:     paymentStatusHeld,
+	}
+
+	fee := auth.fee
+	if fee > 0 {
+		feeTransferId := tbt.ID().String()
+		feeLeg := fees.Leg(req.FromUserId, fee, tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_PENDING)
+		feeLeg.TransferId = &feeTransferId
+		transfers = append(transfers, feeLeg)
+		resp.FeeAmount = &fee
+		resp.FeeTransferId = &feeTransferId
+	}
+
+	err := s.recordPendingPayment(ctx, tracer, auth, req, func(tx *sqlx.Tx) error {
+		return s.recordHeldPayment(ctx, tracer, tx, req, memo, reference, auth.screening.TriggeredRules, resp)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	oteltrace.SpanFromContext(ctx).AddEvent(lib.EVENT_RISK_HELD)
+
+	err = s.submitPayment(ctx, tracer, auth, req, lib.EVENT_TB_CREATE_PENDING_TRANSFER, transfers)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// recordHeldPayment writes the transfer, its review and its fee in the same
+// transaction, so a held payment is either fully recorded or not at all.
+func (s *PaymentServiceServer) recordHeldPayment(ctx context.Context, tracer oteltrace.Tracer, limitTx *sqlx.Tx, req *pb.CreatePaymentRequest, memo, reference *string, triggeredRules []string, resp *pb.CreatePaymentResponse) error {
+	transferId := resp.TransferId
+
+	err := s.insertTransfer(ctx, tracer, limitTx, lib.TRANSFER_STATUS_PENDING, transferId, req.FromUserId, req.ToUserId, req.Amount, memo, reference)
+	if err != nil {
+		return err
+	}
+
+	ctx, reviewSpan := tracer.Start(ctx, lib.EVENT_REVIEW_CREATE)
+	defer reviewSpan.End()
+
+	reviewSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryInsertPaymentReview),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferId}),
+	)
+
+	err = repo.CreatePaymentReview(ctx, limitTx, transferId, triggeredRules)
+	if err != nil {
+		reviewSpan.RecordError(err)
+		return err
+	}
+	reviewSpan.End()
+
+	if resp.FeeAmount != nil {
+		err = s.recordFee(ctx, tracer, limitTx, *resp.FeeTransferId, transferId, req.FromUserId, *resp.FeeAmount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *PaymentServiceServer) ListHeldPayments(ctx context.Context, req *pb.ListHeldPaymentsRequest) (*pb.ListHeldPaymentsResponse, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	limit := uint32(defaultHeldPaymentsLimit)
+	if req.Limit != nil {
+		limit = min(*req.Limit, maxHeldPaymentsLimit)
+	}
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_REVIEW_LIST)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryListHeldPayments),
+	)
+
+	payments, err := repo.ListHeldPayments(ctx, s.db, limit)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+
+	dbSpan.SetAttributes(
+		attribute.Int(lib.ATTR_PAYMENT_COUNT, len(payments)),
+	)
+	dbSpan.End()
+
+	pbPayments := make([]*pb.HeldPayment, len(payments))
+	for i, payment := range payments {
+		pbPayments[i] = repo.DbHeldPaymentToPbHeldPayment(payment)
+	}
+
+	return &pb.ListHeldPaymentsResponse{
+		Payments: pbPayments,
+	}, nil
+}
+
+// claimReview moves the review out of held in a single statement, so
+// concurrent reviewers cannot both act on the same payment. A review already
+// claimed for the same decision can be claimed again, which finishes a
+// decision that was interrupted after the claim.
+func (s *PaymentServiceServer) claimReview(ctx context.Context, tracer oteltrace.Tracer, transferId, claimStatus, reviewer string) (repo.HeldPayment, error) {
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_REVIEW_CLAIM)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryClaimPaymentReview),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferId, claimStatus, reviewer}),
+	)
+
+	payment, err := repo.ClaimPaymentReview(ctx, s.db, transferId, claimStatus, reviewer)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return payment, err
+	}
+
+	return payment, nil
+}
+
+// releaseReview puts a claimed review back on hold when its ledger call
+// failed, so the payment can be reviewed again.
+func (s *PaymentServiceServer) releaseReview(ctx context.Context, tracer oteltrace.Tracer, transferId, claimStatus string) {
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_REVIEW_RELEASE)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryReleasePaymentReview),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferId, claimStatus}),
+	)
+
+	err := repo.ReleasePaymentReview(ctx, s.db, transferId, claimStatus)
+	if err != nil {
+		dbSpan.RecordError(err)
+	}
+}
+
+func (s *PaymentServiceServer) completeReview(ctx context.Context, tracer oteltrace.Tracer, transferId, claimStatus, decision string) (*pb.HeldPayment, error) {
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_REVIEW_UPDATE)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryUpdatePaymentReview),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferId, claimStatus, decision}),
+	)
+
+	err := repo.UpdatePaymentReview(ctx, s.db, transferId, claimStatus, decision)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+
+	payment, err := repo.GetHeldPayment(ctx, s.db, transferId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	dbSpan.End()
+
+	return repo.DbHeldPaymentToPbHeldPayment(payment), nil
+}
+
+// pendingPaymentTransfers returns the legs that post or void a pending
+// payment together with the fee that was put on hold alongside it.
+func (s *PaymentServiceServer) pendingPaymentTransfers(ctx context.Context, tracer oteltrace.Tracer, transferId, fromUserId, toUserId, amount string, kind tbPb.LinkedTransferKind) ([]*tbPb.LinkedTransfer, error) {
+	transfers := []*tbPb.LinkedTransfer{
+		{
+			CreditAccountId:   fromUserId,
+			DebitAccountId:    toUserId,
+			Amount:            amount,
+			Kind:              kind,
+			PendingTransferId: &transferId,
+		},
+	}
+
+	fee, err := s.getFeeForTransfer(ctx, tracer, transferId)
+	if err != nil {
+		return nil, err
+	}
+	if fee != nil {
+		feeTransfer := fees.Leg(fromUserId, uint64(fee.Amount), kind)
+		feeTransfer.PendingTransferId = &fee.TigerbeetleTransferId
+		transfers = append(transfers, feeTransfer)
+	}
+
+	return transfers, nil
+}
+
+// reviewHeldPayment claims the review, posts or voids the held transfers and
+// only then records the decision. The ledger reporting the transfers as
+// already finalized the same way counts as success, since that is what a
+// retry after an interrupted decision sees.
+func (s *PaymentServiceServer) reviewHeldPayment(ctx context.Context, tracer oteltrace.Tracer, req *pb.ReviewHeldPaymentRequest, claimStatus, decision string, kind tbPb.LinkedTransferKind, event string, alreadyDone error) (*pb.HeldPayment, error) {
+	payment, err := s.claimReview(ctx, tracer, req.TransferId, claimStatus, req.Reviewer)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers, err := s.pendingPaymentTransfers(ctx, tracer, payment.TigerbeetleTransferId, payment.FromUserId, payment.ToUserId, payment.Amount, kind)
+	if err != nil {
+		s.releaseReview(ctx, tracer, req.TransferId, claimStatus)
+		return nil, err
+	}
+
+	ctx, ledgerSpan := tracer.Start(ctx, event)
+	defer ledgerSpan.End()
+
+	_, err = s.tigerbeetleServiceClient.CreateLinkedTransfers(
+		ctx,
+		&tbPb.CreateLinkedTransfersRequest{
+			Transfers: transfers,
+		},
+	)
+	if err != nil && status.Convert(err).Message() != alreadyDone.Error() {
+		ledgerSpan.RecordError(err)
+		s.releaseReview(ctx, tracer, req.TransferId, claimStatus)
+		return nil, err
+	}
+	ledgerSpan.End()
+
+	return s.completeReview(ctx, tracer, req.TransferId, claimStatus, decision)
+}
+
+func (s *PaymentServiceServer) ApproveHeldPayment(ctx context.Context, req *pb.ReviewHeldPaymentRequest) (*pb.HeldPayment, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_TB_TRANSFER_ID, req.TransferId),
+		attribute.String(lib.ATTR_REVIEW_REVIEWER, req.Reviewer),
+		attribute.String(lib.ATTR_REVIEW_STATUS, reviewStatusApproved),
+	)
+
+	return s.reviewHeldPayment(
+		ctx, tracer, req,
+		reviewStatusApproving, reviewStatusApproved,
+		tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_POST_PENDING,
+		lib.EVENT_TB_POST_PENDING_TRANSFER,
+		lib.ErrPendingTransferAlreadyPosted,
+	)
+}
+
+func (s *PaymentServiceServer) RejectHeldPayment(ctx context.Context, req *pb.ReviewHeldPaymentRequest) (*pb.HeldPayment, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_TB_TRANSFER_ID, req.TransferId),
+		attribute.String(lib.ATTR_REVIEW_REVIEWER, req.Reviewer),
+		attribute.String(lib.ATTR_REVIEW_STATUS, reviewStatusRejected),
+	)
+
+	return s.reviewHeldPayment(
+		ctx, tracer, req,
+		reviewStatusRejecting, reviewStatusRejected,
+		tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_VOID_PENDING,
+		lib.EVENT_TB_VOID_PENDING_TRANSFER,
+		lib.ErrPendingTransferAlreadyVoided,
+	)
+}
+
+// runHeldPaymentWorker rejects held payments that waited longer than the
+// configured maximum age, so a review that never happens does not keep the
+// payer's funds on hold for good.
+func (s *PaymentServiceServer) runHeldPaymentWorker(ctx context.Context) {
+	ticker := time.NewTicker(heldPaymentWorkerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweepExpiredHeldPayments(ctx)
+		}
+	}
+}
+
+func (s *PaymentServiceServer) sweepExpiredHeldPayments(ctx context.Context) {
+	tracer := otel.Tracer(lib.ServiceName)
+
+	ctx, sweepSpan := tracer.Start(ctx, lib.EVENT_REVIEW_SWEEP)
+	defer sweepSpan.End()
+
+	sweepSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryGetExpiredHeldPayments),
+	)
+
+	payments, err := repo.GetExpiredHeldPayments(ctx, s.db, s.config.HeldPaymentMaxAge, heldPaymentWorkerBatchSize)
+	if err != nil {
+		sweepSpan.RecordError(err)
+		return
+	}
+
+	sweepSpan.SetAttributes(
+		attribute.Int(lib.ATTR_REVIEW_COUNT, len(payments)),
+	)
+
+	for _, payment := range payments {
+		req := &pb.ReviewHeldPaymentRequest{
+			TransferId: payment.TigerbeetleTransferId,
+			Reviewer:   expiryReviewer,
+		}
+		_, err := s.reviewHeldPayment(
+			ctx, tracer, req,
+			reviewStatusRejecting, reviewStatusRejected,
+			tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_VOID_PENDING,
+			lib.EVENT_TB_VOID_PENDING_TRANSFER,
+			lib.ErrPendingTransferAlreadyVoided,
+		)
+		if err != nil && err != lib.ErrAlreadyReviewed {
+			slog.Error("Failed to reject expired held payment", "transfer", payment.TigerbeetleTransferId, "error", err)
+		}
+	}
+}
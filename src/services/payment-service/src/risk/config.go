@@ -0,0 +1,56 @@
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type ruleConfig struct {
+	Name    string          `json:"name"`
+	Type    string          `json:"type"`
+	Verdict string          `json:"verdict"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rulesFile struct {
+	Rules []ruleConfig `json:"rules"`
+}
+
+func LoadEngine(path string) (*Engine, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rules file: %w", err)
+	}
+
+	file := rulesFile{}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("parse rules file: %w", err)
+	}
+
+	rules := make([]ConfiguredRule, len(file.Rules))
+	for i, config := range file.Rules {
+		factory, ok := ruleFactories[config.Type]
+		if !ok {
+			return nil, fmt.Errorf("rule %s: unknown type %q", config.Name, config.Type)
+		}
+
+		verdict, err := ParseVerdict(config.Verdict)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", config.Name, err)
+		}
+
+		rule, err := factory(config.Params)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", config.Name, err)
+		}
+
+		rules[i] = ConfiguredRule{
+			Name:    config.Name,
+			Verdict: verdict,
+			Rule:    rule,
+		}
+	}
+
+	return NewEngine(rules), nil
+}
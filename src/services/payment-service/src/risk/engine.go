@@ -0,0 +1,113 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type Verdict int
+
+const (
+	VerdictAllow Verdict = iota
+	VerdictHold
+	VerdictBlock
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case VerdictHold:
+		return "hold"
+	case VerdictBlock:
+		return "block"
+	default:
+		return "allow"
+	}
+}
+
+func ParseVerdict(verdict string) (Verdict, error) {
+	switch verdict {
+	case "allow":
+		return VerdictAllow, nil
+	case "hold":
+		return VerdictHold, nil
+	case "block":
+		return VerdictBlock, nil
+	default:
+		return VerdictAllow, fmt.Errorf("unknown verdict %q", verdict)
+	}
+}
+
+type Payment struct {
+	FromUserId string
+	ToUserId   string
+	Amount     uint64
+}
+
+type Session struct {
+	CreatedAt   time.Time
+	Device      string
+	KnownDevice bool
+}
+
+type PaymentHistory interface {
+	CountPaymentsToCounterparty(ctx context.Context, fromUserId, toUserId string) (uint64, error)
+	CountRecentPayments(ctx context.Context, fromUserId string, window time.Duration) (uint64, error)
+}
+
+type SessionSource interface {
+	// LatestSession returns nil when the user has never logged in.
+	LatestSession(ctx context.Context, userId string) (*Session, error)
+}
+
+type Environment struct {
+	History  PaymentHistory
+	Sessions SessionSource
+	Now      time.Time
+}
+
+type Rule interface {
+	Matches(ctx context.Context, env Environment, payment Payment) (bool, error)
+}
+
+type ConfiguredRule struct {
+	Name    string
+	Verdict Verdict
+	Rule    Rule
+}
+
+type Result struct {
+	Verdict        Verdict
+	TriggeredRules []string
+}
+
+type Engine struct {
+	rules []ConfiguredRule
+}
+
+func NewEngine(rules []ConfiguredRule) *Engine {
+	return &Engine{rules: rules}
+}
+
+// Evaluate runs every rule and returns the most severe verdict along with the
+// names of all rules that matched.
+func (e *Engine) Evaluate(ctx context.Context, env Environment, payment Payment) (Result, error) {
+	result := Result{Verdict: VerdictAllow}
+
+	for _, rule := range e.rules {
+		matches, err := rule.Rule.Matches(ctx, env, payment)
+		if err != nil {
+			return Result{}, fmt.Errorf("evaluate rule %s: %w", rule.Name, err)
+		}
+		if !matches {
+			continue
+		}
+
+		result.TriggeredRules = append(result.TriggeredRules, rule.Name)
+		if rule.Verdict > result.Verdict {
+			result.Verdict = rule.Verdict
+		}
+	}
+
+	return result, nil
+}
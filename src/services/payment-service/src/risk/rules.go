@@ -0,0 +1,135 @@
+package risk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type RuleFactory func(params json.RawMessage) (Rule, error)
+
+var ruleFactories = map[string]RuleFactory{
+	"amount":           newAmountRule,
+	"new_counterparty": newCounterpartyRule,
+	"velocity":         newVelocityRule,
+	"new_session":      newSessionRule,
+}
+
+// RegisterRule makes a rule type available to rule configuration files.
+func RegisterRule(ruleType string, factory RuleFactory) {
+	ruleFactories[ruleType] = factory
+}
+
+func decodeParams(params json.RawMessage, target any) error {
+	if len(params) == 0 {
+		return nil
+	}
+	return json.Unmarshal(params, target)
+}
+
+type amountRule struct {
+	MinAmount uint64 `json:"min_amount"`
+}
+
+func newAmountRule(params json.RawMessage) (Rule, error) {
+	rule := &amountRule{}
+	if err := decodeParams(params, rule); err != nil {
+		return nil, err
+	}
+	if rule.MinAmount == 0 {
+		return nil, fmt.Errorf("min_amount is required")
+	}
+	return rule, nil
+}
+
+func (r *amountRule) Matches(_ context.Context, _ Environment, payment Payment) (bool, error) {
+	return payment.Amount >= r.MinAmount, nil
+}
+
+type counterpartyRule struct {
+	MinAmount uint64 `json:"min_amount"`
+}
+
+func newCounterpartyRule(params json.RawMessage) (Rule, error) {
+	rule := &counterpartyRule{}
+	if err := decodeParams(params, rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (r *counterpartyRule) Matches(ctx context.Context, env Environment, payment Payment) (bool, error) {
+	if payment.Amount < r.MinAmount {
+		return false, nil
+	}
+
+	count, err := env.History.CountPaymentsToCounterparty(ctx, payment.FromUserId, payment.ToUserId)
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+type velocityRule struct {
+	WindowMinutes uint64 `json:"window_minutes"`
+	MaxCount      uint64 `json:"max_count"`
+}
+
+func newVelocityRule(params json.RawMessage) (Rule, error) {
+	rule := &velocityRule{}
+	if err := decodeParams(params, rule); err != nil {
+		return nil, err
+	}
+	if rule.WindowMinutes == 0 || rule.MaxCount == 0 {
+		return nil, fmt.Errorf("window_minutes and max_count are required")
+	}
+	return rule, nil
+}
+
+func (r *velocityRule) Matches(ctx context.Context, env Environment, payment Payment) (bool, error) {
+	window := time.Duration(r.WindowMinutes) * time.Minute
+
+	count, err := env.History.CountRecentPayments(ctx, payment.FromUserId, window)
+	if err != nil {
+		return false, err
+	}
+	return count >= r.MaxCount, nil
+}
+
+type sessionRule struct {
+	WindowMinutes     uint64 `json:"window_minutes"`
+	MinAmount         uint64 `json:"min_amount"`
+	UnknownDeviceOnly bool   `json:"unknown_device_only"`
+}
+
+func newSessionRule(params json.RawMessage) (Rule, error) {
+	rule := &sessionRule{}
+	if err := decodeParams(params, rule); err != nil {
+		return nil, err
+	}
+	if rule.WindowMinutes == 0 {
+		return nil, fmt.Errorf("window_minutes is required")
+	}
+	return rule, nil
+}
+
+func (r *sessionRule) Matches(ctx context.Context, env Environment, payment Payment) (bool, error) {
+	if payment.Amount < r.MinAmount {
+		return false, nil
+	}
+
+	session, err := env.Sessions.LatestSession(ctx, payment.FromUserId)
+	if err != nil {
+		return false, err
+	}
+	if session == nil {
+		return false, nil
+	}
+	if r.UnknownDeviceOnly && session.KnownDevice {
+		return false, nil
+	}
+
+	window := time.Duration(r.WindowMinutes) * time.Minute
+	return env.Now.Sub(session.CreatedAt) <= window, nil
+}
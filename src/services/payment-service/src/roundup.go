@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"payment-service/src/lib"
+	"payment-service/src/repo"
+	pb "protobufs/gen/go/payment-service"
+	userPb "protobufs/gen/go/user-service"
+
+	"github.com/jmoiron/sqlx"
+
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func (s *PaymentServiceServer) userHasOpenPot(ctx context.Context, userId, potId string) (bool, error) {
+	pots, err := s.userServiceClient.ListPots(ctx, &userPb.ListPotsRequest{
+		UserId: userId,
+	})
+	if err != nil {
+		slog.Error("Failed to list pots", "error", err)
+		return false, lib.ErrUnexpected
+	}
+
+	return slices.ContainsFunc(pots.Pots, func(pot *userPb.Pot) bool {
+		return pot.PotId == potId
+	}), nil
+}
+
+// prepareRoundUp returns the user's round-up rule and the amount to set aside
+// for this payment, or a nil rule when nothing should be rounded up.
+func (s *PaymentServiceServer) prepareRoundUp(ctx context.Context, tracer oteltrace.Tracer, userId string, amount uint64) (*repo.RoundUpRule, uint64, error) {
+	ctx, roundUpSpan := tracer.Start(ctx, lib.EVENT_ROUND_UP_PREPARE)
+	defer roundUpSpan.End()
+
+	rule, err := repo.GetRoundUpRule(ctx, s.db, userId)
+	if err != nil {
+		roundUpSpan.RecordError(err)
+		return nil, 0, err
+	}
+	if rule == nil || !rule.Enabled {
+		return nil, 0, nil
+	}
+
+	roundUpAmount := lib.RoundUpAmount(amount, uint32(rule.RoundTo), uint32(rule.Multiplier))
+	if roundUpAmount == 0 {
+		return nil, 0, nil
+	}
+
+	roundUpSpan.SetAttributes(
+		attribute.String(lib.ATTR_ROUND_UP_POT_ID, rule.PotId),
+		attribute.Int64(lib.ATTR_ROUND_UP_AMOUNT, int64(roundUpAmount)),
+	)
+
+	hasPot, err := s.userHasOpenPot(ctx, userId, rule.PotId)
+	if err != nil {
+		roundUpSpan.RecordError(err)
+		return nil, 0, err
+	}
+	if !hasPot {
+		roundUpSpan.AddEvent(lib.EVENT_ROUND_UP_POT_MISSING)
+		return nil, 0, nil
+	}
+
+	return rule, roundUpAmount, nil
+}
+
+func (s *PaymentServiceServer) recordRoundUp(ctx context.Context, tracer oteltrace.Tracer, db sqlx.ExecerContext, transferId, paymentTransferId, userId, potId string, amount uint64) error {
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_ROUND_UP_RECORD)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryInsertRoundUp),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferId, paymentTransferId, userId, potId}),
+	)
+
+	err := repo.CreateRoundUp(ctx, db, transferId, paymentTransferId, userId, potId, amount)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *PaymentServiceServer) SetRoundUpRule(ctx context.Context, req *pb.SetRoundUpRuleRequest) (*pb.RoundUpRule, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_ROUND_UP_POT_ID, req.PotId),
+	)
+
+	multiplier := uint32(lib.DefaultRoundUpMultiplier)
+	if req.Multiplier != nil {
+		multiplier = *req.Multiplier
+	}
+
+	err := lib.ValidateRoundUpRule(req.RoundTo, multiplier)
+	if err != nil {
+		span.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "roundTo"),
+		))
+		return nil, err
+	}
+
+	hasPot, err := s.userHasOpenPot(ctx, req.UserId, req.PotId)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if !hasPot {
+		span.AddEvent(lib.EVENT_ROUND_UP_POT_MISSING)
+		return nil, lib.ErrNotFound
+	}
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_ROUND_UP_RULE_SET)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryUpsertRoundUpRule),
+	)
+
+	rule, err := repo.SetRoundUpRule(ctx, s.db, req.UserId, req.PotId, req.RoundTo, multiplier, req.Enabled)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	dbSpan.End()
+
+	return repo.DbRoundUpRuleToPb(rule), nil
+}
+
+func (s *PaymentServiceServer) GetRoundUpRule(ctx context.Context, req *pb.GetRoundUpRuleRequest) (*pb.RoundUpRule, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_ROUND_UP_RULE_GET)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryGetRoundUpRule),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	rule, err := repo.GetRoundUpRule(ctx, s.db, req.UserId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	if rule == nil {
+		return nil, lib.ErrNotFound
+	}
+	dbSpan.End()
+
+	return repo.DbRoundUpRuleToPb(*rule), nil
+}
+
+func (s *PaymentServiceServer) GetRoundUpSummary(ctx context.Context, req *pb.GetRoundUpSummaryRequest) (*pb.RoundUpSummary, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	start, end, err := lib.ParseRoundUpSummaryMonth(req.Month, time.Now().UTC())
+	if err != nil {
+		span.AddEvent(lib.EVENT_VALIDATION_FAILED, oteltrace.WithAttributes(
+			attribute.String("field", "month"),
+		))
+		return nil, err
+	}
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_ROUND_UP_SUMMARY)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, lib.QueryGetRoundUpSummary),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId, start.Format(time.RFC3339), end.Format(time.RFC3339)}),
+	)
+
+	summary, err := repo.GetRoundUpSummary(ctx, s.db, req.UserId, start, end)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	dbSpan.End()
+
+	return &pb.RoundUpSummary{
+		Month:        start.Format(lib.RoundUpSummaryMonthLayout),
+		TotalSaved:   uint64(summary.TotalSaved),
+		RoundUpCount: uint32(summary.RoundUpCount),
+	}, nil
+}
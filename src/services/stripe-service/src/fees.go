@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	paymentPb "protobufs/gen/go/payment-service"
+	"stripe-service/src/lib"
+	"stripe-service/src/queries"
+	"stripe-service/src/repo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// quoteFee prices a deposit or payout from the user's payment limit tier in
+// the fee schedule. The tier is owned by payment-service.
+func (s *StripeServiceServer) quoteFee(ctx context.Context, tracer trace.Tracer, flow, userId, amount string) (uint64, error) {
+	ctx, feeSpan := tracer.Start(ctx, lib.EVENT_FEE_QUOTE)
+	defer feeSpan.End()
+
+	amountUint64, err := lib.ParseAmount(amount)
+	if err != nil {
+		feeSpan.RecordError(err)
+		return 0, lib.ErrUnacceptableRequest
+	}
+
+	limits, err := s.paymentService.GetPaymentLimits(ctx, &paymentPb.GetPaymentLimitsRequest{UserId: userId})
+	if err != nil {
+		feeSpan.RecordError(err)
+		return 0, lib.ErrUnexpected
+	}
+
+	fee := s.feeSchedule.Rule(flow, limits.Tier).Fee(amountUint64)
+
+	feeSpan.SetAttributes(
+		attribute.String(lib.ATTR_FEE_FLOW, flow),
+		attribute.String(lib.ATTR_FEE_TIER, limits.Tier),
+		attribute.Int64(lib.ATTR_FEE_AMOUNT, int64(fee)),
+	)
+	feeSpan.End()
+
+	return fee, nil
+}
+
+func (s *StripeServiceServer) recordFee(ctx context.Context, tracer trace.Tracer, feeTransferId, transferId, userId, flow string, fee uint64) error {
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_FEE_RECORD)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryInsertFee),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{feeTransferId, transferId, userId, flow}),
+	)
+
+	_, err := s.db.ExecContext(ctx, queries.QueryInsertFee, feeTransferId, transferId, userId, flow, int64(fee))
+	if err != nil {
+		dbSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+	dbSpan.End()
+
+	return nil
+}
+
+// getFeeForTransfer returns the fee charged alongside the transfer, or nil
+// when the transfer was free.
+func (s *StripeServiceServer) getFeeForTransfer(ctx context.Context, tracer trace.Tracer, transferId string) (*repo.Fee, error) {
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_FEE_GET)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetFeeForTransfer),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferId}),
+	)
+
+	fee := repo.Fee{}
+	err := s.db.GetContext(ctx, &fee, queries.QueryGetFeeForTransfer, transferId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		dbSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_FEE_TRANSFER_ID, fee.TigerbeetleTransferId),
+	)
+	dbSpan.End()
+
+	return &fee, nil
+}
@@ -0,0 +1,21 @@
+package lib
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// ParseAmount converts a hex encoded ledger amount into minor units.
+func ParseAmount(amount string) (uint64, error) {
+	value, ok := new(big.Int).SetString(amount, 16)
+	if !ok || value.Sign() < 0 || !value.IsUint64() {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	return value.Uint64(), nil
+}
+
+// FormatAmount encodes minor units the way the ledger expects amounts.
+func FormatAmount(amount uint64) string {
+	return strconv.FormatUint(amount, 16)
+}
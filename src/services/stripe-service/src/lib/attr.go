@@ -1,7 +1,8 @@
 package lib
 
 const (
-	ATTR_USER_ID = "user.id"
+	ATTR_USER_ID    = "user.id"
+	ATTR_KYC_STATUS = "kyc.status"
 
 	ATTR_TB_TRANSFER_ID     = "tb.transfer.id"
 	ATTR_TB_TRANSFER_AMOUNT = "tb.transfer.amount"
@@ -11,6 +12,11 @@ const (
 	ATTR_STRIPE_PAYMENT_INTENT_ID = "stripe.payment_intent.id"
 	ATTR_STRIPE_PAYOUT_ID         = "stripe.payout.id"
 
+	ATTR_FEE_FLOW        = "fee.flow"
+	ATTR_FEE_TIER        = "fee.tier"
+	ATTR_FEE_AMOUNT      = "fee.amount"
+	ATTR_FEE_TRANSFER_ID = "fee.transfer.id"
+
 	ATTR_DB_QUERY         = "db.query"
 	ATTR_DB_ARGS          = "db.args"
 	ATTR_DB_ROWS_AFFECTED = "db.rows_affected"
@@ -18,6 +24,7 @@ const (
 
 const (
 	EVENT_TB_CREATE_TRANSFER         = "tb.transfer.create"
+	EVENT_TB_CREATE_LINKED_TRANSFERS = "tb.transfer.linked.create"
 	EVENT_TB_CREATE_PENDING_TRANSFER = "tb.transfer.pending.create"
 	EVENT_TB_POST_PENDING_TRANSFER   = "tb.transfer.pending.post"
 	EVENT_TB_VOID_PENDING_TRANSFER   = "tb.transfer.pending.void"
@@ -38,4 +45,10 @@ const (
 	EVENT_PAYOUT_CREATE_PENDING = "payout.pending.create"
 	EVENT_PAYOUT_POST_PENDING   = "payout.pending.post"
 	EVENT_PAYOUT_VOID_PENDING   = "payout.pending.void"
+	EVENT_PAYOUT_KYC_CHECK      = "payout.kyc.check"
+	EVENT_PAYOUT_KYC_REQUIRED   = "payout.kyc.required"
+
+	EVENT_FEE_QUOTE  = "fee.quote"
+	EVENT_FEE_RECORD = "fee.record"
+	EVENT_FEE_GET    = "fee.get"
 )
@@ -13,8 +13,11 @@ const (
 type Configuration struct {
 	StripeServicePort        string
 	TigerbeetleServiceUrl    string
+	UserServiceUrl           string
+	PaymentServiceUrl        string
 	StripeServiceDatabaseDsn string
 	OtelExporterOtlpEndpoint string
+	FeeSchedulePath          string
 }
 
 func GetEnv(envName string) string {
@@ -29,7 +32,10 @@ func ParseConfiguration() *Configuration {
 	return &Configuration{
 		StripeServicePort:        GetEnv("STRIPE_SERVICE_PORT"),
 		TigerbeetleServiceUrl:    GetEnv("STRIPE_SERVICE_TIGERBEETLE_SERVICE_URL"),
+		UserServiceUrl:           GetEnv("STRIPE_SERVICE_USER_SERVICE_URL"),
+		PaymentServiceUrl:        GetEnv("STRIPE_SERVICE_PAYMENT_SERVICE_URL"),
 		StripeServiceDatabaseDsn: GetEnv("STRIPE_SERVICE_DATABASE_DSN"),
 		OtelExporterOtlpEndpoint: GetEnv("STRIPE_SERVICE_OTEL_EXPORTER_OTLP_ENDPOINT"),
+		FeeSchedulePath:          GetEnv("STRIPE_SERVICE_FEE_SCHEDULE_PATH"),
 	}
 }
@@ -7,4 +7,5 @@ var (
 	ErrNotFound            = errors.New("NOT_FOUND")
 	ErrUnacceptableRequest = errors.New("UNACCEPTABLE")
 	ErrConflict            = errors.New("CONFLICT")
+	ErrKycRequired         = errors.New("KYC_REQUIRED")
 )
@@ -6,9 +6,12 @@ import (
 	"log"
 	"log/slog"
 	"net"
+	paymentPb "protobufs/gen/go/payment-service"
 	pb "protobufs/gen/go/stripe-service"
 	tbPb "protobufs/gen/go/tigerbeetle-service"
+	userPb "protobufs/gen/go/user-service"
 
+	"fees"
 	"stripe-service/src/lib"
 
 	"github.com/jmoiron/sqlx"
@@ -31,6 +34,11 @@ type StripeServiceServer struct {
 	config                       *lib.Configuration
 	tigerbeetleService           tbPb.TigerbeetleServiceClient
 	tigerbeetleServiceConnection *grpc.ClientConn
+	userService                  userPb.UserServiceClient
+	userServiceConnection        *grpc.ClientConn
+	paymentService               paymentPb.PaymentServiceClient
+	paymentServiceConnection     *grpc.ClientConn
+	feeSchedule                  fees.FeeSchedule
 }
 
 func initTracer(config *lib.Configuration) func() {
@@ -86,11 +94,35 @@ func newServer(config *lib.Configuration) *StripeServiceServer {
 	client := tbPb.NewTigerbeetleServiceClient(conn)
 	log.Println("Connected to Tigerbeetle service grpc")
 
+	userConn, err := grpc.NewClient(config.UserServiceUrl, opts...)
+	if err != nil {
+		log.Fatalf("Failed to open User service grpc connection: %v", err)
+	}
+	userClient := userPb.NewUserServiceClient(userConn)
+	log.Println("Connected to User service grpc")
+
+	paymentConn, err := grpc.NewClient(config.PaymentServiceUrl, opts...)
+	if err != nil {
+		log.Fatalf("Failed to open Payment service grpc connection: %v", err)
+	}
+	paymentClient := paymentPb.NewPaymentServiceClient(paymentConn)
+	log.Println("Connected to Payment service grpc")
+
+	feeSchedule, err := fees.LoadFeeSchedule(config.FeeSchedulePath)
+	if err != nil {
+		log.Fatalf("Failed to load fee schedule: %v", err)
+	}
+
 	return &StripeServiceServer{
 		db:                           db,
 		config:                       config,
 		tigerbeetleServiceConnection: conn,
 		tigerbeetleService:           client,
+		userServiceConnection:        userConn,
+		userService:                  userClient,
+		paymentServiceConnection:     paymentConn,
+		paymentService:               paymentClient,
+		feeSchedule:                  feeSchedule,
 	}
 }
 
@@ -112,6 +144,8 @@ func main() {
 	server := newServer(config)
 	defer server.db.Close()
 	defer server.tigerbeetleServiceConnection.Close()
+	defer server.userServiceConnection.Close()
+	defer server.paymentServiceConnection.Close()
 
 	pb.RegisterStripeServiceServer(grpcServer, server)
 	slog.Info("Service ready to accept connections", "service", lib.ServiceName, "port", config.StripeServicePort)
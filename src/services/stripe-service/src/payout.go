@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"database/sql"
+	"fees"
 	pb "protobufs/gen/go/stripe-service"
 	tbPb "protobufs/gen/go/tigerbeetle-service"
+	userPb "protobufs/gen/go/user-service"
 	"stripe-service/src/lib"
 	"stripe-service/src/queries"
 	"stripe-service/src/repo"
@@ -13,27 +15,85 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
-func (s *StripeServiceServer) voidPendingTransferOnError(ctx context.Context, tracer trace.Tracer, userId, transferId, amount string) {
+// voidPendingTransfersOnError voids the pending legs of a payout whose
+// bookkeeping failed, so the held funds are released back to the user.
+func (s *StripeServiceServer) voidPendingTransfersOnError(ctx context.Context, tracer trace.Tracer, userId string, transfers []*tbPb.LinkedTransfer, transferIds []string) {
 	ctx, voidSpan := tracer.Start(ctx, lib.EVENT_TB_VOID_PENDING_TRANSFER)
 	defer voidSpan.End()
 
 	voidSpan.SetAttributes(
 		attribute.String(lib.ATTR_USER_ID, userId),
-		attribute.String(lib.ATTR_TB_TRANSFER_ID, transferId),
-		attribute.String(lib.ATTR_TB_TRANSFER_AMOUNT, amount),
+		attribute.StringSlice(lib.ATTR_TB_TRANSFER_ID, transferIds),
 	)
 
-	_, err := s.tigerbeetleService.VoidPendingTransfer(ctx, &tbPb.VoidPendingTransferRequest{
-		CreditAccountId:   userId,
-		DebitAccountId:    lib.SYSTEM_FLOAT_ACCOUNT_ID,
-		Amount:            amount,
-		PendingTransferId: transferId,
+	voids := make([]*tbPb.LinkedTransfer, len(transfers))
+	for i, transfer := range transfers {
+		voids[i] = &tbPb.LinkedTransfer{
+			CreditAccountId:   transfer.CreditAccountId,
+			DebitAccountId:    transfer.DebitAccountId,
+			Amount:            transfer.Amount,
+			Kind:              tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_VOID_PENDING,
+			PendingTransferId: &transferIds[i],
+		}
+	}
+
+	_, err := s.tigerbeetleService.CreateLinkedTransfers(ctx, &tbPb.CreateLinkedTransfersRequest{
+		Transfers: voids,
 	})
 	if err != nil {
 		voidSpan.RecordError(err)
 	}
 }
 
+// payoutTransfers returns the legs that post or void a pending payout together
+// with the fee that was put on hold alongside it.
+func (s *StripeServiceServer) payoutTransfers(ctx context.Context, tracer trace.Tracer, payout repo.Payout, amount string, kind tbPb.LinkedTransferKind) ([]*tbPb.LinkedTransfer, error) {
+	transfers := []*tbPb.LinkedTransfer{
+		{
+			CreditAccountId:   payout.UserId,
+			DebitAccountId:    lib.SYSTEM_FLOAT_ACCOUNT_ID,
+			Amount:            amount,
+			Kind:              kind,
+			PendingTransferId: &payout.TigerbeetleTransferId,
+		},
+	}
+
+	fee, err := s.getFeeForTransfer(ctx, tracer, payout.TigerbeetleTransferId)
+	if err != nil {
+		return nil, err
+	}
+	if fee != nil {
+		feeTransfer := fees.Leg(payout.UserId, uint64(fee.Amount), kind)
+		feeTransfer.PendingTransferId = &fee.TigerbeetleTransferId
+		transfers = append(transfers, feeTransfer)
+	}
+
+	return transfers, nil
+}
+
+// checkPayoutKyc only lets users whose identity is verified move money out.
+func (s *StripeServiceServer) checkPayoutKyc(ctx context.Context, tracer trace.Tracer, userId string) error {
+	ctx, kycSpan := tracer.Start(ctx, lib.EVENT_PAYOUT_KYC_CHECK)
+	defer kycSpan.End()
+
+	kyc, err := s.userService.GetKycStatus(ctx, &userPb.GetKycStatusRequest{UserId: userId})
+	if err != nil {
+		kycSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	kycSpan.SetAttributes(
+		attribute.String(lib.ATTR_KYC_STATUS, kyc.Status),
+	)
+
+	if !kyc.PayoutsAllowed {
+		kycSpan.AddEvent(lib.EVENT_PAYOUT_KYC_REQUIRED)
+		return lib.ErrKycRequired
+	}
+
+	return nil
+}
+
 func (s *StripeServiceServer) CreatePendingPayout(ctx context.Context, req *pb.CreatePendingPayoutRequest) (*pb.CreatePendingPayoutResponse, error) {
 	span := trace.SpanFromContext(ctx)
 	tracer := span.TracerProvider().Tracer(lib.ServiceName)
@@ -44,21 +104,43 @@ func (s *StripeServiceServer) CreatePendingPayout(ctx context.Context, req *pb.C
 		attribute.String(lib.ATTR_TB_TRANSFER_AMOUNT, req.Amount),
 	)
 
+	err := s.checkPayoutKyc(ctx, tracer, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	fee, err := s.quoteFee(ctx, tracer, fees.FLOW_PAYOUT, req.UserId, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := []*tbPb.LinkedTransfer{
+		{
+			DebitAccountId:  lib.SYSTEM_FLOAT_ACCOUNT_ID,
+			CreditAccountId: req.UserId,
+			Amount:          req.Amount,
+			Kind:            tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_PENDING,
+		},
+	}
+	if fee > 0 {
+		transfers = append(transfers, fees.Leg(req.UserId, fee, tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_PENDING))
+	}
+
 	ctx, tbSpan := tracer.Start(ctx, lib.EVENT_TB_CREATE_PENDING_TRANSFER)
 	defer tbSpan.End()
 
-	transferResp, err := s.tigerbeetleService.CreatePendingTransfer(ctx, &tbPb.CreatePendingRequest{
-		DebitAccountId:  lib.SYSTEM_FLOAT_ACCOUNT_ID,
-		CreditAccountId: req.UserId,
-		Amount:          req.Amount,
+	transferResp, err := s.tigerbeetleService.CreateLinkedTransfers(ctx, &tbPb.CreateLinkedTransfersRequest{
+		Transfers: transfers,
 	})
 	if err != nil {
 		tbSpan.RecordError(err)
 		return nil, err
 	}
 
+	transferId := transferResp.TransferIds[0]
+
 	tbSpan.SetAttributes(
-		attribute.String(lib.ATTR_TB_TRANSFER_ID, transferResp.TransferId),
+		attribute.String(lib.ATTR_TB_TRANSFER_ID, transferId),
 	)
 
 	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_PAYOUT_CREATE_PENDING)
@@ -66,28 +148,42 @@ func (s *StripeServiceServer) CreatePendingPayout(ctx context.Context, req *pb.C
 
 	dbSpan.SetAttributes(
 		attribute.String(lib.ATTR_DB_QUERY, queries.QueryCreatePendingPayout),
-		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferResp.TransferId, req.StripeAccountId, req.UserId}),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{transferId, req.StripeAccountId, req.UserId}),
 	)
 
-	result, err := s.db.ExecContext(ctx, queries.QueryCreatePendingPayout, transferResp.TransferId, req.StripeAccountId, req.UserId)
+	result, err := s.db.ExecContext(ctx, queries.QueryCreatePendingPayout, transferId, req.StripeAccountId, req.UserId)
 	if err != nil {
 		dbSpan.RecordError(err)
-		s.voidPendingTransferOnError(ctx, tracer, req.UserId, transferResp.TransferId, req.Amount)
+		s.voidPendingTransfersOnError(ctx, tracer, req.UserId, transfers, transferResp.TransferIds)
 		return nil, lib.ErrUnexpected
 	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		dbSpan.RecordError(err)
-		s.voidPendingTransferOnError(ctx, tracer, req.UserId, transferResp.TransferId, req.Amount)
+		s.voidPendingTransfersOnError(ctx, tracer, req.UserId, transfers, transferResp.TransferIds)
 		return nil, lib.ErrUnexpected
 	}
 	span.SetAttributes(
 		attribute.Int64(lib.ATTR_DB_ROWS_AFFECTED, rowsAffected),
 	)
 
-	return &pb.CreatePendingPayoutResponse{
-		TigerbeetleTransferId: transferResp.TransferId,
-	}, nil
+	resp := &pb.CreatePendingPayoutResponse{
+		TigerbeetleTransferId: transferId,
+	}
+
+	if fee > 0 {
+		feeTransferId := transferResp.TransferIds[1]
+		err = s.recordFee(ctx, tracer, feeTransferId, transferId, req.UserId, fees.FLOW_PAYOUT, fee)
+		if err != nil {
+			s.voidPendingTransfersOnError(ctx, tracer, req.UserId, transfers, transferResp.TransferIds)
+			return nil, err
+		}
+		feeAmount := lib.FormatAmount(fee)
+		resp.FeeAmount = &feeAmount
+		resp.FeeTransferId = &feeTransferId
+	}
+
+	return resp, nil
 }
 
 func (s *StripeServiceServer) PostPendingPayout(ctx context.Context, req *pb.PostPendingPayoutRequest) (*pb.Empty, error) {
@@ -133,11 +229,14 @@ func (s *StripeServiceServer) PostPendingPayout(ctx context.Context, req *pb.Pos
 		attribute.String(lib.ATTR_TB_TRANSFER_AMOUNT, req.Amount),
 	)
 
-	_, err = s.tigerbeetleService.PostPendingTransfer(ctx, &tbPb.PostPendingTransferRequest{
-		CreditAccountId:   payout.UserId,
-		DebitAccountId:    lib.SYSTEM_FLOAT_ACCOUNT_ID,
-		PendingTransferId: payout.TigerbeetleTransferId,
-		Amount:            req.Amount,
+	transfers, err := s.payoutTransfers(ctx, tracer, payout, req.Amount, tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_POST_PENDING)
+	if err != nil {
+		tbSpan.RecordError(err)
+		return nil, err
+	}
+
+	_, err = s.tigerbeetleService.CreateLinkedTransfers(ctx, &tbPb.CreateLinkedTransfersRequest{
+		Transfers: transfers,
 	})
 	if err != nil {
 		tbSpan.RecordError(err)
@@ -220,11 +319,14 @@ func (s *StripeServiceServer) VoidPendingPayout(ctx context.Context, req *pb.Voi
 		attribute.String(lib.ATTR_TB_TRANSFER_AMOUNT, req.Amount),
 	)
 
-	_, err = s.tigerbeetleService.VoidPendingTransfer(ctx, &tbPb.VoidPendingTransferRequest{
-		CreditAccountId:   payout.UserId,
-		DebitAccountId:    lib.SYSTEM_FLOAT_ACCOUNT_ID,
-		Amount:            req.Amount,
-		PendingTransferId: payout.TigerbeetleTransferId,
+	transfers, err := s.payoutTransfers(ctx, tracer, payout, req.Amount, tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_VOID_PENDING)
+	if err != nil {
+		tbSpan.RecordError(err)
+		return nil, err
+	}
+
+	_, err = s.tigerbeetleService.CreateLinkedTransfers(ctx, &tbPb.CreateLinkedTransfersRequest{
+		Transfers: transfers,
 	})
 	if err != nil {
 		tbSpan.RecordError(err)
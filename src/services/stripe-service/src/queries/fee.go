@@ -0,0 +1,14 @@
+package queries
+
+var (
+	QueryInsertFee = `
+		insert into banking.fees (tigerbeetle_transfer_id, transfer_id, user_id, flow, amount)
+		values ($1, $2, $3, $4, $5)
+	`
+
+	QueryGetFeeForTransfer = `
+		select tigerbeetle_transfer_id, amount
+		from banking.fees
+		where transfer_id = $1
+	`
+)
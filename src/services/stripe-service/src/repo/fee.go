@@ -0,0 +1,6 @@
+package repo
+
+type Fee struct {
+	TigerbeetleTransferId string `db:"tigerbeetle_transfer_id"`
+	Amount                int64  `db:"amount"`
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"fees"
 	pb "protobufs/gen/go/stripe-service"
 	tbPb "protobufs/gen/go/tigerbeetle-service"
 	"stripe-service/src/lib"
@@ -170,7 +171,7 @@ func (s *StripeServiceServer) VoidPendingTransfer(ctx context.Context, req *pb.V
 	return &pb.Empty{}, nil
 }
 
-func (s *StripeServiceServer) CreateAndPostTransfer(ctx context.Context, req *pb.CreateAndPostTransferRequest) (*pb.Empty, error) {
+func (s *StripeServiceServer) CreateAndPostTransfer(ctx context.Context, req *pb.CreateAndPostTransferRequest) (*pb.CreateAndPostTransferResponse, error) {
 	span := trace.SpanFromContext(ctx)
 	tracer := span.TracerProvider().Tracer(lib.ServiceName)
 
@@ -181,7 +182,23 @@ func (s *StripeServiceServer) CreateAndPostTransfer(ctx context.Context, req *pb
 		attribute.String(lib.ATTR_TB_TRANSFER_AMOUNT, req.Amount),
 	)
 
-	ctx, tbSpan := tracer.Start(ctx, lib.EVENT_TB_CREATE_TRANSFER)
+	fee, err := s.quoteFee(ctx, tracer, fees.FLOW_DEPOSIT, req.UserId, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := []*tbPb.LinkedTransfer{
+		{
+			CreditAccountId: lib.SYSTEM_FLOAT_ACCOUNT_ID,
+			DebitAccountId:  req.UserId,
+			Amount:          req.Amount,
+		},
+	}
+	if fee > 0 {
+		transfers = append(transfers, fees.Leg(req.UserId, fee, tbPb.LinkedTransferKind_LINKED_TRANSFER_KIND_POSTED))
+	}
+
+	ctx, tbSpan := tracer.Start(ctx, lib.EVENT_TB_CREATE_LINKED_TRANSFERS)
 	defer tbSpan.End()
 
 	tbSpan.SetAttributes(
@@ -191,18 +208,18 @@ func (s *StripeServiceServer) CreateAndPostTransfer(ctx context.Context, req *pb
 		attribute.String(lib.ATTR_TB_TRANSFER_AMOUNT, req.Amount),
 	)
 
-	transfer, err := s.tigerbeetleService.CreateTransfer(ctx, &tbPb.CreateTransferRequest{
-		CreditAccountId: lib.SYSTEM_FLOAT_ACCOUNT_ID,
-		DebitAccountId:  req.UserId,
-		Amount:          req.Amount,
+	transferResp, err := s.tigerbeetleService.CreateLinkedTransfers(ctx, &tbPb.CreateLinkedTransfersRequest{
+		Transfers: transfers,
 	})
 	if err != nil {
 		tbSpan.RecordError(err)
 		return nil, lib.ErrUnexpected
 	}
 
+	transferId := transferResp.TransferIds[0]
+
 	tbSpan.SetAttributes(
-		attribute.String(lib.ATTR_TB_TRANSFER_ID, transfer.TransferId),
+		attribute.String(lib.ATTR_TB_TRANSFER_ID, transferId),
 	)
 	tbSpan.End()
 
@@ -211,17 +228,32 @@ func (s *StripeServiceServer) CreateAndPostTransfer(ctx context.Context, req *pb
 
 	dbSpan.SetAttributes(
 		attribute.String(lib.ATTR_DB_QUERY, queries.QueryCreateAndPostTransfer),
-		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.StripePaymentIntentId, transfer.TransferId, req.StripeCustomerId, req.UserId}),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.StripePaymentIntentId, transferId, req.StripeCustomerId, req.UserId}),
 	)
 
-	_, err = s.db.ExecContext(ctx, queries.QueryCreateAndPostTransfer, req.StripePaymentIntentId, transfer.TransferId, req.StripeCustomerId, req.UserId)
+	_, err = s.db.ExecContext(ctx, queries.QueryCreateAndPostTransfer, req.StripePaymentIntentId, transferId, req.StripeCustomerId, req.UserId)
 	if err != nil {
 		dbSpan.RecordError(err)
 		return nil, lib.ErrUnexpected
 	}
 	dbSpan.End()
 
-	return &pb.Empty{}, nil
+	resp := &pb.CreateAndPostTransferResponse{
+		TigerbeetleTransferId: transferId,
+	}
+
+	if fee > 0 {
+		feeTransferId := transferResp.TransferIds[1]
+		err = s.recordFee(ctx, tracer, feeTransferId, transferId, req.UserId, fees.FLOW_DEPOSIT, fee)
+		if err != nil {
+			return nil, err
+		}
+		feeAmount := lib.FormatAmount(fee)
+		resp.FeeAmount = &feeAmount
+		resp.FeeTransferId = &feeTransferId
+	}
+
+	return resp, nil
 }
 
 func (s *StripeServiceServer) CreatePendingTransfer(ctx context.Context, req *pb.CreatePendingTransferRequest) (*pb.Empty, error) {
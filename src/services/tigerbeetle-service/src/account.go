@@ -13,19 +13,39 @@ import (
 	tbt "github.com/tigerbeetle/tigerbeetle-go/pkg/types"
 )
 
+// System accounts live outside the user account id space and may run a
+// negative balance, so they are created without balance constraints.
+const (
+	systemFloatAccountId = 1
+	revenueAccountId     = 2
+)
+
+// amountMax lets balancing transfers take whatever is available and posts
+// the full amount of a pending transfer.
+var amountMax = tbt.BytesToUint128([16]byte{
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+})
+
 func (s *TigerbeetleServiceServer) EnsureSystemFloatAccountExists(ctx context.Context, _ *pb.Empty) (*pb.Empty, error) {
+	return s.ensureSystemAccountExists(ctx, systemFloatAccountId)
+}
+
+// EnsureRevenueAccountExists creates the account that collects fees charged
+// on deposits, payouts and payments.
+func (s *TigerbeetleServiceServer) EnsureRevenueAccountExists(ctx context.Context, _ *pb.Empty) (*pb.Empty, error) {
+	return s.ensureSystemAccountExists(ctx, revenueAccountId)
+}
+
+func (s *TigerbeetleServiceServer) ensureSystemAccountExists(ctx context.Context, accountId uint64) (*pb.Empty, error) {
 	span := trace.SpanFromContext(ctx)
 	tracer := span.TracerProvider().Tracer(lib.ServiceName)
 
 	_, createSpan := tracer.Start(ctx, lib.EVENT_TB_CREATE_ACCOUNT)
 	defer createSpan.End()
 
-	createSpan.SetAttributes(
-		attribute.String(lib.ATTR_TB_ACCOUNT_ID, "1"),
-	)
-
 	account := tbt.Account{
-		ID:          tbt.Uint128{1},
+		ID:          tbt.ToUint128(accountId),
 		UserData128: tbt.ToUint128(0),
 		UserData64:  0,
 		UserData32:  0,
@@ -35,6 +55,10 @@ func (s *TigerbeetleServiceServer) EnsureSystemFloatAccountExists(ctx context.Co
 		Timestamp:   0,
 	}
 
+	createSpan.SetAttributes(
+		attribute.String(lib.ATTR_TB_ACCOUNT_ID, account.ID.String()),
+	)
+
 	accountErrors, err := s.tbClient.CreateAccounts([]tbt.Account{account})
 	if err != nil {
 		log.Printf("Failed to create account: %v", err)
@@ -89,6 +113,51 @@ func (s *TigerbeetleServiceServer) LookupAccount(ctx context.Context, accountId
 	return ToPbAccount(accounts[0]), nil
 }
 
+// LookupAccounts looks up several accounts in one round trip. Accounts that
+// do not exist are left out of the response.
+func (s *TigerbeetleServiceServer) LookupAccounts(ctx context.Context, req *pb.AccountIds) (*pb.Accounts, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.StringSlice(lib.ATTR_TB_ACCOUNT_ID, req.AccountIds),
+	)
+
+	_, lookupSpan := tracer.Start(ctx, lib.EVENT_TB_LOOKUP_ACCOUNT)
+	defer lookupSpan.End()
+
+	if len(req.AccountIds) == 0 {
+		return &pb.Accounts{}, nil
+	}
+
+	accountIds := make([]tbt.Uint128, len(req.AccountIds))
+	for i, accountId := range req.AccountIds {
+		accountIdUint128, err := tbt.HexStringToUint128(accountId)
+		if err != nil {
+			lookupSpan.RecordError(err)
+			lookupSpan.AddEvent(lib.EVENT_VALIDATION_FAILED)
+			return nil, lib.ErrInvalidRequest
+		}
+		accountIds[i] = accountIdUint128
+	}
+
+	accounts, err := s.tbClient.LookupAccounts(accountIds)
+	if err != nil {
+		lookupSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	lookupSpan.End()
+
+	pbAccounts := make([]*pb.Account, len(accounts))
+	for i, account := range accounts {
+		pbAccounts[i] = ToPbAccount(account)
+	}
+
+	return &pb.Accounts{
+		Accounts: pbAccounts,
+	}, nil
+}
+
 func (s *TigerbeetleServiceServer) CreateAccount(ctx context.Context, _ *pb.Empty) (*pb.AccountId, error) {
 	span := trace.SpanFromContext(ctx)
 	tracer := span.TracerProvider().Tracer(lib.ServiceName)
@@ -132,3 +201,176 @@ func (s *TigerbeetleServiceServer) CreateAccount(ctx context.Context, _ *pb.Empt
 
 	return &pb.AccountId{AccountId: accountId.String()}, nil
 }
+
+// CloseAccount closes the account with a zero amount pending transfer flagged
+// as closing debit. Closed accounts reject new transfers, and voiding the
+// returned transfer reopens the account.
+func (s *TigerbeetleServiceServer) CloseAccount(ctx context.Context, accountId *pb.AccountId) (*pb.TransferId, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_TB_ACCOUNT_ID, accountId.AccountId),
+	)
+
+	_, closeSpan := tracer.Start(ctx, lib.EVENT_TB_CLOSE_ACCOUNT)
+	defer closeSpan.End()
+
+	accountIdUint128, err := tbt.HexStringToUint128(accountId.AccountId)
+	if err != nil {
+		closeSpan.RecordError(err)
+		closeSpan.AddEvent(lib.EVENT_VALIDATION_FAILED)
+		return nil, lib.ErrInvalidRequest
+	}
+
+	transferFlags := tbt.TransferFlags{
+		Pending:      true,
+		ClosingDebit: true,
+	}
+
+	transfer := tbt.Transfer{
+		ID:              tbt.ID(),
+		DebitAccountID:  accountIdUint128,
+		CreditAccountID: tbt.ToUint128(systemFloatAccountId),
+		Amount:          tbt.ToUint128(0),
+		Ledger:          1,
+		Code:            1,
+		Flags:           transferFlags.ToUint16(),
+	}
+
+	closeSpan.SetAttributes(
+		attribute.String(lib.ATTR_TB_TRANSFER_ID, transfer.ID.String()),
+	)
+
+	transferErrors, err := s.tbClient.CreateTransfers([]tbt.Transfer{transfer})
+	if err != nil {
+		closeSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	for _, transferErr := range transferErrors {
+		switch transferErr.Result {
+		case tbt.TransferDebitAccountAlreadyClosed:
+			closeSpan.AddEvent(lib.EVENT_TB_ACCOUNT_CLOSED)
+			return nil, lib.ErrAccountClosed
+		case tbt.TransferDebitAccountNotFound:
+			closeSpan.AddEvent(lib.EVENT_TB_ACCOUNT_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		default:
+			closeSpan.AddEvent("tb.transfer.error", trace.WithAttributes(
+				attribute.String("error", transferErr.Result.String()),
+			))
+			return nil, lib.ErrUnexpected
+		}
+	}
+	closeSpan.End()
+
+	return &pb.TransferId{
+		TransferId: transfer.ID.String(),
+	}, nil
+}
+
+// SweepAndCloseAccount moves the whole balance of the account to the sweep
+// account and closes it in the same linked chain. The sweep is a pending
+// transfer flagged as balancing and closing credit, so it takes exactly what
+// is left even if the balance moved since the caller looked at it, and it is
+// posted straight away. Callers pass their own transfer id so a retry of a
+// sweep that was already applied succeeds without moving anything twice.
+func (s *TigerbeetleServiceServer) SweepAndCloseAccount(ctx context.Context, req *pb.SweepAndCloseAccountRequest) (*pb.TransferId, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_TB_ACCOUNT_ID, req.AccountId),
+		attribute.String(lib.ATTR_TB_DEBIT_ACCOUNT_ID, req.SweepAccountId),
+		attribute.String(lib.ATTR_TB_TRANSFER_ID, req.TransferId),
+	)
+
+	_, closeSpan := tracer.Start(ctx, lib.EVENT_TB_CLOSE_ACCOUNT)
+	defer closeSpan.End()
+
+	accountIdUint128, err := tbt.HexStringToUint128(req.AccountId)
+	if err != nil {
+		closeSpan.RecordError(err)
+		closeSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "accountId"),
+		))
+		return nil, lib.ErrInvalidRequest
+	}
+	sweepAccountIdUint128, err := tbt.HexStringToUint128(req.SweepAccountId)
+	if err != nil {
+		closeSpan.RecordError(err)
+		closeSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "sweepAccountId"),
+		))
+		return nil, lib.ErrInvalidRequest
+	}
+	transferIdUint128, err := tbt.HexStringToUint128(req.TransferId)
+	if err != nil {
+		closeSpan.RecordError(err)
+		closeSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "transferId"),
+		))
+		return nil, lib.ErrInvalidRequest
+	}
+
+	sweepFlags := tbt.TransferFlags{
+		Linked:          true,
+		Pending:         true,
+		BalancingCredit: true,
+		ClosingCredit:   true,
+	}
+	postFlags := tbt.TransferFlags{
+		PostPendingTransfer: true,
+	}
+
+	transfers := []tbt.Transfer{
+		{
+			ID:              transferIdUint128,
+			DebitAccountID:  sweepAccountIdUint128,
+			CreditAccountID: accountIdUint128,
+			Amount:          amountMax,
+			Ledger:          1,
+			Code:            1,
+			Flags:           sweepFlags.ToUint16(),
+		},
+		{
+			ID:        tbt.ID(),
+			PendingID: transferIdUint128,
+			Amount:    amountMax,
+			Flags:     postFlags.ToUint16(),
+		},
+	}
+
+	transferErrors, err := s.tbClient.CreateTransfers(transfers)
+	if err != nil {
+		closeSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	for _, transferErr := range transferErrors {
+		switch transferErr.Result {
+		case tbt.TransferLinkedEventFailed:
+			continue
+		case tbt.TransferExists:
+			closeSpan.AddEvent(lib.EVENT_TB_ACCOUNT_CLOSED)
+			return &pb.TransferId{
+				TransferId: req.TransferId,
+			}, nil
+		case tbt.TransferCreditAccountAlreadyClosed:
+			closeSpan.AddEvent(lib.EVENT_TB_ACCOUNT_CLOSED)
+			return nil, lib.ErrAccountClosed
+		case tbt.TransferCreditAccountNotFound, tbt.TransferDebitAccountNotFound:
+			closeSpan.AddEvent(lib.EVENT_TB_ACCOUNT_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		default:
+			closeSpan.AddEvent("tb.transfer.error", trace.WithAttributes(
+				attribute.String("error", transferErr.Result.String()),
+			))
+			return nil, lib.ErrUnexpected
+		}
+	}
+	closeSpan.End()
+
+	return &pb.TransferId{
+		TransferId: req.TransferId,
+	}, nil
+}
@@ -22,8 +22,11 @@ const (
 	EVENT_TB_LOOKUP_ACCOUNT    = "tb.account.lookup"
 	EVENT_TB_ACCOUNT_NOT_FOUND = "tb.account.not_found"
 	EVENT_TB_ACCOUNT_EXISTS    = "tb.account.exists"
+	EVENT_TB_CLOSE_ACCOUNT     = "tb.account.close"
+	EVENT_TB_ACCOUNT_CLOSED    = "tb.account.already_closed"
 
 	EVENT_TB_CREATE_TRANSFER         = "tb.transfer.create"
+	EVENT_TB_CREATE_LINKED_TRANSFERS = "tb.transfer.linked.create"
 	EVENT_TB_CREATE_PENDING_TRANSFER = "tb.transfer.pending.create"
 	EVENT_TB_POST_PENDING_TRANSFER   = "tb.transfer.pending.post"
 	EVENT_TB_VOID_PENDING_TRANSFER   = "tb.transfer.pending.void"
@@ -7,4 +7,9 @@ var (
 	ErrInvalidRequest = errors.New("INVALID_REQUEST")
 	ErrNotEnoughFunds = errors.New("NOT_ENOUGH_FUNDS")
 	ErrNotFound       = errors.New("NOT_FOUND")
+	ErrAccountClosed  = errors.New("ACCOUNT_CLOSED")
+
+	ErrPendingTransferAlreadyPosted = errors.New("PENDING_TRANSFER_ALREADY_POSTED")
+	ErrPendingTransferAlreadyVoided = errors.New("PENDING_TRANSFER_ALREADY_VOIDED")
+	ErrTransferExists               = errors.New("TRANSFER_EXISTS")
 )
@@ -94,6 +94,15 @@ func main() {
 	server := newServer(configuration)
 	defer server.tbClient.Close()
 
+	_, err = server.EnsureSystemFloatAccountExists(context.Background(), &pb.Empty{})
+	if err != nil {
+		log.Fatalf("Failed to set up the system float account: %v", err)
+	}
+	_, err = server.EnsureRevenueAccountExists(context.Background(), &pb.Empty{})
+	if err != nil {
+		log.Fatalf("Failed to set up the revenue account: %v", err)
+	}
+
 	pb.RegisterTigerbeetleServiceServer(grpcServer, server)
 	slog.Info("Service ready to accept connections", "service", lib.ServiceName, "port", configuration.TigerbeetleServicePort)
 	grpcServer.Serve(lis)
@@ -87,6 +87,144 @@ func (s *TigerbeetleServiceServer) CreateTransfer(ctx context.Context, req *pb.C
 	}, nil
 }
 
+// CreateLinkedTransfers submits the transfers as a single linked chain, so
+// either all of them are applied or none are. Legs may create, post or void
+// pending transfers alongside plain ones. Callers that need to retry a chain
+// safely pass their own transfer ids; resubmitting a chain that was already
+// applied then fails with lib.ErrTransferExists instead of applying it twice.
+func (s *TigerbeetleServiceServer) CreateLinkedTransfers(ctx context.Context, req *pb.CreateLinkedTransfersRequest) (*pb.TransferIds, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.Int(lib.ATTR_TB_TRANSFER_COUNT, len(req.Transfers)),
+	)
+
+	_, createSpan := tracer.Start(ctx, lib.EVENT_TB_CREATE_LINKED_TRANSFERS)
+	defer createSpan.End()
+
+	if len(req.Transfers) == 0 {
+		createSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "transfers"),
+		))
+		return nil, lib.ErrInvalidRequest
+	}
+
+	transfers := make([]tbt.Transfer, len(req.Transfers))
+	transferIds := make([]string, len(req.Transfers))
+	for i, transferReq := range req.Transfers {
+		debitAccountIdUint128, err := tbt.HexStringToUint128(transferReq.DebitAccountId)
+		if err != nil {
+			createSpan.RecordError(err)
+			createSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+				attribute.String("field", "debitAccountId"),
+			))
+			return nil, lib.ErrInvalidRequest
+		}
+		creditAccountIdUint128, err := tbt.HexStringToUint128(transferReq.CreditAccountId)
+		if err != nil {
+			createSpan.RecordError(err)
+			createSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+				attribute.String("field", "creditAccountId"),
+			))
+			return nil, lib.ErrInvalidRequest
+		}
+		amountUint128, err := tbt.HexStringToUint128(transferReq.Amount)
+		if err != nil {
+			createSpan.RecordError(err)
+			createSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+				attribute.String("field", "amount"),
+			))
+			return nil, lib.ErrInvalidRequest
+		}
+
+		transferFlags := tbt.TransferFlags{
+			Linked:              i < len(req.Transfers)-1,
+			Pending:             transferReq.Kind == pb.LinkedTransferKind_LINKED_TRANSFER_KIND_PENDING,
+			PostPendingTransfer: transferReq.Kind == pb.LinkedTransferKind_LINKED_TRANSFER_KIND_POST_PENDING,
+			VoidPendingTransfer: transferReq.Kind == pb.LinkedTransferKind_LINKED_TRANSFER_KIND_VOID_PENDING,
+		}
+
+		transfer := tbt.Transfer{
+			ID:              tbt.ID(),
+			DebitAccountID:  debitAccountIdUint128,
+			CreditAccountID: creditAccountIdUint128,
+			Amount:          amountUint128,
+			Flags:           transferFlags.ToUint16(),
+		}
+		if transferReq.TransferId != nil {
+			transferIdUint128, err := tbt.HexStringToUint128(*transferReq.TransferId)
+			if err != nil {
+				createSpan.RecordError(err)
+				createSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+					attribute.String("field", "transferId"),
+				))
+				return nil, lib.ErrInvalidRequest
+			}
+			transfer.ID = transferIdUint128
+		}
+
+		if transferFlags.PostPendingTransfer || transferFlags.VoidPendingTransfer {
+			if transferReq.PendingTransferId == nil {
+				createSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+					attribute.String("field", "pendingTransferId"),
+				))
+				return nil, lib.ErrInvalidRequest
+			}
+			pendingTransferIdUint128, err := tbt.HexStringToUint128(*transferReq.PendingTransferId)
+			if err != nil {
+				createSpan.RecordError(err)
+				createSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+					attribute.String("field", "pendingTransferId"),
+				))
+				return nil, lib.ErrInvalidRequest
+			}
+			transfer.PendingID = pendingTransferIdUint128
+		} else {
+			transfer.Ledger = 1
+			transfer.Code = 1
+		}
+
+		transfers[i] = transfer
+		transferIds[i] = transfer.ID.String()
+	}
+
+	createSpan.SetAttributes(
+		attribute.StringSlice(lib.ATTR_TB_TRANSFER_ID, transferIds),
+	)
+
+	transferErrors, err := s.tbClient.CreateTransfers(transfers)
+	if err != nil {
+		createSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	for _, transferErr := range transferErrors {
+		switch transferErr.Result {
+		case tbt.TransferLinkedEventFailed:
+			continue
+		case tbt.TransferExceedsDebits:
+			createSpan.AddEvent(lib.EVENT_TB_NOT_ENOUGH_FUNDS)
+			return nil, lib.ErrNotEnoughFunds
+		case tbt.TransferPendingTransferAlreadyPosted:
+			return nil, lib.ErrPendingTransferAlreadyPosted
+		case tbt.TransferPendingTransferAlreadyVoided:
+			return nil, lib.ErrPendingTransferAlreadyVoided
+		case tbt.TransferExists:
+			return nil, lib.ErrTransferExists
+		default:
+			createSpan.AddEvent("tb.transfer.error", trace.WithAttributes(
+				attribute.String("error", transferErr.Result.String()),
+			))
+			return nil, lib.ErrUnexpected
+		}
+	}
+	createSpan.End()
+
+	return &pb.TransferIds{
+		TransferIds: transferIds,
+	}, nil
+}
+
 func (s *TigerbeetleServiceServer) CreatePendingTransfer(ctx context.Context, req *pb.CreatePendingRequest) (*pb.TransferId, error) {
 	span := trace.SpanFromContext(ctx)
 	tracer := span.TracerProvider().Tracer(lib.ServiceName)
@@ -148,13 +286,17 @@ func (s *TigerbeetleServiceServer) CreatePendingTransfer(ctx context.Context, re
 		createSpan.RecordError(err)
 		return nil, lib.ErrUnexpected
 	}
-	if len(transferErrors) != 0 {
-		for _, transferErr := range transferErrors {
+	for _, transferErr := range transferErrors {
+		switch transferErr.Result {
+		case tbt.TransferExceedsDebits:
+			createSpan.AddEvent(lib.EVENT_TB_NOT_ENOUGH_FUNDS)
+			return nil, lib.ErrNotEnoughFunds
+		default:
 			createSpan.AddEvent("tb.transfer.error", trace.WithAttributes(
 				attribute.String("error", transferErr.Result.String()),
 			))
+			return nil, lib.ErrUnexpected
 		}
-		return nil, lib.ErrUnexpected
 	}
 	createSpan.End()
 
@@ -232,13 +374,18 @@ func (s *TigerbeetleServiceServer) PostPendingTransfer(ctx context.Context, req
 		postSpan.RecordError(err)
 		return nil, lib.ErrUnexpected
 	}
-	if len(transferErrors) != 0 {
-		for _, transferErr := range transferErrors {
+	for _, transferErr := range transferErrors {
+		switch transferErr.Result {
+		case tbt.TransferPendingTransferAlreadyPosted:
+			return nil, lib.ErrPendingTransferAlreadyPosted
+		case tbt.TransferPendingTransferAlreadyVoided:
+			return nil, lib.ErrPendingTransferAlreadyVoided
+		default:
 			postSpan.AddEvent("tb.transfer.error", trace.WithAttributes(
 				attribute.String("error", transferErr.Result.String()),
 			))
+			return nil, lib.ErrUnexpected
 		}
-		return nil, lib.ErrUnexpected
 	}
 	postSpan.End()
 
@@ -316,13 +463,18 @@ func (s *TigerbeetleServiceServer) VoidPendingTransfer(ctx context.Context, req
 		voidSpan.RecordError(err)
 		return nil, lib.ErrUnexpected
 	}
-	if len(transferErrors) != 0 {
-		for _, transferErr := range transferErrors {
+	for _, transferErr := range transferErrors {
+		switch transferErr.Result {
+		case tbt.TransferPendingTransferAlreadyPosted:
+			return nil, lib.ErrPendingTransferAlreadyPosted
+		case tbt.TransferPendingTransferAlreadyVoided:
+			return nil, lib.ErrPendingTransferAlreadyVoided
+		default:
 			voidSpan.AddEvent("tb.transfer.error", trace.WithAttributes(
 				attribute.String("error", transferErr.Result.String()),
 			))
+			return nil, lib.ErrUnexpected
 		}
-		return nil, lib.ErrUnexpected
 	}
 	voidSpan.End()
 
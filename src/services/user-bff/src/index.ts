@@ -25,6 +25,7 @@ export interface JwtPayload {
 export interface Env {
   Variables: {
     span: Span;
+    acr: string;
   } & JwtVariables<JwtPayload>;
 }
 
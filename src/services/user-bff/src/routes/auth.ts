@@ -2,7 +2,6 @@ import { SpanStatusCode } from "@opentelemetry/api";
 import { Hono } from "hono";
 import { describeRoute, resolver, validator } from "hono-openapi";
 import { setCookie } from "hono/cookie";
-import { jwt } from "hono/jwt";
 import { UAParser } from "ua-parser-js";
 
 import {
@@ -21,9 +20,9 @@ import {
 } from "@repo/validators/user";
 
 import type { Env } from "..";
-import { env } from "../env";
 import { userService } from "../services/userService";
 import { attrs, events } from "../util/attr";
+import { authMiddleware } from "../util/authMiddleware";
 import { redactJWT } from "../util/redactor";
 
 export const authRouter = new Hono<Env>();
@@ -319,10 +318,7 @@ authRouter.post(
   },
 );
 
-authRouter.use(
-  "/sessions",
-  jwt({ secret: env.USER_BFF_JWT_SECRET, alg: env.USER_BFF_JWT_ALG }),
-);
+authRouter.use("/sessions", authMiddleware);
 
 authRouter.get(
   "/sessions",
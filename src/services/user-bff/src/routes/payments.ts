@@ -1,7 +1,6 @@
 import { randomUUIDv7 } from "bun";
 import { Hono } from "hono";
 import { describeRoute, resolver, validator } from "hono-openapi";
-import { jwt } from "hono/jwt";
 import Long from "long";
 
 import {
@@ -12,7 +11,6 @@ import {
 import { createPaymentRequestSchema } from "@repo/validators/payment";
 
 import type { Env } from "..";
-import { env } from "../env";
 import {
   cacheTransaction,
   getTransaction,
@@ -21,14 +19,12 @@ import {
 import { paymentService } from "../services/paymentService";
 import { userService } from "../services/userService";
 import { attrs, events } from "../util/attr";
+import { authMiddleware } from "../util/authMiddleware";
 import { redactPhoneNumber } from "../util/redactor";
 
 export const paymentRouter = new Hono<Env>();
 
-paymentRouter.use(
-  "*",
-  jwt({ secret: env.USER_BFF_JWT_SECRET, alg: env.USER_BFF_JWT_ALG }),
-);
+paymentRouter.use("*", authMiddleware);
 
 paymentRouter.post(
   "/transfer",
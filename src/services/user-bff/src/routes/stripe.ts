@@ -1,7 +1,6 @@
 import { Hono } from "hono";
 import { describeRoute, resolver, validator } from "hono-openapi";
 import { except } from "hono/combine";
-import { jwt } from "hono/jwt";
 
 import {
   apiErrorResponseSchema,
@@ -14,7 +13,6 @@ import {
 } from "@repo/validators/stripe";
 
 import type { Env } from "..";
-import { env } from "../env";
 import * as paymentIntent from "../events/paymentIntent";
 import * as transfer from "../events/transfer";
 import {
@@ -32,16 +30,11 @@ import {
 } from "../services/stripeService";
 import { userService } from "../services/userService";
 import { attrs, events } from "../util/attr";
+import { authMiddleware, requireStepUp } from "../util/authMiddleware";
 
 export const stripeRouter = new Hono<Env>();
 
-stripeRouter.use(
-  "*",
-  except(
-    "/api/stripe/webhook",
-    jwt({ secret: env.USER_BFF_JWT_SECRET, alg: env.USER_BFF_JWT_ALG }),
-  ),
-);
+stripeRouter.use("*", except("/api/stripe/webhook", authMiddleware));
 
 stripeRouter.post(
   "/generate-stripe-checkout",
@@ -119,6 +112,14 @@ stripeRouter.post(
       401: {
         description: "Missing or expired access token",
       },
+      403: {
+        description: "The session has not stepped up with a second factor",
+        content: {
+          "application/json": {
+            schema: resolver(apiErrorResponseSchema),
+          },
+        },
+      },
       422: {
         description:
           "An error has occurred. Refer to the response error object",
@@ -140,6 +141,8 @@ stripeRouter.post(
     },
   }),
 
+  requireStepUp,
+
   validator("json", createStripePayoutSchema),
 
   async (c) => {
@@ -240,7 +243,7 @@ stripeRouter.get("/payout-eligibility", async (c) => {
   return c.json(data);
 });
 
-stripeRouter.get("/onboard-url", async (c) => {
+stripeRouter.get("/onboard-url", requireStepUp, async (c) => {
   const span = c.get("span");
   const { sub: userId } = c.get("jwtPayload");
 
@@ -1,6 +1,5 @@
 import { Hono } from "hono";
 import { describeRoute, resolver, validator } from "hono-openapi";
-import { jwt } from "hono/jwt";
 
 import {
   apiErrorResponseSchema,
@@ -14,16 +13,13 @@ import {
 } from "@repo/validators/user";
 
 import type { Env } from "..";
-import { env } from "../env";
 import { userService } from "../services/userService";
 import { attrs, events } from "../util/attr";
+import { authMiddleware } from "../util/authMiddleware";
 
 export const userRouter = new Hono<Env>();
 
-userRouter.use(
-  "*",
-  jwt({ secret: env.USER_BFF_JWT_SECRET, alg: env.USER_BFF_JWT_ALG }),
-);
+userRouter.use("*", authMiddleware);
 
 userRouter.get(
   "/",
@@ -2,6 +2,7 @@ export const attrs = {
   ATTR_USER_USER_AGENT: "user.user_agent",
   ATTR_USER_FORWARDED_FOR: "user.forwarded_for",
   ATTR_AUTH_OTP_ERROR_CAUSE: "user.cause",
+  ATTR_AUTH_SESSION_REJECTED_CAUSE: "auth.session.rejected_cause",
   ATTR_USER_SESSION_ACCESS_TOKEN: "user.access_token",
   ATTR_USER_SESSION_ACCESS_TOKEN_EXPIRES: "user.access_token.expires",
   ATTR_USER_SESSION_REFRESH_TOKEN: "user.refresh_token",
@@ -62,6 +63,8 @@ export const events = {
   EVENT_GET_SESSIONS_FAILURE: "auth.sessions.get_failure",
   EVENT_INVALIDATE_SESSION_FAILURE: "auth.sessions.invalidate_failure",
   EVENT_LOGOUT: "auth.logout",
+  EVENT_AUTH_SESSION_REJECTED: "auth.session.rejected",
+  EVENT_AUTH_STEP_UP_REQUIRED: "auth.step_up_required",
 
   EVENT_USER_GET_FAILURE: "user.get_failure",
   EVENT_USER_TRANSFERS_GET_FAILURE: "user.transfers.get_failure",
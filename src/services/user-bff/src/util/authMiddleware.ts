@@ -0,0 +1,133 @@
+import type { Context, Next } from "hono";
+import type { HonoJsonWebKey } from "hono/utils/jwt/jws";
+import { HTTPException } from "hono/http-exception";
+import { jwk } from "hono/jwk";
+import { decode, jwt } from "hono/jwt";
+
+import {
+  createSingleError,
+  createUnexpectedError,
+} from "@repo/validators/error";
+
+import type { Env } from "..";
+import { env } from "../env";
+import { userService } from "../services/userService";
+import { attrs, events } from "./attr";
+
+// user-service reloads its key set every five minutes and publishes keys
+// before they start signing, so keys cached this long always include the
+// current signer.
+const JWKS_CACHE_TTL_MS = 5 * 60 * 1000;
+
+let jwksCache: { keys: HonoJsonWebKey[]; expires: number } | null = null;
+
+async function getJwks(): Promise<HonoJsonWebKey[]> {
+  if (jwksCache !== null && Date.now() < jwksCache.expires) {
+    return jwksCache.keys;
+  }
+
+  const { data, error } = await userService.call("getJwks", {});
+  if (error !== null) {
+    // Keep verifying with the last known keys while user-service is down.
+    if (jwksCache !== null) return jwksCache.keys;
+    throw error;
+  }
+
+  const keys: HonoJsonWebKey[] = data.keys ?? [];
+  jwksCache = { keys, expires: Date.now() + JWKS_CACHE_TTL_MS };
+  return keys;
+}
+
+const verifyWithSecret =
+  env.USER_BFF_JWT_SECRET === undefined
+    ? null
+    : jwt({ secret: env.USER_BFF_JWT_SECRET, alg: "HS256" });
+const verifyWithJwks = jwk({ keys: getJwks });
+
+function acceptsHS256() {
+  return (
+    env.USER_BFF_JWT_HS256_UNTIL === undefined ||
+    Date.now() < env.USER_BFF_JWT_HS256_UNTIL.getTime()
+  );
+}
+
+function bearerToken(c: Context<Env>): string | null {
+  const header = c.req.header("Authorization");
+  if (!header?.startsWith("Bearer ")) return null;
+  return header.slice("Bearer ".length);
+}
+
+function tokenAlgorithm(c: Context<Env>): string | null {
+  const token = bearerToken(c);
+  if (token === null) return null;
+
+  try {
+    return decode(token).header.alg;
+  } catch {
+    return null;
+  }
+}
+
+// validateSession asks user-service whether the session behind a token that
+// verified locally is still active, so revoked sessions and tokens stop
+// working immediately instead of when the token expires.
+async function validateSession(c: Context<Env>, next: Next) {
+  const span = c.get("span");
+
+  const { data, error } = await userService.call("validateAccessToken", {
+    accessToken: bearerToken(c) ?? "",
+  });
+  if (error !== null) {
+    if (
+      error.details === "SESSION_REVOKED" ||
+      error.details === "INVALID_TOKEN" ||
+      error.details === "TOKEN_EXPIRED"
+    ) {
+      span.addEvent(events.EVENT_AUTH_SESSION_REJECTED);
+      span.setAttribute(attrs.ATTR_AUTH_SESSION_REJECTED_CAUSE, error.details);
+      throw new HTTPException(401, { message: "Unauthorized" });
+    }
+
+    span.recordException(error);
+    throw new HTTPException(500, {
+      res: c.json(createUnexpectedError(), 500),
+    });
+  }
+
+  c.set("acr", data.acr ?? "");
+  await next();
+}
+
+// authMiddleware verifies access tokens issued by user-service and then
+// checks that their session is still active. Tokens signed with the shared
+// secret are accepted only while HS256 is still allowed; everything else is
+// verified against the keys user-service publishes.
+export async function authMiddleware(c: Context<Env>, next: Next) {
+  const checkSession = () => validateSession(c, next);
+
+  if (
+    verifyWithSecret !== null &&
+    acceptsHS256() &&
+    tokenAlgorithm(c) === "HS256"
+  ) {
+    return verifyWithSecret(c, checkSession);
+  }
+  return verifyWithJwks(c, checkSession);
+}
+
+// requireStepUp guards operations that move money out of the platform or
+// change where it goes. They need a token issued after a recent second
+// factor check.
+export async function requireStepUp(c: Context<Env>, next: Next) {
+  if (c.get("acr") !== "aal2") {
+    c.get("span").addEvent(events.EVENT_AUTH_STEP_UP_REQUIRED);
+    return c.json(
+      createSingleError(
+        "STEP_UP_REQUIRED",
+        "Verify your second factor before continuing",
+      ),
+      403,
+    );
+  }
+  await next();
+}
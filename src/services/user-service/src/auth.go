@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
-	"log/slog"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"user-service/src/lib"
 	"user-service/src/queries"
@@ -12,14 +17,108 @@ import (
 	"github.com/google/uuid"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 
 	pb "protobufs/gen/go/user-service"
 )
 
+// tooManyAttempts tells the caller when to retry through the retry-after
+// trailer, in whole seconds, so the error message itself stays stable.
+func tooManyAttempts(ctx context.Context, retryAt time.Time) error {
+	retryAfter := max(int64(math.Ceil(time.Until(retryAt).Seconds())), 0)
+	grpc.SetTrailer(ctx, metadata.Pairs(lib.RetryAfterMetadataKey, strconv.FormatInt(retryAfter, 10)))
+	return lib.ErrTooManyAttempts
+}
+
+func (s *UserServiceServer) checkAuthLockout(ctx context.Context, tracer trace.Tracer, keys []string) error {
+	ctx, lockoutSpan := tracer.Start(ctx, lib.EVENT_AUTH_LOCKOUT_CHECK)
+	defer lockoutSpan.End()
+
+	lockoutSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetAuthLockout),
+	)
+
+	lockedUntil, err := repo.GetAuthLockout(ctx, s.db, keys)
+	if err != nil {
+		lockoutSpan.RecordError(err)
+		return err
+	}
+	if lockedUntil != nil {
+		lockoutSpan.AddEvent(lib.EVENT_AUTH_LOCKED_OUT)
+		return tooManyAttempts(ctx, *lockedUntil)
+	}
+
+	return nil
+}
+
+// recordAuthAttempt counts an attempt for the limit. Empty values, e.g. an IP
+// address the caller did not pass on, are not counted.
+func (s *UserServiceServer) recordAuthAttempt(ctx context.Context, tracer trace.Tracer, limit lib.AttemptLimit, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	ctx, attemptSpan := tracer.Start(ctx, lib.EVENT_AUTH_ATTEMPT_RECORD)
+	defer attemptSpan.End()
+
+	attemptSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryRecordAuthAttempt),
+	)
+
+	lockedUntil, err := repo.RecordAuthAttempt(ctx, s.db, limit, value)
+	if err != nil {
+		attemptSpan.RecordError(err)
+		return err
+	}
+	if lockedUntil != nil {
+		attemptSpan.AddEvent(lib.EVENT_AUTH_LOCKED_OUT)
+	}
+
+	return nil
+}
+
 func (s *UserServiceServer) RequestAuthentication(ctx context.Context, req *pb.RequestAuthenticationRequest) (*pb.Empty, error) {
 	span := trace.SpanFromContext(ctx)
 	tracer := span.TracerProvider().Tracer(lib.ServiceName)
 
+	span.SetAttributes(
+		attribute.String(lib.ATTR_PHONE_NUMBER, lib.RedactPhoneNumber(req.PhoneNumber)),
+		attribute.String(lib.ATTR_IP_ADDRESS, req.IpAddress),
+	)
+
+	lockoutKeys := []string{lib.LoginPhoneLimit.Key(req.PhoneNumber)}
+	if req.IpAddress != "" {
+		lockoutKeys = append(lockoutKeys, lib.OTPRequestIpLimit.Key(req.IpAddress))
+	}
+	if err := s.checkAuthLockout(ctx, tracer, lockoutKeys); err != nil {
+		return nil, err
+	}
+	if err := s.recordAuthAttempt(ctx, tracer, lib.OTPRequestIpLimit, req.IpAddress); err != nil {
+		return nil, err
+	}
+
+	ctx, throttleSpan := tracer.Start(ctx, lib.EVENT_OTP_THROTTLE)
+	defer throttleSpan.End()
+
+	throttleSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetOtpThrottle),
+	)
+
+	throttle, err := repo.GetOTPThrottle(s.db, ctx, req.PhoneNumber)
+	if err != nil {
+		throttleSpan.RecordError(err)
+		return nil, err
+	}
+
+	now := time.Now()
+	allowedAt, requestCount := lib.NextOTPRequest(throttle.LastRequestedAt, throttle.RequestCount, now)
+	if now.Before(allowedAt) {
+		throttleSpan.AddEvent(lib.EVENT_OTP_THROTTLED)
+		return nil, tooManyAttempts(ctx, allowedAt)
+	}
+	throttleSpan.End()
+
 	otpCode, err := lib.GenerateOTPCode()
 	if err != nil {
 		span.RecordError(err)
@@ -39,27 +138,71 @@ func (s *UserServiceServer) RequestAuthentication(ctx context.Context, req *pb.R
 	ctx, storeOtpSpan := tracer.Start(ctx, lib.EVENT_OTP_STORE)
 	defer storeOtpSpan.End()
 
-	err = repo.StoreOTP(s.db, ctx, req.PhoneNumber, hashedOtpCode)
+	err = repo.StoreOTP(s.db, ctx, req.PhoneNumber, hashedOtpCode, requestCount, throttle.LastRequestedAt)
 	if err != nil {
+		// The user exists, so a missed update means a concurrent request
+		// issued a code first.
+		if err == lib.ErrNotFound {
+			storeOtpSpan.AddEvent(lib.EVENT_OTP_THROTTLED)
+			return nil, tooManyAttempts(ctx, now.Add(lib.OTPRequestBaseBackoff))
+		}
 		return nil, err
 	}
 	storeOtpSpan.End()
 
-	//TODO: remove me
-	slog.Info("Issued otp code", "code", otpCode)
+	ctx, sendOtpSpan := tracer.Start(ctx, lib.EVENT_OTP_SEND)
+	defer sendOtpSpan.End()
+
+	sendOtpSpan.SetAttributes(
+		attribute.String(lib.ATTR_PHONE_NUMBER, lib.RedactPhoneNumber(req.PhoneNumber)),
+	)
+
+	err = s.otpSender.SendOTP(ctx, req.PhoneNumber, lib.OTPMessage(otpCode))
+	if err != nil {
+		sendOtpSpan.RecordError(err)
+		return nil, lib.ErrOTPDeliveryFailed
+	}
+	sendOtpSpan.End()
 
 	return &pb.Empty{}, nil
 }
 
+// recordLoginFailure counts a failed login against the phone number and the
+// caller's IP address.
+func (s *UserServiceServer) recordLoginFailure(ctx context.Context, tracer trace.Tracer, req *pb.OTPAuthenticationRequest) error {
+	if err := s.recordAuthAttempt(ctx, tracer, lib.LoginPhoneLimit, req.PhoneNumber); err != nil {
+		return err
+	}
+	return s.recordAuthAttempt(ctx, tracer, lib.LoginIpLimit, req.IpAddress)
+}
+
 func (s *UserServiceServer) AuthenticateWithOTP(ctx context.Context, req *pb.OTPAuthenticationRequest) (*pb.Session, error) {
 	span := trace.SpanFromContext(ctx)
 	tracer := span.TracerProvider().Tracer(lib.ServiceName)
 
+	span.SetAttributes(
+		attribute.String(lib.ATTR_PHONE_NUMBER, lib.RedactPhoneNumber(req.PhoneNumber)),
+		attribute.String(lib.ATTR_IP_ADDRESS, req.IpAddress),
+	)
+
+	lockoutKeys := []string{lib.LoginPhoneLimit.Key(req.PhoneNumber)}
+	if req.IpAddress != "" {
+		lockoutKeys = append(lockoutKeys, lib.LoginIpLimit.Key(req.IpAddress))
+	}
+	if err := s.checkAuthLockout(ctx, tracer, lockoutKeys); err != nil {
+		return nil, err
+	}
+
 	ctx, getOtpSpan := tracer.Start(ctx, lib.EVENT_OTP_GET)
 	defer getOtpSpan.End()
 
 	otpCode, err := repo.GetOtp(s.db, ctx, req.PhoneNumber)
 	if err != nil {
+		if err == lib.ErrNotFound {
+			if recordErr := s.recordLoginFailure(ctx, tracer, req); recordErr != nil {
+				return nil, recordErr
+			}
+		}
 		return nil, err
 	}
 	getOtpSpan.End()
@@ -78,10 +221,51 @@ func (s *UserServiceServer) AuthenticateWithOTP(ctx context.Context, req *pb.OTP
 	}
 	if !hashesMatch {
 		verifyOtpSpan.AddEvent(lib.EVENT_OTP_HASH_MISMATCH)
+
+		failure, err := repo.RecordOTPFailure(s.db, ctx, otpCode.UserId)
+		if err != nil {
+			verifyOtpSpan.RecordError(err)
+			return nil, err
+		}
+		if err := s.recordLoginFailure(ctx, tracer, req); err != nil {
+			return nil, err
+		}
+
+		verifyOtpSpan.SetAttributes(
+			attribute.Int(lib.ATTR_OTP_FAILED_ATTEMPTS, failure.FailedAttempts),
+		)
+
+		// The code is gone, so the caller has to wait until a new one may
+		// be requested.
+		if failure.FailedAttempts >= lib.MaxOTPAttempts {
+			verifyOtpSpan.AddEvent(lib.EVENT_OTP_INVALIDATED)
+			retryAt, _ := lib.NextOTPRequest(failure.LastRequestedAt, failure.RequestCount, time.Now())
+			return nil, tooManyAttempts(ctx, retryAt)
+		}
 		return nil, lib.ErrOTPMismatch
 	}
 	verifyOtpSpan.End()
 
+	ctx, consumeOtpSpan := tracer.Start(ctx, lib.EVENT_OTP_CONSUME)
+	defer consumeOtpSpan.End()
+
+	consumeOtpSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryConsumeOtp),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{otpCode.UserId}),
+	)
+
+	err = repo.ConsumeOTP(s.db, ctx, otpCode.UserId)
+	if err != nil {
+		consumeOtpSpan.RecordError(err)
+		return nil, err
+	}
+	err = repo.ClearAuthAttempts(ctx, s.db, lib.LoginPhoneLimit, req.PhoneNumber)
+	if err != nil {
+		consumeOtpSpan.RecordError(err)
+		return nil, err
+	}
+	consumeOtpSpan.End()
+
 	sessionId, err := uuid.NewV7()
 	if err != nil {
 		span.RecordError(err)
@@ -95,13 +279,15 @@ func (s *UserServiceServer) AuthenticateWithOTP(ctx context.Context, req *pb.OTP
 	ctx, generateTokenPairSpan := tracer.Start(ctx, lib.EVENT_GENERATE_TOKEN_PAIR)
 	defer generateTokenPairSpan.End()
 
-	tokenPair, err := s.tokenService.GenerateTokenPair(otpCode.UserId, sessionId.String())
+	tokenPair, err := s.tokenService.GenerateTokenPair(otpCode.UserId, sessionId.String(), 0, lib.NewAuthContext(nil, time.Now()))
 	if err != nil {
 		generateTokenPairSpan.RecordError(err)
 		return nil, lib.ErrUnexpected
 	}
 	generateTokenPairSpan.End()
 
+	location := s.geoIp.Lookup(req.IpAddress)
+
 	ctx, storeSessionSpan := tracer.Start(ctx, lib.EVENT_SESSION_STORE)
 	defer storeSessionSpan.End()
 
@@ -115,6 +301,7 @@ func (s *UserServiceServer) AuthenticateWithOTP(ctx context.Context, req *pb.OTP
 				req.Device,
 				req.Application,
 				req.IpAddress,
+				lib.StringOrEmpty(location),
 			},
 		),
 	)
@@ -128,6 +315,7 @@ func (s *UserServiceServer) AuthenticateWithOTP(ctx context.Context, req *pb.OTP
 		req.Device,
 		req.Application,
 		req.IpAddress,
+		location,
 	)
 	if err != nil {
 		storeSessionSpan.RecordError(err)
@@ -152,6 +340,35 @@ func (s *UserServiceServer) AuthenticateWithOTP(ctx context.Context, req *pb.OTP
 	}, nil
 }
 
+// revokeReusedSession ends a session whose already rotated refresh token was
+// presented again. Either the legitimate client or an attacker holds a copy,
+// and there is no telling which, so neither may keep the session.
+func (s *UserServiceServer) revokeReusedSession(ctx context.Context, tracer trace.Tracer, token *lib.TokenClaims) error {
+	ctx, revokeSpan := tracer.Start(ctx, lib.EVENT_REFRESH_TOKEN_REUSED)
+	defer revokeSpan.End()
+
+	revokeSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryInvalidateSession),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{token.SessionId, token.UserId}),
+	)
+
+	_, err := s.db.ExecContext(ctx, queries.QueryInvalidateSession, token.SessionId, token.UserId)
+	if err != nil {
+		revokeSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+	s.sessionRevocations.Revoke(token.SessionId)
+
+	err = repo.RecordSecurityEvent(ctx, s.db, token.UserId, &token.SessionId, lib.SECURITY_EVENT_REFRESH_TOKEN_REUSE,
+		fmt.Sprintf("generation %d presented again", token.Generation))
+	if err != nil {
+		revokeSpan.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
 func (s *UserServiceServer) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.Session, error) {
 	span := trace.SpanFromContext(ctx)
 	tracer := span.TracerProvider().Tracer(lib.ServiceName)
@@ -173,59 +390,73 @@ func (s *UserServiceServer) RefreshToken(ctx context.Context, req *pb.RefreshTok
 		decodeTokenSpan.RecordError(err)
 		return nil, lib.ErrUnexpected
 	}
+	if token.Type != lib.TOKEN_TYPE_REFRESH {
+		decodeTokenSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "refreshToken"),
+		))
+		return nil, lib.ErrUnacceptableRequest
+	}
+	decodeTokenSpan.End()
 
 	span.SetAttributes(
 		attribute.String(lib.ATTR_USER_ID, token.UserId),
 		attribute.String(lib.ATTR_SESSION_ID, token.SessionId),
+		attribute.Int64(lib.ATTR_REFRESH_GENERATION, token.Generation),
 	)
 
-	ctx, generateTokenPairSpan := tracer.Start(ctx, lib.EVENT_GENERATE_TOKEN_PAIR)
-	defer generateTokenPairSpan.End()
+	ctx, rotateSpan := tracer.Start(ctx, lib.EVENT_SESSION_ROTATE)
+	defer rotateSpan.End()
 
-	tokenPair, err := s.tokenService.GenerateTokenPair(token.UserId, token.SessionId)
-	if err != nil {
-		generateTokenPairSpan.RecordError(err)
-		return nil, lib.ErrUnexpected
-	}
-	generateTokenPairSpan.End()
-
-	ctx, storeSessionSpan := tracer.Start(ctx, lib.EVENT_SESSION_STORE)
-	defer storeSessionSpan.End()
+	expires := time.Now().Add(lib.RefreshTokenTTL)
 
-	storeSessionSpan.SetAttributes(
-		attribute.String(lib.ATTR_DB_QUERY, queries.QueryRefreshSession),
+	rotateSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryRotateSession),
 		attribute.StringSlice(lib.ATTR_DB_ARGS,
 			[]string{
-				tokenPair.RefreshTokenExpires.UTC().Format(time.RFC3339),
+				expires.UTC().Format(time.RFC3339),
 				token.SessionId,
+				strconv.FormatInt(token.Generation, 10),
 			},
 		),
 	)
 
-	result, err := s.db.ExecContext(
-		ctx,
-		queries.QueryRefreshSession,
-		tokenPair.RefreshTokenExpires,
-		token.SessionId,
-	)
-	if err != nil {
-		storeSessionSpan.RecordError(err)
+	rotated := repo.RotatedSession{}
+	err = s.db.GetContext(ctx, &rotated, queries.QueryRotateSession, expires, token.SessionId, token.Generation)
+	if err != nil && err != sql.ErrNoRows {
+		rotateSpan.RecordError(err)
 		return nil, lib.ErrUnexpected
 	}
+	if err == sql.ErrNoRows {
+		rotateSpan.AddEvent(lib.EVENT_DB_NO_ROWS_AFFECTED)
+
+		session := repo.SessionGeneration{}
+		err = s.db.GetContext(ctx, &session, queries.QueryGetSessionGeneration, token.SessionId)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, lib.ErrTokenExpired
+			}
+			rotateSpan.RecordError(err)
+			return nil, lib.ErrUnexpected
+		}
+
+		if session.Active && session.RefreshGeneration > token.Generation {
+			if err := s.revokeReusedSession(ctx, tracer, token); err != nil {
+				return nil, err
+			}
+		}
+		return nil, lib.ErrTokenExpired
+	}
+	rotateSpan.End()
 
-	rowsAffected, err := result.RowsAffected()
+	ctx, generateTokenPairSpan := tracer.Start(ctx, lib.EVENT_GENERATE_TOKEN_PAIR)
+	defer generateTokenPairSpan.End()
+
+	tokenPair, err := s.tokenService.GenerateTokenPair(token.UserId, token.SessionId, rotated.RefreshGeneration, lib.NewAuthContext(rotated.MfaAt, time.Now()))
 	if err != nil {
-		storeSessionSpan.RecordError(err)
+		generateTokenPairSpan.RecordError(err)
 		return nil, lib.ErrUnexpected
 	}
-	if rowsAffected == 0 {
-		storeSessionSpan.AddEvent(lib.EVENT_DB_NO_ROWS_AFFECTED)
-		return nil, lib.ErrTokenExpired
-	}
-
-	storeSessionSpan.SetAttributes(
-		attribute.Int64(lib.ATTR_DB_ROWS_AFFECTED, rowsAffected),
-	)
+	generateTokenPairSpan.End()
 
 	return &pb.Session{
 		AccessToken:         tokenPair.AccessToken,
@@ -282,11 +513,196 @@ func (s *UserServiceServer) InvalidateSession(ctx context.Context, req *pb.Inval
 		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.SessionId, req.UserId}),
 	)
 
-	_, err := s.db.ExecContext(ctx, queries.QueryInvalidateSession, req.SessionId, req.UserId)
+	result, err := s.db.ExecContext(ctx, queries.QueryInvalidateSession, req.SessionId, req.UserId)
 	if err != nil {
 		span.RecordError(err)
 		return nil, lib.ErrUnexpected
 	}
+	if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+		s.sessionRevocations.Revoke(req.SessionId)
+	}
 
 	return &pb.Empty{}, nil
 }
+
+// InvalidateAllSessions ends every active session of the user, except the
+// one to keep when given, e.g. the session making the request.
+func (s *UserServiceServer) InvalidateAllSessions(ctx context.Context, req *pb.InvalidateAllSessionsRequest) (*pb.InvalidateAllSessionsResponse, error) {
+	span := trace.SpanFromContext(ctx)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryInvalidateAllSessions),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId, lib.StringOrEmpty(req.KeepSessionId)}),
+	)
+
+	sessionIds := []string{}
+	err := s.db.SelectContext(ctx, &sessionIds, queries.QueryInvalidateAllSessions, req.UserId, req.KeepSessionId)
+	if err != nil {
+		span.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	for _, sessionId := range sessionIds {
+		s.sessionRevocations.Revoke(sessionId)
+	}
+
+	span.SetAttributes(
+		attribute.Int(lib.ATTR_DB_ROWS_AFFECTED, len(sessionIds)),
+	)
+
+	return &pb.InvalidateAllSessionsResponse{
+		InvalidatedCount: uint32(len(sessionIds)),
+	}, nil
+}
+
+func (s *UserServiceServer) RenameSession(ctx context.Context, req *pb.RenameSessionRequest) (*pb.ActiveSession, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_SESSION_ID, req.SessionId),
+	)
+
+	var name *string
+	if req.Name != nil {
+		trimmed := strings.TrimSpace(*req.Name)
+		if utf8.RuneCountInString(trimmed) > lib.SessionNameMaxLength {
+			span.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+				attribute.String("field", "name"),
+			))
+			return nil, lib.ErrUnacceptableRequest
+		}
+		if trimmed != "" {
+			name = &trimmed
+		}
+	}
+
+	ctx, renameSpan := tracer.Start(ctx, lib.EVENT_SESSION_RENAME)
+	defer renameSpan.End()
+
+	renameSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryRenameSession),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.SessionId, req.UserId, lib.StringOrEmpty(name)}),
+	)
+
+	session := repo.ActiveSession{}
+	err := s.db.GetContext(ctx, &session, queries.QueryRenameSession, req.SessionId, req.UserId, name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			renameSpan.AddEvent(lib.EVENT_SESSION_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		}
+		renameSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	renameSpan.End()
+
+	return repo.DbActiveSessionToPbActiveSession(session), nil
+}
+
+// ValidateAccessToken checks the signature and expiry of an access token and
+// that its session has not ended since it was issued.
+func (s *UserServiceServer) ValidateAccessToken(ctx context.Context, req *pb.ValidateAccessTokenRequest) (*pb.AccessTokenClaims, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_ACCESS_TOKEN, lib.RedactJWT(req.AccessToken)),
+	)
+
+	ctx, decodeTokenSpan := tracer.Start(ctx, lib.EVENT_DECODE_TOKEN)
+	defer decodeTokenSpan.End()
+
+	token, err := s.tokenService.DecodeAndValidate(req.AccessToken)
+	if err != nil {
+		if err == lib.ErrTokenExpired {
+			decodeTokenSpan.AddEvent(lib.EVENT_TOKEN_EXPIRED)
+			return nil, err
+		}
+
+		decodeTokenSpan.AddEvent(lib.EVENT_TOKEN_INVALID, trace.WithAttributes(
+			attribute.String("error", err.Error()),
+		))
+		return nil, lib.ErrInvalidToken
+	}
+	if token.Type != lib.TOKEN_TYPE_ACCESS {
+		decodeTokenSpan.AddEvent(lib.EVENT_TOKEN_INVALID, trace.WithAttributes(
+			attribute.String("error", "unexpected token type "+token.Type),
+		))
+		return nil, lib.ErrInvalidToken
+	}
+	decodeTokenSpan.End()
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, token.UserId),
+		attribute.String(lib.ATTR_SESSION_ID, token.SessionId),
+	)
+
+	ctx, checkSessionSpan := tracer.Start(ctx, lib.EVENT_SESSION_CHECK)
+	defer checkSessionSpan.End()
+
+	revoked, fresh := s.sessionRevocations.IsRevoked(token.SessionId, time.Now())
+	if !fresh {
+		checkSessionSpan.SetAttributes(
+			attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetSessionGeneration),
+			attribute.StringSlice(lib.ATTR_DB_ARGS, []string{token.SessionId}),
+		)
+
+		session := repo.SessionGeneration{}
+		err = s.db.GetContext(ctx, &session, queries.QueryGetSessionGeneration, token.SessionId)
+		if err != nil && err != sql.ErrNoRows {
+			checkSessionSpan.RecordError(err)
+			return nil, lib.ErrUnexpected
+		}
+		revoked = err == sql.ErrNoRows || !session.Active
+	}
+	if revoked {
+		checkSessionSpan.AddEvent(lib.EVENT_SESSION_REVOKED)
+		return nil, lib.ErrSessionRevoked
+	}
+	checkSessionSpan.End()
+
+	return &pb.AccessTokenClaims{
+		UserId:    token.UserId,
+		SessionId: token.SessionId,
+		Expires:   token.Expires.UTC().Format(time.RFC3339),
+		Acr:       token.Acr,
+		Amr:       token.Amr,
+	}, nil
+}
+
+func (s *UserServiceServer) GetLatestSession(ctx context.Context, req *pb.GetLatestSessionRequest) (*pb.LatestSession, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	ctx, getSessionSpan := tracer.Start(ctx, lib.EVENT_SESSION_GET_LATEST)
+	defer getSessionSpan.End()
+
+	getSessionSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetLatestSession),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	session := repo.LatestSession{}
+	err := s.db.GetContext(ctx, &session, queries.QueryGetLatestSession, req.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			getSessionSpan.AddEvent(lib.EVENT_SESSION_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		}
+		getSessionSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+
+	getSessionSpan.SetAttributes(
+		attribute.String(lib.ATTR_SESSION_ID, session.SessionId),
+	)
+	getSessionSpan.End()
+
+	return repo.DbLatestSessionToPbLatestSession(session), nil
+}
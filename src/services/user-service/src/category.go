@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"user-service/src/lib"
+	"user-service/src/queries"
+	"user-service/src/repo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "protobufs/gen/go/user-service"
+)
+
+func (s *UserServiceServer) transferCategorizer(ctx context.Context, tracer trace.Tracer, userId string, transferIds []string) (repo.TransferCategorizer, error) {
+	categorizer := repo.TransferCategorizer{}
+
+	ctx, mapTransferCategoriesSpan := tracer.Start(ctx, lib.EVENT_MAP_TRANSFER_CATEGORIES)
+	defer mapTransferCategoriesSpan.End()
+
+	transferCategories, err := repo.MapTransferCategories(ctx, s.db, userId, transferIds)
+	if err != nil {
+		mapTransferCategoriesSpan.RecordError(err)
+		return categorizer, err
+	}
+	mapTransferCategoriesSpan.End()
+
+	ctx, mapCounterpartyCategoriesSpan := tracer.Start(ctx, lib.EVENT_MAP_COUNTERPARTY_CATEGORIES)
+	defer mapCounterpartyCategoriesSpan.End()
+
+	counterpartyCategories, err := repo.MapCounterpartyCategories(ctx, s.db, userId)
+	if err != nil {
+		mapCounterpartyCategoriesSpan.RecordError(err)
+		return categorizer, err
+	}
+	mapCounterpartyCategoriesSpan.End()
+
+	categorizer.TransferCategories = transferCategories
+	categorizer.CounterpartyCategories = counterpartyCategories
+	return categorizer, nil
+}
+
+func validateCategory(ctx context.Context, tracer trace.Tracer, category *string) error {
+	_, validateSpan := tracer.Start(ctx, lib.EVENT_CATEGORY_VALIDATE)
+	defer validateSpan.End()
+
+	if category == nil {
+		return nil
+	}
+
+	validateSpan.SetAttributes(
+		attribute.String(lib.ATTR_CATEGORY, *category),
+	)
+
+	if !lib.IsCategory(*category) {
+		validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "category"),
+		))
+		return lib.ErrUnacceptableRequest
+	}
+
+	return nil
+}
+
+func (s *UserServiceServer) SetTransferCategory(ctx context.Context, req *pb.SetTransferCategoryRequest) (*pb.Empty, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_TRANSFER_ID, req.TransferId),
+	)
+
+	if err := validateCategory(ctx, tracer, req.Category); err != nil {
+		return nil, err
+	}
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_DB_SET_TRANSFER_CATEGORY)
+	defer dbSpan.End()
+
+	var err error
+	if req.Category == nil {
+		dbSpan.SetAttributes(
+			attribute.String(lib.ATTR_DB_QUERY, queries.QueryDeleteTransferCategory),
+			attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId, req.TransferId}),
+		)
+		_, err = s.db.ExecContext(ctx, queries.QueryDeleteTransferCategory, req.UserId, req.TransferId)
+	} else {
+		dbSpan.SetAttributes(
+			attribute.String(lib.ATTR_DB_QUERY, queries.QuerySetTransferCategory),
+			attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId, req.TransferId, *req.Category}),
+		)
+		_, err = s.db.ExecContext(ctx, queries.QuerySetTransferCategory, req.UserId, req.TransferId, *req.Category)
+	}
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbSpan.End()
+
+	return &pb.Empty{}, nil
+}
+
+func (s *UserServiceServer) SetCounterpartyCategory(ctx context.Context, req *pb.SetCounterpartyCategoryRequest) (*pb.Empty, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_COUNTERPARTY_ID, req.CounterpartyId),
+	)
+
+	if err := validateCategory(ctx, tracer, req.Category); err != nil {
+		return nil, err
+	}
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_DB_SET_COUNTERPARTY_CATEGORY)
+	defer dbSpan.End()
+
+	var err error
+	if req.Category == nil {
+		dbSpan.SetAttributes(
+			attribute.String(lib.ATTR_DB_QUERY, queries.QueryDeleteCounterpartyCategory),
+			attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId, req.CounterpartyId}),
+		)
+		_, err = s.db.ExecContext(ctx, queries.QueryDeleteCounterpartyCategory, req.UserId, req.CounterpartyId)
+	} else {
+		dbSpan.SetAttributes(
+			attribute.String(lib.ATTR_DB_QUERY, queries.QuerySetCounterpartyCategory),
+			attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId, req.CounterpartyId, *req.Category}),
+		)
+		_, err = s.db.ExecContext(ctx, queries.QuerySetCounterpartyCategory, req.UserId, req.CounterpartyId, *req.Category)
+	}
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbSpan.End()
+
+	return &pb.Empty{}, nil
+}
+
+// GetSpendingInsights totals the user's transfers between the timestamps,
+// defaulting to the current and previous InsightsMonths-1 calendar months.
+// Ranges longer than InsightsMaxMonths are rejected before the ledger is read.
+func (s *UserServiceServer) GetSpendingInsights(ctx context.Context, req *pb.GetSpendingInsightsRequest) (*pb.SpendingInsights, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	now := time.Now().UTC()
+	maxTimestamp := now
+	minTimestamp := time.Date(now.Year(), now.Month()-(lib.InsightsMonths-1), 1, 0, 0, 0, 0, time.UTC)
+
+	var err error
+	if req.MaxTimestamp != nil {
+		maxTimestamp, err = time.Parse(time.RFC3339Nano, *req.MaxTimestamp)
+		if err != nil {
+			span.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+				attribute.String("field", "maxTimestamp"),
+			))
+			return nil, lib.ErrUnacceptableRequest
+		}
+	}
+	if req.MinTimestamp != nil {
+		minTimestamp, err = time.Parse(time.RFC3339Nano, *req.MinTimestamp)
+		if err != nil {
+			span.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+				attribute.String("field", "minTimestamp"),
+			))
+			return nil, lib.ErrUnacceptableRequest
+		}
+	}
+	if !minTimestamp.Before(maxTimestamp) || maxTimestamp.After(minTimestamp.AddDate(0, lib.InsightsMaxMonths, 0)) {
+		span.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "minTimestamp"),
+		))
+		return nil, lib.ErrUnacceptableRequest
+	}
+
+	transfers, err := s.getAllAccountTransfers(ctx, tracer, req.UserId, minTimestamp, maxTimestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	pbTransfers, err := s.transfersWithDetails(ctx, tracer, req.UserId, transfers)
+	if err != nil {
+		return nil, err
+	}
+
+	_, buildSpan := tracer.Start(ctx, lib.EVENT_BUILD_SPENDING_INSIGHTS)
+	defer buildSpan.End()
+
+	insights, err := repo.BuildSpendingInsights(pbTransfers)
+	if err != nil {
+		buildSpan.RecordError(err)
+		return nil, err
+	}
+	buildSpan.End()
+
+	insights.MinTimestamp = minTimestamp.UTC().Format(time.RFC3339Nano)
+	insights.MaxTimestamp = maxTimestamp.UTC().Format(time.RFC3339Nano)
+
+	return insights, nil
+}
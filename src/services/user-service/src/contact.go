@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"user-service/src/lib"
+	"user-service/src/queries"
+	"user-service/src/repo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "protobufs/gen/go/user-service"
+)
+
+// checkContactUser makes sure the contact is another user who has not been
+// deleted.
+func (s *UserServiceServer) checkContactUser(ctx context.Context, tracer trace.Tracer, userId, contactUserId string) error {
+	ctx, validateSpan := tracer.Start(ctx, lib.EVENT_CONTACT_VALIDATE)
+	defer validateSpan.End()
+
+	if contactUserId == "" || contactUserId == userId {
+		validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "contactUserId"),
+		))
+		return lib.ErrUnacceptableRequest
+	}
+
+	validateSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetUserById),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{contactUserId}),
+	)
+
+	user := repo.User{}
+	err := s.db.GetContext(ctx, &user, queries.QueryGetUserById, contactUserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			validateSpan.AddEvent(lib.EVENT_USER_NOT_FOUND)
+			return lib.ErrNotFound
+		}
+		validateSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	return nil
+}
+
+func (s *UserServiceServer) updateContact(ctx context.Context, query string, userId, contactUserId string, update func(ctx context.Context) (*repo.Contact, error)) (*pb.Contact, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, userId),
+		attribute.String(lib.ATTR_CONTACT_USER_ID, contactUserId),
+	)
+
+	if err := s.checkContactUser(ctx, tracer, userId, contactUserId); err != nil {
+		return nil, err
+	}
+
+	ctx, updateSpan := tracer.Start(ctx, lib.EVENT_DB_UPDATE_CONTACT)
+	defer updateSpan.End()
+
+	updateSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, query),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{userId, contactUserId}),
+	)
+
+	contact, err := update(ctx)
+	if err != nil {
+		if err == lib.ErrContactBlocked {
+			updateSpan.AddEvent(lib.EVENT_CONTACT_BLOCKED)
+			return nil, err
+		}
+		updateSpan.RecordError(err)
+		return nil, err
+	}
+
+	return repo.DbContactToPbContact(*contact), nil
+}
+
+// AddFavorite pins the contact to the top of the suggestions. Blocked
+// contacts have to be unblocked first.
+func (s *UserServiceServer) AddFavorite(ctx context.Context, req *pb.ContactRequest) (*pb.Contact, error) {
+	return s.updateContact(ctx, queries.QuerySetContactFavorite, req.UserId, req.ContactUserId, func(ctx context.Context) (*repo.Contact, error) {
+		return repo.SetContactFavorite(ctx, s.db, req.UserId, req.ContactUserId, true)
+	})
+}
+
+func (s *UserServiceServer) RemoveFavorite(ctx context.Context, req *pb.ContactRequest) (*pb.Contact, error) {
+	return s.updateContact(ctx, queries.QuerySetContactFavorite, req.UserId, req.ContactUserId, func(ctx context.Context) (*repo.Contact, error) {
+		return repo.SetContactFavorite(ctx, s.db, req.UserId, req.ContactUserId, false)
+	})
+}
+
+// SetContactNickname sets the name the user sees for the contact, or clears
+// it when no nickname is given.
+func (s *UserServiceServer) SetContactNickname(ctx context.Context, req *pb.SetContactNicknameRequest) (*pb.Contact, error) {
+	var nickname *string
+	if req.Nickname != nil {
+		normalized, err := lib.NormalizeProfileText(*req.Nickname, lib.NicknameMaxLength)
+		if err != nil {
+			span := trace.SpanFromContext(ctx)
+			span.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+				attribute.String("field", "nickname"),
+			))
+			return nil, err
+		}
+		nickname = &normalized
+	}
+
+	return s.updateContact(ctx, queries.QuerySetContactNickname, req.UserId, req.ContactUserId, func(ctx context.Context) (*repo.Contact, error) {
+		return repo.SetContactNickname(ctx, s.db, req.UserId, req.ContactUserId, nickname)
+	})
+}
+
+// BlockUser stops the contact from paying the user and hides them from the
+// user's suggestions. It also removes them from the favorites.
+func (s *UserServiceServer) BlockUser(ctx context.Context, req *pb.ContactRequest) (*pb.Contact, error) {
+	return s.updateContact(ctx, queries.QuerySetContactBlocked, req.UserId, req.ContactUserId, func(ctx context.Context) (*repo.Contact, error) {
+		return repo.SetContactBlocked(ctx, s.db, req.UserId, req.ContactUserId, true)
+	})
+}
+
+func (s *UserServiceServer) UnblockUser(ctx context.Context, req *pb.ContactRequest) (*pb.Contact, error) {
+	return s.updateContact(ctx, queries.QuerySetContactBlocked, req.UserId, req.ContactUserId, func(ctx context.Context) (*repo.Contact, error) {
+		return repo.SetContactBlocked(ctx, s.db, req.UserId, req.ContactUserId, false)
+	})
+}
+
+// ListContacts returns favorites first, then nicknamed and blocked contacts,
+// each sorted by the name the user sees.
+func (s *UserServiceServer) ListContacts(ctx context.Context, req *pb.ListContactsRequest) (*pb.ListContactsResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_DB_GET_CONTACTS)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetContacts),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	contacts, err := repo.GetContacts(ctx, s.db, req.UserId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+
+	dbSpan.SetAttributes(
+		attribute.Int(lib.ATTR_CONTACT_COUNT, len(contacts)),
+	)
+
+	pbContacts := make([]*pb.Contact, len(contacts))
+	for i, contact := range contacts {
+		pbContacts[i] = repo.DbContactToPbContact(contact)
+	}
+
+	return &pb.ListContactsResponse{Contacts: pbContacts}, nil
+}
+
+// GetBlockStatus reports whether user_id has blocked other_user_id. It is
+// meant for services that act on behalf of other_user_id, so the blocked user
+// itself never learns about the block from it.
+func (s *UserServiceServer) GetBlockStatus(ctx context.Context, req *pb.GetBlockStatusRequest) (*pb.BlockStatus, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_CONTACT_USER_ID, req.OtherUserId),
+	)
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_DB_GET_CONTACT_BLOCK)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetContactBlocked),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId, req.OtherUserId}),
+	)
+
+	blocked, err := repo.IsContactBlocked(ctx, s.db, req.UserId, req.OtherUserId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+
+	return &pb.BlockStatus{Blocked: blocked}, nil
+}
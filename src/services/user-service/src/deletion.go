@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"user-service/src/lib"
+	"user-service/src/queries"
+	"user-service/src/repo"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+
+	paymentPb "protobufs/gen/go/payment-service"
+	tbPb "protobufs/gen/go/tigerbeetle-service"
+	pb "protobufs/gen/go/user-service"
+)
+
+// closeAccount closes the user's TigerBeetle account and returns the closing
+// transfer, or an empty id when the account was already closed.
+func (s *UserServiceServer) closeAccount(ctx context.Context, tracer trace.Tracer, userId string) (string, error) {
+	ctx, closeSpan := tracer.Start(ctx, lib.EVENT_TB_CLOSE_ACCOUNT)
+	defer closeSpan.End()
+
+	closeSpan.SetAttributes(
+		attribute.String(lib.ATTR_TB_ACCOUNT_ID, userId),
+	)
+
+	closing, err := s.tigerbeetleService.CloseAccount(ctx, &tbPb.AccountId{AccountId: userId})
+	if err != nil {
+		if status.Convert(err).Message() == lib.ErrAccountClosed.Error() {
+			closeSpan.AddEvent(lib.EVENT_ACCOUNT_ALREADY_CLOSED)
+			return "", nil
+		}
+		closeSpan.RecordError(err)
+		return "", lib.ErrUnexpected
+	}
+
+	return closing.TransferId, nil
+}
+
+func (s *UserServiceServer) reopenAccount(ctx context.Context, tracer trace.Tracer, userId, closingTransferId string) error {
+	ctx, reopenSpan := tracer.Start(ctx, lib.EVENT_TB_REOPEN_ACCOUNT)
+	defer reopenSpan.End()
+
+	reopenSpan.SetAttributes(
+		attribute.String(lib.ATTR_TB_ACCOUNT_ID, userId),
+		attribute.String(lib.ATTR_TRANSFER_ID, closingTransferId),
+	)
+
+	_, err := s.tigerbeetleService.VoidPendingTransfer(ctx, &tbPb.VoidPendingTransferRequest{
+		DebitAccountId:    userId,
+		CreditAccountId:   lib.SYSTEM_FLOAT_ACCOUNT_ID,
+		Amount:            "0",
+		PendingTransferId: closingTransferId,
+	})
+	if err != nil {
+		reopenSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	return nil
+}
+
+// checkAccountEmpty fails with ErrBalanceNotZero unless the account and every
+// open pot are empty.
+func (s *UserServiceServer) checkAccountEmpty(ctx context.Context, tracer trace.Tracer, userId string) error {
+	ctx, checkSpan := tracer.Start(ctx, lib.EVENT_USER_BALANCE_CHECK)
+	defer checkSpan.End()
+
+	checkSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetActivePots),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{userId}),
+	)
+
+	account, err := s.tigerbeetleService.LookupAccount(ctx, &tbPb.AccountId{AccountId: userId})
+	if err != nil {
+		checkSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+	empty, err := repo.AccountEmpty(account)
+	if err != nil {
+		checkSpan.RecordError(err)
+		return err
+	}
+
+	pots := []repo.Pot{}
+	err = s.db.SelectContext(ctx, &pots, queries.QueryGetActivePots, userId)
+	if err != nil {
+		checkSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+	_, potsTotal, err := s.potsWithBalances(ctx, tracer, pots)
+	if err != nil {
+		return err
+	}
+
+	if !empty || potsTotal.Cmp(big.NewInt(0)) != 0 {
+		checkSpan.AddEvent(lib.EVENT_USER_BALANCE_NOT_ZERO)
+		return lib.ErrBalanceNotZero
+	}
+
+	return nil
+}
+
+// finishDeletion closes every ledger account of a pseudonymized user, pots
+// included, and has payment-service revoke payment links, refund held escrows
+// and stop round-ups. Every step tolerates having run before, so it is retried
+// by the deletion worker until the user is marked as fully deleted.
+func (s *UserServiceServer) finishDeletion(ctx context.Context, tracer trace.Tracer, userId string) error {
+	ctx, finishSpan := tracer.Start(ctx, lib.EVENT_USER_DELETION_FINISH)
+	defer finishSpan.End()
+
+	finishSpan.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, userId),
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetUserPotIds),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{userId}),
+	)
+
+	potIds, err := repo.GetUserPotIds(ctx, s.db, userId)
+	if err != nil {
+		finishSpan.RecordError(err)
+		return err
+	}
+
+	finishSpan.SetAttributes(
+		attribute.Int(lib.ATTR_POT_COUNT, len(potIds)),
+	)
+
+	// The main account is normally closed already. Closing it again covers a
+	// deletion whose account was reopened after the pseudonymization failed
+	// to report back.
+	for _, accountId := range append([]string{userId}, potIds...) {
+		if _, err := s.closeAccount(ctx, tracer, accountId); err != nil {
+			finishSpan.RecordError(err)
+			return err
+		}
+	}
+
+	ctx, revokeSpan := tracer.Start(ctx, lib.EVENT_USER_PAYMENTS_REVOKE)
+	defer revokeSpan.End()
+
+	revoked, err := s.paymentService.RevokeUserPayments(ctx, &paymentPb.RevokeUserPaymentsRequest{UserId: userId})
+	if err != nil {
+		revokeSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	revokeSpan.SetAttributes(
+		attribute.Int(lib.ATTR_PAYMENT_LINKS_REVOKED, int(revoked.PaymentLinksRevoked)),
+		attribute.Int(lib.ATTR_ESCROWS_REFUNDED, int(revoked.EscrowsRefunded)),
+		attribute.Int(lib.ATTR_BULK_PAYMENTS_REJECTED, int(revoked.BulkPaymentsRejected)),
+		attribute.Bool(lib.ATTR_ROUND_UP_RULE_DISABLED, revoked.RoundUpRuleDisabled),
+	)
+	revokeSpan.End()
+
+	if err := repo.CompleteUserDeletion(ctx, s.db, userId); err != nil {
+		finishSpan.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *UserServiceServer) sweepUnfinishedDeletions(ctx context.Context) {
+	tracer := otel.Tracer(lib.ServiceName)
+
+	ctx, sweepSpan := tracer.Start(ctx, lib.EVENT_USER_DELETION_SWEEP)
+	defer sweepSpan.End()
+
+	userIds, err := repo.GetUnfinishedDeletions(ctx, s.db, lib.DeletionWorkerBatchSize)
+	if err != nil {
+		sweepSpan.RecordError(err)
+		return
+	}
+
+	for _, userId := range userIds {
+		if err := s.finishDeletion(ctx, tracer, userId); err != nil {
+			slog.Error("Failed to finish user deletion", "user", userId, "error", err)
+		}
+	}
+}
+
+func (s *UserServiceServer) runDeletionWorker(ctx context.Context) {
+	ticker := time.NewTicker(lib.DeletionWorkerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweepUnfinishedDeletions(ctx)
+		}
+	}
+}
+
+// DeleteUser closes the account of a user with a zero balance and
+// pseudonymizes their personal details. Ledger records keep the user id and
+// show the user as deleted. Users with a second factor have to confirm with a
+// code.
+//
+// The TigerBeetle account is closed before the balance is checked, so no
+// transfer can land in between. When the check or the pseudonymization fails
+// the account is reopened, so a user who is still live keeps a working
+// account. Once pseudonymized, the deletion is finished by closing the pots
+// and revoking what payment-service still holds; if that stops part way, the
+// deletion worker picks it up again.
+func (s *UserServiceServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.Empty, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	ctx, dbGetUserSpan := tracer.Start(ctx, lib.EVENT_DB_GET_USER)
+	defer dbGetUserSpan.End()
+
+	dbGetUserSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetUserById),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	user := repo.User{}
+	err := s.db.GetContext(ctx, &user, queries.QueryGetUserById, req.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			dbGetUserSpan.AddEvent(lib.EVENT_USER_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		}
+		dbGetUserSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbGetUserSpan.End()
+
+	factor, err := repo.GetTotpFactor(ctx, s.db, user.UserId)
+	if err != nil && err != lib.ErrNotFound {
+		return nil, err
+	}
+	if factor != nil && factor.ConfirmedAt != nil {
+		if err := s.verifySecondFactor(ctx, tracer, user.UserId, lib.StringOrEmpty(req.Code)); err != nil {
+			return nil, err
+		}
+	}
+
+	closingTransferId, err := s.closeAccount(ctx, tracer, user.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkAccountEmpty(ctx, tracer, user.UserId); err != nil {
+		if closingTransferId != "" {
+			if err := s.reopenAccount(ctx, tracer, user.UserId, closingTransferId); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	ctx, deleteSpan := tracer.Start(ctx, lib.EVENT_DB_DELETE_USER)
+	defer deleteSpan.End()
+
+	deleteSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryDeleteUser),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{user.UserId}),
+	)
+
+	sessionIds, err := repo.DeleteUser(ctx, s.db, user.UserId)
+	if err != nil {
+		if err == lib.ErrNotFound {
+			deleteSpan.AddEvent(lib.EVENT_USER_NOT_FOUND)
+			return nil, err
+		}
+		deleteSpan.RecordError(err)
+		if closingTransferId != "" {
+			if err := s.reopenAccount(ctx, tracer, user.UserId, closingTransferId); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+	for _, sessionId := range sessionIds {
+		s.sessionRevocations.Revoke(sessionId)
+	}
+
+	deleteSpan.SetAttributes(
+		attribute.Int(lib.ATTR_DB_ROWS_AFFECTED, len(sessionIds)),
+	)
+
+	if err := repo.RecordSecurityEvent(ctx, s.db, user.UserId, nil, lib.SECURITY_EVENT_ACCOUNT_DELETED, ""); err != nil {
+		deleteSpan.RecordError(err)
+		return nil, err
+	}
+	deleteSpan.End()
+
+	// The user is gone at this point, so a failure here is left to the
+	// deletion worker instead of being reported back.
+	if err := s.finishDeletion(ctx, tracer, user.UserId); err != nil {
+		span.AddEvent(lib.EVENT_USER_DELETION_DEFERRED)
+	}
+
+	return &pb.Empty{}, nil
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"slices"
+	"time"
+
+	"user-service/src/lib"
+	"user-service/src/queries"
+	"user-service/src/repo"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+
+	paymentPb "protobufs/gen/go/payment-service"
+	pb "protobufs/gen/go/user-service"
+)
+
+// exportRows loads one table section of a data export.
+func exportRows[T any](ctx context.Context, tracer trace.Tracer, db *sqlx.DB, userId, name, description, query string, load func(context.Context, *sqlx.DB, string) ([]T, error)) (lib.ExportFile, error) {
+	ctx, sectionSpan := tracer.Start(ctx, lib.EVENT_EXPORT_SECTION)
+	defer sectionSpan.End()
+
+	sectionSpan.SetAttributes(
+		attribute.String(lib.ATTR_EXPORT_SECTION, name),
+		attribute.String(lib.ATTR_DB_QUERY, query),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{userId}),
+	)
+
+	rows, err := load(ctx, db, userId)
+	if err != nil {
+		sectionSpan.RecordError(err)
+		return lib.ExportFile{}, err
+	}
+
+	sectionSpan.SetAttributes(
+		attribute.Int(lib.ATTR_EXPORT_RECORD_COUNT, len(rows)),
+	)
+
+	return lib.ExportFile{Name: name, Description: description, Records: len(rows), Data: rows}, nil
+}
+
+func (s *UserServiceServer) exportProfile(ctx context.Context, tracer trace.Tracer, user repo.User) (lib.ExportFile, error) {
+	verification, err := s.getKycVerification(ctx, tracer, user.UserId)
+	if err != nil {
+		return lib.ExportFile{}, err
+	}
+
+	ctx, sectionSpan := tracer.Start(ctx, lib.EVENT_EXPORT_SECTION)
+	defer sectionSpan.End()
+
+	sectionSpan.SetAttributes(
+		attribute.String(lib.ATTR_EXPORT_SECTION, lib.EXPORT_FILE_PROFILE),
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetTotpFactor),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{user.UserId}),
+	)
+
+	totp := repo.ExportTotp{}
+	factor, err := repo.GetTotpFactor(ctx, s.db, user.UserId)
+	if err != nil && err != lib.ErrNotFound {
+		sectionSpan.RecordError(err)
+		return lib.ExportFile{}, err
+	}
+	if factor != nil {
+		totp.Enabled = factor.ConfirmedAt != nil
+		totp.ConfirmedAt = factor.ConfirmedAt
+	}
+
+	profile := repo.ExportProfile{
+		UserId:       user.UserId,
+		PhoneNumber:  user.PhoneNumber,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		Address:      user.Address,
+		BirthDate:    user.BirthDate.Format(time.DateOnly),
+		CreatedAt:    user.CreatedAt,
+		Discoverable: user.Discoverable,
+		Kyc: repo.ExportKycStatus{
+			Status:     lib.EffectiveKycStatus(verification.Status, verification.Expires, time.Now()),
+			VerifiedAt: verification.VerifiedAt,
+			Expires:    verification.Expires,
+		},
+		Totp: totp,
+	}
+
+	return lib.ExportFile{
+		Name:        lib.EXPORT_FILE_PROFILE,
+		Description: "Profile, identity verification status and second factor",
+		Records:     1,
+		Data:        profile,
+	}, nil
+}
+
+func (s *UserServiceServer) exportPots(ctx context.Context, tracer trace.Tracer, userId string) (lib.ExportFile, error) {
+	file, err := exportRows(ctx, tracer, s.db, userId, lib.EXPORT_FILE_POTS,
+		"Savings pots, including closed ones, with their current balances", queries.QueryExportPots, repo.ExportPots)
+	if err != nil {
+		return file, err
+	}
+
+	pbPots, _, err := s.potsWithBalances(ctx, tracer, file.Data.([]repo.Pot))
+	if err != nil {
+		return file, err
+	}
+
+	pots := make([]repo.ExportPot, len(pbPots))
+	for i, pbPot := range pbPots {
+		pots[i], err = repo.PbPotToExportPot(pbPot)
+		if err != nil {
+			return file, err
+		}
+	}
+	file.Data = pots
+
+	return file, nil
+}
+
+// exportLedger lists every transfer on the user's account, oldest first, with
+// the amount signed from the user's point of view.
+func (s *UserServiceServer) exportLedger(ctx context.Context, tracer trace.Tracer, userId string, generatedAt time.Time) (lib.ExportFile, error) {
+	transfers, err := s.getAllAccountTransfers(ctx, tracer, userId, time.Unix(0, 0), generatedAt)
+	if err != nil {
+		return lib.ExportFile{}, err
+	}
+	slices.Reverse(transfers)
+
+	pbTransfers, err := s.transfersWithDetails(ctx, tracer, userId, transfers)
+	if err != nil {
+		return lib.ExportFile{}, err
+	}
+
+	entries := make([]repo.ExportLedgerEntry, len(transfers))
+	for i, transfer := range transfers {
+		amount, err := repo.TransferNetAmount(transfer, userId)
+		if err != nil {
+			return lib.ExportFile{}, lib.ErrUnexpected
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, transfer.Timestamp)
+		if err != nil {
+			return lib.ExportFile{}, lib.ErrUnexpected
+		}
+
+		status := lib.EXPORT_TRANSFER_POSTED
+		switch {
+		case transfer.Voided:
+			status = lib.EXPORT_TRANSFER_VOIDED
+		case transfer.Pending:
+			status = lib.EXPORT_TRANSFER_PENDING
+		}
+
+		entries[i] = repo.ExportLedgerEntry{
+			TransferId:  transfer.TransferId,
+			Timestamp:   timestamp,
+			Description: repo.TransferDescription(pbTransfers[i]),
+			Amount:      lib.FormatMinorUnits(amount),
+			Status:      status,
+			Category:    pbTransfers[i].Category,
+			Memo:        pbTransfers[i].Memo,
+			Reference:   pbTransfers[i].Reference,
+		}
+	}
+
+	return lib.ExportFile{
+		Name:        lib.EXPORT_FILE_LEDGER,
+		Description: "Every transfer on the account, oldest first, signed from the account holder's side",
+		Records:     len(entries),
+		Data:        entries,
+	}, nil
+}
+
+// exportPotLedgers lists every transfer on each of the user's pots, closed
+// ones included, signed from the pot's side.
+func (s *UserServiceServer) exportPotLedgers(ctx context.Context, tracer trace.Tracer, userId string, generatedAt time.Time) (lib.ExportFile, error) {
+	pots, err := repo.ExportPots(ctx, s.db, userId)
+	if err != nil {
+		return lib.ExportFile{}, err
+	}
+
+	ledgers := make([]repo.ExportPotLedger, len(pots))
+	records := 0
+	for i, pot := range pots {
+		transfers, err := s.getAllAccountTransfers(ctx, tracer, pot.PotId, time.Unix(0, 0), generatedAt)
+		if err != nil {
+			return lib.ExportFile{}, err
+		}
+		slices.Reverse(transfers)
+
+		entries := make([]repo.ExportPotLedgerEntry, len(transfers))
+		for j, transfer := range transfers {
+			amount, err := repo.TransferNetAmount(transfer, pot.PotId)
+			if err != nil {
+				return lib.ExportFile{}, lib.ErrUnexpected
+			}
+			timestamp, err := time.Parse(time.RFC3339Nano, transfer.Timestamp)
+			if err != nil {
+				return lib.ExportFile{}, lib.ErrUnexpected
+			}
+
+			status := lib.EXPORT_TRANSFER_POSTED
+			switch {
+			case transfer.Voided:
+				status = lib.EXPORT_TRANSFER_VOIDED
+			case transfer.Pending:
+				status = lib.EXPORT_TRANSFER_PENDING
+			}
+
+			entries[j] = repo.ExportPotLedgerEntry{
+				TransferId: transfer.TransferId,
+				Timestamp:  timestamp,
+				Amount:     lib.FormatMinorUnits(amount),
+				Status:     status,
+			}
+		}
+
+		ledgers[i] = repo.ExportPotLedger{PotId: pot.PotId, Name: pot.Name, Entries: entries}
+		records += len(entries)
+	}
+
+	return lib.ExportFile{
+		Name:        lib.EXPORT_FILE_POT_LEDGERS,
+		Description: "Every transfer on each savings pot, oldest first, signed from the pot's side",
+		Records:     records,
+		Data:        ledgers,
+	}, nil
+}
+
+// exportStatements adds the statement list and then each statement's PDF and
+// CSV, loading one statement's documents at a time.
+func (s *UserServiceServer) exportStatements(ctx context.Context, tracer trace.Tracer, userId string, archive *lib.ExportArchive) error {
+	file, err := exportRows(ctx, tracer, s.db, userId, lib.EXPORT_FILE_STATEMENTS,
+		"Monthly statements, with their documents under "+lib.EXPORT_STATEMENTS_DIR, queries.QueryExportStatements, repo.ExportStatements)
+	if err != nil {
+		return err
+	}
+
+	dbStatements := file.Data.([]repo.Statement)
+	statements := make([]repo.ExportStatement, len(dbStatements))
+	for i, statement := range dbStatements {
+		statements[i], err = repo.DbStatementToExportStatement(statement)
+		if err != nil {
+			return err
+		}
+	}
+	file.Data = statements
+
+	if err := archive.Add(file); err != nil {
+		return lib.ErrUnexpected
+	}
+
+	for _, statement := range dbStatements {
+		ctx, dbSpan := tracer.Start(ctx, lib.EVENT_DB_GET_STATEMENT)
+
+		dbSpan.SetAttributes(
+			attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetStatementFiles),
+			attribute.StringSlice(lib.ATTR_DB_ARGS, []string{statement.StatementId, userId}),
+		)
+
+		files := repo.StatementFiles{}
+		err := s.db.GetContext(ctx, &files, queries.QueryGetStatementFiles, statement.StatementId, userId)
+		if err != nil {
+			dbSpan.RecordError(err)
+			dbSpan.End()
+			return lib.ErrUnexpected
+		}
+		dbSpan.End()
+
+		documents := []lib.ExportFile{
+			{
+				Name:        lib.EXPORT_STATEMENTS_DIR + lib.StatementFilename(files.Month, lib.STATEMENT_FORMAT_PDF),
+				Description: "Statement for " + lib.FormatStatementMonth(files.Month),
+				Records:     1,
+				Content:     files.Pdf,
+			},
+			{
+				Name:        lib.EXPORT_STATEMENTS_DIR + lib.StatementFilename(files.Month, lib.STATEMENT_FORMAT_CSV),
+				Description: "Statement for " + lib.FormatStatementMonth(files.Month),
+				Records:     1,
+				Content:     files.Csv,
+			},
+		}
+		for _, document := range documents {
+			if err := archive.Add(document); err != nil {
+				return lib.ErrUnexpected
+			}
+		}
+	}
+
+	return nil
+}
+
+// exportPaymentData adds the sections payment-service holds on the user, such
+// as payment links, escrows and limits, as they arrive.
+func (s *UserServiceServer) exportPaymentData(ctx context.Context, tracer trace.Tracer, userId string, archive *lib.ExportArchive) error {
+	ctx, paymentDataSpan := tracer.Start(ctx, lib.EVENT_EXPORT_PAYMENT_DATA)
+	defer paymentDataSpan.End()
+
+	sections, err := s.paymentService.ExportUserPaymentData(ctx, &paymentPb.ExportUserPaymentDataRequest{UserId: userId})
+	if err != nil {
+		paymentDataSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	for {
+		section, err := sections.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			paymentDataSpan.RecordError(err)
+			return lib.ErrUnexpected
+		}
+
+		paymentDataSpan.AddEvent(lib.EVENT_EXPORT_SECTION, trace.WithAttributes(
+			attribute.String(lib.ATTR_EXPORT_SECTION, section.Name),
+			attribute.Int(lib.ATTR_EXPORT_RECORD_COUNT, int(section.Records)),
+		))
+
+		err = archive.Add(lib.ExportFile{
+			Name:        section.Name,
+			Description: section.Description,
+			Records:     int(section.Records),
+			Content:     section.Content,
+		})
+		if err != nil {
+			paymentDataSpan.RecordError(err)
+			return lib.ErrUnexpected
+		}
+	}
+
+	return nil
+}
+
+// ExportUserData streams everything held on the user, including what
+// payment-service holds, as a zip of JSON files with a manifest. Documents
+// submitted for identity verification are described but not included.
+//
+// The zip is written as it is built and sent in chunks of lib.ExportChunkSize.
+// The first message also carries the filename, content type and generation
+// time, and the last one carries only the checksum of the whole zip.
+func (s *UserServiceServer) ExportUserData(req *pb.ExportUserDataRequest, stream grpc.ServerStreamingServer[pb.UserDataExport]) error {
+	ctx := stream.Context()
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	lockoutKeys := []string{lib.DataExportUserLimit.Key(req.UserId)}
+	if err := s.checkAuthLockout(ctx, tracer, lockoutKeys); err != nil {
+		return err
+	}
+
+	ctx, dbGetUserSpan := tracer.Start(ctx, lib.EVENT_DB_GET_USER)
+	defer dbGetUserSpan.End()
+
+	dbGetUserSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetUserById),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	user := repo.User{}
+	err := s.db.GetContext(ctx, &user, queries.QueryGetUserById, req.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			dbGetUserSpan.AddEvent(lib.EVENT_USER_NOT_FOUND)
+			return lib.ErrNotFound
+		}
+		dbGetUserSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+	dbGetUserSpan.End()
+
+	if err := s.recordAuthAttempt(ctx, tracer, lib.DataExportUserLimit, req.UserId); err != nil {
+		return err
+	}
+
+	generatedAt := time.Now().UTC()
+	filename := lib.ExportFilename(generatedAt)
+
+	first := true
+	chunks := lib.NewExportChunkWriter(func(chunk []byte) error {
+		message := &pb.UserDataExport{Content: chunk}
+		if first {
+			message.Filename = filename
+			message.ContentType = lib.ExportContentType
+			message.GeneratedAt = generatedAt.Format(time.RFC3339)
+			first = false
+		}
+		return stream.Send(message)
+	})
+	archive := lib.NewExportArchive(chunks, user.UserId, generatedAt)
+
+	add := func(file lib.ExportFile, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := archive.Add(file); err != nil {
+			span.RecordError(err)
+			return lib.ErrUnexpected
+		}
+		return nil
+	}
+
+	sections := []func() error{
+		func() error {
+			return add(s.exportProfile(ctx, tracer, user))
+		},
+		func() error {
+			return add(exportRows(ctx, tracer, s.db, user.UserId, lib.EXPORT_FILE_PROFILE_HISTORY,
+				"Changes to name, address and phone number", queries.QueryExportProfileHistory, repo.ExportProfileHistory))
+		},
+		func() error {
+			return add(exportRows(ctx, tracer, s.db, user.UserId, lib.EXPORT_FILE_SESSIONS,
+				"Sessions, including expired and signed out ones", queries.QueryExportSessions, repo.ExportSessions))
+		},
+		func() error {
+			return add(exportRows(ctx, tracer, s.db, user.UserId, lib.EXPORT_FILE_SECURITY_EVENTS,
+				"Security events such as second factor and phone number changes", queries.QueryExportSecurityEvents, repo.ExportSecurityEvents))
+		},
+		func() error {
+			return add(exportRows(ctx, tracer, s.db, user.UserId, lib.EXPORT_FILE_KYC_SUBMISSIONS,
+				"Identity verification submissions, without document numbers and images", queries.QueryExportKycSubmissions, repo.ExportKycSubmissions))
+		},
+		func() error {
+			return add(exportRows(ctx, tracer, s.db, user.UserId, lib.EXPORT_FILE_CONTACTS,
+				"Contacts with their nicknames, favorites and blocks", queries.QueryExportContacts, repo.ExportContacts))
+		},
+		func() error {
+			return add(exportRows(ctx, tracer, s.db, user.UserId, lib.EXPORT_FILE_TRANSFER_CATEGORIES,
+				"Categories set on single transfers", queries.QueryExportTransferCategories, repo.ExportTransferCategories))
+		},
+		func() error {
+			return add(exportRows(ctx, tracer, s.db, user.UserId, lib.EXPORT_FILE_COUNTERPARTY_CATEGORIES,
+				"Categories set for every transfer with a counterparty", queries.QueryExportCounterpartyCategories, repo.ExportCounterpartyCategories))
+		},
+		func() error {
+			return add(exportRows(ctx, tracer, s.db, user.UserId, lib.EXPORT_FILE_PAYMENTS,
+				"Payments sent and received", queries.QueryExportPayments, repo.ExportPayments))
+		},
+		func() error {
+			return add(exportRows(ctx, tracer, s.db, user.UserId, lib.EXPORT_FILE_DEPOSITS,
+				"Card deposits", queries.QueryExportDeposits, repo.ExportDeposits))
+		},
+		func() error {
+			return add(exportRows(ctx, tracer, s.db, user.UserId, lib.EXPORT_FILE_PAYOUTS,
+				"Payouts to bank accounts", queries.QueryExportPayouts, repo.ExportPayouts))
+		},
+		func() error {
+			return add(s.exportPots(ctx, tracer, user.UserId))
+		},
+		func() error {
+			return add(s.exportLedger(ctx, tracer, user.UserId, generatedAt))
+		},
+		func() error {
+			return add(s.exportPotLedgers(ctx, tracer, user.UserId, generatedAt))
+		},
+		func() error {
+			return s.exportStatements(ctx, tracer, user.UserId, archive)
+		},
+		func() error {
+			return s.exportPaymentData(ctx, tracer, user.UserId, archive)
+		},
+	}
+
+	for _, section := range sections {
+		if err := section(); err != nil {
+			return err
+		}
+	}
+
+	ctx, buildSpan := tracer.Start(ctx, lib.EVENT_EXPORT_BUILD)
+	defer buildSpan.End()
+
+	if err := archive.Close(); err != nil {
+		buildSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+	if err := chunks.Flush(); err != nil {
+		buildSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	buildSpan.SetAttributes(
+		attribute.Int(lib.ATTR_EXPORT_SIZE, chunks.Size()),
+	)
+
+	if err := repo.RecordSecurityEvent(ctx, s.db, user.UserId, nil, lib.SECURITY_EVENT_DATA_EXPORTED, filename); err != nil {
+		buildSpan.RecordError(err)
+		return err
+	}
+	buildSpan.End()
+
+	return stream.Send(&pb.UserDataExport{
+		Checksum: chunks.Checksum(),
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"user-service/src/lib"
+
+	"go.opentelemetry.io/otel/trace"
+
+	pb "protobufs/gen/go/user-service"
+)
+
+func (s *UserServiceServer) GetJwks(ctx context.Context, req *pb.Empty) (*pb.Jwks, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	_, jwksSpan := tracer.Start(ctx, lib.EVENT_JWKS_BUILD)
+	defer jwksSpan.End()
+
+	jwks, err := s.tokenService.Jwks()
+	if err != nil {
+		jwksSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	jwksSpan.End()
+
+	keys := make([]*pb.Jwk, len(jwks))
+	for i, jwk := range jwks {
+		keys[i] = &pb.Jwk{
+			Kty: jwk.Kty,
+			Crv: jwk.Crv,
+			Kid: jwk.Kid,
+			Use: jwk.Use,
+			Alg: jwk.Alg,
+			X:   jwk.X,
+		}
+		if jwk.Y != "" {
+			keys[i].Y = &jwk.Y
+		}
+	}
+
+	return &pb.Jwks{Keys: keys}, nil
+}
+
+// serveJwks publishes the verification keys at the well-known path for
+// verifiers that cannot call the grpc service.
+func (s *UserServiceServer) serveJwks(port string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		jwks, err := s.tokenService.Jwks()
+		if err != nil {
+			slog.Error("Failed to build JWKS", "error", err)
+			http.Error(w, lib.ErrUnexpected.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(map[string][]lib.Jwk{"keys": jwks})
+	})
+
+	slog.Info("Serving JWKS", "port", port)
+	if err := http.ListenAndServe("0.0.0.0:"+port, mux); err != nil {
+		slog.Error("JWKS server stopped", "error", err)
+	}
+}
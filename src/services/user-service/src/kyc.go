@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"user-service/src/lib"
+	"user-service/src/queries"
+	"user-service/src/repo"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "protobufs/gen/go/user-service"
+)
+
+const kycDecidedByReview = "review"
+
+func (s *UserServiceServer) getKycVerification(ctx context.Context, tracer trace.Tracer, userId string) (*repo.KycVerification, error) {
+	ctx, getSpan := tracer.Start(ctx, lib.EVENT_KYC_GET)
+	defer getSpan.End()
+
+	getSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetKycVerification),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{userId}),
+	)
+
+	verification, err := repo.GetKycVerification(ctx, s.db, userId)
+	if err != nil {
+		getSpan.RecordError(err)
+		return nil, err
+	}
+
+	getSpan.SetAttributes(
+		attribute.String(lib.ATTR_KYC_STATUS, verification.Status),
+	)
+
+	return verification, nil
+}
+
+func (s *UserServiceServer) decideKyc(ctx context.Context, tracer trace.Tracer, submissionId string, decision lib.KycDecision, documentExpires time.Time, decidedBy string) error {
+	ctx, decideSpan := tracer.Start(ctx, lib.EVENT_KYC_DECIDE)
+	defer decideSpan.End()
+
+	decideSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryDecideKyc),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{submissionId, decision.Status, decision.Reason, decidedBy}),
+	)
+
+	err := repo.DecideKyc(ctx, s.db, submissionId, decision, documentExpires, decidedBy)
+	if err != nil {
+		if err == lib.ErrConflict {
+			decideSpan.AddEvent(lib.EVENT_KYC_TRANSITION_DENIED)
+			return err
+		}
+		decideSpan.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+// SubmitKycDocuments moves the user to pending and hands the document to the
+// verifier. When the verifier fails or asks for a manual review, the user
+// stays pending until ReviewKycSubmission decides.
+func (s *UserServiceServer) SubmitKycDocuments(ctx context.Context, req *pb.SubmitKycDocumentsRequest) (*pb.KycStatus, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_KYC_DOCUMENT_TYPE, req.DocumentType),
+	)
+
+	ctx, validateSpan := tracer.Start(ctx, lib.EVENT_KYC_VALIDATE)
+	defer validateSpan.End()
+
+	document, err := lib.NewKycDocument(req.DocumentType, req.DocumentNumber, req.IssuingCountry, req.DocumentExpires, req.DocumentImage)
+	if err != nil {
+		validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED)
+		return nil, err
+	}
+	validateSpan.End()
+
+	lockoutKeys := []string{lib.KycSubmissionUserLimit.Key(req.UserId)}
+	if err := s.checkAuthLockout(ctx, tracer, lockoutKeys); err != nil {
+		return nil, err
+	}
+	if err := s.recordAuthAttempt(ctx, tracer, lib.KycSubmissionUserLimit, req.UserId); err != nil {
+		return nil, err
+	}
+
+	ctx, dbGetUserSpan := tracer.Start(ctx, lib.EVENT_DB_GET_USER)
+	defer dbGetUserSpan.End()
+
+	dbGetUserSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetUserById),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	user := repo.User{}
+	err = s.db.GetContext(ctx, &user, queries.QueryGetUserById, req.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			dbGetUserSpan.AddEvent(lib.EVENT_USER_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		}
+		dbGetUserSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbGetUserSpan.End()
+
+	verification, err := s.getKycVerification(ctx, tracer, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	status := lib.EffectiveKycStatus(verification.Status, verification.Expires, time.Now())
+	if !lib.KycTransitionAllowed(status, lib.KYC_STATUS_PENDING) {
+		span.AddEvent(lib.EVENT_KYC_TRANSITION_DENIED, trace.WithAttributes(
+			attribute.String(lib.ATTR_KYC_STATUS, status),
+		))
+		return nil, lib.ErrConflict
+	}
+
+	ctx, submitSpan := tracer.Start(ctx, lib.EVENT_KYC_SUBMIT)
+	defer submitSpan.End()
+
+	submissionId := uuid.NewString()
+
+	submitSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QuerySubmitKyc),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId, submissionId, verification.Status}),
+		attribute.String(lib.ATTR_KYC_SUBMISSION_ID, submissionId),
+	)
+
+	sealed := repo.SealedKycDocument{Document: document}
+	sealed.DocumentNumberCiphertext, err = s.secretBox.Seal([]byte(document.DocumentNumber))
+	if err != nil {
+		submitSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	if document.Image != nil {
+		sealed.ImageCiphertext, err = s.secretBox.Seal(document.Image)
+		if err != nil {
+			submitSpan.RecordError(err)
+			return nil, lib.ErrUnexpected
+		}
+	}
+
+	err = repo.SubmitKyc(ctx, s.db, req.UserId, submissionId, verification.Status, sealed)
+	if err != nil {
+		if err == lib.ErrConflict {
+			submitSpan.AddEvent(lib.EVENT_KYC_TRANSITION_DENIED)
+			return nil, err
+		}
+		submitSpan.RecordError(err)
+		return nil, err
+	}
+	submitSpan.End()
+
+	ctx, verifySpan := tracer.Start(ctx, lib.EVENT_KYC_VERIFY)
+	defer verifySpan.End()
+
+	decision, err := s.kycVerifier.Verify(ctx, lib.KycSubmission{
+		SubmissionId: submissionId,
+		UserId:       user.UserId,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		BirthDate:    user.BirthDate,
+		Document:     document,
+	})
+	if err != nil {
+		verifySpan.RecordError(err)
+		decision = lib.KycDecision{Status: lib.KYC_STATUS_PENDING}
+	}
+
+	verifySpan.SetAttributes(
+		attribute.String(lib.ATTR_KYC_STATUS, decision.Status),
+	)
+	verifySpan.End()
+
+	if decision.Status != lib.KYC_STATUS_PENDING {
+		err = s.decideKyc(ctx, tracer, submissionId, decision, document.DocumentExpires, s.config.KycVerifier)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetKycStatus(ctx, &pb.GetKycStatusRequest{UserId: req.UserId})
+}
+
+func (s *UserServiceServer) GetKycStatus(ctx context.Context, req *pb.GetKycStatusRequest) (*pb.KycStatus, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	verification, err := s.getKycVerification(ctx, tracer, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.DbKycVerificationToPbKycStatus(*verification, time.Now()), nil
+}
+
+// ReviewKycSubmission decides a submission the verifier left pending.
+func (s *UserServiceServer) ReviewKycSubmission(ctx context.Context, req *pb.ReviewKycSubmissionRequest) (*pb.KycStatus, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_KYC_SUBMISSION_ID, req.SubmissionId),
+		attribute.String(lib.ATTR_KYC_STATUS, req.Status),
+	)
+
+	if !lib.KycTransitionAllowed(lib.KYC_STATUS_PENDING, req.Status) {
+		span.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "status"),
+		))
+		return nil, lib.ErrUnacceptableRequest
+	}
+
+	ctx, getSpan := tracer.Start(ctx, lib.EVENT_KYC_GET)
+	defer getSpan.End()
+
+	getSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetKycSubmission),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.SubmissionId}),
+	)
+
+	submission, err := repo.GetKycSubmission(ctx, s.db, req.SubmissionId)
+	if err != nil {
+		if err == lib.ErrNotFound {
+			getSpan.AddEvent(lib.EVENT_KYC_SUBMISSION_MISSING)
+			return nil, err
+		}
+		getSpan.RecordError(err)
+		return nil, err
+	}
+	getSpan.End()
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, submission.UserId),
+	)
+
+	decision := lib.KycDecision{Status: req.Status, Reason: lib.StringOrEmpty(req.Reason)}
+	err = s.decideKyc(ctx, tracer, submission.SubmissionId, decision, submission.DocumentExpires, kycDecidedByReview)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetKycStatus(ctx, &pb.GetKycStatusRequest{UserId: submission.UserId})
+}
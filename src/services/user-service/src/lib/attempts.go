@@ -0,0 +1,117 @@
+package lib
+
+import (
+	"time"
+)
+
+const (
+	// Failed guesses before an OTP is invalidated.
+	MaxOTPAttempts = 5
+
+	// The n-th OTP request within the window must wait base * 2^(n-1) after
+	// the previous one, up to the max.
+	OTPRequestBaseBackoff = 30 * time.Second
+	OTPRequestMaxBackoff  = time.Hour
+	OTPRequestWindow      = 24 * time.Hour
+
+	RetryAfterMetadataKey = "retry-after"
+)
+
+// AttemptLimit locks a key (a phone number or IP address) once MaxAttempts
+// are recorded within Window.
+type AttemptLimit struct {
+	Prefix      string
+	MaxAttempts int
+	Window      time.Duration
+	Lockout     time.Duration
+}
+
+var (
+	LoginPhoneLimit = AttemptLimit{
+		Prefix:      "login_phone",
+		MaxAttempts: 10,
+		Window:      time.Hour,
+		Lockout:     time.Hour,
+	}
+	LoginIpLimit = AttemptLimit{
+		Prefix:      "login_ip",
+		MaxAttempts: 50,
+		Window:      time.Hour,
+		Lockout:     time.Hour,
+	}
+	MfaUserLimit = AttemptLimit{
+		Prefix:      "mfa_user",
+		MaxAttempts: 5,
+		Window:      15 * time.Minute,
+		Lockout:     15 * time.Minute,
+	}
+	// Every challenge sends a message, so creating them is limited too.
+	PaymentChallengeUserLimit = AttemptLimit{
+		Prefix:      "payment_challenge_user",
+		MaxAttempts: 20,
+		Window:      time.Hour,
+		Lockout:     time.Hour,
+	}
+	PhoneNumberChangeUserLimit = AttemptLimit{
+		Prefix:      "phone_number_change_user",
+		MaxAttempts: 5,
+		Window:      24 * time.Hour,
+		Lockout:     24 * time.Hour,
+	}
+	KycSubmissionUserLimit = AttemptLimit{
+		Prefix:      "kyc_submission_user",
+		MaxAttempts: 5,
+		Window:      24 * time.Hour,
+		Lockout:     24 * time.Hour,
+	}
+	// Exports read the whole ledger, so they are kept to a few a day.
+	DataExportUserLimit = AttemptLimit{
+		Prefix:      "data_export_user",
+		MaxAttempts: 3,
+		Window:      24 * time.Hour,
+		Lockout:     24 * time.Hour,
+	}
+	// Searches are limited so the user base cannot be enumerated through
+	// them.
+	UserSearchUserLimit = AttemptLimit{
+		Prefix:      "user_search_user",
+		MaxAttempts: 30,
+		Window:      10 * time.Minute,
+		Lockout:     time.Hour,
+	}
+	// Once a user has been found by phone number this often, they are left
+	// out of phone number results until the lockout ends.
+	UserSearchPhoneTargetLimit = AttemptLimit{
+		Prefix:      "user_search_phone_target",
+		MaxAttempts: 20,
+		Window:      time.Hour,
+		Lockout:     time.Hour,
+	}
+	OTPRequestIpLimit = AttemptLimit{
+		Prefix:      "otp_request_ip",
+		MaxAttempts: 20,
+		Window:      time.Hour,
+		Lockout:     time.Hour,
+	}
+)
+
+func (limit AttemptLimit) Key(value string) string {
+	return limit.Prefix + ":" + value
+}
+
+// NextOTPRequest returns when the next OTP may be requested and the request
+// count to store with it. Counts reset once the window has passed since the
+// previous request.
+func NextOTPRequest(lastRequestedAt *time.Time, requestCount int, now time.Time) (time.Time, int) {
+	if lastRequestedAt == nil || now.Sub(*lastRequestedAt) >= OTPRequestWindow || requestCount <= 0 {
+		return now, 1
+	}
+
+	backoff := OTPRequestBaseBackoff
+	for i := 1; i < requestCount && backoff < OTPRequestMaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, OTPRequestMaxBackoff)
+
+	return lastRequestedAt.Add(backoff), requestCount + 1
+}
@@ -14,8 +14,56 @@ const (
 
 	ATTR_SESSION_ID    = "auth.session.id"
 	ATTR_REFRESH_TOKEN = "auth.session.refresh_token"
+	ATTR_ACCESS_TOKEN  = "auth.session.access_token"
+	ATTR_IP_ADDRESS    = "auth.ip_address"
+
+	ATTR_REFRESH_GENERATION = "auth.session.refresh_generation"
+
+	ATTR_PAYMENT_CHALLENGE_ID  = "payment_challenge.id"
+	ATTR_PAYMENT_AMOUNT        = "payment_challenge.amount"
+	ATTR_PAYMENT_TO_USER_ID    = "payment_challenge.to_user_id"
+	ATTR_PAYMENT_BULK_BATCH_ID = "payment_challenge.bulk_batch_id"
+
+	ATTR_OTP_FAILED_ATTEMPTS = "auth.otp.failed_attempts"
+
+	ATTR_PHONE_NUMBER_CHANGE_ID = "user.phone_number_change.id"
+	ATTR_PROFILE_FIELDS         = "user.profile.fields"
+
+	ATTR_KYC_STATUS        = "kyc.status"
+	ATTR_KYC_SUBMISSION_ID = "kyc.submission_id"
+	ATTR_KYC_DOCUMENT_TYPE = "kyc.document_type"
 
 	ATTR_SUGGESTED_USERS_LIMIT = "suggested_users.limit"
+	ATTR_SUGGESTED_USERS_COUNT = "suggested_users.count"
+
+	ATTR_CONTACT_USER_ID = "contact.user_id"
+	ATTR_CONTACT_COUNT   = "contact.count"
+
+	ATTR_USER_SEARCH_KIND         = "user_search.kind"
+	ATTR_USER_SEARCH_LIMIT        = "user_search.limit"
+	ATTR_USER_SEARCH_RESULT_COUNT = "user_search.result_count"
+	ATTR_USER_DISCOVERABLE        = "user.discoverable"
+
+	ATTR_POT_ID     = "pot.id"
+	ATTR_POT_COUNT  = "pot.count"
+	ATTR_POT_AMOUNT = "pot.amount"
+
+	ATTR_TRANSFER_ID     = "transfer.id"
+	ATTR_COUNTERPARTY_ID = "category.counterparty_id"
+	ATTR_CATEGORY        = "category.name"
+
+	ATTR_STATEMENT_ID     = "statement.id"
+	ATTR_STATEMENT_MONTH  = "statement.month"
+	ATTR_STATEMENT_FORMAT = "statement.format"
+
+	ATTR_EXPORT_SECTION      = "export.section"
+	ATTR_EXPORT_RECORD_COUNT = "export.record_count"
+	ATTR_EXPORT_SIZE         = "export.size"
+
+	ATTR_PAYMENT_LINKS_REVOKED  = "deletion.payment_links_revoked"
+	ATTR_ESCROWS_REFUNDED       = "deletion.escrows_refunded"
+	ATTR_BULK_PAYMENTS_REJECTED = "deletion.bulk_payments_rejected"
+	ATTR_ROUND_UP_RULE_DISABLED = "deletion.round_up_rule_disabled"
 )
 
 const (
@@ -24,13 +72,54 @@ const (
 	EVENT_OTP_GET           = "auth.otp.get"
 	EVENT_OTP_VERIFY        = "auth.otp.verify"
 	EVENT_OTP_HASH_MISMATCH = "auth.otp.hash_mismatch"
+	EVENT_OTP_SEND          = "auth.otp.send"
+	EVENT_OTP_THROTTLE      = "auth.otp.throttle"
+	EVENT_OTP_THROTTLED     = "auth.otp.throttled"
+	EVENT_OTP_INVALIDATED   = "auth.otp.invalidated"
+	EVENT_OTP_CONSUME       = "auth.otp.consume"
+
+	EVENT_TOTP_ENROLL          = "auth.totp.enroll"
+	EVENT_TOTP_CONFIRM         = "auth.totp.confirm"
+	EVENT_TOTP_DISABLE         = "auth.totp.disable"
+	EVENT_MFA_VERIFY           = "auth.mfa.verify"
+	EVENT_MFA_MISMATCH         = "auth.mfa.mismatch"
+	EVENT_RECOVERY_CODE_USED   = "auth.mfa.recovery_code_used"
+	EVENT_RECOVERY_CODES_STORE = "auth.mfa.recovery_codes.store"
+	EVENT_SESSION_STEP_UP      = "auth.session.step_up"
+	EVENT_STEP_UP_CHECK        = "auth.session.step_up_check"
+	EVENT_STEP_UP_REQUIRED     = "auth.session.step_up_required"
+
+	EVENT_PAYMENT_CHALLENGE_CREATE     = "payment_challenge.create"
+	EVENT_PAYMENT_CHALLENGE_SEND       = "payment_challenge.send"
+	EVENT_PAYMENT_CHALLENGE_GET        = "payment_challenge.get"
+	EVENT_PAYMENT_CHALLENGE_NOT_FOUND  = "payment_challenge.not_found"
+	EVENT_PAYMENT_CHALLENGE_MISMATCH   = "payment_challenge.mismatch"
+	EVENT_PAYMENT_CHALLENGE_CONFIRM    = "payment_challenge.confirm"
+	EVENT_PAYMENT_CONFIRMATION_REDEEM  = "payment_challenge.redeem"
+	EVENT_PAYMENT_CONFIRMATION_RELEASE = "payment_challenge.release"
+
+	EVENT_AUTH_LOCKOUT_CHECK  = "auth.lockout.check"
+	EVENT_AUTH_LOCKED_OUT     = "auth.lockout.locked"
+	EVENT_AUTH_ATTEMPT_RECORD = "auth.attempt.record"
 
 	EVENT_GENERATE_TOKEN_PAIR = "auth.token_pair.generate"
 	EVENT_DECODE_TOKEN        = "auth.token.decode"
 	EVENT_TOKEN_EXPIRED       = "auth.token.expired"
+	EVENT_TOKEN_INVALID       = "auth.token.invalid"
+	EVENT_JWKS_BUILD          = "auth.jwks.build"
+
+	EVENT_SESSION_STORE      = "auth.session.store"
+	EVENT_SESSION_GET        = "auth.session.get"
+	EVENT_SESSION_GET_LATEST = "auth.session.get_latest"
+	EVENT_SESSION_NOT_FOUND  = "auth.session.not_found"
+	EVENT_SESSION_ROTATE     = "auth.session.rotate"
+	EVENT_SESSION_REVOKED    = "auth.session.revoked"
+	EVENT_SESSION_CHECK      = "auth.session.check"
+	EVENT_SESSION_RENAME     = "auth.session.rename"
 
-	EVENT_SESSION_STORE = "auth.session.store"
-	EVENT_SESSION_GET   = "auth.session.get"
+	EVENT_REFRESH_TOKEN_REUSED = "auth.refresh_token.reused"
+
+	EVENT_VALIDATION_FAILED = "validation.failed"
 
 	EVENT_DB_NO_ROWS_AFFECTED            = "db.no_rows_affected"
 	EVENT_DB_UNIQUE_CONSTRAINT_VIOLATION = "db.unique_constraint_violation"
@@ -40,15 +129,88 @@ const (
 	EVENT_DB_CREATE_USER        = "user.db.create"
 	EVENT_DB_GET_USER           = "user.db.get"
 	EVENT_MAP_USER_IDS          = "user.map_ids_to_names"
+	EVENT_MAP_TRANSFER_DETAILS  = "user.map_transfer_details"
 	EVENT_USER_UNDERAGE         = "user.underage"
 	EVENT_USER_NOT_FOUND        = "user.not_found"
+	EVENT_DB_DELETE_USER        = "user.db.delete"
+	EVENT_USER_BALANCE_CHECK    = "user.balance_check"
+	EVENT_USER_BALANCE_NOT_ZERO = "user.balance_not_zero"
+
+	EVENT_USER_DELETION_FINISH   = "user.deletion.finish"
+	EVENT_USER_DELETION_DEFERRED = "user.deletion.deferred"
+	EVENT_USER_DELETION_SWEEP    = "user.deletion.sweep"
+	EVENT_USER_PAYMENTS_REVOKE   = "user.payments.revoke"
 
-	EVENT_TB_CREATE_ACCOUNT = "tigerbeetle.create_account"
-	EVENT_TB_LOOKUP_ACCOUNT = "tigerbeetle.lookup_account"
-	EVENT_TB_GET_TRANSFERS  = "tigerbeetle.get_transfers"
+	EVENT_PROFILE_VALIDATE              = "user.profile.validate"
+	EVENT_DB_UPDATE_PROFILE             = "user.profile.db.update"
+	EVENT_DB_GET_PROFILE_HISTORY        = "user.profile.db.get_history"
+	EVENT_PHONE_NUMBER_CHANGE_CREATE    = "user.phone_number_change.create"
+	EVENT_PHONE_NUMBER_CHANGE_SEND      = "user.phone_number_change.send"
+	EVENT_PHONE_NUMBER_CHANGE_GET       = "user.phone_number_change.get"
+	EVENT_PHONE_NUMBER_CHANGE_NOT_FOUND = "user.phone_number_change.not_found"
+	EVENT_PHONE_NUMBER_CHANGE_MISMATCH  = "user.phone_number_change.mismatch"
+	EVENT_PHONE_NUMBER_CHANGE_COMPLETE  = "user.phone_number_change.complete"
+	EVENT_SESSIONS_INVALIDATE           = "auth.sessions.invalidate"
 
-	EVENT_ACCOUNT_NOT_FOUND = "tigerbeetle.account_not_found"
+	EVENT_KYC_VALIDATE           = "kyc.validate"
+	EVENT_KYC_GET                = "kyc.db.get"
+	EVENT_KYC_SUBMIT             = "kyc.db.submit"
+	EVENT_KYC_VERIFY             = "kyc.verify"
+	EVENT_KYC_DECIDE             = "kyc.db.decide"
+	EVENT_KYC_TRANSITION_DENIED  = "kyc.transition_denied"
+	EVENT_KYC_SUBMISSION_MISSING = "kyc.submission_not_found"
+
+	EVENT_TB_CREATE_ACCOUNT  = "tigerbeetle.create_account"
+	EVENT_TB_LOOKUP_ACCOUNT  = "tigerbeetle.lookup_account"
+	EVENT_TB_GET_TRANSFERS   = "tigerbeetle.get_transfers"
+	EVENT_TB_CREATE_TRANSFER = "tigerbeetle.create_transfer"
+	EVENT_TB_CLOSE_ACCOUNT   = "tigerbeetle.close_account"
+	EVENT_TB_REOPEN_ACCOUNT  = "tigerbeetle.reopen_account"
+
+	EVENT_ACCOUNT_NOT_FOUND      = "tigerbeetle.account_not_found"
+	EVENT_ACCOUNT_ALREADY_CLOSED = "tigerbeetle.account_already_closed"
 
 	EVENT_GET_SUGGESTED_USERS    = "suggested_users.get"
 	EVENT_GET_SUGGESTED_USERS_DB = "suggested_users.db.get"
+
+	EVENT_CONTACT_VALIDATE     = "contact.validate"
+	EVENT_DB_UPDATE_CONTACT    = "contact.db.update"
+	EVENT_DB_GET_CONTACTS      = "contact.db.get"
+	EVENT_DB_GET_CONTACT_BLOCK = "contact.db.get_block"
+	EVENT_CONTACT_BLOCKED      = "contact.blocked"
+
+	EVENT_USER_SEARCH_VALIDATE   = "user_search.validate"
+	EVENT_DB_SEARCH_USERS        = "user_search.db.search"
+	EVENT_USER_SEARCH_TARGETS    = "user_search.targets"
+	EVENT_USER_SEARCH_TARGET_CAP = "user_search.target_capped"
+	EVENT_DB_UPDATE_DISCOVERABLE = "user.discoverable.db.update"
+
+	EVENT_POT_VALIDATE     = "pot.validate"
+	EVENT_DB_CREATE_POT    = "pot.db.create"
+	EVENT_DB_GET_POT       = "pot.db.get"
+	EVENT_DB_UPDATE_POT    = "pot.db.update"
+	EVENT_POT_BALANCES     = "pot.balances"
+	EVENT_POT_LIMIT        = "pot.limit_reached"
+	EVENT_POT_NOT_FOUND    = "pot.not_found"
+	EVENT_MAP_POT_IDS      = "pot.map_ids_to_names"
+	EVENT_NOT_ENOUGH_FUNDS = "tigerbeetle.not_enough_funds"
+
+	EVENT_CATEGORY_VALIDATE            = "category.validate"
+	EVENT_MAP_TRANSFER_CATEGORIES      = "category.map_transfer_categories"
+	EVENT_MAP_COUNTERPARTY_CATEGORIES  = "category.map_counterparty_categories"
+	EVENT_DB_SET_TRANSFER_CATEGORY     = "category.db.set_transfer"
+	EVENT_DB_SET_COUNTERPARTY_CATEGORY = "category.db.set_counterparty"
+	EVENT_BUILD_SPENDING_INSIGHTS      = "category.build_insights"
+
+	EVENT_STATEMENT_VALIDATE          = "statement.validate"
+	EVENT_STATEMENT_RENDER            = "statement.render"
+	EVENT_DB_GET_STATEMENT            = "statement.db.get"
+	EVENT_DB_CREATE_STATEMENT         = "statement.db.create"
+	EVENT_STATEMENT_NOT_FOUND         = "statement.not_found"
+	EVENT_STATEMENT_CHECKSUM_MISMATCH = "statement.checksum_mismatch"
+
+	EVENT_EXPORT_SECTION = "export.section"
+	EVENT_EXPORT_BUILD   = "export.build"
+
+	EVENT_EXPORT_PAYMENT_DATA = "export.payment_data"
 )
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	CATEGORY_INCOME        = "income"
+	CATEGORY_TRANSFERS     = "transfers"
+	CATEGORY_DEPOSITS      = "deposits"
+	CATEGORY_PAYOUTS       = "payouts"
+	CATEGORY_SAVINGS       = "savings"
+	CATEGORY_FEES          = "fees"
+	CATEGORY_FOOD          = "food"
+	CATEGORY_GROCERIES     = "groceries"
+	CATEGORY_TRANSPORT     = "transport"
+	CATEGORY_HOUSING       = "housing"
+	CATEGORY_BILLS         = "bills"
+	CATEGORY_ENTERTAINMENT = "entertainment"
+	CATEGORY_SHOPPING      = "shopping"
+	CATEGORY_HEALTH        = "health"
+	CATEGORY_TRAVEL        = "travel"
+	CATEGORY_GIFTS         = "gifts"
+
+	InsightsMonths = 12
+	// Insights page through every transfer in the range, so longer ranges
+	// are refused rather than read into memory.
+	InsightsMaxMonths = 24
+)
+
+var Categories = []string{
+	CATEGORY_INCOME,
+	CATEGORY_TRANSFERS,
+	CATEGORY_DEPOSITS,
+	CATEGORY_PAYOUTS,
+	CATEGORY_SAVINGS,
+	CATEGORY_FEES,
+	CATEGORY_FOOD,
+	CATEGORY_GROCERIES,
+	CATEGORY_TRANSPORT,
+	CATEGORY_HOUSING,
+	CATEGORY_BILLS,
+	CATEGORY_ENTERTAINMENT,
+	CATEGORY_SHOPPING,
+	CATEGORY_HEALTH,
+	CATEGORY_TRAVEL,
+	CATEGORY_GIFTS,
+}
+
+type memoKeywordRule struct {
+	category string
+	keywords []string
+}
+
+// Rules are checked in order and the first one with a keyword among the memo
+// words wins.
+var memoKeywordRules = []memoKeywordRule{
+	{CATEGORY_GROCERIES, []string{"groceries", "grocery", "supermarket", "market", "prisma", "lidl", "alepa", "kmarket", "ruoka"}},
+	{CATEGORY_FOOD, []string{"food", "lunch", "dinner", "breakfast", "pizza", "sushi", "burger", "kebab", "restaurant", "cafe", "coffee", "beer", "drinks", "snacks"}},
+	{CATEGORY_TRANSPORT, []string{"taxi", "uber", "bolt", "bus", "train", "tram", "metro", "ticket", "fuel", "gas", "parking"}},
+	{CATEGORY_HOUSING, []string{"rent", "vuokra", "mortgage", "landlord"}},
+	{CATEGORY_BILLS, []string{"bill", "bills", "electricity", "water", "internet", "phone", "insurance", "subscription"}},
+	{CATEGORY_ENTERTAINMENT, []string{"movie", "movies", "cinema", "concert", "festival", "game", "games", "netflix", "spotify", "party"}},
+	{CATEGORY_SHOPPING, []string{"clothes", "shoes", "shopping", "amazon", "ikea"}},
+	{CATEGORY_HEALTH, []string{"pharmacy", "doctor", "dentist", "gym", "medicine"}},
+	{CATEGORY_TRAVEL, []string{"hotel", "flight", "flights", "airbnb", "trip", "holiday", "vacation"}},
+	{CATEGORY_GIFTS, []string{"gift", "present", "birthday", "wedding", "christmas"}},
+}
+
+func IsCategory(category string) bool {
+	return slices.Contains(Categories, category)
+}
+
+// CategorizeMemo matches whole memo words case-insensitively against the
+// keyword rules.
+func CategorizeMemo(memo string) (string, bool) {
+	words := strings.FieldsFunc(strings.ToLower(memo), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, rule := range memoKeywordRules {
+		for _, word := range words {
+			if slices.Contains(rule.keywords, word) {
+				return rule.category, true
+			}
+		}
+	}
+	return "", false
+}
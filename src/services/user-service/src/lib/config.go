@@ -12,14 +12,44 @@ const (
 	RefreshTokenTTL            = 30 * time.Minute
 	OTPExpirationWindowMinutes = 5
 	ServiceName                = "user-service"
+	SessionNameMaxLength       = 64
+
+	// Revoked sessions are reloaded this often. Past the max staleness,
+	// access token validation reads the session directly instead.
+	SessionRevocationRefreshInterval = 2 * time.Second
+	SessionRevocationMaxStaleness    = 10 * time.Second
+
+	// Transfers are paged out of TigerBeetle in batches of this size when a
+	// whole period is needed.
+	TransfersPageSize = 1000
+
+	SYSTEM_FLOAT_ACCOUNT_ID = "1"
+
+	// Deleted users keep their id for the ledger, and are shown under this
+	// name wherever they appear as a counterparty.
+	DeletedUserName = "Deleted user"
+
+	// Deletions that stopped after the user was pseudonymized are picked up
+	// again this often, at most this many at a time.
+	DeletionWorkerInterval  = time.Minute
+	DeletionWorkerBatchSize = 100
 )
 
 type Configuration struct {
 	UserServicePort          string
 	TigerbeetleServiceUrl    string
+	PaymentServiceUrl        string
 	UserServiceDatabaseDsn   string
 	UserServiceJWTSecret     string
+	JWTKeyDir                string
+	JWTHS256Until            *time.Time
+	JWKSHttpPort             string
+	GeoIPDatabasePath        string
+	MfaEncryptionKey         string
 	OtelExporterOtlpEndpoint string
+	OTPSender                string
+	OTPFallbackSender        string
+	KycVerifier              string
 }
 
 func GetEnv(envName string) string {
@@ -32,11 +62,37 @@ func GetEnv(envName string) string {
 }
 
 func ParseConfiguration() *Configuration {
-	return &Configuration{
+	config := &Configuration{
 		UserServicePort:          GetEnv("USER_SERVICE_PORT"),
 		TigerbeetleServiceUrl:    GetEnv("USER_SERVICE_TIGERBEETLE_SERVICE_URL"),
+		PaymentServiceUrl:        GetEnv("USER_SERVICE_PAYMENT_SERVICE_URL"),
 		UserServiceDatabaseDsn:   GetEnv("USER_SERVICE_DATABASE_DSN"),
-		UserServiceJWTSecret:     GetEnv("USER_SERVICE_JWT_SECRET"),
+		UserServiceJWTSecret:     os.Getenv("USER_SERVICE_JWT_SECRET"),
+		JWTKeyDir:                os.Getenv("USER_SERVICE_JWT_KEY_DIR"),
+		JWKSHttpPort:             os.Getenv("USER_SERVICE_JWKS_HTTP_PORT"),
+		GeoIPDatabasePath:        os.Getenv("USER_SERVICE_GEOIP_DATABASE_PATH"),
+		MfaEncryptionKey:         GetEnv("USER_SERVICE_MFA_ENCRYPTION_KEY"),
 		OtelExporterOtlpEndpoint: GetEnv("USER_SERVICE_OTEL_EXPORTER_OTLP_ENDPOINT"),
+		OTPSender:                GetEnv("USER_SERVICE_OTP_SENDER"),
+		OTPFallbackSender:        os.Getenv("USER_SERVICE_OTP_FALLBACK_SENDER"),
+		KycVerifier:              GetEnv("USER_SERVICE_KYC_VERIFIER"),
 	}
+
+	if hs256Until := os.Getenv("USER_SERVICE_JWT_HS256_UNTIL"); hs256Until != "" {
+		until, err := time.Parse(time.RFC3339, hs256Until)
+		if err != nil {
+			slog.Error("Invalid env variable", "name", "USER_SERVICE_JWT_HS256_UNTIL", "error", err)
+			panic("Invalid env variable")
+		}
+		config.JWTHS256Until = &until
+	}
+
+	// Tokens are signed either with the keys in the key directory or with the
+	// shared secret, so one of them has to be set.
+	if config.UserServiceJWTSecret == "" && config.JWTKeyDir == "" {
+		slog.Error("Missing env variable", "name", "USER_SERVICE_JWT_SECRET or USER_SERVICE_JWT_KEY_DIR")
+		panic("Missing env variable")
+	}
+
+	return config
 }
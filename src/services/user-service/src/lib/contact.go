@@ -0,0 +1,37 @@
+package lib
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	NicknameMaxLength      = 32
+	SuggestedUsersMaxLimit = 50
+
+	// Suggestions look at transfers this far back. Favorites are suggested
+	// regardless.
+	SuggestionLookback = 180 * 24 * time.Hour
+
+	// A favorite outranks any counterparty that is not one, and the recency
+	// bonus halves every half-life since the last transfer.
+	suggestionFavoriteBoost   = 100
+	suggestionRecencyWeight   = 4
+	suggestionRecencyHalfLife = 14 * 24 * time.Hour
+)
+
+// SuggestionScore ranks a suggested user by whether they are a favorite, how
+// often money moved between the two users and how recently. Frequency grows
+// logarithmically so a few regular counterparties do not crowd out recent
+// ones.
+func SuggestionScore(favorite bool, transferCount int, lastTransferAt *time.Time, now time.Time) float64 {
+	score := math.Log2(1 + float64(transferCount))
+	if lastTransferAt != nil {
+		age := max(now.Sub(*lastTransferAt), 0)
+		score += suggestionRecencyWeight * math.Exp2(-float64(age)/float64(suggestionRecencyHalfLife))
+	}
+	if favorite {
+		score += suggestionFavoriteBoost
+	}
+	return score
+}
@@ -9,4 +9,20 @@ var (
 	ErrUnacceptableRequest = errors.New("UNACCEPTABLE")
 	ErrTokenExpired        = errors.New("TOKEN_EXPIRED")
 	ErrConflict            = errors.New("CONFLICT")
+	ErrNotEnoughFunds      = errors.New("NOT_ENOUGH_FUNDS")
+	ErrPotLimitReached     = errors.New("POT_LIMIT_REACHED")
+	ErrOTPDeliveryFailed   = errors.New("OTP_DELIVERY_FAILED")
+	ErrTooManyAttempts     = errors.New("TOO_MANY_ATTEMPTS")
+	ErrInvalidToken        = errors.New("INVALID_TOKEN")
+	ErrSessionRevoked      = errors.New("SESSION_REVOKED")
+	ErrMfaNotEnrolled      = errors.New("MFA_NOT_ENROLLED")
+	ErrMfaCodeMismatch     = errors.New("MFA_CODE_MISMATCH")
+	ErrStepUpRequired      = errors.New("STEP_UP_REQUIRED")
+	ErrAccountClosed       = errors.New("ACCOUNT_CLOSED")
+	ErrBalanceNotZero      = errors.New("BALANCE_NOT_ZERO")
+	ErrContactBlocked      = errors.New("CONTACT_BLOCKED")
+
+	ErrPaymentChallengeMismatch   = errors.New("PAYMENT_CHALLENGE_MISMATCH")
+	ErrPaymentConfirmationInvalid = errors.New("PAYMENT_CONFIRMATION_INVALID")
+	ErrPhoneNumberChangeMismatch  = errors.New("PHONE_NUMBER_CHANGE_MISMATCH")
 )
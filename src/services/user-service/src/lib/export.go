@@ -0,0 +1,197 @@
+package lib
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+const (
+	ExportFormatVersion = 1
+	ExportContentType   = "application/zip"
+	ExportManifestName  = "manifest.json"
+
+	// The archive is streamed in chunks of this size, well under the default
+	// gRPC message limit.
+	ExportChunkSize = 1 << 20
+
+	EXPORT_FILE_PROFILE         = "profile.json"
+	EXPORT_FILE_PROFILE_HISTORY = "profile_history.json"
+	EXPORT_FILE_SESSIONS        = "sessions.json"
+	EXPORT_FILE_SECURITY_EVENTS = "security_events.json"
+	EXPORT_FILE_KYC_SUBMISSIONS = "kyc_submissions.json"
+	EXPORT_FILE_PAYMENTS        = "payments.json"
+	EXPORT_FILE_DEPOSITS        = "deposits.json"
+	EXPORT_FILE_PAYOUTS         = "payouts.json"
+	EXPORT_FILE_POTS            = "pots.json"
+	EXPORT_FILE_LEDGER          = "ledger.json"
+	EXPORT_FILE_POT_LEDGERS     = "pot_ledgers.json"
+	EXPORT_FILE_CONTACTS        = "contacts.json"
+	EXPORT_FILE_STATEMENTS      = "statements.json"
+
+	EXPORT_FILE_TRANSFER_CATEGORIES     = "transfer_categories.json"
+	EXPORT_FILE_COUNTERPARTY_CATEGORIES = "counterparty_categories.json"
+
+	// Statement documents are added under this directory with their
+	// download filenames.
+	EXPORT_STATEMENTS_DIR = "statements/"
+
+	EXPORT_TRANSFER_PENDING = "pending"
+	EXPORT_TRANSFER_POSTED  = "posted"
+	EXPORT_TRANSFER_VOIDED  = "voided"
+)
+
+// ExportFile is one file of a data export. Data is written as indented JSON
+// unless Content is set, in which case it is written as is. Records is the
+// number of entries for lists and 1 for single objects and documents.
+type ExportFile struct {
+	Name        string
+	Description string
+	Records     int
+	Data        any
+	Content     []byte
+}
+
+type exportManifest struct {
+	FormatVersion int                   `json:"format_version"`
+	UserId        string                `json:"user_id"`
+	GeneratedAt   string                `json:"generated_at"`
+	Files         []exportManifestEntry `json:"files"`
+}
+
+type exportManifestEntry struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Records     int    `json:"records"`
+	Sha256      string `json:"sha256"`
+}
+
+func ExportFilename(generatedAt time.Time) string {
+	return fmt.Sprintf("data-export-%s.zip", generatedAt.UTC().Format("20060102T150405Z"))
+}
+
+// ExportArchive writes a data export as a zip, one file at a time, so only the
+// file being added is held in memory. Close adds a manifest listing the files
+// with their record counts and checksums.
+type ExportArchive struct {
+	archive     *zip.Writer
+	generatedAt time.Time
+	manifest    exportManifest
+}
+
+func NewExportArchive(w io.Writer, userId string, generatedAt time.Time) *ExportArchive {
+	return &ExportArchive{
+		archive:     zip.NewWriter(w),
+		generatedAt: generatedAt.UTC(),
+		manifest: exportManifest{
+			FormatVersion: ExportFormatVersion,
+			UserId:        userId,
+			GeneratedAt:   generatedAt.UTC().Format(time.RFC3339),
+			Files:         []exportManifestEntry{},
+		},
+	}
+}
+
+func (a *ExportArchive) writeFile(name string, file ExportFile) ([]byte, error) {
+	content := file.Content
+	if content == nil {
+		var err error
+		content, err = json.MarshalIndent(file.Data, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("encode %s: %w", name, err)
+		}
+	}
+	writer, err := a.archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: a.generatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+func (a *ExportArchive) Add(file ExportFile) error {
+	content, err := a.writeFile(file.Name, file)
+	if err != nil {
+		return err
+	}
+	a.manifest.Files = append(a.manifest.Files, exportManifestEntry{
+		Name:        file.Name,
+		Description: file.Description,
+		Records:     file.Records,
+		Sha256:      Checksum(content),
+	})
+	return nil
+}
+
+func (a *ExportArchive) Close() error {
+	if _, err := a.writeFile(ExportManifestName, ExportFile{Data: a.manifest}); err != nil {
+		return err
+	}
+	return a.archive.Close()
+}
+
+// ExportChunkWriter hands the archive to send in chunks of ExportChunkSize as
+// it is written, keeping a running checksum of everything sent.
+type ExportChunkWriter struct {
+	send   func([]byte) error
+	buffer []byte
+	hash   hash.Hash
+	size   int
+}
+
+func NewExportChunkWriter(send func([]byte) error) *ExportChunkWriter {
+	return &ExportChunkWriter{
+		send:   send,
+		buffer: make([]byte, 0, ExportChunkSize),
+		hash:   sha256.New(),
+	}
+}
+
+func (w *ExportChunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), ExportChunkSize-len(w.buffer))
+		w.buffer = append(w.buffer, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(w.buffer) == ExportChunkSize {
+			if err := w.Flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *ExportChunkWriter) Flush() error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	if err := w.send(w.buffer); err != nil {
+		return err
+	}
+	w.hash.Write(w.buffer)
+	w.size += len(w.buffer)
+	w.buffer = make([]byte, 0, ExportChunkSize)
+	return nil
+}
+
+// Checksum is the sha256 of everything flushed so far.
+func (w *ExportChunkWriter) Checksum() string {
+	return hex.EncodeToString(w.hash.Sum(nil))
+}
+
+func (w *ExportChunkWriter) Size() int {
+	return w.size
+}
@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+type geoIpRange struct {
+	start    netip.Addr
+	end      netip.Addr
+	location string
+}
+
+// GeoIP resolves addresses to a coarse "City, Region, Country" location from
+// an IP range CSV. Both the DB-IP lite country layout
+// (ip_start,ip_end,country) and city layout
+// (ip_start,ip_end,continent,country,stateprov,city,...) are accepted.
+type GeoIP struct {
+	ranges []geoIpRange
+}
+
+func LoadGeoIP(path string) (*GeoIP, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	ranges := []geoIpRange{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: expected at least 3 columns", line)
+		}
+
+		start, err := netip.ParseAddr(record[0])
+		if err != nil {
+			// Allow a header row.
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		end, err := netip.ParseAddr(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		parts := []string{record[2]}
+		if len(record) >= 6 {
+			parts = []string{record[5], record[4], record[3]}
+		}
+		location := joinNonEmpty(parts)
+		if location == "" {
+			continue
+		}
+
+		ranges = append(ranges, geoIpRange{start: start.Unmap(), end: end.Unmap(), location: location})
+	}
+
+	slices.SortFunc(ranges, func(a, b geoIpRange) int {
+		return a.start.Compare(b.start)
+	})
+
+	return &GeoIP{ranges: ranges}, nil
+}
+
+// Lookup returns nil for unparseable, private and unknown addresses. A nil
+// GeoIP resolves nothing.
+func (g *GeoIP) Lookup(ipAddress string) *string {
+	if g == nil {
+		return nil
+	}
+
+	addr, err := netip.ParseAddr(ipAddress)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+	if addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified() {
+		return nil
+	}
+
+	i, found := slices.BinarySearchFunc(g.ranges, addr, func(r geoIpRange, target netip.Addr) int {
+		return r.start.Compare(target)
+	})
+	if !found {
+		i--
+	}
+	if i < 0 || g.ranges[i].end.Compare(addr) < 0 {
+		return nil
+	}
+
+	return &g.ranges[i].location
+}
+
+func joinNonEmpty(parts []string) string {
+	nonEmpty := []string{}
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, ", ")
+}
@@ -0,0 +1,238 @@
+package lib
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	JWTKeyManifestFile   = "keys.json"
+	JWTKeyReloadInterval = 5 * time.Minute
+)
+
+var ErrNoSigningKey = errors.New("no signing key is active")
+
+// keyManifest lists the keys in the key directory. A key signs new tokens from
+// sign_from until a newer key takes over, and verifies tokens until
+// verify_until. Publishing the next key ahead of its sign_from and keeping the
+// previous one until its tokens have expired gives verifiers an overlap.
+type keyManifest struct {
+	Keys []struct {
+		Kid         string     `json:"kid"`
+		File        string     `json:"file"`
+		SignFrom    time.Time  `json:"sign_from"`
+		VerifyUntil *time.Time `json:"verify_until"`
+	} `json:"keys"`
+}
+
+type SigningKey struct {
+	Kid         string
+	Method      jwt.SigningMethod
+	PrivateKey  crypto.Signer
+	SignFrom    time.Time
+	VerifyUntil *time.Time
+}
+
+func (key SigningKey) verifiable(now time.Time) bool {
+	return key.VerifyUntil == nil || now.Before(*key.VerifyUntil)
+}
+
+// Jwk is the public half of a signing key as published in the JWKS document.
+type Jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+}
+
+type KeySet struct {
+	dir  string
+	mu   sync.RWMutex
+	keys []SigningKey
+}
+
+func LoadKeySet(dir string) (*KeySet, error) {
+	keySet := &KeySet{dir: dir}
+	if err := keySet.Reload(); err != nil {
+		return nil, err
+	}
+	return keySet, nil
+}
+
+// Reload reads the manifest and keys again. On failure the previously loaded
+// keys stay in use.
+func (ks *KeySet) Reload() error {
+	content, err := os.ReadFile(filepath.Join(ks.dir, JWTKeyManifestFile))
+	if err != nil {
+		return fmt.Errorf("read key manifest: %w", err)
+	}
+
+	manifest := keyManifest{}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return fmt.Errorf("parse key manifest: %w", err)
+	}
+
+	keys := make([]SigningKey, 0, len(manifest.Keys))
+	seen := map[string]bool{}
+	for _, entry := range manifest.Keys {
+		if entry.Kid == "" || seen[entry.Kid] {
+			return fmt.Errorf("key %q: missing or duplicate kid", entry.Kid)
+		}
+		seen[entry.Kid] = true
+
+		signer, method, err := loadPrivateKey(filepath.Join(ks.dir, filepath.Base(entry.File)))
+		if err != nil {
+			return fmt.Errorf("key %s: %w", entry.Kid, err)
+		}
+
+		keys = append(keys, SigningKey{
+			Kid:         entry.Kid,
+			Method:      method,
+			PrivateKey:  signer,
+			SignFrom:    entry.SignFrom,
+			VerifyUntil: entry.VerifyUntil,
+		})
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads the key directory on every interval so scheduled keys can be
+// added without a restart.
+func (ks *KeySet) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := ks.Reload(); err != nil {
+				slog.Error("Failed to reload JWT keys", "error", err)
+			}
+		}
+	}()
+}
+
+func loadPrivateKey(path string) (crypto.Signer, jwt.SigningMethod, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no PEM block found")
+	}
+
+	var parsed any
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch key := parsed.(type) {
+	case ed25519.PrivateKey:
+		return key, jwt.SigningMethodEdDSA, nil
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, nil, fmt.Errorf("unsupported curve %s", key.Curve.Params().Name)
+		}
+		return key, jwt.SigningMethodES256, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// SigningKey returns the verifiable key with the latest sign_from that has
+// already been reached.
+func (ks *KeySet) SigningKey(now time.Time) (SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var current *SigningKey
+	for i, key := range ks.keys {
+		if now.Before(key.SignFrom) || !key.verifiable(now) {
+			continue
+		}
+		if current == nil || key.SignFrom.After(current.SignFrom) {
+			current = &ks.keys[i]
+		}
+	}
+	if current == nil {
+		return SigningKey{}, ErrNoSigningKey
+	}
+	return *current, nil
+}
+
+func (ks *KeySet) VerificationKey(kid string, now time.Time) (SigningKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for _, key := range ks.keys {
+		if key.Kid == kid && key.verifiable(now) {
+			return key, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+// Jwks lists every key that currently verifies tokens, including keys that
+// are scheduled but not signing yet.
+func (ks *KeySet) Jwks(now time.Time) ([]Jwk, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	jwks := []Jwk{}
+	for _, key := range ks.keys {
+		if !key.verifiable(now) {
+			continue
+		}
+
+		jwk := Jwk{Kid: key.Kid, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.PrivateKey.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *ecdsa.PublicKey:
+			ecdhKey, err := public.ECDH()
+			if err != nil {
+				return nil, err
+			}
+			// Uncompressed point: 0x04 || X || Y.
+			point := ecdhKey.Bytes()
+			coordinateSize := (len(point) - 1) / 2
+			jwk.Kty = "EC"
+			jwk.Crv = "P-256"
+			jwk.X = base64.RawURLEncoding.EncodeToString(point[1 : 1+coordinateSize])
+			jwk.Y = base64.RawURLEncoding.EncodeToString(point[1+coordinateSize:])
+		}
+		jwks = append(jwks, jwk)
+	}
+
+	return jwks, nil
+}
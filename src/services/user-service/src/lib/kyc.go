@@ -0,0 +1,189 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	KYC_STATUS_UNVERIFIED = "unverified"
+	KYC_STATUS_PENDING    = "pending"
+	KYC_STATUS_VERIFIED   = "verified"
+	KYC_STATUS_REJECTED   = "rejected"
+	KYC_STATUS_EXPIRED    = "expired"
+
+	KYC_DOCUMENT_PASSPORT         = "passport"
+	KYC_DOCUMENT_NATIONAL_ID      = "national_id"
+	KYC_DOCUMENT_DRIVING_LICENCE  = "driving_licence"
+	KYC_DOCUMENT_RESIDENCE_PERMIT = "residence_permit"
+
+	KYC_VERIFIER_STUB = "stub"
+
+	// A verification has to be renewed after this long, or earlier when the
+	// document it was based on expires.
+	KycValidity = 365 * 24 * time.Hour
+
+	KycDocumentImageMaxSize = 5 << 20
+)
+
+var KycDocumentTypes = []string{
+	KYC_DOCUMENT_PASSPORT,
+	KYC_DOCUMENT_NATIONAL_ID,
+	KYC_DOCUMENT_DRIVING_LICENCE,
+	KYC_DOCUMENT_RESIDENCE_PERMIT,
+}
+
+var kycDocumentImageTypes = []string{"image/jpeg", "image/png", "application/pdf"}
+
+// kycTransitions lists the statuses each status may move to. Verified users
+// only resubmit once their verification has expired.
+var kycTransitions = map[string][]string{
+	KYC_STATUS_UNVERIFIED: {KYC_STATUS_PENDING},
+	KYC_STATUS_PENDING:    {KYC_STATUS_VERIFIED, KYC_STATUS_REJECTED},
+	KYC_STATUS_REJECTED:   {KYC_STATUS_PENDING},
+	KYC_STATUS_VERIFIED:   {KYC_STATUS_EXPIRED},
+	KYC_STATUS_EXPIRED:    {KYC_STATUS_PENDING},
+}
+
+func KycTransitionAllowed(from, to string) bool {
+	return slices.Contains(kycTransitions[from], to)
+}
+
+// EffectiveKycStatus reports verifications past their expiry as expired.
+// Expiry is not written back, the stored status stays verified.
+func EffectiveKycStatus(status string, expires *time.Time, now time.Time) string {
+	if status == KYC_STATUS_VERIFIED && expires != nil && !now.Before(*expires) {
+		return KYC_STATUS_EXPIRED
+	}
+	return status
+}
+
+// KycVerificationExpiry is the end of the validity period, or the day the
+// document expires when that is sooner.
+func KycVerificationExpiry(documentExpires, now time.Time) time.Time {
+	expires := now.Add(KycValidity)
+	if documentExpires := documentExpires.AddDate(0, 0, 1); documentExpires.Before(expires) {
+		return documentExpires
+	}
+	return expires
+}
+
+type KycDocument struct {
+	DocumentType     string
+	DocumentNumber   string
+	IssuingCountry   string
+	DocumentExpires  time.Time
+	Image            []byte
+	ImageContentType string
+}
+
+// NewKycDocument validates the submitted document. The number is upper-cased
+// with spaces and dashes removed, and the issuing country is an ISO 3166-1
+// alpha-2 code.
+func NewKycDocument(documentType, documentNumber, issuingCountry, documentExpires string, image []byte) (KycDocument, error) {
+	if !slices.Contains(KycDocumentTypes, documentType) {
+		return KycDocument{}, ErrUnacceptableRequest
+	}
+
+	documentNumber = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(documentNumber))
+	if len(documentNumber) < 5 || len(documentNumber) > 20 || !isUpperAlphanumeric(documentNumber) {
+		return KycDocument{}, ErrUnacceptableRequest
+	}
+
+	issuingCountry = strings.ToUpper(strings.TrimSpace(issuingCountry))
+	if len(issuingCountry) != 2 || !isUpperAlphanumeric(issuingCountry) {
+		return KycDocument{}, ErrUnacceptableRequest
+	}
+
+	expires, err := time.Parse(time.DateOnly, documentExpires)
+	if err != nil {
+		return KycDocument{}, ErrUnacceptableRequest
+	}
+
+	document := KycDocument{
+		DocumentType:    documentType,
+		DocumentNumber:  documentNumber,
+		IssuingCountry:  issuingCountry,
+		DocumentExpires: expires,
+	}
+
+	if len(image) > 0 {
+		if len(image) > KycDocumentImageMaxSize {
+			return KycDocument{}, ErrUnacceptableRequest
+		}
+		contentType := http.DetectContentType(image)
+		if !slices.Contains(kycDocumentImageTypes, contentType) {
+			return KycDocument{}, ErrUnacceptableRequest
+		}
+		document.Image = image
+		document.ImageContentType = contentType
+	}
+
+	return document, nil
+}
+
+func isUpperAlphanumeric(value string) bool {
+	for _, char := range value {
+		if (char < 'A' || char > 'Z') && (char < '0' || char > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// KycSubmission is what a verifier gets to check: the document and the
+// details the user registered with.
+type KycSubmission struct {
+	SubmissionId string
+	UserId       string
+	FirstName    string
+	LastName     string
+	BirthDate    time.Time
+	Document     KycDocument
+}
+
+// KycDecision is verified, rejected, or pending when the verifier needs a
+// manual review.
+type KycDecision struct {
+	Status string
+	Reason string
+}
+
+// KycVerifier checks the identity of a submission, usually by handing it to
+// an identity verification provider.
+type KycVerifier interface {
+	Verify(ctx context.Context, submission KycSubmission) (KycDecision, error)
+}
+
+func NewKycVerifier(kind string) (KycVerifier, error) {
+	switch kind {
+	case KYC_VERIFIER_STUB:
+		return &StubKycVerifier{}, nil
+	default:
+		return nil, fmt.Errorf("unknown kyc verifier %q", kind)
+	}
+}
+
+// StubKycVerifier is meant for local development and decides from the
+// document alone: expired documents and numbers starting with "REJECT" are
+// rejected, numbers starting with "REVIEW" are left for manual review, and
+// everything else is verified.
+type StubKycVerifier struct{}
+
+func (verifier *StubKycVerifier) Verify(ctx context.Context, submission KycSubmission) (KycDecision, error) {
+	document := submission.Document
+	switch {
+	case !document.DocumentExpires.After(time.Now()):
+		return KycDecision{Status: KYC_STATUS_REJECTED, Reason: "document_expired"}, nil
+	case strings.HasPrefix(document.DocumentNumber, "REJECT"):
+		return KycDecision{Status: KYC_STATUS_REJECTED, Reason: "document_not_accepted"}, nil
+	case strings.HasPrefix(document.DocumentNumber, "REVIEW"):
+		return KycDecision{Status: KYC_STATUS_PENDING}, nil
+	default:
+		return KycDecision{Status: KYC_STATUS_VERIFIED}, nil
+	}
+}
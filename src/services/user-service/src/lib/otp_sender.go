@@ -0,0 +1,203 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OTP_SENDER_HTTP    = "http"
+	OTP_SENDER_SMTP    = "smtp"
+	OTP_SENDER_FILE    = "file"
+	OTP_SENDER_CONSOLE = "console"
+
+	smsGatewayTimeout = 10 * time.Second
+)
+
+// OTPSender delivers a message carrying a one-time passcode to the owner of
+// the phone number. Implementations must never log the message.
+type OTPSender interface {
+	SendOTP(ctx context.Context, phoneNumber, message string) error
+}
+
+func OTPMessage(code string) string {
+	return fmt.Sprintf("Your verification code is %s. It expires in %d minutes.", code, OTPExpirationWindowMinutes)
+}
+
+// NewOTPSender builds the sender selected by kind, reading its settings from
+// the environment. With a fallback kind, the fallback is tried whenever the
+// primary sender fails.
+func NewOTPSender(kind, fallbackKind string) (OTPSender, error) {
+	sender, err := newOTPSender(kind)
+	if err != nil {
+		return nil, err
+	}
+	if fallbackKind == "" {
+		return sender, nil
+	}
+
+	fallback, err := newOTPSender(fallbackKind)
+	if err != nil {
+		return nil, err
+	}
+	return &FallbackOTPSender{Primary: sender, Fallback: fallback}, nil
+}
+
+func newOTPSender(kind string) (OTPSender, error) {
+	switch kind {
+	case OTP_SENDER_HTTP:
+		return &HTTPSMSSender{
+			url:      GetEnv("USER_SERVICE_SMS_GATEWAY_URL"),
+			apiKey:   GetEnv("USER_SERVICE_SMS_GATEWAY_API_KEY"),
+			senderId: GetEnv("USER_SERVICE_SMS_SENDER_ID"),
+			client:   &http.Client{Timeout: smsGatewayTimeout},
+		}, nil
+	case OTP_SENDER_SMTP:
+		return &SMTPOTPSender{
+			address:           GetEnv("USER_SERVICE_SMTP_ADDRESS"),
+			username:          os.Getenv("USER_SERVICE_SMTP_USERNAME"),
+			password:          os.Getenv("USER_SERVICE_SMTP_PASSWORD"),
+			from:              GetEnv("USER_SERVICE_SMTP_FROM"),
+			recipientTemplate: GetEnv("USER_SERVICE_SMTP_RECIPIENT_TEMPLATE"),
+		}, nil
+	case OTP_SENDER_FILE:
+		return &SinkOTPSender{path: GetEnv("USER_SERVICE_OTP_FILE_PATH")}, nil
+	case OTP_SENDER_CONSOLE:
+		return &SinkOTPSender{}, nil
+	default:
+		return nil, fmt.Errorf("unknown otp sender %q", kind)
+	}
+}
+
+// HTTPSMSSender posts the message as JSON to a generic SMS gateway and treats
+// any non-2xx response as a failed delivery.
+type HTTPSMSSender struct {
+	url      string
+	apiKey   string
+	senderId string
+	client   *http.Client
+}
+
+func (sender *HTTPSMSSender) SendOTP(ctx context.Context, phoneNumber, message string) error {
+	body, err := json.Marshal(map[string]string{
+		"from":    sender.senderId,
+		"to":      phoneNumber,
+		"message": message,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sender.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+sender.apiKey)
+
+	resp, err := sender.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sms gateway request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sms gateway responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTPOTPSender emails the message to an address derived from the phone
+// number, e.g. an email-to-SMS gateway. "{phone}" in the recipient template is
+// replaced with the number without spaces or a leading plus.
+type SMTPOTPSender struct {
+	address           string
+	username          string
+	password          string
+	from              string
+	recipientTemplate string
+}
+
+func (sender *SMTPOTPSender) SendOTP(ctx context.Context, phoneNumber, message string) error {
+	phone := strings.TrimPrefix(strings.ReplaceAll(phoneNumber, " ", ""), "+")
+	recipient := strings.ReplaceAll(sender.recipientTemplate, "{phone}", phone)
+
+	content := strings.Join([]string{
+		"From: " + sender.from,
+		"To: " + recipient,
+		"Subject: Verification code",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		message,
+		"",
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if sender.username != "" {
+		host, _, err := net.SplitHostPort(sender.address)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", sender.username, sender.password, host)
+	}
+
+	if err := smtp.SendMail(sender.address, auth, sender.from, []string{recipient}, []byte(content)); err != nil {
+		return fmt.Errorf("smtp send: %w", err)
+	}
+	return nil
+}
+
+// SinkOTPSender is meant for local development. It appends the message to the
+// file at path, or writes it to stdout when path is empty.
+type SinkOTPSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (sender *SinkOTPSender) SendOTP(ctx context.Context, phoneNumber, message string) error {
+	line := fmt.Sprintf("%s to=%s %s\n", time.Now().UTC().Format(time.RFC3339), phoneNumber, message)
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+
+	if sender.path == "" {
+		_, err := os.Stdout.WriteString(line)
+		return err
+	}
+
+	file, err := os.OpenFile(sender.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(line); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+type FallbackOTPSender struct {
+	Primary  OTPSender
+	Fallback OTPSender
+}
+
+func (sender *FallbackOTPSender) SendOTP(ctx context.Context, phoneNumber, message string) error {
+	primaryErr := sender.Primary.SendOTP(ctx, phoneNumber, message)
+	if primaryErr == nil {
+		return nil
+	}
+	if err := sender.Fallback.SendOTP(ctx, phoneNumber, message); err != nil {
+		return errors.Join(primaryErr, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package lib
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	TOKEN_TYPE_PAYMENT_CONFIRMATION = "payment_confirmation"
+
+	PaymentChallengeTTL         = 5 * time.Minute
+	PaymentConfirmationTTL      = 2 * time.Minute
+	MaxPaymentChallengeAttempts = 5
+
+	// BulkPaymentRecipientName stands in for the payee in the challenge for
+	// a bulk payment, which pays many recipients at once.
+	BulkPaymentRecipientName = "the recipients of your bulk payment"
+)
+
+// PaymentChallengeMessage names the amount and payee next to the code, so
+// the user sees exactly what they are approving (dynamic linking).
+func PaymentChallengeMessage(code string, amount uint64, recipientName string) string {
+	return fmt.Sprintf("Code %s confirms your payment of %s to %s. Never share it. It expires in %d minutes.",
+		code, FormatMinorUnits(new(big.Int).SetUint64(amount)), recipientName, int(PaymentChallengeTTL.Minutes()))
+}
+
+// PaymentConfirmationClaims bind a confirmed challenge to the exact payment
+// it was issued for. A single payment has a recipient, a bulk payment has a
+// batch id, and the other one is empty.
+type PaymentConfirmationClaims struct {
+	UserId      string
+	ChallengeId string
+	ToUserId    string
+	BulkBatchId string
+	Amount      uint64
+}
+
+func (ts *TokenService) GeneratePaymentConfirmation(claims PaymentConfirmationClaims) (string, time.Time, error) {
+	mapClaims := jwt.MapClaims{
+		"sub": claims.UserId,
+		"jti": claims.ChallengeId,
+		"typ": TOKEN_TYPE_PAYMENT_CONFIRMATION,
+		// As a string, JSON numbers lose precision above 2^53.
+		"amt": strconv.FormatUint(claims.Amount, 10),
+	}
+	if claims.BulkBatchId != "" {
+		mapClaims["bat"] = claims.BulkBatchId
+	} else {
+		mapClaims["to"] = claims.ToUserId
+	}
+
+	token, expires, err := ts.generateToken(mapClaims, PaymentConfirmationTTL)
+	if err != nil {
+		return "", expires, fmt.Errorf("generate payment confirmation: %w", err)
+	}
+
+	return token, expires, nil
+}
+
+func (ts *TokenService) DecodePaymentConfirmation(tokenString string) (*PaymentConfirmationClaims, error) {
+	token, err := jwt.Parse(tokenString, ts.verificationKey, jwt.WithValidMethods(ts.validMethods()), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("parse token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid claims")
+	}
+	if tokenType, _ := claims["typ"].(string); tokenType != TOKEN_TYPE_PAYMENT_CONFIRMATION {
+		return nil, fmt.Errorf("unexpected token type %q", tokenType)
+	}
+
+	userId, _ := claims["sub"].(string)
+	challengeId, _ := claims["jti"].(string)
+	toUserId, _ := claims["to"].(string)
+	bulkBatchId, _ := claims["bat"].(string)
+	amount, _ := claims["amt"].(string)
+	if userId == "" || challengeId == "" || (toUserId == "") == (bulkBatchId == "") {
+		return nil, fmt.Errorf("missing claims")
+	}
+
+	parsedAmount, err := strconv.ParseUint(amount, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse amount: %w", err)
+	}
+
+	return &PaymentConfirmationClaims{
+		UserId:      userId,
+		ChallengeId: challengeId,
+		ToUserId:    toUserId,
+		BulkBatchId: bulkBatchId,
+		Amount:      parsedAmount,
+	}, nil
+}
@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	pdfPageWidth    = 595
+	pdfPageHeight   = 842
+	pdfMargin       = 40
+	pdfFontSize     = 8
+	pdfLeading      = 11
+	pdfLinesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLeading
+)
+
+// RenderTextPdf lays out the lines on A4 pages in the built-in Courier font.
+// It writes no creation date or document id, so the same lines always render
+// to the same bytes.
+func RenderTextPdf(lines []string) []byte {
+	pages := [][]string{}
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	// Objects 1-3 are the catalog, page tree and font, followed by a page and
+	// content stream object for every page.
+	objects := []string{"", "", "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>"}
+	pageRefs := make([]string, len(pages))
+	for i, page := range pages {
+		pageId := len(objects) + 1
+		pageRefs[i] = fmt.Sprintf("%d 0 R", pageId)
+
+		content := pdfPageContent(page)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, pageId+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		)
+	}
+	objects[0] = "<< /Type /Catalog /Pages 2 0 R >>"
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(pageRefs, " "), len(pages))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xrefOffset := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+
+	return buf.Bytes()
+}
+
+func pdfPageContent(lines []string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+	for _, line := range lines {
+		buf.WriteString("(")
+		buf.Write(pdfEscape(line))
+		buf.WriteString(") Tj T*\n")
+	}
+	buf.WriteString("ET")
+	return buf.String()
+}
+
+// pdfEscape encodes the line in WinAnsi and escapes string delimiters. Runes
+// outside Latin-1 apart from the euro sign are replaced with '?'.
+func pdfEscape(line string) []byte {
+	escaped := []byte{}
+	for _, r := range line {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			escaped = append(escaped, '\\', byte(r))
+		case r == '€':
+			escaped = append(escaped, 0x80)
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			escaped = append(escaped, byte(r))
+		default:
+			escaped = append(escaped, '?')
+		}
+	}
+	return escaped
+}
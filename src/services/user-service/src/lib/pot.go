@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	MaxOpenPots      = 20
+	MaxPotNameLength = 40
+
+	POT_STATUS_OPEN    = "open"
+	POT_STATUS_CLOSING = "closing"
+	POT_STATUS_CLOSED  = "closed"
+)
+
+func NormalizePotName(name string) (string, error) {
+	trimmed := strings.TrimSpace(name)
+	if len(trimmed) == 0 || utf8.RuneCountInString(trimmed) > MaxPotNameLength {
+		return "", ErrUnacceptableRequest
+	}
+	return trimmed, nil
+}
+
+func ParsePotTarget(amount *uint64, date *string, now time.Time) (*int64, *time.Time, error) {
+	var targetAmount *int64
+	if amount != nil {
+		// The target is stored as a signed bigint, so larger amounts would
+		// wrap around to a negative target.
+		if *amount == 0 || *amount > math.MaxInt64 {
+			return nil, nil, ErrUnacceptableRequest
+		}
+		converted := int64(*amount)
+		targetAmount = &converted
+	}
+
+	var targetDate *time.Time
+	if date != nil {
+		parsed, err := time.Parse(time.RFC3339, *date)
+		if err != nil || !parsed.After(now) {
+			return nil, nil, ErrUnacceptableRequest
+		}
+		targetDate = &parsed
+	}
+
+	return targetAmount, targetDate, nil
+}
@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	PROFILE_FIELD_FIRST_NAME   = "first_name"
+	PROFILE_FIELD_LAST_NAME    = "last_name"
+	PROFILE_FIELD_ADDRESS      = "address"
+	PROFILE_FIELD_PHONE_NUMBER = "phone_number"
+
+	NameMaxLength    = 64
+	AddressMaxLength = 256
+
+	ProfileHistoryPageSize = 50
+
+	PhoneNumberChangeTTL         = 10 * time.Minute
+	MaxPhoneNumberChangeAttempts = 5
+)
+
+// NormalizeProfileText trims the value and rejects empty values, values
+// longer than maxLength and control characters.
+func NormalizeProfileText(value string, maxLength int) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || utf8.RuneCountInString(value) > maxLength {
+		return "", ErrUnacceptableRequest
+	}
+	for _, char := range value {
+		if unicode.IsControl(char) {
+			return "", ErrUnacceptableRequest
+		}
+	}
+	return value, nil
+}
+
+// NormalizePhoneNumber trims the number and accepts an optional leading plus
+// followed by 7 to 15 digits, optionally grouped with spaces.
+func NormalizePhoneNumber(phoneNumber string) (string, error) {
+	phoneNumber = strings.TrimSpace(phoneNumber)
+	digits := 0
+	for i, char := range phoneNumber {
+		switch {
+		case char >= '0' && char <= '9':
+			digits++
+		case char == '+' && i == 0:
+		case char == ' ':
+		default:
+			return "", ErrUnacceptableRequest
+		}
+	}
+	if digits < 7 || digits > 15 {
+		return "", ErrUnacceptableRequest
+	}
+	return phoneNumber, nil
+}
+
+// PhoneNumberChangeMessage goes to the current number, so the owner hears of
+// the change even when someone else requested it.
+func PhoneNumberChangeMessage(code string) string {
+	return fmt.Sprintf("Code %s confirms moving your account to a new phone number. If you did not request this, contact support. It expires in %d minutes.",
+		code, int(PhoneNumberChangeTTL.Minutes()))
+}
+
+func NewPhoneNumberMessage(code string) string {
+	return fmt.Sprintf("Your code to verify this phone number is %s. It expires in %d minutes.",
+		code, int(PhoneNumberChangeTTL.Minutes()))
+}
+
+// ProfileChange is one changed field, kept in the profile history.
+type ProfileChange struct {
+	Field    string
+	OldValue string
+	NewValue string
+}
@@ -20,6 +20,20 @@ func RedactPhoneNumber(phoneNumber string) string {
 	return redacted.String()
 }
 
+// MaskPhoneNumber hides every digit and keeps only the grouping.
+func MaskPhoneNumber(phoneNumber string) string {
+	var masked strings.Builder
+	masked.Grow(len(phoneNumber))
+	for _, char := range phoneNumber {
+		if char == ' ' || char == '-' || char == '+' {
+			masked.WriteRune(char)
+		} else {
+			masked.WriteRune('*')
+		}
+	}
+	return masked.String()
+}
+
 func RedactJWT(jwt string) string {
 	runes := []rune(jwt)
 	if len(runes) <= 10 {
@@ -0,0 +1,59 @@
+package lib
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	USER_SEARCH_NAME  = "name"
+	USER_SEARCH_PHONE = "phone"
+
+	UserSearchDefaultLimit = 10
+	UserSearchMaxLimit     = 20
+
+	// Short queries match too many users to be useful and make it cheap to
+	// walk the user base, so names need a few characters and phone number
+	// prefixes have to cover most of a number, not just the country and
+	// area code.
+	UserSearchMinNameLength  = 3
+	UserSearchMinPhoneDigits = 8
+	UserSearchMaxPhoneDigits = 15
+)
+
+// ParseUserSearchQuery decides whether the query is a phone number prefix or a
+// name. A query starting with a plus or a digit is a phone number prefix and is
+// reduced to its digits. Names are lowercased for the trigram match.
+func ParseUserSearchQuery(query string) (kind string, term string, err error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return "", "", ErrUnacceptableRequest
+	}
+
+	if query[0] == '+' || (query[0] >= '0' && query[0] <= '9') {
+		var digits strings.Builder
+		for i, char := range query {
+			switch {
+			case char >= '0' && char <= '9':
+				digits.WriteRune(char)
+			case char == '+' && i == 0:
+			case char == ' ' || char == '-':
+			default:
+				return "", "", ErrUnacceptableRequest
+			}
+		}
+		if digits.Len() < UserSearchMinPhoneDigits || digits.Len() > UserSearchMaxPhoneDigits {
+			return "", "", ErrUnacceptableRequest
+		}
+		return USER_SEARCH_PHONE, digits.String(), nil
+	}
+
+	name, err := NormalizeProfileText(query, 2*NameMaxLength+1)
+	if err != nil {
+		return "", "", err
+	}
+	if utf8.RuneCountInString(name) < UserSearchMinNameLength {
+		return "", "", ErrUnacceptableRequest
+	}
+	return USER_SEARCH_NAME, strings.ToLower(strings.Join(strings.Fields(name), " ")), nil
+}
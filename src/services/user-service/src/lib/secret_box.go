@@ -0,0 +1,53 @@
+package lib
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// SecretBox encrypts secrets that have to be read back, such as TOTP seeds,
+// with AES-256-GCM. Sealed values are the nonce followed by the ciphertext.
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// NewSecretBox takes the 32 byte key encoded as standard base64.
+func NewSecretBox(encodedKey string) (*SecretBox, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretBox{aead: aead}, nil
+}
+
+func (box *SecretBox) Seal(plaintext []byte) ([]byte, error) {
+	nonce, err := generateRandomBytes(uint32(box.aead.NonceSize()))
+	if err != nil {
+		return nil, err
+	}
+	return box.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (box *SecretBox) Open(sealed []byte) ([]byte, error) {
+	nonceSize := box.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.New("sealed value is too short")
+	}
+	return box.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+}
@@ -0,0 +1,11 @@
+package lib
+
+const (
+	SECURITY_EVENT_REFRESH_TOKEN_REUSE  = "refresh_token_reuse"
+	SECURITY_EVENT_TOTP_ENABLED         = "totp_enabled"
+	SECURITY_EVENT_TOTP_DISABLED        = "totp_disabled"
+	SECURITY_EVENT_RECOVERY_CODE_USED   = "recovery_code_used"
+	SECURITY_EVENT_PHONE_NUMBER_CHANGED = "phone_number_changed"
+	SECURITY_EVENT_DATA_EXPORTED        = "data_exported"
+	SECURITY_EVENT_ACCOUNT_DELETED      = "account_deleted"
+)
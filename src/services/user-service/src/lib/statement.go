@@ -0,0 +1,186 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	STATEMENT_FORMAT_PDF = "pdf"
+	STATEMENT_FORMAT_CSV = "csv"
+
+	MinorUnitsPerUnit = 100
+
+	statementMonthLayout = "2006-01"
+	statementDateLayout  = "2006-01-02"
+)
+
+type StatementLine struct {
+	TransferId  string
+	Timestamp   time.Time
+	Description string
+	Memo        string
+	Reference   string
+	Amount      *big.Int
+	Balance     *big.Int
+}
+
+// Statement covers one calendar month of the user's main account. Amounts
+// are signed minor units: credits to the user are positive.
+type Statement struct {
+	UserId         string
+	Name           string
+	Month          time.Time
+	OpeningBalance *big.Int
+	ClosingBalance *big.Int
+	Lines          []StatementLine
+}
+
+// ParseStatementMonth returns the start of the month, which must already be
+// over.
+func ParseStatementMonth(month string, now time.Time) (time.Time, error) {
+	start, err := time.Parse(statementMonthLayout, month)
+	if err != nil {
+		return time.Time{}, ErrUnacceptableRequest
+	}
+	if start.AddDate(0, 1, 0).After(now) {
+		return time.Time{}, ErrUnacceptableRequest
+	}
+	return start, nil
+}
+
+func FormatStatementMonth(month time.Time) string {
+	return month.UTC().Format(statementMonthLayout)
+}
+
+func StatementFilename(month time.Time, format string) string {
+	return "statement-" + FormatStatementMonth(month) + "." + format
+}
+
+func StatementContentType(format string) string {
+	if format == STATEMENT_FORMAT_PDF {
+		return "application/pdf"
+	}
+	return "text/csv"
+}
+
+func Checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// LedgerChecksum covers only what the ledger fixes for good: transfer ids,
+// timestamps, amounts and balances. Names and descriptions are left out, so a
+// renamed user, pot or counterparty does not change the checksum.
+func LedgerChecksum(statement Statement) string {
+	fields := []string{
+		statement.UserId,
+		FormatStatementMonth(statement.Month),
+		statement.OpeningBalance.Text(16),
+	}
+	for _, line := range statement.Lines {
+		fields = append(fields,
+			line.TransferId,
+			line.Timestamp.UTC().Format(time.RFC3339Nano),
+			line.Amount.Text(16),
+			line.Balance.Text(16),
+		)
+	}
+	fields = append(fields, statement.ClosingBalance.Text(16))
+
+	return Checksum([]byte(strings.Join(fields, "\n")))
+}
+
+// FormatMinorUnits renders signed minor units as a decimal amount, e.g.
+// -1234 as "-12.34".
+func FormatMinorUnits(amount *big.Int) string {
+	sign := ""
+	abs := new(big.Int).Abs(amount)
+	if amount.Sign() < 0 {
+		sign = "-"
+	}
+	units, cents := new(big.Int).QuoRem(abs, big.NewInt(MinorUnitsPerUnit), new(big.Int))
+	return fmt.Sprintf("%s%s.%02d", sign, units.String(), cents.Int64())
+}
+
+func RenderStatementCsv(statement Statement) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	records := [][]string{
+		{"date", "transfer_id", "description", "memo", "reference", "amount", "balance"},
+		{statement.Month.Format(statementDateLayout), "", "Opening balance", "", "", "", FormatMinorUnits(statement.OpeningBalance)},
+	}
+	for _, line := range statement.Lines {
+		records = append(records, []string{
+			line.Timestamp.UTC().Format(time.RFC3339),
+			line.TransferId,
+			line.Description,
+			line.Memo,
+			line.Reference,
+			FormatMinorUnits(line.Amount),
+			FormatMinorUnits(line.Balance),
+		})
+	}
+	records = append(records, []string{
+		statementLastDay(statement.Month).Format(statementDateLayout), "", "Closing balance", "", "", "", FormatMinorUnits(statement.ClosingBalance),
+	})
+
+	if err := writer.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func RenderStatementPdf(statement Statement) []byte {
+	row := func(date, description, memo, amount, balance string) string {
+		return fmt.Sprintf("%-10s  %-30s  %-26s  %13s  %13s",
+			date, fitColumn(description, 30), fitColumn(memo, 26), amount, balance)
+	}
+
+	lines := []string{
+		"ACCOUNT STATEMENT",
+		"",
+		"Account holder: " + statement.Name,
+		"Account:        " + statement.UserId,
+		"Period:         " + statement.Month.Format(statementDateLayout) + " - " + statementLastDay(statement.Month).Format(statementDateLayout),
+		"",
+		row("Date", "Description", "Memo", "Amount", "Balance"),
+		strings.Repeat("-", 100),
+		row(statement.Month.Format(statementDateLayout), "Opening balance", "", "", FormatMinorUnits(statement.OpeningBalance)),
+	}
+	for _, line := range statement.Lines {
+		lines = append(lines, row(
+			line.Timestamp.UTC().Format(statementDateLayout),
+			line.Description,
+			line.Memo,
+			FormatMinorUnits(line.Amount),
+			FormatMinorUnits(line.Balance),
+		))
+	}
+	lines = append(lines,
+		row(statementLastDay(statement.Month).Format(statementDateLayout), "Closing balance", "", "", FormatMinorUnits(statement.ClosingBalance)),
+		strings.Repeat("-", 100),
+		fmt.Sprintf("%d transfers", len(statement.Lines)),
+	)
+
+	return RenderTextPdf(lines)
+}
+
+func statementLastDay(month time.Time) time.Time {
+	return month.AddDate(0, 1, -1)
+}
+
+func fitColumn(value string, width int) string {
+	if utf8.RuneCountInString(value) <= width {
+		return value
+	}
+	return string([]rune(value)[:width-1]) + "~"
+}
@@ -15,26 +15,86 @@ type TokenPair struct {
 	RefreshTokenExpires time.Time
 }
 
+const (
+	TOKEN_TYPE_ACCESS  = "access"
+	TOKEN_TYPE_REFRESH = "refresh"
+)
+
+const (
+	AMR_SMS = "sms"
+	AMR_OTP = "otp"
+	AMR_MFA = "mfa"
+
+	ACR_SINGLE_FACTOR = "aal1"
+	ACR_MULTI_FACTOR  = "aal2"
+)
+
+// AuthContext describes how the session was authenticated, published as the
+// amr and acr claims of access tokens.
+type AuthContext struct {
+	Amr []string
+	Acr string
+}
+
+// NewAuthContext treats a session as multi-factor while its last step-up
+// verification is recent.
+func NewAuthContext(mfaAt *time.Time, now time.Time) AuthContext {
+	if mfaAt != nil && now.Sub(*mfaAt) < StepUpValidity {
+		return AuthContext{Amr: []string{AMR_SMS, AMR_OTP, AMR_MFA}, Acr: ACR_MULTI_FACTOR}
+	}
+	return AuthContext{Amr: []string{AMR_SMS}, Acr: ACR_SINGLE_FACTOR}
+}
+
+// TokenClaims carries the refresh generation of the session for refresh
+// tokens. Each refresh moves the session to the next generation, so a refresh
+// token can only be used once.
 type TokenClaims struct {
-	UserId    string
-	SessionId string
+	UserId     string
+	SessionId  string
+	Type       string
+	Generation int64
+	Expires    time.Time
+	Amr        []string
+	Acr        string
 }
 
+// TokenService signs with the current key of the key set when one is
+// configured. The shared secret then only verifies HS256 tokens issued before
+// the switch, and only until hs256Until; without a cut-off HS256 tokens are
+// rejected as soon as a key set is configured. Without a key set it keeps
+// signing HS256 tokens.
 type TokenService struct {
-	secret string
+	secret     string
+	keys       *KeySet
+	hs256Until *time.Time
 }
 
-func NewTokenService(secret string) *TokenService {
-	return &TokenService{secret: secret}
+func NewTokenService(secret string, keys *KeySet, hs256Until *time.Time) *TokenService {
+	return &TokenService{secret: secret, keys: keys, hs256Until: hs256Until}
 }
 
-func (ts *TokenService) GenerateTokenPair(userId, sessionId string) (*TokenPair, error) {
-	accessToken, accessTokenExpires, err := ts.generateToken(userId, sessionId, AccessTokenTTL)
+func (ts *TokenService) acceptsHS256(now time.Time) bool {
+	if ts.secret == "" {
+		return false
+	}
+	if ts.keys == nil {
+		return true
+	}
+	return ts.hs256Until != nil && now.Before(*ts.hs256Until)
+}
+
+func (ts *TokenService) GenerateTokenPair(userId, sessionId string, generation int64, auth AuthContext) (*TokenPair, error) {
+	accessToken, accessTokenExpires, err := ts.GenerateAccessToken(userId, sessionId, auth)
 	if err != nil {
-		return nil, fmt.Errorf("generate access token: %w", err)
+		return nil, err
 	}
 
-	refreshToken, refreshTokenExpires, err := ts.generateToken(userId, sessionId, RefreshTokenTTL)
+	refreshToken, refreshTokenExpires, err := ts.generateToken(jwt.MapClaims{
+		"sub": userId,
+		"sid": sessionId,
+		"typ": TOKEN_TYPE_REFRESH,
+		"gen": generation,
+	}, RefreshTokenTTL)
 	if err != nil {
 		return nil, fmt.Errorf("generate refresh token: %w", err)
 	}
@@ -47,25 +107,92 @@ func (ts *TokenService) GenerateTokenPair(userId, sessionId string) (*TokenPair,
 	}, nil
 }
 
-func (ts *TokenService) generateToken(userId, sessionId string, ttl time.Duration) (string, time.Time, error) {
-	expires := time.Now().Add(ttl)
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"iss": "banking-user-service",
+func (ts *TokenService) GenerateAccessToken(userId, sessionId string, auth AuthContext) (string, time.Time, error) {
+	accessToken, accessTokenExpires, err := ts.generateToken(jwt.MapClaims{
 		"sub": userId,
-		"exp": expires.Unix(),
-		"iat": time.Now().Unix(),
 		"sid": sessionId,
-	})
+		"typ": TOKEN_TYPE_ACCESS,
+		"amr": auth.Amr,
+		"acr": auth.Acr,
+	}, AccessTokenTTL)
+	if err != nil {
+		return "", accessTokenExpires, fmt.Errorf("generate access token: %w", err)
+	}
+
+	return accessToken, accessTokenExpires, nil
+}
+
+func (ts *TokenService) generateToken(claims jwt.MapClaims, ttl time.Duration) (string, time.Time, error) {
+	expires := time.Now().Add(ttl)
+	claims["iss"] = "banking-user-service"
+	claims["exp"] = expires.Unix()
+	claims["iat"] = time.Now().Unix()
 
-	token, err := jwtToken.SignedString([]byte(ts.secret))
+	if ts.keys == nil {
+		jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token, err := jwtToken.SignedString([]byte(ts.secret))
+		return token, expires, err
+	}
+
+	key, err := ts.keys.SigningKey(time.Now())
+	if err != nil {
+		return "", expires, err
+	}
+	jwtToken := jwt.NewWithClaims(key.Method, claims)
+	jwtToken.Header["kid"] = key.Kid
+
+	token, err := jwtToken.SignedString(key.PrivateKey)
 
 	return token, expires, err
 }
 
-func (ts *TokenService) DecodeAndValidate(tokenString string) (*TokenClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+func (ts *TokenService) verificationKey(token *jwt.Token) (any, error) {
+	if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		if !ts.acceptsHS256(time.Now()) {
+			return nil, fmt.Errorf("HS256 tokens are not accepted")
+		}
 		return []byte(ts.secret), nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	}
+
+	if ts.keys == nil {
+		return nil, fmt.Errorf("no verification keys are configured")
+	}
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing key id")
+	}
+	key, ok := ts.keys.VerificationKey(kid, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if key.Method.Alg() != token.Method.Alg() {
+		return nil, fmt.Errorf("algorithm %s does not match key %s", token.Method.Alg(), kid)
+	}
+	return key.PrivateKey.Public(), nil
+}
+
+func (ts *TokenService) validMethods() []string {
+	methods := []string{}
+	if ts.acceptsHS256(time.Now()) {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if ts.keys != nil {
+		methods = append(methods, jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodES256.Alg())
+	}
+	return methods
+}
+
+// Jwks returns the public keys that verify tokens. It is empty while tokens
+// are signed with the shared secret.
+func (ts *TokenService) Jwks() ([]Jwk, error) {
+	if ts.keys == nil {
+		return []Jwk{}, nil
+	}
+	return ts.keys.Jwks(time.Now())
+}
+
+func (ts *TokenService) DecodeAndValidate(tokenString string) (*TokenClaims, error) {
+	token, err := jwt.Parse(tokenString, ts.verificationKey, jwt.WithValidMethods(ts.validMethods()))
 	if err != nil {
 		return nil, fmt.Errorf("parse token: %w", err)
 	}
@@ -93,9 +220,41 @@ func (ts *TokenService) DecodeAndValidate(tokenString string) (*TokenClaims, err
 		return nil, fmt.Errorf("missing session id")
 	}
 
-	return &TokenClaims{
+	tokenType, ok := claims["typ"].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing token type")
+	}
+
+	tokenClaims := &TokenClaims{
 		UserId:    userId,
 		SessionId: sessionId,
-	}, nil
+		Type:      tokenType,
+		Expires:   expiry.Time,
+	}
+
+	if tokenType == TOKEN_TYPE_ACCESS {
+		// Tokens issued before amr and acr were added count as single factor.
+		tokenClaims.Acr = ACR_SINGLE_FACTOR
+		if acr, ok := claims["acr"].(string); ok {
+			tokenClaims.Acr = acr
+		}
+		if amr, ok := claims["amr"].([]any); ok {
+			for _, method := range amr {
+				if method, ok := method.(string); ok {
+					tokenClaims.Amr = append(tokenClaims.Amr, method)
+				}
+			}
+		}
+	}
+
+	if tokenType == TOKEN_TYPE_REFRESH {
+		generation, ok := claims["gen"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("missing refresh generation")
+		}
+		tokenClaims.Generation = int64(generation)
+	}
+
+	return tokenClaims, nil
 
 }
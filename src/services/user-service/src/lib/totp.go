@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	TOTPIssuer       = "FSO Banking"
+	TOTPDigits       = 6
+	TOTPPeriod       = 30 * time.Second
+	totpSecretLength = 20
+
+	// Codes from one period before or after the current one are accepted to
+	// allow for clock drift.
+	TOTPSkewSteps = 1
+
+	RecoveryCodeCount  = 10
+	recoveryCodeLength = 10
+
+	// A step-up verification counts as recent MFA for this long.
+	StepUpValidity = 15 * time.Minute
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateTOTPSecret() ([]byte, error) {
+	return generateRandomBytes(totpSecretLength)
+}
+
+func EncodeTOTPSecret(secret []byte) string {
+	return totpEncoding.EncodeToString(secret)
+}
+
+// TOTPURI is the otpauth:// key URI that authenticator apps import, usually
+// from a QR code.
+func TOTPURI(secret []byte, accountName string) string {
+	label := url.PathEscape(TOTPIssuer) + ":" + url.PathEscape(accountName)
+	query := url.Values{
+		"secret":    {EncodeTOTPSecret(secret)},
+		"issuer":    {TOTPIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(TOTPDigits)},
+		"period":    {fmt.Sprint(int(TOTPPeriod.Seconds()))},
+	}
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+func TOTPStep(now time.Time) int64 {
+	return now.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// TOTPCode is the RFC 4226 HOTP value for the step.
+func TOTPCode(secret []byte, step int64) string {
+	mac := hmac.New(sha1.New, secret)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulus := uint32(1)
+	for range TOTPDigits {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%modulus)
+}
+
+// VerifyTOTP returns the step the code belongs to. Steps up to lastUsedStep
+// are rejected so a code cannot be replayed.
+func VerifyTOTP(secret []byte, code string, now time.Time, lastUsedStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	current := TOTPStep(now)
+	for step := current - TOTPSkewSteps; step <= current+TOTPSkewSteps; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(TOTPCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns codes formatted as "xxxxx-xxxxx" for display.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		random, err := generateRandomBytes(recoveryCodeLength)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(random))[:recoveryCodeLength]
+		codes[i] = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode strips the formatting users may or may not type. It
+// returns "" for anything that cannot be a recovery code.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != recoveryCodeLength {
+		return ""
+	}
+	for _, char := range code {
+		if !strings.ContainsRune("abcdefghijklmnopqrstuvwxyz234567", char) {
+			return ""
+		}
+	}
+	return code
+}
@@ -13,3 +13,17 @@ func RemoveDuplicates(items []string) []string {
 func FormatName(firstName, lastName string) string {
 	return strings.TrimSpace(firstName + " " + lastName)
 }
+
+func StringOrEmpty(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func StringOrNil(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
@@ -6,10 +6,12 @@ import (
 	"log"
 	"log/slog"
 	"net"
+	paymentPb "protobufs/gen/go/payment-service"
 	tbPb "protobufs/gen/go/tigerbeetle-service"
 	pb "protobufs/gen/go/user-service"
 
 	"user-service/src/lib"
+	"user-service/src/repo"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
@@ -31,7 +33,14 @@ type UserServiceServer struct {
 	config                       *lib.Configuration
 	tigerbeetleService           tbPb.TigerbeetleServiceClient
 	tigerbeetleServiceConnection *grpc.ClientConn
+	paymentService               paymentPb.PaymentServiceClient
+	paymentServiceConnection     *grpc.ClientConn
 	tokenService                 *lib.TokenService
+	otpSender                    lib.OTPSender
+	sessionRevocations           *repo.SessionRevocations
+	geoIp                        *lib.GeoIP
+	secretBox                    *lib.SecretBox
+	kycVerifier                  lib.KycVerifier
 }
 
 func initTracer(config *lib.Configuration) func() {
@@ -91,14 +100,73 @@ func newServer(config *lib.Configuration) *UserServiceServer {
 	client := tbPb.NewTigerbeetleServiceClient(conn)
 	slog.Info("Connected to Tigerbeetle service grpc")
 
-	tokenService := lib.NewTokenService(config.UserServiceJWTSecret)
+	paymentConn, err := grpc.NewClient(config.PaymentServiceUrl, opts...)
+	if err != nil {
+		slog.Error("Failed to open Payment service grpc connection", "error", err)
+		panic(err)
+	}
+	paymentClient := paymentPb.NewPaymentServiceClient(paymentConn)
+	slog.Info("Connected to Payment service grpc")
+
+	var jwtKeys *lib.KeySet
+	if config.JWTKeyDir != "" {
+		jwtKeys, err = lib.LoadKeySet(config.JWTKeyDir)
+		if err != nil {
+			slog.Error("Failed to load JWT keys", "error", err)
+			panic(err)
+		}
+		jwtKeys.Watch(lib.JWTKeyReloadInterval)
+		slog.Info("Loaded JWT keys", "dir", config.JWTKeyDir)
+	}
+	tokenService := lib.NewTokenService(config.UserServiceJWTSecret, jwtKeys, config.JWTHS256Until)
+
+	otpSender, err := lib.NewOTPSender(config.OTPSender, config.OTPFallbackSender)
+	if err != nil {
+		slog.Error("Failed to create OTP sender", "error", err)
+		panic(err)
+	}
+
+	kycVerifier, err := lib.NewKycVerifier(config.KycVerifier)
+	if err != nil {
+		slog.Error("Failed to create KYC verifier", "error", err)
+		panic(err)
+	}
+
+	var geoIp *lib.GeoIP
+	if config.GeoIPDatabasePath != "" {
+		geoIp, err = lib.LoadGeoIP(config.GeoIPDatabasePath)
+		if err != nil {
+			slog.Error("Failed to load GeoIP database", "error", err)
+			panic(err)
+		}
+		slog.Info("Loaded GeoIP database", "path", config.GeoIPDatabasePath)
+	}
+
+	secretBox, err := lib.NewSecretBox(config.MfaEncryptionKey)
+	if err != nil {
+		slog.Error("Failed to create MFA secret box", "error", err)
+		panic(err)
+	}
+
+	sessionRevocations := repo.NewSessionRevocations(db)
+	if err := sessionRevocations.Refresh(context.Background()); err != nil {
+		panic(err)
+	}
+	sessionRevocations.Watch(lib.SessionRevocationRefreshInterval)
 
 	return &UserServiceServer{
 		db:                           db,
 		config:                       config,
 		tigerbeetleServiceConnection: conn,
 		tigerbeetleService:           client,
+		paymentServiceConnection:     paymentConn,
+		paymentService:               paymentClient,
 		tokenService:                 tokenService,
+		otpSender:                    otpSender,
+		sessionRevocations:           sessionRevocations,
+		geoIp:                        geoIp,
+		secretBox:                    secretBox,
+		kycVerifier:                  kycVerifier,
 	}
 }
 
@@ -121,8 +189,18 @@ func main() {
 	server := newServer(config)
 	defer server.db.Close()
 	defer server.tigerbeetleServiceConnection.Close()
+	defer server.paymentServiceConnection.Close()
+
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	go server.runDeletionWorker(workerCtx)
 
 	pb.RegisterUserServiceServer(grpcServer, server)
+
+	if config.JWKSHttpPort != "" {
+		go server.serveJwks(config.JWKSHttpPort)
+	}
+
 	slog.Info("Service ready to accept connections", "service", lib.ServiceName, "port", config.UserServicePort)
 	grpcServer.Serve(lis)
 }
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"user-service/src/lib"
+	"user-service/src/queries"
+	"user-service/src/repo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "protobufs/gen/go/user-service"
+)
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery code.
+// Failures count against the user so codes cannot be brute forced.
+func (s *UserServiceServer) verifySecondFactor(ctx context.Context, tracer trace.Tracer, userId, code string) error {
+	lockoutKeys := []string{lib.MfaUserLimit.Key(userId)}
+	if err := s.checkAuthLockout(ctx, tracer, lockoutKeys); err != nil {
+		return err
+	}
+
+	ctx, verifySpan := tracer.Start(ctx, lib.EVENT_MFA_VERIFY)
+	defer verifySpan.End()
+
+	verifySpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetTotpFactor),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{userId}),
+	)
+
+	factor, err := repo.GetTotpFactor(ctx, s.db, userId)
+	if err == lib.ErrNotFound || (err == nil && factor.ConfirmedAt == nil) {
+		return lib.ErrMfaNotEnrolled
+	}
+	if err != nil {
+		verifySpan.RecordError(err)
+		return err
+	}
+
+	secret, err := s.secretBox.Open(factor.SecretCiphertext)
+	if err != nil {
+		verifySpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	if step, ok := lib.VerifyTOTP(secret, code, time.Now(), factor.LastUsedStep); ok {
+		err = repo.UseTotpStep(ctx, s.db, userId, step)
+		if err != lib.ErrMfaCodeMismatch {
+			return err
+		}
+	} else if recoveryCode := lib.NormalizeRecoveryCode(code); recoveryCode != "" {
+		err = s.useRecoveryCode(ctx, userId, recoveryCode)
+		if err == nil {
+			verifySpan.AddEvent(lib.EVENT_RECOVERY_CODE_USED)
+		}
+		if err != lib.ErrMfaCodeMismatch {
+			return err
+		}
+	}
+
+	verifySpan.AddEvent(lib.EVENT_MFA_MISMATCH)
+	if err := s.recordAuthAttempt(ctx, tracer, lib.MfaUserLimit, userId); err != nil {
+		return err
+	}
+	return lib.ErrMfaCodeMismatch
+}
+
+func (s *UserServiceServer) useRecoveryCode(ctx context.Context, userId, recoveryCode string) error {
+	codes, err := repo.GetUnusedRecoveryCodes(ctx, s.db, userId)
+	if err != nil {
+		return err
+	}
+
+	for _, stored := range codes {
+		matches, err := lib.VerifyHash(stored.CodeHash, recoveryCode)
+		if err != nil {
+			return lib.ErrUnexpected
+		}
+		if !matches {
+			continue
+		}
+
+		if err := repo.UseRecoveryCode(ctx, s.db, stored.RecoveryCodeId); err != nil {
+			return err
+		}
+		return repo.RecordSecurityEvent(ctx, s.db, userId, nil, lib.SECURITY_EVENT_RECOVERY_CODE_USED,
+			"recovery code "+stored.RecoveryCodeId)
+	}
+
+	return lib.ErrMfaCodeMismatch
+}
+
+// requireStepUp checks that the session passed a second factor recently
+// enough to count as multi-factor, the same test used for the acr claim.
+func (s *UserServiceServer) requireStepUp(ctx context.Context, tracer trace.Tracer, userId, sessionId string) error {
+	ctx, stepUpSpan := tracer.Start(ctx, lib.EVENT_STEP_UP_CHECK)
+	defer stepUpSpan.End()
+
+	stepUpSpan.SetAttributes(
+		attribute.String(lib.ATTR_SESSION_ID, sessionId),
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetSessionMfa),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{sessionId, userId}),
+	)
+
+	var mfaAt *time.Time
+	err := s.db.GetContext(ctx, &mfaAt, queries.QueryGetSessionMfa, sessionId, userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			stepUpSpan.AddEvent(lib.EVENT_SESSION_NOT_FOUND)
+			return lib.ErrSessionRevoked
+		}
+		stepUpSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	if lib.NewAuthContext(mfaAt, time.Now()).Acr != lib.ACR_MULTI_FACTOR {
+		stepUpSpan.AddEvent(lib.EVENT_STEP_UP_REQUIRED)
+		return lib.ErrStepUpRequired
+	}
+	return nil
+}
+
+// BeginTotpEnrollment generates a new secret. It only takes effect once
+// confirmed with a code from the authenticator app, and replaces any earlier
+// unconfirmed secret.
+func (s *UserServiceServer) BeginTotpEnrollment(ctx context.Context, req *pb.BeginTotpEnrollmentRequest) (*pb.TotpEnrollment, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	ctx, dbGetUserSpan := tracer.Start(ctx, lib.EVENT_DB_GET_USER)
+	defer dbGetUserSpan.End()
+
+	dbGetUserSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetUserById),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	user := repo.User{}
+	err := s.db.GetContext(ctx, &user, queries.QueryGetUserById, req.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			dbGetUserSpan.AddEvent(lib.EVENT_USER_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		}
+		dbGetUserSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbGetUserSpan.End()
+
+	ctx, enrollSpan := tracer.Start(ctx, lib.EVENT_TOTP_ENROLL)
+	defer enrollSpan.End()
+
+	secret, err := lib.GenerateTOTPSecret()
+	if err != nil {
+		enrollSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	sealed, err := s.secretBox.Seal(secret)
+	if err != nil {
+		enrollSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+
+	enrollSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryUpsertPendingTotpFactor),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	err = repo.StorePendingTotpFactor(ctx, s.db, req.UserId, sealed)
+	if err != nil {
+		if err == lib.ErrConflict {
+			enrollSpan.AddEvent(lib.EVENT_DB_NO_ROWS_AFFECTED)
+			return nil, err
+		}
+		enrollSpan.RecordError(err)
+		return nil, err
+	}
+	enrollSpan.End()
+
+	return &pb.TotpEnrollment{
+		Secret:     lib.EncodeTOTPSecret(secret),
+		OtpauthUri: lib.TOTPURI(secret, user.PhoneNumber),
+	}, nil
+}
+
+// ConfirmTotpEnrollment enables the pending secret and returns a fresh set of
+// recovery codes. The codes are only stored hashed and cannot be shown again.
+func (s *UserServiceServer) ConfirmTotpEnrollment(ctx context.Context, req *pb.ConfirmTotpEnrollmentRequest) (*pb.RecoveryCodes, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	lockoutKeys := []string{lib.MfaUserLimit.Key(req.UserId)}
+	if err := s.checkAuthLockout(ctx, tracer, lockoutKeys); err != nil {
+		return nil, err
+	}
+
+	ctx, confirmSpan := tracer.Start(ctx, lib.EVENT_TOTP_CONFIRM)
+	defer confirmSpan.End()
+
+	confirmSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetTotpFactor),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	factor, err := repo.GetTotpFactor(ctx, s.db, req.UserId)
+	if err != nil {
+		if err == lib.ErrNotFound {
+			return nil, lib.ErrMfaNotEnrolled
+		}
+		confirmSpan.RecordError(err)
+		return nil, err
+	}
+	if factor.ConfirmedAt != nil {
+		return nil, lib.ErrConflict
+	}
+
+	secret, err := s.secretBox.Open(factor.SecretCiphertext)
+	if err != nil {
+		confirmSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+
+	step, ok := lib.VerifyTOTP(secret, req.Code, time.Now(), factor.LastUsedStep)
+	if !ok {
+		confirmSpan.AddEvent(lib.EVENT_MFA_MISMATCH)
+		if err := s.recordAuthAttempt(ctx, tracer, lib.MfaUserLimit, req.UserId); err != nil {
+			return nil, err
+		}
+		return nil, lib.ErrMfaCodeMismatch
+	}
+	confirmSpan.End()
+
+	ctx, storeCodesSpan := tracer.Start(ctx, lib.EVENT_RECOVERY_CODES_STORE)
+	defer storeCodesSpan.End()
+
+	codes, err := lib.GenerateRecoveryCodes()
+	if err != nil {
+		storeCodesSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	codeHashes := make([]string, len(codes))
+	for i, code := range codes {
+		codeHashes[i], err = lib.GenerateHash(lib.NormalizeRecoveryCode(code))
+		if err != nil {
+			storeCodesSpan.RecordError(err)
+			return nil, lib.ErrUnexpected
+		}
+	}
+
+	storeCodesSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryReplaceRecoveryCodes),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	if err := repo.ReplaceRecoveryCodes(ctx, s.db, req.UserId, codeHashes); err != nil {
+		storeCodesSpan.RecordError(err)
+		return nil, err
+	}
+	if err := repo.ConfirmTotpFactor(ctx, s.db, req.UserId, step); err != nil {
+		storeCodesSpan.RecordError(err)
+		return nil, err
+	}
+	if err := repo.RecordSecurityEvent(ctx, s.db, req.UserId, nil, lib.SECURITY_EVENT_TOTP_ENABLED, ""); err != nil {
+		storeCodesSpan.RecordError(err)
+		return nil, err
+	}
+	storeCodesSpan.End()
+
+	return &pb.RecoveryCodes{Codes: codes}, nil
+}
+
+func (s *UserServiceServer) DisableTotp(ctx context.Context, req *pb.DisableTotpRequest) (*pb.Empty, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	if err := s.verifySecondFactor(ctx, tracer, req.UserId, req.Code); err != nil {
+		return nil, err
+	}
+
+	ctx, disableSpan := tracer.Start(ctx, lib.EVENT_TOTP_DISABLE)
+	defer disableSpan.End()
+
+	disableSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryDeleteTotpFactor),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	if err := repo.DeleteTotpFactor(ctx, s.db, req.UserId); err != nil {
+		disableSpan.RecordError(err)
+		return nil, err
+	}
+	if err := repo.RecordSecurityEvent(ctx, s.db, req.UserId, nil, lib.SECURITY_EVENT_TOTP_DISABLED, ""); err != nil {
+		disableSpan.RecordError(err)
+		return nil, err
+	}
+
+	return &pb.Empty{}, nil
+}
+
+// VerifyStepUp stamps the session with the time of a successful second factor
+// check and returns an access token that carries it. Refreshed tokens keep the
+// multi-factor amr and acr until the step-up is no longer recent.
+func (s *UserServiceServer) VerifyStepUp(ctx context.Context, req *pb.VerifyStepUpRequest) (*pb.StepUp, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_SESSION_ID, req.SessionId),
+	)
+
+	if err := s.verifySecondFactor(ctx, tracer, req.UserId, req.Code); err != nil {
+		return nil, err
+	}
+
+	ctx, stepUpSpan := tracer.Start(ctx, lib.EVENT_SESSION_STEP_UP)
+	defer stepUpSpan.End()
+
+	stepUpSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryStampSessionMfa),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.SessionId, req.UserId}),
+	)
+
+	var mfaAt time.Time
+	err := s.db.GetContext(ctx, &mfaAt, queries.QueryStampSessionMfa, req.SessionId, req.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			stepUpSpan.AddEvent(lib.EVENT_SESSION_NOT_FOUND)
+			return nil, lib.ErrSessionRevoked
+		}
+		stepUpSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	stepUpSpan.End()
+
+	ctx, generateTokenSpan := tracer.Start(ctx, lib.EVENT_GENERATE_TOKEN_PAIR)
+	defer generateTokenSpan.End()
+
+	accessToken, accessTokenExpires, err := s.tokenService.GenerateAccessToken(req.UserId, req.SessionId, lib.NewAuthContext(&mfaAt, time.Now()))
+	if err != nil {
+		generateTokenSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	generateTokenSpan.End()
+
+	return &pb.StepUp{
+		MfaAt:              mfaAt.UTC().Format(time.RFC3339),
+		AccessToken:        accessToken,
+		AccessTokenExpires: accessTokenExpires.UTC().Format(time.RFC3339),
+	}, nil
+}
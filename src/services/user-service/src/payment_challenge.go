@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"user-service/src/lib"
+	"user-service/src/queries"
+	"user-service/src/repo"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "protobufs/gen/go/user-service"
+)
+
+// CreatePaymentChallenge sends the payer a code bound to the amount and
+// recipient. Confirming it yields the token payment-service requires for
+// payments above its threshold. A bulk payment is confirmed once for the
+// whole batch, so its challenge is bound to the batch id and total instead,
+// and has no recipient.
+func (s *UserServiceServer) CreatePaymentChallenge(ctx context.Context, req *pb.CreatePaymentChallengeRequest) (*pb.PaymentChallenge, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	amount := strconv.FormatUint(req.Amount, 10)
+
+	bulkBatchId := lib.StringOrEmpty(req.BulkBatchId)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_PAYMENT_TO_USER_ID, req.ToUserId),
+		attribute.String(lib.ATTR_PAYMENT_BULK_BATCH_ID, bulkBatchId),
+		attribute.String(lib.ATTR_PAYMENT_AMOUNT, amount),
+	)
+
+	if req.Amount == 0 || (req.ToUserId == "") == (bulkBatchId == "") || req.UserId == req.ToUserId {
+		span.AddEvent(lib.EVENT_VALIDATION_FAILED)
+		return nil, lib.ErrUnacceptableRequest
+	}
+
+	lockoutKeys := []string{lib.PaymentChallengeUserLimit.Key(req.UserId)}
+	if err := s.checkAuthLockout(ctx, tracer, lockoutKeys); err != nil {
+		return nil, err
+	}
+	if err := s.recordAuthAttempt(ctx, tracer, lib.PaymentChallengeUserLimit, req.UserId); err != nil {
+		return nil, err
+	}
+
+	ctx, dbGetUserSpan := tracer.Start(ctx, lib.EVENT_DB_GET_USER)
+	defer dbGetUserSpan.End()
+
+	userIds := []string{req.UserId}
+	if bulkBatchId == "" {
+		userIds = append(userIds, req.ToUserId)
+	}
+
+	dbGetUserSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetUserById),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, userIds),
+	)
+
+	users := make([]repo.User, len(userIds))
+	for i, userId := range userIds {
+		err := s.db.GetContext(ctx, &users[i], queries.QueryGetUserById, userId)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				dbGetUserSpan.AddEvent(lib.EVENT_USER_NOT_FOUND)
+				return nil, lib.ErrNotFound
+			}
+			dbGetUserSpan.RecordError(err)
+			return nil, lib.ErrUnexpected
+		}
+	}
+	payer := users[0]
+	recipientName := lib.BulkPaymentRecipientName
+	if bulkBatchId == "" {
+		recipientName = lib.FormatName(users[1].FirstName, users[1].LastName)
+	}
+	dbGetUserSpan.End()
+
+	ctx, createSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_CHALLENGE_CREATE)
+	defer createSpan.End()
+
+	code, err := lib.GenerateOTPCode()
+	if err != nil {
+		createSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	codeHash, err := lib.GenerateHash(code)
+	if err != nil {
+		createSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+
+	challengeId := uuid.NewString()
+
+	createSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryInsertPaymentChallenge),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{challengeId, req.UserId, req.ToUserId, bulkBatchId, amount}),
+		attribute.String(lib.ATTR_PAYMENT_CHALLENGE_ID, challengeId),
+	)
+
+	expires, err := repo.CreatePaymentChallenge(ctx, s.db, repo.PaymentChallenge{
+		ChallengeId: challengeId,
+		UserId:      req.UserId,
+		ToUserId:    lib.StringOrNil(req.ToUserId),
+		BulkBatchId: lib.StringOrNil(bulkBatchId),
+		Amount:      amount,
+		CodeHash:    codeHash,
+	})
+	if err != nil {
+		createSpan.RecordError(err)
+		return nil, err
+	}
+	createSpan.End()
+
+	ctx, sendSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_CHALLENGE_SEND)
+	defer sendSpan.End()
+
+	sendSpan.SetAttributes(
+		attribute.String(lib.ATTR_PHONE_NUMBER, lib.RedactPhoneNumber(payer.PhoneNumber)),
+	)
+
+	err = s.otpSender.SendOTP(ctx, payer.PhoneNumber, lib.PaymentChallengeMessage(code, req.Amount, recipientName))
+	if err != nil {
+		sendSpan.RecordError(err)
+		return nil, lib.ErrOTPDeliveryFailed
+	}
+	sendSpan.End()
+
+	return &pb.PaymentChallenge{
+		ChallengeId:   challengeId,
+		ToUserId:      req.ToUserId,
+		BulkBatchId:   req.BulkBatchId,
+		RecipientName: recipientName,
+		Amount:        req.Amount,
+		Expires:       expires.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// ConfirmPaymentChallenge checks the code and issues the confirmation token.
+// The payer's session must have stepped up recently.
+func (s *UserServiceServer) ConfirmPaymentChallenge(ctx context.Context, req *pb.ConfirmPaymentChallengeRequest) (*pb.PaymentConfirmation, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_PAYMENT_CHALLENGE_ID, req.ChallengeId),
+		attribute.String(lib.ATTR_SESSION_ID, req.SessionId),
+	)
+
+	ctx, getSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_CHALLENGE_GET)
+	defer getSpan.End()
+
+	getSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetPaymentChallenge),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.ChallengeId, req.UserId}),
+	)
+
+	challenge := repo.PaymentChallenge{}
+	err := s.db.GetContext(ctx, &challenge, queries.QueryGetPaymentChallenge, req.ChallengeId, req.UserId, lib.MaxPaymentChallengeAttempts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			getSpan.AddEvent(lib.EVENT_PAYMENT_CHALLENGE_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		}
+		getSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	if challenge.ConfirmedAt != nil {
+		getSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "challengeId"),
+		))
+		return nil, lib.ErrConflict
+	}
+	getSpan.End()
+
+	// The code proves possession of the phone; a recent step-up adds the
+	// second factor that a SIM swap alone cannot provide.
+	if err := s.requireStepUp(ctx, tracer, req.UserId, req.SessionId); err != nil {
+		return nil, err
+	}
+
+	amount, err := strconv.ParseUint(challenge.Amount, 10, 64)
+	if err != nil {
+		span.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+
+	ctx, confirmSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_CHALLENGE_CONFIRM)
+	defer confirmSpan.End()
+
+	matches, err := lib.VerifyHash(challenge.CodeHash, req.Code)
+	if err != nil {
+		confirmSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	if !matches {
+		confirmSpan.AddEvent(lib.EVENT_PAYMENT_CHALLENGE_MISMATCH)
+		if err := repo.RecordPaymentChallengeFailure(ctx, s.db, challenge.ChallengeId); err != nil {
+			confirmSpan.RecordError(err)
+			return nil, err
+		}
+		return nil, lib.ErrPaymentChallengeMismatch
+	}
+
+	confirmSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryConfirmPaymentChallenge),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{challenge.ChallengeId}),
+	)
+
+	err = repo.ConfirmPaymentChallenge(ctx, s.db, challenge.ChallengeId)
+	if err != nil {
+		if err == lib.ErrNotFound {
+			confirmSpan.AddEvent(lib.EVENT_PAYMENT_CHALLENGE_NOT_FOUND)
+			return nil, err
+		}
+		confirmSpan.RecordError(err)
+		return nil, err
+	}
+
+	token, expires, err := s.tokenService.GeneratePaymentConfirmation(lib.PaymentConfirmationClaims{
+		UserId:      challenge.UserId,
+		ChallengeId: challenge.ChallengeId,
+		ToUserId:    lib.StringOrEmpty(challenge.ToUserId),
+		BulkBatchId: lib.StringOrEmpty(challenge.BulkBatchId),
+		Amount:      amount,
+	})
+	if err != nil {
+		confirmSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	confirmSpan.End()
+
+	return &pb.PaymentConfirmation{
+		ConfirmationToken: token,
+		Expires:           expires.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// RedeemPaymentConfirmation is called by payment-service before it executes
+// the payment. Each confirmation is accepted once, and only for the payer,
+// recipient and amount it was issued for.
+func (s *UserServiceServer) RedeemPaymentConfirmation(ctx context.Context, req *pb.RedeemPaymentConfirmationRequest) (*pb.Empty, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	amount := strconv.FormatUint(req.Amount, 10)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.FromUserId),
+		attribute.String(lib.ATTR_PAYMENT_TO_USER_ID, req.ToUserId),
+		attribute.String(lib.ATTR_PAYMENT_AMOUNT, amount),
+	)
+
+	ctx, redeemSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_CONFIRMATION_REDEEM)
+	defer redeemSpan.End()
+
+	claims, err := s.tokenService.DecodePaymentConfirmation(req.ConfirmationToken)
+	if err != nil {
+		redeemSpan.AddEvent(lib.EVENT_TOKEN_INVALID, trace.WithAttributes(
+			attribute.String("error", err.Error()),
+		))
+		return nil, lib.ErrPaymentConfirmationInvalid
+	}
+	if claims.UserId != req.FromUserId || claims.ToUserId != req.ToUserId || claims.BulkBatchId != lib.StringOrEmpty(req.BulkBatchId) || claims.Amount != req.Amount {
+		redeemSpan.AddEvent(lib.EVENT_PAYMENT_CHALLENGE_MISMATCH)
+		return nil, lib.ErrPaymentConfirmationInvalid
+	}
+
+	redeemSpan.SetAttributes(
+		attribute.String(lib.ATTR_PAYMENT_CHALLENGE_ID, claims.ChallengeId),
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryRedeemPaymentChallenge),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{claims.ChallengeId, claims.UserId, claims.ToUserId, claims.BulkBatchId, amount}),
+	)
+
+	err = repo.RedeemPaymentConfirmation(ctx, s.db, *claims, amount)
+	if err != nil {
+		if err == lib.ErrPaymentConfirmationInvalid {
+			redeemSpan.AddEvent(lib.EVENT_DB_NO_ROWS_AFFECTED)
+			return nil, err
+		}
+		redeemSpan.RecordError(err)
+		return nil, err
+	}
+
+	return &pb.Empty{}, nil
+}
+
+// ReleasePaymentConfirmation is called by payment-service when a payment it
+// redeemed a confirmation for fails before any money moves, so the payer can
+// retry without confirming again.
+func (s *UserServiceServer) ReleasePaymentConfirmation(ctx context.Context, req *pb.RedeemPaymentConfirmationRequest) (*pb.Empty, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	amount := strconv.FormatUint(req.Amount, 10)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.FromUserId),
+		attribute.String(lib.ATTR_PAYMENT_TO_USER_ID, req.ToUserId),
+		attribute.String(lib.ATTR_PAYMENT_AMOUNT, amount),
+	)
+
+	ctx, releaseSpan := tracer.Start(ctx, lib.EVENT_PAYMENT_CONFIRMATION_RELEASE)
+	defer releaseSpan.End()
+
+	claims, err := s.tokenService.DecodePaymentConfirmation(req.ConfirmationToken)
+	if err != nil {
+		releaseSpan.AddEvent(lib.EVENT_TOKEN_INVALID, trace.WithAttributes(
+			attribute.String("error", err.Error()),
+		))
+		return nil, lib.ErrPaymentConfirmationInvalid
+	}
+	if claims.UserId != req.FromUserId || claims.ToUserId != req.ToUserId || claims.BulkBatchId != lib.StringOrEmpty(req.BulkBatchId) || claims.Amount != req.Amount {
+		releaseSpan.AddEvent(lib.EVENT_PAYMENT_CHALLENGE_MISMATCH)
+		return nil, lib.ErrPaymentConfirmationInvalid
+	}
+
+	releaseSpan.SetAttributes(
+		attribute.String(lib.ATTR_PAYMENT_CHALLENGE_ID, claims.ChallengeId),
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryReleasePaymentChallenge),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{claims.ChallengeId, claims.UserId, claims.ToUserId, claims.BulkBatchId, amount}),
+	)
+
+	err = repo.ReleasePaymentConfirmation(ctx, s.db, *claims, amount)
+	if err != nil {
+		if err == lib.ErrPaymentConfirmationInvalid {
+			releaseSpan.AddEvent(lib.EVENT_DB_NO_ROWS_AFFECTED)
+			return nil, err
+		}
+		releaseSpan.RecordError(err)
+		return nil, err
+	}
+
+	return &pb.Empty{}, nil
+}
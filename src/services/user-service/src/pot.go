@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math/big"
+	"time"
+
+	"user-service/src/lib"
+	"user-service/src/queries"
+	"user-service/src/repo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+
+	tbPb "protobufs/gen/go/tigerbeetle-service"
+	pb "protobufs/gen/go/user-service"
+
+	tbt "github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+func (s *UserServiceServer) potsWithBalances(ctx context.Context, tracer trace.Tracer, pots []repo.Pot) ([]*pb.Pot, *big.Int, error) {
+	ctx, balancesSpan := tracer.Start(ctx, lib.EVENT_POT_BALANCES)
+	defer balancesSpan.End()
+
+	balancesSpan.SetAttributes(
+		attribute.Int(lib.ATTR_POT_COUNT, len(pots)),
+	)
+
+	total := big.NewInt(0)
+	pbPots := make([]*pb.Pot, len(pots))
+	if len(pots) == 0 {
+		return pbPots, total, nil
+	}
+
+	potIds := make([]string, len(pots))
+	for i, pot := range pots {
+		potIds[i] = pot.PotId
+	}
+
+	accounts, err := s.tigerbeetleService.LookupAccounts(ctx, &tbPb.AccountIds{AccountIds: potIds})
+	if err != nil {
+		balancesSpan.RecordError(err)
+		return nil, nil, lib.ErrUnexpected
+	}
+
+	accountsById := make(map[string]*tbPb.Account, len(accounts.Accounts))
+	for _, account := range accounts.Accounts {
+		accountsById[account.AccountId] = account
+	}
+
+	for i, pot := range pots {
+		account, ok := accountsById[pot.PotId]
+		if !ok {
+			balancesSpan.AddEvent(lib.EVENT_POT_NOT_FOUND)
+			return nil, nil, lib.ErrUnexpected
+		}
+
+		balance, err := repo.PotBalance(account)
+		if err != nil {
+			balancesSpan.RecordError(err)
+			return nil, nil, err
+		}
+
+		total.Add(total, balance)
+		pbPots[i] = repo.DbPotToPbPot(pot, balance)
+	}
+	balancesSpan.End()
+
+	return pbPots, total, nil
+}
+
+func (s *UserServiceServer) potWithBalance(ctx context.Context, tracer trace.Tracer, pot repo.Pot) (*pb.Pot, error) {
+	pbPots, _, err := s.potsWithBalances(ctx, tracer, []repo.Pot{pot})
+	if err != nil {
+		return nil, err
+	}
+	return pbPots[0], nil
+}
+
+func (s *UserServiceServer) getOpenPot(ctx context.Context, tracer trace.Tracer, potId, userId string) (repo.Pot, error) {
+	ctx, dbGetPotSpan := tracer.Start(ctx, lib.EVENT_DB_GET_POT)
+	defer dbGetPotSpan.End()
+
+	dbGetPotSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetPot),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{potId, userId}),
+	)
+
+	pot := repo.Pot{}
+	err := s.db.GetContext(ctx, &pot, queries.QueryGetPot, potId, userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			dbGetPotSpan.AddEvent(lib.EVENT_POT_NOT_FOUND)
+			return pot, lib.ErrNotFound
+		}
+		dbGetPotSpan.RecordError(err)
+		return pot, lib.ErrUnexpected
+	}
+	if pot.Status != lib.POT_STATUS_OPEN {
+		dbGetPotSpan.AddEvent(lib.EVENT_POT_NOT_FOUND)
+		return pot, lib.ErrNotFound
+	}
+
+	return pot, nil
+}
+
+func (s *UserServiceServer) transferInternal(ctx context.Context, tracer trace.Tracer, debitAccountId, creditAccountId string, amount *big.Int) error {
+	ctx, transferSpan := tracer.Start(ctx, lib.EVENT_TB_CREATE_TRANSFER)
+	defer transferSpan.End()
+
+	transferSpan.SetAttributes(
+		attribute.String(lib.ATTR_POT_AMOUNT, amount.Text(16)),
+	)
+
+	_, err := s.tigerbeetleService.CreateTransfer(ctx, &tbPb.CreateTransferRequest{
+		DebitAccountId:  debitAccountId,
+		CreditAccountId: creditAccountId,
+		Amount:          tbt.BigIntToUint128(*amount).String(),
+	})
+	if err != nil {
+		if status.Convert(err).Message() == lib.ErrNotEnoughFunds.Error() {
+			transferSpan.AddEvent(lib.EVENT_NOT_ENOUGH_FUNDS)
+			return lib.ErrNotEnoughFunds
+		}
+		transferSpan.RecordError(err)
+		return lib.ErrUnexpected
+	}
+
+	return nil
+}
+
+func (s *UserServiceServer) CreatePot(ctx context.Context, req *pb.CreatePotRequest) (*pb.Pot, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	ctx, validateSpan := tracer.Start(ctx, lib.EVENT_POT_VALIDATE)
+	defer validateSpan.End()
+
+	name, err := lib.NormalizePotName(req.Name)
+	if err != nil {
+		validateSpan.RecordError(err)
+		return nil, err
+	}
+	targetAmount, targetDate, err := lib.ParsePotTarget(req.TargetAmount, req.TargetDate, time.Now())
+	if err != nil {
+		validateSpan.RecordError(err)
+		return nil, err
+	}
+
+	var openPots int
+	err = s.db.GetContext(ctx, &openPots, queries.QueryCountActivePots, req.UserId)
+	if err != nil {
+		validateSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	if openPots >= lib.MaxOpenPots {
+		validateSpan.AddEvent(lib.EVENT_POT_LIMIT)
+		return nil, lib.ErrPotLimitReached
+	}
+	validateSpan.End()
+
+	ctx, createTbAccountSpan := tracer.Start(ctx, lib.EVENT_TB_CREATE_ACCOUNT)
+	defer createTbAccountSpan.End()
+
+	tbAccount, err := s.tigerbeetleService.CreateAccount(ctx, &tbPb.Empty{})
+	if err != nil {
+		createTbAccountSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+
+	createTbAccountSpan.SetAttributes(
+		attribute.String(lib.ATTR_TB_ACCOUNT_ID, tbAccount.AccountId),
+	)
+	createTbAccountSpan.End()
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_POT_ID, tbAccount.AccountId),
+	)
+
+	ctx, dbCreatePotSpan := tracer.Start(ctx, lib.EVENT_DB_CREATE_POT)
+	defer dbCreatePotSpan.End()
+
+	dbCreatePotSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryCreatePot),
+	)
+
+	pot := repo.Pot{}
+	err = s.db.GetContext(ctx, &pot, queries.QueryCreatePot, tbAccount.AccountId, req.UserId, name, targetAmount, targetDate)
+	if err != nil {
+		dbCreatePotSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbCreatePotSpan.End()
+
+	return repo.DbPotToPbPot(pot, big.NewInt(0)), nil
+}
+
+func (s *UserServiceServer) ListPots(ctx context.Context, req *pb.ListPotsRequest) (*pb.ListPotsResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	ctx, dbGetPotsSpan := tracer.Start(ctx, lib.EVENT_DB_GET_POT)
+	defer dbGetPotsSpan.End()
+
+	dbGetPotsSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetActivePots),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	pots := []repo.Pot{}
+	err := s.db.SelectContext(ctx, &pots, queries.QueryGetActivePots, req.UserId)
+	if err != nil {
+		dbGetPotsSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbGetPotsSpan.End()
+
+	pbPots, _, err := s.potsWithBalances(ctx, tracer, pots)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ListPotsResponse{
+		Pots: pbPots,
+	}, nil
+}
+
+func (s *UserServiceServer) updatePot(ctx context.Context, tracer trace.Tracer, query string, args ...any) (*pb.Pot, error) {
+	ctx, dbUpdatePotSpan := tracer.Start(ctx, lib.EVENT_DB_UPDATE_POT)
+	defer dbUpdatePotSpan.End()
+
+	dbUpdatePotSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, query),
+	)
+
+	pot := repo.Pot{}
+	err := s.db.GetContext(ctx, &pot, query, args...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			dbUpdatePotSpan.AddEvent(lib.EVENT_POT_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		}
+		dbUpdatePotSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbUpdatePotSpan.End()
+
+	return s.potWithBalance(ctx, tracer, pot)
+}
+
+func (s *UserServiceServer) RenamePot(ctx context.Context, req *pb.RenamePotRequest) (*pb.Pot, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_POT_ID, req.PotId),
+	)
+
+	name, err := lib.NormalizePotName(req.Name)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return s.updatePot(ctx, tracer, queries.QueryRenamePot, req.PotId, req.UserId, name)
+}
+
+func (s *UserServiceServer) SetPotTarget(ctx context.Context, req *pb.SetPotTargetRequest) (*pb.Pot, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_POT_ID, req.PotId),
+	)
+
+	targetAmount, targetDate, err := lib.ParsePotTarget(req.TargetAmount, req.TargetDate, time.Now())
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return s.updatePot(ctx, tracer, queries.QuerySetPotTarget, req.PotId, req.UserId, targetAmount, targetDate)
+}
+
+// ClosePot sweeps whatever is left in the pot back to the main account and
+// closes the pot's TigerBeetle account in one step. The pot is marked as
+// closing first, together with the id of the sweep transfer, so a call that
+// stopped halfway is finished by calling ClosePot again.
+func (s *UserServiceServer) ClosePot(ctx context.Context, req *pb.PotRequest) (*pb.Pot, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_POT_ID, req.PotId),
+	)
+
+	ctx, dbClosingSpan := tracer.Start(ctx, lib.EVENT_DB_UPDATE_POT)
+	defer dbClosingSpan.End()
+
+	dbClosingSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryStartClosingPot),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.PotId, req.UserId}),
+	)
+
+	pot := repo.Pot{}
+	err := s.db.GetContext(ctx, &pot, queries.QueryStartClosingPot, req.PotId, req.UserId, tbt.ID().String())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			dbClosingSpan.AddEvent(lib.EVENT_POT_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		}
+		dbClosingSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbClosingSpan.End()
+
+	ctx, closeSpan := tracer.Start(ctx, lib.EVENT_TB_CLOSE_ACCOUNT)
+	defer closeSpan.End()
+
+	closeSpan.SetAttributes(
+		attribute.String(lib.ATTR_TB_ACCOUNT_ID, pot.PotId),
+	)
+
+	_, err = s.tigerbeetleService.SweepAndCloseAccount(ctx, &tbPb.SweepAndCloseAccountRequest{
+		AccountId:      pot.PotId,
+		SweepAccountId: pot.UserId,
+		TransferId:     *pot.CloseTransferId,
+	})
+	if err != nil {
+		closeSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	closeSpan.End()
+
+	return s.updatePot(ctx, tracer, queries.QueryClosePot, req.PotId, req.UserId)
+}
+
+func (s *UserServiceServer) movePotFunds(ctx context.Context, req *pb.MovePotFundsRequest, toPot bool) (*pb.Pot, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_POT_ID, req.PotId),
+	)
+
+	if req.Amount == 0 {
+		return nil, lib.ErrUnacceptableRequest
+	}
+
+	pot, err := s.getOpenPot(ctx, tracer, req.PotId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := new(big.Int).SetUint64(req.Amount)
+	if toPot {
+		err = s.transferInternal(ctx, tracer, req.PotId, req.UserId, amount)
+	} else {
+		err = s.transferInternal(ctx, tracer, req.UserId, req.PotId, amount)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.potWithBalance(ctx, tracer, pot)
+}
+
+func (s *UserServiceServer) MoveToPot(ctx context.Context, req *pb.MovePotFundsRequest) (*pb.Pot, error) {
+	return s.movePotFunds(ctx, req, true)
+}
+
+func (s *UserServiceServer) MoveFromPot(ctx context.Context, req *pb.MovePotFundsRequest) (*pb.Pot, error) {
+	return s.movePotFunds(ctx, req, false)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"user-service/src/lib"
+	"user-service/src/queries"
+	"user-service/src/repo"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "protobufs/gen/go/user-service"
+)
+
+func (s *UserServiceServer) UpdateProfile(ctx context.Context, req *pb.UpdateProfileRequest) (*pb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	ctx, validateSpan := tracer.Start(ctx, lib.EVENT_PROFILE_VALIDATE)
+	defer validateSpan.End()
+
+	requested := map[string]string{}
+	for _, field := range []struct {
+		name      string
+		value     *string
+		maxLength int
+	}{
+		{lib.PROFILE_FIELD_FIRST_NAME, req.FirstName, lib.NameMaxLength},
+		{lib.PROFILE_FIELD_LAST_NAME, req.LastName, lib.NameMaxLength},
+		{lib.PROFILE_FIELD_ADDRESS, req.Address, lib.AddressMaxLength},
+	} {
+		if field.value == nil {
+			continue
+		}
+		value, err := lib.NormalizeProfileText(*field.value, field.maxLength)
+		if err != nil {
+			validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+				attribute.String("field", field.name),
+			))
+			return nil, err
+		}
+		requested[field.name] = value
+	}
+	validateSpan.End()
+
+	ctx, dbGetUserSpan := tracer.Start(ctx, lib.EVENT_DB_GET_USER)
+	defer dbGetUserSpan.End()
+
+	dbGetUserSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetUserById),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	user := repo.User{}
+	err := s.db.GetContext(ctx, &user, queries.QueryGetUserById, req.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			dbGetUserSpan.AddEvent(lib.EVENT_USER_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		}
+		dbGetUserSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbGetUserSpan.End()
+
+	changes := []lib.ProfileChange{}
+	fields := []string{}
+	for _, current := range []struct {
+		name  string
+		value string
+	}{
+		{lib.PROFILE_FIELD_FIRST_NAME, user.FirstName},
+		{lib.PROFILE_FIELD_LAST_NAME, user.LastName},
+		{lib.PROFILE_FIELD_ADDRESS, user.Address},
+	} {
+		value, ok := requested[current.name]
+		if !ok || value == current.value {
+			continue
+		}
+		changes = append(changes, lib.ProfileChange{Field: current.name, OldValue: current.value, NewValue: value})
+		fields = append(fields, current.name)
+	}
+
+	if len(changes) > 0 {
+		ctx, dbUpdateSpan := tracer.Start(ctx, lib.EVENT_DB_UPDATE_PROFILE)
+		defer dbUpdateSpan.End()
+
+		dbUpdateSpan.SetAttributes(
+			attribute.String(lib.ATTR_DB_QUERY, queries.QueryUpdateProfile),
+			attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+			attribute.StringSlice(lib.ATTR_PROFILE_FIELDS, fields),
+		)
+
+		err = repo.UpdateProfile(ctx, s.db, user, changes)
+		if err != nil {
+			if err == lib.ErrConflict {
+				dbUpdateSpan.AddEvent(lib.EVENT_DB_NO_ROWS_AFFECTED)
+				return nil, err
+			}
+			dbUpdateSpan.RecordError(err)
+			return nil, err
+		}
+		dbUpdateSpan.End()
+	}
+
+	return s.GetUserById(ctx, &pb.GetUserByIdRequest{UserId: req.UserId})
+}
+
+func (s *UserServiceServer) GetProfileHistory(ctx context.Context, req *pb.GetProfileHistoryRequest) (*pb.GetProfileHistoryResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	limit := uint32(lib.ProfileHistoryPageSize)
+	if req.Limit != nil && *req.Limit > 0 && *req.Limit < limit {
+		limit = *req.Limit
+	}
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	ctx, dbGetHistorySpan := tracer.Start(ctx, lib.EVENT_DB_GET_PROFILE_HISTORY)
+	defer dbGetHistorySpan.End()
+
+	dbGetHistorySpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetProfileHistory),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	entries, err := repo.GetProfileHistory(ctx, s.db, req.UserId, limit)
+	if err != nil {
+		dbGetHistorySpan.RecordError(err)
+		return nil, err
+	}
+	dbGetHistorySpan.End()
+
+	changes := make([]*pb.ProfileChange, len(entries))
+	for i, entry := range entries {
+		changes[i] = repo.DbProfileHistoryEntryToPbProfileChange(entry)
+	}
+
+	return &pb.GetProfileHistoryResponse{Changes: changes}, nil
+}
+
+// StartPhoneNumberChange sends one code to the current number and one to the
+// new number. Both have to be confirmed, so neither a stolen session nor a
+// lost phone is enough to move the account.
+func (s *UserServiceServer) StartPhoneNumberChange(ctx context.Context, req *pb.StartPhoneNumberChangeRequest) (*pb.PhoneNumberChange, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	newPhoneNumber, err := lib.NormalizePhoneNumber(req.NewPhoneNumber)
+	if err != nil {
+		span.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "newPhoneNumber"),
+		))
+		return nil, err
+	}
+
+	lockoutKeys := []string{lib.PhoneNumberChangeUserLimit.Key(req.UserId)}
+	if err := s.checkAuthLockout(ctx, tracer, lockoutKeys); err != nil {
+		return nil, err
+	}
+	if err := s.recordAuthAttempt(ctx, tracer, lib.PhoneNumberChangeUserLimit, req.UserId); err != nil {
+		return nil, err
+	}
+
+	ctx, dbGetUserSpan := tracer.Start(ctx, lib.EVENT_DB_GET_USER)
+	defer dbGetUserSpan.End()
+
+	dbGetUserSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetUserById),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	user := repo.User{}
+	err = s.db.GetContext(ctx, &user, queries.QueryGetUserById, req.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			dbGetUserSpan.AddEvent(lib.EVENT_USER_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		}
+		dbGetUserSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	if user.PhoneNumber == newPhoneNumber {
+		dbGetUserSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "newPhoneNumber"),
+		))
+		return nil, lib.ErrUnacceptableRequest
+	}
+
+	existing := repo.User{}
+	err = s.db.GetContext(ctx, &existing, queries.QueryGetUserByPhoneNumber, newPhoneNumber)
+	if err == nil {
+		dbGetUserSpan.AddEvent(lib.EVENT_DB_UNIQUE_CONSTRAINT_VIOLATION)
+		return nil, lib.ErrConflict
+	}
+	if err != sql.ErrNoRows {
+		dbGetUserSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbGetUserSpan.End()
+
+	ctx, createSpan := tracer.Start(ctx, lib.EVENT_PHONE_NUMBER_CHANGE_CREATE)
+	defer createSpan.End()
+
+	codes := make([]string, 2)
+	codeHashes := make([]string, 2)
+	for i := range codes {
+		codes[i], err = lib.GenerateOTPCode()
+		if err != nil {
+			createSpan.RecordError(err)
+			return nil, lib.ErrUnexpected
+		}
+		codeHashes[i], err = lib.GenerateHash(codes[i])
+		if err != nil {
+			createSpan.RecordError(err)
+			return nil, lib.ErrUnexpected
+		}
+	}
+
+	changeId := uuid.NewString()
+
+	createSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryInsertPhoneNumberChange),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{changeId, req.UserId, lib.RedactPhoneNumber(newPhoneNumber)}),
+		attribute.String(lib.ATTR_PHONE_NUMBER_CHANGE_ID, changeId),
+	)
+
+	expires, err := repo.CreatePhoneNumberChange(ctx, s.db, repo.PhoneNumberChange{
+		ChangeId:       changeId,
+		UserId:         req.UserId,
+		NewPhoneNumber: newPhoneNumber,
+		OldCodeHash:    codeHashes[0],
+		NewCodeHash:    codeHashes[1],
+	})
+	if err != nil {
+		createSpan.RecordError(err)
+		return nil, err
+	}
+	createSpan.End()
+
+	ctx, sendSpan := tracer.Start(ctx, lib.EVENT_PHONE_NUMBER_CHANGE_SEND)
+	defer sendSpan.End()
+
+	sendSpan.SetAttributes(
+		attribute.StringSlice(lib.ATTR_PHONE_NUMBER, []string{
+			lib.RedactPhoneNumber(user.PhoneNumber),
+			lib.RedactPhoneNumber(newPhoneNumber),
+		}),
+	)
+
+	err = s.otpSender.SendOTP(ctx, user.PhoneNumber, lib.PhoneNumberChangeMessage(codes[0]))
+	if err != nil {
+		sendSpan.RecordError(err)
+		return nil, lib.ErrOTPDeliveryFailed
+	}
+	err = s.otpSender.SendOTP(ctx, newPhoneNumber, lib.NewPhoneNumberMessage(codes[1]))
+	if err != nil {
+		sendSpan.RecordError(err)
+		return nil, lib.ErrOTPDeliveryFailed
+	}
+	sendSpan.End()
+
+	return &pb.PhoneNumberChange{
+		ChangeId: changeId,
+		Expires:  expires.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// ConfirmPhoneNumberChange moves the account to the new number once both
+// codes match, and ends every other session of the user.
+func (s *UserServiceServer) ConfirmPhoneNumberChange(ctx context.Context, req *pb.ConfirmPhoneNumberChangeRequest) (*pb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_PHONE_NUMBER_CHANGE_ID, req.ChangeId),
+	)
+
+	ctx, getSpan := tracer.Start(ctx, lib.EVENT_PHONE_NUMBER_CHANGE_GET)
+	defer getSpan.End()
+
+	getSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetPhoneNumberChange),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.ChangeId, req.UserId}),
+	)
+
+	change, err := repo.GetPhoneNumberChange(ctx, s.db, req.ChangeId, req.UserId)
+	if err != nil {
+		if err == lib.ErrNotFound {
+			getSpan.AddEvent(lib.EVENT_PHONE_NUMBER_CHANGE_NOT_FOUND)
+			return nil, err
+		}
+		getSpan.RecordError(err)
+		return nil, err
+	}
+	getSpan.End()
+
+	ctx, completeSpan := tracer.Start(ctx, lib.EVENT_PHONE_NUMBER_CHANGE_COMPLETE)
+	defer completeSpan.End()
+
+	// Both codes are always checked so a failure does not reveal which one
+	// was wrong.
+	oldMatches, err := lib.VerifyHash(change.OldCodeHash, req.OldCode)
+	if err != nil {
+		completeSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	newMatches, err := lib.VerifyHash(change.NewCodeHash, req.NewCode)
+	if err != nil {
+		completeSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	if !oldMatches || !newMatches {
+		completeSpan.AddEvent(lib.EVENT_PHONE_NUMBER_CHANGE_MISMATCH)
+		if err := repo.RecordPhoneNumberChangeFailure(ctx, s.db, change.ChangeId); err != nil {
+			completeSpan.RecordError(err)
+			return nil, err
+		}
+		return nil, lib.ErrPhoneNumberChangeMismatch
+	}
+
+	completeSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryCompletePhoneNumberChange),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{change.ChangeId}),
+	)
+
+	err = repo.CompletePhoneNumberChange(ctx, s.db, change.ChangeId)
+	if err != nil {
+		switch err {
+		case lib.ErrConflict:
+			completeSpan.AddEvent(lib.EVENT_DB_UNIQUE_CONSTRAINT_VIOLATION)
+		case lib.ErrNotFound:
+			completeSpan.AddEvent(lib.EVENT_PHONE_NUMBER_CHANGE_NOT_FOUND)
+		default:
+			completeSpan.RecordError(err)
+		}
+		return nil, err
+	}
+	completeSpan.End()
+
+	ctx, invalidateSpan := tracer.Start(ctx, lib.EVENT_SESSIONS_INVALIDATE)
+	defer invalidateSpan.End()
+
+	invalidateSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryInvalidateAllSessions),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId, lib.StringOrEmpty(req.KeepSessionId)}),
+	)
+
+	sessionIds := []string{}
+	err = s.db.SelectContext(ctx, &sessionIds, queries.QueryInvalidateAllSessions, req.UserId, req.KeepSessionId)
+	if err != nil {
+		invalidateSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	for _, sessionId := range sessionIds {
+		s.sessionRevocations.Revoke(sessionId)
+	}
+
+	invalidateSpan.SetAttributes(
+		attribute.Int(lib.ATTR_DB_ROWS_AFFECTED, len(sessionIds)),
+	)
+
+	err = repo.RecordSecurityEvent(ctx, s.db, req.UserId, req.KeepSessionId, lib.SECURITY_EVENT_PHONE_NUMBER_CHANGED,
+		lib.RedactPhoneNumber(change.NewPhoneNumber))
+	if err != nil {
+		invalidateSpan.RecordError(err)
+		return nil, err
+	}
+	invalidateSpan.End()
+
+	return s.GetUserById(ctx, &pb.GetUserByIdRequest{UserId: req.UserId})
+}
@@ -0,0 +1,35 @@
+package queries
+
+var (
+	QueryRecordAuthAttempt = `
+		insert into banking.auth_attempts (attempt_key, attempts, window_started_at)
+		values ($1, 1, now())
+		on conflict (attempt_key) do update
+		set attempts = case
+				when auth_attempts.window_started_at > now() - ($2)::interval then auth_attempts.attempts + 1
+				else 1
+			end,
+			window_started_at = case
+				when auth_attempts.window_started_at > now() - ($2)::interval then auth_attempts.window_started_at
+				else now()
+			end
+		returning attempts
+	`
+
+	QueryLockAuthAttempt = `
+		update banking.auth_attempts
+		set locked_until = now() + ($2)::interval, attempts = 0, window_started_at = now()
+		where attempt_key = $1
+		returning locked_until
+	`
+
+	QueryGetAuthLockout = `
+		select max(locked_until) from banking.auth_attempts
+		where attempt_key = any($1) and locked_until > now()
+	`
+
+	QueryClearAuthAttempts = `
+		delete from banking.auth_attempts
+		where attempt_key = $1
+	`
+)
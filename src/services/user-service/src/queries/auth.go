@@ -1,50 +1,115 @@
 package queries
 
 var (
+	QueryGetOtpThrottle = `
+		select users.user_id, otp.last_requested_at, coalesce(otp.request_count, 0) as request_count
+		from banking.users
+		left join banking.one_time_passcodes otp on otp.user_id = users.user_id
+		where users.phone_number = $1
+	`
+
+	// The update only applies when nobody else issued a code since the
+	// throttle state was read.
 	QueryInsertOtp = `
-		insert into banking.one_time_passcodes (user_id, one_time_passcode_hash)
-		select users.user_id, $2
+		insert into banking.one_time_passcodes
+		(user_id, one_time_passcode_hash, expires, failed_attempts, request_count, last_requested_at)
+		select users.user_id, $2, now() + ($3)::interval, 0, $4, now()
 		from banking.users
 		where users.phone_number = $1
 		on conflict (user_id) do update
-				set one_time_passcode_hash = $2, expires = now() + ($3)::interval
+				set one_time_passcode_hash = $2, expires = now() + ($3)::interval, failed_attempts = 0,
+						request_count = $4, last_requested_at = now()
+				where one_time_passcodes.last_requested_at is not distinct from $5
 		`
 
 	QueryGetOtp = `
+		select otp.one_time_passcode_hash, otp.user_id, otp.failed_attempts
+		from banking.one_time_passcodes otp
+		join banking.users on users.user_id = otp.user_id
+		where users.phone_number = $1
+				and otp.expires > now()
+				and otp.failed_attempts < $2
+	`
+
+	QueryRecordOtpFailure = `
+		update banking.one_time_passcodes
+		set failed_attempts = failed_attempts + 1,
+				expires = case when failed_attempts + 1 >= $2 then now() else expires end
+		where user_id = $1 and expires > now()
+		returning failed_attempts, last_requested_at, request_count
+	`
+
+	QueryConsumeOtp = `
 		with otp_expiry_update as (
 				update banking.one_time_passcodes
-						set expires = now()
-						from banking.users
-						where
-								users.phone_number = $1
-										and users.user_id = one_time_passcodes.user_id
-										and one_time_passcodes.expires > now()
-						returning one_time_passcode_hash, users.user_id as user_id),
-				last_phone_verification_update AS (
-						update banking.users
-								set last_phone_verification = now()
-								where phone_number = $1
-										and user_id in (select user_id from otp_expiry_update)
-								returning user_id)
-		select *
-		from otp_expiry_update
+						set expires = now(), request_count = 0
+						where user_id = $1
+								and expires > now()
+								and failed_attempts < $2
+						returning user_id)
+		update banking.users
+				set last_phone_verification = now()
+				where user_id in (select user_id from otp_expiry_update)
 	`
 
 	QueryInsertSession = `
-		insert into banking.sessions (session_id, user_id, expires, device, application, ip_address)
-		values ($1, $2, $3, $4, $5, $6)
+		insert into banking.sessions (session_id, user_id, expires, device, application, ip_address, location, last_seen_at)
+		values ($1, $2, $3, $4, $5, $6, $7, now())
 	`
 
-	QueryRefreshSession = `
+	QueryRotateSession = `
 		update banking.sessions
-		set expires = $1
-		where session_id = $2 AND expires > now()
+		set expires = $1, refresh_generation = refresh_generation + 1, last_seen_at = now()
+		where session_id = $2 and refresh_generation = $3 and expires > now()
+		returning refresh_generation, mfa_at
+	`
+
+	QueryGetSessionGeneration = `
+		select refresh_generation, expires > now() as active
+		from banking.sessions
+		where session_id = $1
+	`
+
+	// Sessions ended within the last access token lifetime. Older ones can no
+	// longer have a valid access token.
+	QueryGetRevokedSessions = `
+		select session_id, expires
+		from banking.sessions
+		where expires <= now() and expires > now() - ($1)::interval
+	`
+
+	QueryStampSessionMfa = `
+		update banking.sessions
+		set mfa_at = now()
+		where session_id = $1 and user_id = $2 and expires > now()
+		returning mfa_at
+	`
+
+	QueryGetSessionMfa = `
+		select mfa_at
+		from banking.sessions
+		where session_id = $1 and user_id = $2 and expires > now()
 	`
 
 	QueryGetActiveSessions = `
-		select session_id, expires, created_at, device, application, ip_address
+		select session_id, expires, created_at, device, application, ip_address, name, last_seen_at, location
 		from banking.sessions
 		where user_id = $1 and expires > now()
+		order by last_seen_at desc
+	`
+
+	QueryRenameSession = `
+		update banking.sessions
+		set name = $3
+		where session_id = $1 and user_id = $2 and expires > now()
+		returning session_id, expires, created_at, device, application, ip_address, name, last_seen_at, location
+	`
+
+	QueryInvalidateAllSessions = `
+		update banking.sessions
+		set expires = now()
+		where user_id = $1 and expires > now() and ($2::string is null or session_id::string != $2)
+		returning session_id
 	`
 
 	QueryInvalidateSession = `
@@ -52,4 +117,18 @@ var (
 		set expires = now()
 		where session_id = $1 and user_id = $2
 	`
+
+	QueryGetLatestSession = `
+		select session_id, created_at, device, application, ip_address,
+			exists(
+				select 1 from banking.sessions previous
+				where previous.user_id = latest.user_id
+					and previous.device = latest.device
+					and previous.created_at < latest.created_at
+			) as known_device
+		from banking.sessions latest
+		where user_id = $1
+		order by created_at desc
+		limit 1
+	`
 )
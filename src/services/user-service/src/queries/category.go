@@ -0,0 +1,37 @@
+package queries
+
+var (
+	QueryMapTransferCategories = `
+		select transfer_id, category from banking.transfer_categories
+		where user_id = $1 and transfer_id = any($2)
+	`
+
+	QueryMapCounterpartyCategories = `
+		select counterparty_id, category from banking.counterparty_categories
+		where user_id = $1
+	`
+
+	QuerySetTransferCategory = `
+		insert into banking.transfer_categories (user_id, transfer_id, category)
+		values ($1, $2, $3)
+		on conflict (user_id, transfer_id) do update
+		set category = excluded.category, updated_at = now()
+	`
+
+	QueryDeleteTransferCategory = `
+		delete from banking.transfer_categories
+		where user_id = $1 and transfer_id = $2
+	`
+
+	QuerySetCounterpartyCategory = `
+		insert into banking.counterparty_categories (user_id, counterparty_id, category)
+		values ($1, $2, $3)
+		on conflict (user_id, counterparty_id) do update
+		set category = excluded.category, updated_at = now()
+	`
+
+	QueryDeleteCounterpartyCategory = `
+		delete from banking.counterparty_categories
+		where user_id = $1 and counterparty_id = $2
+	`
+)
@@ -0,0 +1,63 @@
+package queries
+
+var (
+	// Favoriting a blocked contact leaves the row alone, so nothing is
+	// returned.
+	QuerySetContactFavorite = `
+		with upserted as (
+				insert into banking.contacts (user_id, contact_user_id, favorite)
+						values ($1, $2, $3)
+						on conflict (user_id, contact_user_id) do update
+								set favorite = excluded.favorite, updated_at = now()
+								where not contacts.blocked or not excluded.favorite
+						returning contact_user_id, nickname, favorite, blocked, created_at)
+		select upserted.contact_user_id, users.phone_number, users.first_name, users.last_name,
+				upserted.nickname, upserted.favorite, upserted.blocked, upserted.created_at
+		from upserted
+		join banking.users on users.user_id = upserted.contact_user_id
+	`
+
+	QuerySetContactNickname = `
+		with upserted as (
+				insert into banking.contacts (user_id, contact_user_id, nickname)
+						values ($1, $2, $3)
+						on conflict (user_id, contact_user_id) do update
+								set nickname = excluded.nickname, updated_at = now()
+						returning contact_user_id, nickname, favorite, blocked, created_at)
+		select upserted.contact_user_id, users.phone_number, users.first_name, users.last_name,
+				upserted.nickname, upserted.favorite, upserted.blocked, upserted.created_at
+		from upserted
+		join banking.users on users.user_id = upserted.contact_user_id
+	`
+
+	// Blocking a contact also removes it from the favorites.
+	QuerySetContactBlocked = `
+		with upserted as (
+				insert into banking.contacts (user_id, contact_user_id, blocked)
+						values ($1, $2, $3)
+						on conflict (user_id, contact_user_id) do update
+								set blocked = excluded.blocked,
+										favorite = contacts.favorite and not excluded.blocked,
+										updated_at = now()
+						returning contact_user_id, nickname, favorite, blocked, created_at)
+		select upserted.contact_user_id, users.phone_number, users.first_name, users.last_name,
+				upserted.nickname, upserted.favorite, upserted.blocked, upserted.created_at
+		from upserted
+		join banking.users on users.user_id = upserted.contact_user_id
+	`
+
+	QueryGetContacts = `
+		select contacts.contact_user_id, users.phone_number, users.first_name, users.last_name,
+				contacts.nickname, contacts.favorite, contacts.blocked, contacts.created_at
+		from banking.contacts
+		join banking.users on users.user_id = contacts.contact_user_id
+		where contacts.user_id = $1 and users.deleted_at is null
+				and (contacts.favorite or contacts.blocked or contacts.nickname is not null)
+		order by contacts.favorite desc, lower(coalesce(contacts.nickname, users.first_name)) asc
+	`
+
+	QueryGetContactBlocked = `
+		select blocked from banking.contacts
+		where user_id = $1 and contact_user_id = $2
+	`
+)
@@ -0,0 +1,89 @@
+package queries
+
+var (
+	QueryExportSessions = `
+		select session_id, created_at, expires, device, application, ip_address, name, last_seen_at, location
+		from banking.sessions
+		where user_id = $1
+		order by created_at asc
+	`
+
+	QueryExportSecurityEvents = `
+		select event_id, session_id, kind, details, created_at
+		from banking.security_events
+		where user_id = $1
+		order by created_at asc
+	`
+
+	QueryExportProfileHistory = `
+		select change_id, field, old_value, new_value, changed_at
+		from banking.profile_history
+		where user_id = $1
+		order by changed_at asc
+	`
+
+	QueryExportPayments = `
+		select tigerbeetle_transfer_id, from_user_id, to_user_id, amount, memo, reference, created_at
+		from banking.transfers
+		where from_user_id = $1 or to_user_id = $1
+		order by created_at asc
+	`
+
+	QueryExportDeposits = `
+		select tigerbeetle_transfer_id, stripe_payment_intent_id, payment_status, posted_at, voided_at
+		from banking.deposits
+		where user_id = $1
+		order by tigerbeetle_transfer_id asc
+	`
+
+	QueryExportPayouts = `
+		select tigerbeetle_transfer_id, stripe_payout_id, payment_status, posted_at, voided_at
+		from banking.payouts
+		where user_id = $1
+		order by tigerbeetle_transfer_id asc
+	`
+
+	QueryExportPots = `
+		select pot_id, user_id, name, target_amount, target_date, status, created_at, closed_at
+		from banking.pots
+		where user_id = $1
+		order by created_at asc
+	`
+
+	QueryExportKycSubmissions = `
+		select submission_id, document_type, issuing_country, document_expires, status, reason, decided_at, created_at
+		from banking.kyc_submissions
+		where user_id = $1
+		order by created_at asc
+	`
+
+	QueryExportContacts = `
+		select contacts.contact_user_id, users.first_name, users.last_name, contacts.nickname,
+				contacts.favorite, contacts.blocked, contacts.created_at
+		from banking.contacts
+		join banking.users on users.user_id = contacts.contact_user_id
+		where contacts.user_id = $1
+		order by contacts.created_at asc
+	`
+
+	QueryExportTransferCategories = `
+		select transfer_id, category, updated_at
+		from banking.transfer_categories
+		where user_id = $1
+		order by updated_at asc
+	`
+
+	QueryExportCounterpartyCategories = `
+		select counterparty_id, category, updated_at
+		from banking.counterparty_categories
+		where user_id = $1
+		order by updated_at asc
+	`
+
+	QueryExportStatements = `
+		select statement_id, user_id, month, opening_balance, closing_balance, transfer_count, pdf_checksum, csv_checksum, ledger_checksum, created_at
+		from banking.statements
+		where user_id = $1
+		order by month asc
+	`
+)
@@ -0,0 +1,44 @@
+package queries
+
+var (
+	QueryGetKycVerification = `
+		select user_id, status, submission_id, reason, verified_at, expires, updated_at
+		from banking.kyc_verifications
+		where user_id = $1
+	`
+
+	// The verification only moves to pending while it still has the status
+	// the transition was checked against. Users without a row are unverified.
+	QuerySubmitKyc = `
+		with transitioned as (
+				insert into banking.kyc_verifications (user_id, status, submission_id, updated_at)
+						values ($1, 'pending', $2, now())
+						on conflict (user_id) do update
+								set status = excluded.status, submission_id = excluded.submission_id,
+										reason = null, verified_at = null, expires = null, updated_at = now()
+								where kyc_verifications.status = $3
+						returning user_id)
+		insert into banking.kyc_submissions (submission_id, user_id, document_type, issuing_country, document_number_ciphertext,
+				document_expires, document_ciphertext, document_content_type)
+		select $2, transitioned.user_id, $4, $5, $6, $7, $8, $9
+		from transitioned
+	`
+
+	QueryGetKycSubmission = `
+		select submission_id, user_id, document_type, issuing_country, document_expires, status
+		from banking.kyc_submissions
+		where submission_id = $1
+	`
+
+	QueryDecideKyc = `
+		with decided as (
+				update banking.kyc_verifications
+						set status = $2, reason = $3, verified_at = $4, expires = $5, updated_at = now()
+						where submission_id = $1 and status = 'pending'
+						returning submission_id)
+		update banking.kyc_submissions
+		set status = $2, reason = $3, decided_by = $6, decided_at = now()
+		from decided
+		where kyc_submissions.submission_id = decided.submission_id
+	`
+)
@@ -0,0 +1,55 @@
+package queries
+
+var (
+	QueryGetTotpFactor = `
+		select user_id, secret_ciphertext, confirmed_at, last_used_step
+		from banking.totp_factors
+		where user_id = $1
+	`
+
+	// A confirmed factor is never replaced, it has to be disabled first.
+	QueryUpsertPendingTotpFactor = `
+		insert into banking.totp_factors (user_id, secret_ciphertext, last_used_step)
+		values ($1, $2, 0)
+		on conflict (user_id) do update
+				set secret_ciphertext = $2, last_used_step = 0, created_at = now()
+				where totp_factors.confirmed_at is null
+	`
+
+	QueryConfirmTotpFactor = `
+		update banking.totp_factors
+		set confirmed_at = now(), last_used_step = $2
+		where user_id = $1 and confirmed_at is null and last_used_step < $2
+	`
+
+	QueryUseTotpStep = `
+		update banking.totp_factors
+		set last_used_step = $2
+		where user_id = $1 and confirmed_at is not null and last_used_step < $2
+	`
+
+	QueryDeleteTotpFactor = `
+		with deleted_codes as (
+				delete from banking.recovery_codes where user_id = $1 returning user_id)
+		delete from banking.totp_factors where user_id = $1
+	`
+
+	QueryReplaceRecoveryCodes = `
+		with deleted_codes as (
+				delete from banking.recovery_codes where user_id = $1 returning user_id)
+		insert into banking.recovery_codes (user_id, code_hash)
+		select $1, unnest($2::string[])
+	`
+
+	QueryGetUnusedRecoveryCodes = `
+		select recovery_code_id, code_hash
+		from banking.recovery_codes
+		where user_id = $1 and used_at is null
+	`
+
+	QueryUseRecoveryCode = `
+		update banking.recovery_codes
+		set used_at = now()
+		where recovery_code_id = $1 and used_at is null
+	`
+)
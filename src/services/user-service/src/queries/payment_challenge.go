@@ -0,0 +1,49 @@
+package queries
+
+var (
+	QueryInsertPaymentChallenge = `
+		insert into banking.payment_challenges (challenge_id, user_id, to_user_id, bulk_batch_id, amount, code_hash, expires)
+		values ($1, $2, $3, $4, $5, $6, now() + ($7)::interval)
+		returning expires
+	`
+
+	QueryGetPaymentChallenge = `
+		select challenge_id, user_id, to_user_id, bulk_batch_id, amount, code_hash, failed_attempts, expires, confirmed_at
+		from banking.payment_challenges
+		where challenge_id = $1 and user_id = $2 and expires > now() and failed_attempts < $3
+	`
+
+	QueryRecordPaymentChallengeFailure = `
+		update banking.payment_challenges
+		set failed_attempts = failed_attempts + 1,
+				expires = case when failed_attempts + 1 >= $2 then now() else expires end
+		where challenge_id = $1 and expires > now()
+	`
+
+	QueryConfirmPaymentChallenge = `
+		update banking.payment_challenges
+		set confirmed_at = now()
+		where challenge_id = $1 and confirmed_at is null and expires > now() and failed_attempts < $2
+	`
+
+	// The confirmation can only be redeemed once, for exactly the payment it
+	// was issued for. A challenge has either a recipient or a bulk batch, and
+	// the other one is null.
+	QueryRedeemPaymentChallenge = `
+		update banking.payment_challenges
+		set redeemed_at = now()
+		where challenge_id = $1 and user_id = $2
+				and coalesce(to_user_id, '') = $3 and coalesce(bulk_batch_id, '') = $4 and amount = $5
+				and confirmed_at > now() - ($6)::interval
+				and redeemed_at is null
+	`
+
+	// Undoes a redemption for a payment that failed before any money moved.
+	QueryReleasePaymentChallenge = `
+		update banking.payment_challenges
+		set redeemed_at = null
+		where challenge_id = $1 and user_id = $2
+				and coalesce(to_user_id, '') = $3 and coalesce(bulk_batch_id, '') = $4 and amount = $5
+				and redeemed_at is not null
+	`
+)
@@ -0,0 +1,56 @@
+package queries
+
+var (
+	QueryCreatePot = `
+		insert into banking.pots (pot_id, user_id, name, target_amount, target_date, status)
+		values ($1, $2, $3, $4, $5, 'open')
+		returning pot_id, user_id, name, target_amount, target_date, status, created_at, closed_at
+	`
+
+	QueryCountActivePots = `
+		select count(*) from banking.pots
+		where user_id = $1 and status in ('open', 'closing')
+	`
+
+	QueryGetPot = `
+		select pot_id, user_id, name, target_amount, target_date, status, created_at, closed_at
+		from banking.pots
+		where pot_id = $1 and user_id = $2
+	`
+
+	QueryGetActivePots = `
+		select pot_id, user_id, name, target_amount, target_date, status, created_at, closed_at
+		from banking.pots
+		where user_id = $1 and status in ('open', 'closing')
+		order by created_at asc
+	`
+
+	QueryRenamePot = `
+		update banking.pots set name = $3
+		where pot_id = $1 and user_id = $2 and status = 'open'
+		returning pot_id, user_id, name, target_amount, target_date, status, created_at, closed_at
+	`
+
+	QuerySetPotTarget = `
+		update banking.pots set target_amount = $3, target_date = $4
+		where pot_id = $1 and user_id = $2 and status = 'open'
+		returning pot_id, user_id, name, target_amount, target_date, status, created_at, closed_at
+	`
+
+	QueryStartClosingPot = `
+		update banking.pots set status = 'closing', close_transfer_id = coalesce(close_transfer_id, $3)
+		where pot_id = $1 and user_id = $2 and status in ('open', 'closing')
+		returning pot_id, user_id, name, target_amount, target_date, status, created_at, closed_at, close_transfer_id
+	`
+
+	QueryClosePot = `
+		update banking.pots set status = 'closed', closed_at = now()
+		where pot_id = $1 and user_id = $2 and status = 'closing'
+		returning pot_id, user_id, name, target_amount, target_date, status, created_at, closed_at
+	`
+
+	QueryMapPotIdsToNames = `
+		select pot_id, name from banking.pots
+		where pot_id = any($1)
+	`
+)
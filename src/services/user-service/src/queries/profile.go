@@ -0,0 +1,67 @@
+package queries
+
+var (
+	// The update only applies while the profile still holds the values the
+	// changes were computed from, and records the changes along with it.
+	QueryUpdateProfile = `
+		with updated as (
+				update banking.users
+						set first_name = $2, last_name = $3, address = $4
+						where user_id = $1 and first_name = $5 and last_name = $6 and address = $7
+						returning user_id)
+		insert into banking.profile_history (user_id, field, old_value, new_value)
+		select updated.user_id, change.field, change.old_value, change.new_value
+		from updated, unnest($8::string[], $9::string[], $10::string[]) as change(field, old_value, new_value)
+	`
+
+	QueryGetProfileHistory = `
+		select change_id, field, old_value, new_value, changed_at
+		from banking.profile_history
+		where user_id = $1
+		order by changed_at desc
+		limit $2
+	`
+
+	QueryInsertPhoneNumberChange = `
+		insert into banking.phone_number_changes (change_id, user_id, new_phone_number, old_code_hash, new_code_hash, expires)
+		values ($1, $2, $3, $4, $5, now() + ($6)::interval)
+		returning expires
+	`
+
+	QueryGetPhoneNumberChange = `
+		select change_id, user_id, new_phone_number, old_code_hash, new_code_hash, failed_attempts
+		from banking.phone_number_changes
+		where change_id = $1 and user_id = $2
+				and expires > now() and failed_attempts < $3 and completed_at is null
+	`
+
+	QueryRecordPhoneNumberChangeFailure = `
+		update banking.phone_number_changes
+		set failed_attempts = failed_attempts + 1,
+				expires = case when failed_attempts + 1 >= $2 then now() else expires end
+		where change_id = $1 and expires > now()
+	`
+
+	QueryCompletePhoneNumberChange = `
+		with completed as (
+				update banking.phone_number_changes
+						set completed_at = now()
+						where change_id = $1 and completed_at is null and expires > now()
+						returning user_id, new_phone_number),
+			old as (
+				select users.user_id, users.phone_number
+				from banking.users
+				join completed on completed.user_id = users.user_id),
+			updated as (
+				update banking.users
+						set phone_number = completed.new_phone_number, last_phone_verification = now()
+						from completed
+						where users.user_id = completed.user_id
+						returning users.user_id)
+		insert into banking.profile_history (user_id, field, old_value, new_value)
+		select old.user_id, 'phone_number', old.phone_number, completed.new_phone_number
+		from old
+		join completed on completed.user_id = old.user_id
+		join updated on updated.user_id = old.user_id
+	`
+)
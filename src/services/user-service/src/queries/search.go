@@ -0,0 +1,45 @@
+package queries
+
+var (
+	// Users who opted out of discovery, deleted users and users who blocked
+	// the caller are never returned. The % operator matches names by trigram
+	// similarity, so typos and partial names still find the user.
+	QuerySearchUsersByName = `
+		with candidates as (
+				select user_id, phone_number, first_name, last_name,
+						lower(first_name || ' ' || last_name) as full_name
+				from banking.users
+				where user_id != $1 and deleted_at is null and discoverable
+						and not exists (
+								select 1 from banking.contacts
+								where contacts.user_id = users.user_id
+										and contacts.contact_user_id = $1 and contacts.blocked))
+		select user_id, phone_number, first_name, last_name
+		from candidates
+		where full_name % $2 or lower(first_name) % $2 or lower(last_name) % $2
+		order by greatest(similarity(full_name, $2), similarity(lower(first_name), $2), similarity(lower(last_name), $2)) desc,
+				user_id asc
+		limit $3
+	`
+
+	// Stored numbers may be grouped with spaces and start with a plus, so
+	// both are ignored when comparing digits.
+	QuerySearchUsersByPhonePrefix = `
+		select user_id, phone_number, first_name, last_name
+		from banking.users
+		where user_id != $1 and deleted_at is null and discoverable
+				and ltrim(replace(phone_number, ' ', ''), '+') like $2 || '%'
+				and not exists (
+						select 1 from banking.contacts
+						where contacts.user_id = users.user_id
+								and contacts.contact_user_id = $1 and contacts.blocked)
+		order by phone_number asc
+		limit $3
+	`
+
+	QuerySetDiscoverable = `
+		update banking.users
+		set discoverable = $2
+		where user_id = $1 and deleted_at is null
+	`
+)
@@ -0,0 +1,8 @@
+package queries
+
+var (
+	QueryInsertSecurityEvent = `
+		insert into banking.security_events (user_id, session_id, kind, details)
+		values ($1, $2, $3, $4)
+	`
+)
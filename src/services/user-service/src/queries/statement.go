@@ -0,0 +1,37 @@
+package queries
+
+var (
+	QueryInsertStatement = `
+		insert into banking.statements
+		(statement_id, user_id, month, opening_balance, closing_balance, transfer_count, pdf, csv, pdf_checksum, csv_checksum, ledger_checksum)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		returning statement_id, user_id, month, opening_balance, closing_balance, transfer_count, pdf_checksum, csv_checksum, ledger_checksum, created_at
+	`
+
+	QueryGetStatementForMonth = `
+		select statement_id, user_id, month, opening_balance, closing_balance, transfer_count, pdf_checksum, csv_checksum, ledger_checksum, created_at
+		from banking.statements
+		where user_id = $1 and month = $2
+	`
+
+	QueryGetPreviousStatement = `
+		select statement_id, user_id, month, opening_balance, closing_balance, transfer_count, pdf_checksum, csv_checksum, ledger_checksum, created_at
+		from banking.statements
+		where user_id = $1 and month < $2
+		order by month desc
+		limit 1
+	`
+
+	QueryListStatements = `
+		select statement_id, user_id, month, opening_balance, closing_balance, transfer_count, pdf_checksum, csv_checksum, ledger_checksum, created_at
+		from banking.statements
+		where user_id = $1
+		order by month desc
+	`
+
+	QueryGetStatementFiles = `
+		select statement_id, month, pdf, csv, pdf_checksum, csv_checksum
+		from banking.statements
+		where statement_id = $1 and user_id = $2
+	`
+)
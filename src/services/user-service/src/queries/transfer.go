@@ -0,0 +1,13 @@
+package queries
+
+var (
+	QueryMapTransferIdsToDetails = `
+		select tigerbeetle_transfer_id, memo, reference, null::text as fee_for_transfer_id, null::text as fee_flow
+		from banking.transfers
+		where tigerbeetle_transfer_id = any($1)
+		union all
+		select tigerbeetle_transfer_id, null::text, null::text, transfer_id, flow
+		from banking.fees
+		where tigerbeetle_transfer_id = any($1)
+	`
+)
@@ -5,40 +5,102 @@ var (
 		INSERT INTO banking.users
 		(user_id, phone_number, first_name, last_name, address, birth_date) 
 		VALUES ($1,$2,$3,$4,$5,$6) 
-		RETURNING user_id, phone_number, first_name, last_name, address, created_at, birth_date
+		RETURNING user_id, phone_number, first_name, last_name, address, created_at, birth_date, discoverable
 	`
 
 	QueryGetUserById = `
-		select user_id, phone_number, first_name, last_name, address, created_at, birth_date
+		select user_id, phone_number, first_name, last_name, address, created_at, birth_date, discoverable
 		from banking.users
-		where user_id = $1
+		where user_id = $1 and deleted_at is null
 	`
 
 	QueryGetUserByPhoneNumber = `
-		select user_id, phone_number, first_name, last_name, address, created_at, birth_date
+		select user_id, phone_number, first_name, last_name, address, created_at, birth_date, discoverable
 		from banking.users
-		where phone_number = $1
+		where phone_number = $1 and deleted_at is null
 	`
 
 	QueryMapUserIdsToNames = `
-		select first_name, last_name, user_id from banking.users
+		select first_name, last_name, user_id, deleted_at is not null as deleted from banking.users
 		where user_id = any($1)
 	`
 
+	// Deletion keeps the user id the ledger refers to and overwrites the
+	// personal details. The phone number placeholder keeps the column unique
+	// and frees the number for a new registration. Second factors, one-time
+	// passcodes and the profile history go, empty pots are closed and active
+	// sessions end. deletion_completed_at stays null until the ledger accounts
+	// are closed and payment-service has revoked what is still live.
+	QueryDeleteUser = `
+		with deleted as (
+				update banking.users
+						set phone_number = 'deleted:' || user_id, first_name = '', last_name = '', address = '',
+								birth_date = '1900-01-01', deleted_at = now()
+						where user_id = $1 and deleted_at is null
+						returning user_id),
+			closed_pots as (
+				update banking.pots set status = 'closed', closed_at = now()
+						where user_id in (select user_id from deleted) and status in ('open', 'closing')
+						returning pot_id),
+			deleted_history as (
+				delete from banking.profile_history where user_id in (select user_id from deleted) returning user_id),
+			deleted_phone_number_changes as (
+				delete from banking.phone_number_changes where user_id in (select user_id from deleted) returning user_id),
+			deleted_passcodes as (
+				delete from banking.one_time_passcodes where user_id in (select user_id from deleted) returning user_id),
+			deleted_recovery_codes as (
+				delete from banking.recovery_codes where user_id in (select user_id from deleted) returning user_id),
+			deleted_factors as (
+				delete from banking.totp_factors where user_id in (select user_id from deleted) returning user_id),
+			expired_sessions as (
+				update banking.sessions set expires = now()
+						where user_id in (select user_id from deleted) and expires > now()
+						returning session_id)
+		select array(select session_id::string from expired_sessions) as session_ids
+		from deleted
+	`
+
+	QueryGetUserPotIds = `
+		select pot_id from banking.pots
+		where user_id = $1
+		order by created_at asc
+	`
+
+	QueryCompleteUserDeletion = `
+		update banking.users set deletion_completed_at = now()
+		where user_id = $1 and deleted_at is not null and deletion_completed_at is null
+	`
+
+	QueryGetUnfinishedDeletions = `
+		select user_id from banking.users
+		where deleted_at is not null and deletion_completed_at is null
+		order by deleted_at asc
+		limit $1
+	`
+
+	// One row per counterparty of recent transfers and per favorite. Ranking
+	// and the limit are applied by the caller.
 	QueryGetSuggestedUsers = `
-		SELECT 
-			other_user.user_id,
-			other_user.phone_number,
-			other_user.first_name,
-			other_user.last_name
-		FROM banking.transfers transfer
-		JOIN banking.users from_user ON transfer.from_user_id = from_user.user_id
-		JOIN banking.users to_user ON transfer.to_user_id = to_user.user_id
-		JOIN banking.users other_user ON other_user.user_id = 
-			CASE WHEN transfer.from_user_id = $1 THEN transfer.to_user_id 
-				 ELSE transfer.from_user_id END
-		WHERE (transfer.from_user_id = $1 OR transfer.to_user_id = $1)
-		ORDER BY transfer.created_at DESC
-		LIMIT $2
+		with counterparties as (
+				select case when from_user_id = $1 then to_user_id else from_user_id end as user_id,
+						count(*) as transfer_count, max(created_at) as last_transfer_at
+				from banking.transfers
+				where (from_user_id = $1 or to_user_id = $1) and created_at > now() - $2::interval
+				group by 1),
+			favorites as (
+				select contact_user_id as user_id from banking.contacts
+				where user_id = $1 and favorite),
+			candidates as (
+				select user_id from counterparties
+				union
+				select user_id from favorites)
+		select users.user_id, users.phone_number, users.first_name, users.last_name,
+				contacts.nickname, coalesce(contacts.favorite, false) as favorite,
+				coalesce(counterparties.transfer_count, 0) as transfer_count, counterparties.last_transfer_at
+		from candidates
+		join banking.users on users.user_id = candidates.user_id
+		left join counterparties on counterparties.user_id = candidates.user_id
+		left join banking.contacts on contacts.user_id = $1 and contacts.contact_user_id = candidates.user_id
+		where users.user_id != $1 and users.deleted_at is null and not coalesce(contacts.blocked, false)
 	`
 )
@@ -12,6 +12,9 @@ type ActiveSession struct {
 	Device      string    `db:"device"`
 	Application string    `db:"application"`
 	IpAddress   string    `db:"ip_address"`
+	Name        *string   `db:"name"`
+	LastSeenAt  time.Time `db:"last_seen_at"`
+	Location    *string   `db:"location"`
 }
 
 func DbActiveSessionToPbActiveSession(session ActiveSession) *pb.ActiveSession {
@@ -22,5 +25,38 @@ func DbActiveSessionToPbActiveSession(session ActiveSession) *pb.ActiveSession {
 		Device:      session.Device,
 		Application: session.Application,
 		IpAddress:   session.IpAddress,
+		Name:        session.Name,
+		LastSeenAt:  session.LastSeenAt.UTC().Format(time.RFC3339),
+		Location:    session.Location,
+	}
+}
+
+type RotatedSession struct {
+	RefreshGeneration int64      `db:"refresh_generation"`
+	MfaAt             *time.Time `db:"mfa_at"`
+}
+
+type SessionGeneration struct {
+	RefreshGeneration int64 `db:"refresh_generation"`
+	Active            bool  `db:"active"`
+}
+
+type LatestSession struct {
+	SessionId   string    `db:"session_id"`
+	CreatedAt   time.Time `db:"created_at"`
+	Device      string    `db:"device"`
+	Application string    `db:"application"`
+	IpAddress   string    `db:"ip_address"`
+	KnownDevice bool      `db:"known_device"`
+}
+
+func DbLatestSessionToPbLatestSession(session LatestSession) *pb.LatestSession {
+	return &pb.LatestSession{
+		SessionId:   session.SessionId,
+		CreatedAt:   session.CreatedAt.UTC().Format(time.RFC3339),
+		Device:      session.Device,
+		Application: session.Application,
+		IpAddress:   session.IpAddress,
+		KnownDevice: session.KnownDevice,
 	}
 }
@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+func interval(duration time.Duration) string {
+	return fmt.Sprintf("%d seconds", int64(duration.Seconds()))
+}
+
+// GetAuthLockout returns the latest lockout among the keys, or nil when none
+// of them is locked.
+func GetAuthLockout(ctx context.Context, db *sqlx.DB, keys []string) (*time.Time, error) {
+	var lockedUntil *time.Time
+	err := db.GetContext(ctx, &lockedUntil, queries.QueryGetAuthLockout, pq.Array(keys))
+	if err != nil {
+		slog.Error("Failed to get auth lockout", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return lockedUntil, nil
+}
+
+// RecordAuthAttempt counts an attempt against the key and locks it when the
+// limit is reached, returning the end of the lockout.
+func RecordAuthAttempt(ctx context.Context, db *sqlx.DB, limit lib.AttemptLimit, value string) (*time.Time, error) {
+	key := limit.Key(value)
+
+	var attempts int
+	err := db.GetContext(ctx, &attempts, queries.QueryRecordAuthAttempt, key, interval(limit.Window))
+	if err != nil {
+		slog.Error("Failed to record auth attempt", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	if attempts < limit.MaxAttempts {
+		return nil, nil
+	}
+
+	var lockedUntil time.Time
+	err = db.GetContext(ctx, &lockedUntil, queries.QueryLockAuthAttempt, key, interval(limit.Lockout))
+	if err != nil {
+		slog.Error("Failed to lock auth attempts", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return &lockedUntil, nil
+}
+
+func ClearAuthAttempts(ctx context.Context, db *sqlx.DB, limit lib.AttemptLimit, value string) error {
+	_, err := db.ExecContext(ctx, queries.QueryClearAuthAttempts, limit.Key(value))
+	if err != nil {
+		slog.Error("Failed to clear auth attempts", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return nil
+}
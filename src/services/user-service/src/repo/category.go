@@ -0,0 +1,207 @@
+package repo
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	pb "protobufs/gen/go/user-service"
+	"slices"
+	"time"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type DbTransferCategory struct {
+	TransferId string `db:"transfer_id"`
+	Category   string `db:"category"`
+}
+
+type DbCounterpartyCategory struct {
+	CounterpartyId string `db:"counterparty_id"`
+	Category       string `db:"category"`
+}
+
+func MapTransferCategories(ctx context.Context, db *sqlx.DB, userId string, transferIds []string) (map[string]string, error) {
+	result := make(map[string]string)
+
+	categories := []DbTransferCategory{}
+	err := db.SelectContext(ctx, &categories, queries.QueryMapTransferCategories, userId, pq.Array(transferIds))
+	if err != nil {
+		slog.Error("Failed to map transfer categories", "error", err)
+		return result, lib.ErrUnexpected
+	}
+
+	for _, category := range categories {
+		result[category.TransferId] = category.Category
+	}
+
+	return result, nil
+}
+
+func MapCounterpartyCategories(ctx context.Context, db *sqlx.DB, userId string) (map[string]string, error) {
+	result := make(map[string]string)
+
+	categories := []DbCounterpartyCategory{}
+	err := db.SelectContext(ctx, &categories, queries.QueryMapCounterpartyCategories, userId)
+	if err != nil {
+		slog.Error("Failed to map counterparty categories", "error", err)
+		return result, lib.ErrUnexpected
+	}
+
+	for _, category := range categories {
+		result[category.CounterpartyId] = category.Category
+	}
+
+	return result, nil
+}
+
+// TransferCounterpartyId returns the account on the other side of the
+// transfer from the requesting user's point of view.
+func TransferCounterpartyId(transfer *pb.Transfer) string {
+	if transfer.IsIncreasingTransfer {
+		return transfer.CreditAccountId
+	}
+	return transfer.DebitAccountId
+}
+
+// TransferCategorizer holds the user's own category choices, which take
+// precedence over the automatic rules: a category set on the transfer wins
+// over one set on the counterparty.
+type TransferCategorizer struct {
+	TransferCategories     map[string]string
+	CounterpartyCategories map[string]string
+}
+
+func (categorizer TransferCategorizer) Categorize(transfer *pb.Transfer) string {
+	if category, ok := categorizer.TransferCategories[transfer.TransferId]; ok {
+		return category
+	}
+	if category, ok := categorizer.CounterpartyCategories[TransferCounterpartyId(transfer)]; ok {
+		return category
+	}
+
+	switch {
+	case transfer.IsFee:
+		return lib.CATEGORY_FEES
+	case transfer.PotName != nil:
+		return lib.CATEGORY_SAVINGS
+	case transfer.IsSystemTransfer && transfer.IsIncreasingTransfer:
+		return lib.CATEGORY_DEPOSITS
+	case transfer.IsSystemTransfer:
+		return lib.CATEGORY_PAYOUTS
+	}
+
+	if transfer.Memo != nil {
+		if category, ok := lib.CategorizeMemo(*transfer.Memo); ok {
+			return category
+		}
+	}
+
+	if transfer.IsIncreasingTransfer {
+		return lib.CATEGORY_INCOME
+	}
+	return lib.CATEGORY_TRANSFERS
+}
+
+// BuildSpendingInsights totals settled transfers into income and expense per
+// category, counterparty and month. Pending and voided transfers have not
+// moved money, and moves between the user's own account and pots are neither
+// income nor expense, so all of them are skipped.
+func BuildSpendingInsights(transfers []*pb.Transfer) (*pb.SpendingInsights, error) {
+	insights := &pb.SpendingInsights{}
+	categories := make(map[string]*pb.CategoryInsight)
+	counterparties := make(map[string]*pb.CounterpartyInsight)
+	months := make(map[string]*pb.MonthInsight)
+
+	for _, transfer := range transfers {
+		if transfer.Pending || transfer.Voided || transfer.PotName != nil {
+			continue
+		}
+
+		amountBig, err := HexStringToBigInt(transfer.Amount)
+		if err != nil || !amountBig.IsUint64() {
+			slog.Error("Failed to parse transfer amount", "transferId", transfer.TransferId, "error", err)
+			return nil, lib.ErrUnexpected
+		}
+		amount := amountBig.Uint64()
+
+		timestamp, err := time.Parse(time.RFC3339Nano, transfer.Timestamp)
+		if err != nil {
+			slog.Error("Failed to parse transfer timestamp", "transferId", transfer.TransferId, "error", err)
+			return nil, lib.ErrUnexpected
+		}
+		monthKey := timestamp.UTC().Format("2006-01")
+
+		category, ok := categories[transfer.Category]
+		if !ok {
+			category = &pb.CategoryInsight{Category: transfer.Category}
+			categories[transfer.Category] = category
+		}
+		month, ok := months[monthKey]
+		if !ok {
+			month = &pb.MonthInsight{Month: monthKey}
+			months[monthKey] = month
+		}
+
+		var counterparty *pb.CounterpartyInsight
+		if !transfer.IsSystemTransfer {
+			counterpartyId := TransferCounterpartyId(transfer)
+			counterparty, ok = counterparties[counterpartyId]
+			if !ok {
+				counterparty = &pb.CounterpartyInsight{CounterpartyId: counterpartyId}
+				if transfer.IsIncreasingTransfer {
+					counterparty.FirstName = transfer.CreditUserFirstName
+					counterparty.LastName = transfer.CreditUserLastName
+				} else {
+					counterparty.FirstName = transfer.DebitUserFirstName
+					counterparty.LastName = transfer.DebitUserLastName
+				}
+				counterparties[counterpartyId] = counterparty
+			}
+			counterparty.TransferCount++
+		}
+
+		category.TransferCount++
+		if transfer.IsIncreasingTransfer {
+			insights.Income += amount
+			category.Income += amount
+			month.Income += amount
+			if counterparty != nil {
+				counterparty.Income += amount
+			}
+		} else {
+			insights.Expense += amount
+			category.Expense += amount
+			month.Expense += amount
+			if counterparty != nil {
+				counterparty.Expense += amount
+			}
+		}
+	}
+
+	for _, category := range categories {
+		insights.Categories = append(insights.Categories, category)
+	}
+	slices.SortFunc(insights.Categories, func(a, b *pb.CategoryInsight) int {
+		return cmp.Or(cmp.Compare(b.Expense, a.Expense), cmp.Compare(b.Income, a.Income), cmp.Compare(a.Category, b.Category))
+	})
+
+	for _, counterparty := range counterparties {
+		insights.Counterparties = append(insights.Counterparties, counterparty)
+	}
+	slices.SortFunc(insights.Counterparties, func(a, b *pb.CounterpartyInsight) int {
+		return cmp.Or(cmp.Compare(b.Expense, a.Expense), cmp.Compare(b.Income, a.Income), cmp.Compare(a.CounterpartyId, b.CounterpartyId))
+	})
+
+	for _, month := range months {
+		insights.Months = append(insights.Months, month)
+	}
+	slices.SortFunc(insights.Months, func(a, b *pb.MonthInsight) int {
+		return cmp.Compare(a.Month, b.Month)
+	})
+
+	return insights, nil
+}
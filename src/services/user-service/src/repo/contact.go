@@ -0,0 +1,91 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	pb "protobufs/gen/go/user-service"
+	"time"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Contact struct {
+	ContactUserId string    `db:"contact_user_id"`
+	PhoneNumber   string    `db:"phone_number"`
+	FirstName     string    `db:"first_name"`
+	LastName      string    `db:"last_name"`
+	Nickname      *string   `db:"nickname"`
+	Favorite      bool      `db:"favorite"`
+	Blocked       bool      `db:"blocked"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+func upsertContact(ctx context.Context, db *sqlx.DB, query string, args ...any) (*Contact, error) {
+	contact := &Contact{}
+	err := db.GetContext(ctx, contact, query, args...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, lib.ErrContactBlocked
+		}
+		slog.Error("Failed to update contact", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return contact, nil
+}
+
+// SetContactFavorite returns ErrContactBlocked when favoriting a blocked
+// contact.
+func SetContactFavorite(ctx context.Context, db *sqlx.DB, userId, contactUserId string, favorite bool) (*Contact, error) {
+	return upsertContact(ctx, db, queries.QuerySetContactFavorite, userId, contactUserId, favorite)
+}
+
+func SetContactNickname(ctx context.Context, db *sqlx.DB, userId, contactUserId string, nickname *string) (*Contact, error) {
+	return upsertContact(ctx, db, queries.QuerySetContactNickname, userId, contactUserId, nickname)
+}
+
+func SetContactBlocked(ctx context.Context, db *sqlx.DB, userId, contactUserId string, blocked bool) (*Contact, error) {
+	return upsertContact(ctx, db, queries.QuerySetContactBlocked, userId, contactUserId, blocked)
+}
+
+func GetContacts(ctx context.Context, db *sqlx.DB, userId string) ([]Contact, error) {
+	contacts := []Contact{}
+	err := db.SelectContext(ctx, &contacts, queries.QueryGetContacts, userId)
+	if err != nil {
+		slog.Error("Failed to get contacts", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return contacts, nil
+}
+
+// IsContactBlocked reports whether userId has blocked contactUserId.
+func IsContactBlocked(ctx context.Context, db *sqlx.DB, userId, contactUserId string) (bool, error) {
+	var blocked bool
+	err := db.GetContext(ctx, &blocked, queries.QueryGetContactBlocked, userId, contactUserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		slog.Error("Failed to get contact block", "error", err)
+		return false, lib.ErrUnexpected
+	}
+
+	return blocked, nil
+}
+
+func DbContactToPbContact(contact Contact) *pb.Contact {
+	return &pb.Contact{
+		UserId:      contact.ContactUserId,
+		PhoneNumber: contact.PhoneNumber,
+		FirstName:   contact.FirstName,
+		LastName:    contact.LastName,
+		Nickname:    contact.Nickname,
+		Favorite:    contact.Favorite,
+		Blocked:     contact.Blocked,
+		CreatedAt:   contact.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,299 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	pb "protobufs/gen/go/user-service"
+	"time"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// The export rows are written to the archive as they are, so they carry json
+// tags and leave out internal columns such as ciphertexts and hashes.
+
+type ExportProfile struct {
+	UserId       string          `json:"user_id"`
+	PhoneNumber  string          `json:"phone_number"`
+	FirstName    string          `json:"first_name"`
+	LastName     string          `json:"last_name"`
+	Address      string          `json:"address"`
+	BirthDate    string          `json:"birth_date"`
+	CreatedAt    time.Time       `json:"created_at"`
+	Discoverable bool            `json:"discoverable"`
+	Kyc          ExportKycStatus `json:"kyc"`
+	Totp         ExportTotp      `json:"totp"`
+}
+
+type ExportKycStatus struct {
+	Status     string     `json:"status"`
+	VerifiedAt *time.Time `json:"verified_at"`
+	Expires    *time.Time `json:"expires"`
+}
+
+type ExportTotp struct {
+	Enabled     bool       `json:"enabled"`
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+}
+
+type ExportSession struct {
+	SessionId   string    `db:"session_id" json:"session_id"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	Expires     time.Time `db:"expires" json:"expires"`
+	Device      string    `db:"device" json:"device"`
+	Application string    `db:"application" json:"application"`
+	IpAddress   string    `db:"ip_address" json:"ip_address"`
+	Name        *string   `db:"name" json:"name"`
+	LastSeenAt  time.Time `db:"last_seen_at" json:"last_seen_at"`
+	Location    *string   `db:"location" json:"location"`
+}
+
+type ExportSecurityEvent struct {
+	EventId   string    `db:"event_id" json:"event_id"`
+	SessionId *string   `db:"session_id" json:"session_id"`
+	Kind      string    `db:"kind" json:"kind"`
+	Details   *string   `db:"details" json:"details"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type ExportProfileChange struct {
+	ChangeId  string    `db:"change_id" json:"change_id"`
+	Field     string    `db:"field" json:"field"`
+	OldValue  string    `db:"old_value" json:"old_value"`
+	NewValue  string    `db:"new_value" json:"new_value"`
+	ChangedAt time.Time `db:"changed_at" json:"changed_at"`
+}
+
+type ExportPayment struct {
+	TransferId string    `db:"tigerbeetle_transfer_id" json:"transfer_id"`
+	FromUserId string    `db:"from_user_id" json:"from_user_id"`
+	ToUserId   string    `db:"to_user_id" json:"to_user_id"`
+	Amount     string    `db:"amount" json:"amount"`
+	Memo       *string   `db:"memo" json:"memo"`
+	Reference  *string   `db:"reference" json:"reference"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+type ExportDeposit struct {
+	TransferId            string     `db:"tigerbeetle_transfer_id" json:"transfer_id"`
+	StripePaymentIntentId string     `db:"stripe_payment_intent_id" json:"stripe_payment_intent_id"`
+	PaymentStatus         string     `db:"payment_status" json:"payment_status"`
+	PostedAt              *time.Time `db:"posted_at" json:"posted_at"`
+	VoidedAt              *time.Time `db:"voided_at" json:"voided_at"`
+}
+
+type ExportPayout struct {
+	TransferId     string     `db:"tigerbeetle_transfer_id" json:"transfer_id"`
+	StripePayoutId *string    `db:"stripe_payout_id" json:"stripe_payout_id"`
+	PaymentStatus  string     `db:"payment_status" json:"payment_status"`
+	PostedAt       *time.Time `db:"posted_at" json:"posted_at"`
+	VoidedAt       *time.Time `db:"voided_at" json:"voided_at"`
+}
+
+type ExportPot struct {
+	PotId        string  `json:"pot_id"`
+	Name         string  `json:"name"`
+	Balance      string  `json:"balance"`
+	TargetAmount *string `json:"target_amount"`
+	TargetDate   *string `json:"target_date"`
+	Status       string  `json:"status"`
+	CreatedAt    string  `json:"created_at"`
+	ClosedAt     *string `json:"closed_at"`
+}
+
+type ExportKycSubmission struct {
+	SubmissionId    string     `db:"submission_id" json:"submission_id"`
+	DocumentType    string     `db:"document_type" json:"document_type"`
+	IssuingCountry  string     `db:"issuing_country" json:"issuing_country"`
+	DocumentExpires time.Time  `db:"document_expires" json:"document_expires"`
+	Status          string     `db:"status" json:"status"`
+	Reason          *string    `db:"reason" json:"reason"`
+	DecidedAt       *time.Time `db:"decided_at" json:"decided_at"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+}
+
+type ExportLedgerEntry struct {
+	TransferId  string    `json:"transfer_id"`
+	Timestamp   time.Time `json:"timestamp"`
+	Description string    `json:"description"`
+	Amount      string    `json:"amount"`
+	Status      string    `json:"status"`
+	Category    string    `json:"category"`
+	Memo        *string   `json:"memo"`
+	Reference   *string   `json:"reference"`
+}
+
+type ExportPotLedger struct {
+	PotId   string                 `json:"pot_id"`
+	Name    string                 `json:"name"`
+	Entries []ExportPotLedgerEntry `json:"entries"`
+}
+
+type ExportPotLedgerEntry struct {
+	TransferId string    `json:"transfer_id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Amount     string    `json:"amount"`
+	Status     string    `json:"status"`
+}
+
+type ExportContact struct {
+	ContactUserId string    `db:"contact_user_id" json:"contact_user_id"`
+	FirstName     string    `db:"first_name" json:"first_name"`
+	LastName      string    `db:"last_name" json:"last_name"`
+	Nickname      *string   `db:"nickname" json:"nickname"`
+	Favorite      bool      `db:"favorite" json:"favorite"`
+	Blocked       bool      `db:"blocked" json:"blocked"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
+type ExportTransferCategory struct {
+	TransferId string    `db:"transfer_id" json:"transfer_id"`
+	Category   string    `db:"category" json:"category"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type ExportCounterpartyCategory struct {
+	CounterpartyId string    `db:"counterparty_id" json:"counterparty_id"`
+	Category       string    `db:"category" json:"category"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type ExportStatement struct {
+	StatementId    string    `json:"statement_id"`
+	Month          string    `json:"month"`
+	OpeningBalance string    `json:"opening_balance"`
+	ClosingBalance string    `json:"closing_balance"`
+	TransferCount  int       `json:"transfer_count"`
+	PdfFile        string    `json:"pdf_file"`
+	CsvFile        string    `json:"csv_file"`
+	PdfChecksum    string    `json:"pdf_checksum"`
+	CsvChecksum    string    `json:"csv_checksum"`
+	LedgerChecksum string    `json:"ledger_checksum"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func selectExportRows[T any](ctx context.Context, db *sqlx.DB, query, userId string) ([]T, error) {
+	rows := []T{}
+	err := db.SelectContext(ctx, &rows, query, userId)
+	if err != nil {
+		slog.Error("Failed to export user data", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return rows, nil
+}
+
+func ExportSessions(ctx context.Context, db *sqlx.DB, userId string) ([]ExportSession, error) {
+	return selectExportRows[ExportSession](ctx, db, queries.QueryExportSessions, userId)
+}
+
+func ExportSecurityEvents(ctx context.Context, db *sqlx.DB, userId string) ([]ExportSecurityEvent, error) {
+	return selectExportRows[ExportSecurityEvent](ctx, db, queries.QueryExportSecurityEvents, userId)
+}
+
+func ExportProfileHistory(ctx context.Context, db *sqlx.DB, userId string) ([]ExportProfileChange, error) {
+	return selectExportRows[ExportProfileChange](ctx, db, queries.QueryExportProfileHistory, userId)
+}
+
+// ExportPayments returns the payments the user sent or received, with the
+// stored hex amounts rendered as decimal amounts.
+func ExportPayments(ctx context.Context, db *sqlx.DB, userId string) ([]ExportPayment, error) {
+	payments, err := selectExportRows[ExportPayment](ctx, db, queries.QueryExportPayments, userId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range payments {
+		amount, err := HexStringToBigInt(payments[i].Amount)
+		if err != nil {
+			slog.Error("Failed to parse payment amount hex to bigInt", "error", err)
+			return nil, lib.ErrUnexpected
+		}
+		payments[i].Amount = lib.FormatMinorUnits(amount)
+	}
+	return payments, nil
+}
+
+func ExportDeposits(ctx context.Context, db *sqlx.DB, userId string) ([]ExportDeposit, error) {
+	return selectExportRows[ExportDeposit](ctx, db, queries.QueryExportDeposits, userId)
+}
+
+func ExportPayouts(ctx context.Context, db *sqlx.DB, userId string) ([]ExportPayout, error) {
+	return selectExportRows[ExportPayout](ctx, db, queries.QueryExportPayouts, userId)
+}
+
+func ExportPots(ctx context.Context, db *sqlx.DB, userId string) ([]Pot, error) {
+	return selectExportRows[Pot](ctx, db, queries.QueryExportPots, userId)
+}
+
+func PbPotToExportPot(pot *pb.Pot) (ExportPot, error) {
+	balance, err := HexStringToBigInt(pot.Balance)
+	if err != nil {
+		slog.Error("Failed to parse pot balance hex to bigInt", "error", err)
+		return ExportPot{}, lib.ErrUnexpected
+	}
+
+	exportPot := ExportPot{
+		PotId:      pot.PotId,
+		Name:       pot.Name,
+		Balance:    lib.FormatMinorUnits(balance),
+		TargetDate: pot.TargetDate,
+		Status:     pot.Status,
+		CreatedAt:  pot.CreatedAt,
+		ClosedAt:   pot.ClosedAt,
+	}
+	if pot.TargetAmount != nil {
+		targetAmount := lib.FormatMinorUnits(new(big.Int).SetUint64(*pot.TargetAmount))
+		exportPot.TargetAmount = &targetAmount
+	}
+
+	return exportPot, nil
+}
+
+func ExportKycSubmissions(ctx context.Context, db *sqlx.DB, userId string) ([]ExportKycSubmission, error) {
+	return selectExportRows[ExportKycSubmission](ctx, db, queries.QueryExportKycSubmissions, userId)
+}
+
+func ExportContacts(ctx context.Context, db *sqlx.DB, userId string) ([]ExportContact, error) {
+	return selectExportRows[ExportContact](ctx, db, queries.QueryExportContacts, userId)
+}
+
+func ExportTransferCategories(ctx context.Context, db *sqlx.DB, userId string) ([]ExportTransferCategory, error) {
+	return selectExportRows[ExportTransferCategory](ctx, db, queries.QueryExportTransferCategories, userId)
+}
+
+func ExportCounterpartyCategories(ctx context.Context, db *sqlx.DB, userId string) ([]ExportCounterpartyCategory, error) {
+	return selectExportRows[ExportCounterpartyCategory](ctx, db, queries.QueryExportCounterpartyCategories, userId)
+}
+
+func ExportStatements(ctx context.Context, db *sqlx.DB, userId string) ([]Statement, error) {
+	return selectExportRows[Statement](ctx, db, queries.QueryExportStatements, userId)
+}
+
+func DbStatementToExportStatement(statement Statement) (ExportStatement, error) {
+	openingBalance, ok := new(big.Int).SetString(statement.OpeningBalance, 16)
+	if !ok {
+		slog.Error("Failed to parse statement opening balance", "statement_id", statement.StatementId)
+		return ExportStatement{}, lib.ErrUnexpected
+	}
+	closingBalance, ok := new(big.Int).SetString(statement.ClosingBalance, 16)
+	if !ok {
+		slog.Error("Failed to parse statement closing balance", "statement_id", statement.StatementId)
+		return ExportStatement{}, lib.ErrUnexpected
+	}
+
+	return ExportStatement{
+		StatementId:    statement.StatementId,
+		Month:          lib.FormatStatementMonth(statement.Month),
+		OpeningBalance: lib.FormatMinorUnits(openingBalance),
+		ClosingBalance: lib.FormatMinorUnits(closingBalance),
+		TransferCount:  statement.TransferCount,
+		PdfFile:        lib.EXPORT_STATEMENTS_DIR + lib.StatementFilename(statement.Month, lib.STATEMENT_FORMAT_PDF),
+		CsvFile:        lib.EXPORT_STATEMENTS_DIR + lib.StatementFilename(statement.Month, lib.STATEMENT_FORMAT_CSV),
+		PdfChecksum:    statement.PdfChecksum,
+		CsvChecksum:    statement.CsvChecksum,
+		LedgerChecksum: statement.LedgerChecksum,
+		CreatedAt:      statement.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,134 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	pb "protobufs/gen/go/user-service"
+	"time"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type KycVerification struct {
+	UserId       string     `db:"user_id"`
+	Status       string     `db:"status"`
+	SubmissionId *string    `db:"submission_id"`
+	Reason       *string    `db:"reason"`
+	VerifiedAt   *time.Time `db:"verified_at"`
+	Expires      *time.Time `db:"expires"`
+	UpdatedAt    *time.Time `db:"updated_at"`
+}
+
+type KycSubmission struct {
+	SubmissionId    string    `db:"submission_id"`
+	UserId          string    `db:"user_id"`
+	DocumentType    string    `db:"document_type"`
+	IssuingCountry  string    `db:"issuing_country"`
+	DocumentExpires time.Time `db:"document_expires"`
+	Status          string    `db:"status"`
+}
+
+// SealedKycDocument is a document with the number and image encrypted.
+type SealedKycDocument struct {
+	Document                 lib.KycDocument
+	DocumentNumberCiphertext []byte
+	ImageCiphertext          []byte
+}
+
+// GetKycVerification returns an unverified verification for users who have
+// never submitted a document.
+func GetKycVerification(ctx context.Context, db *sqlx.DB, userId string) (*KycVerification, error) {
+	verification := &KycVerification{}
+	err := db.GetContext(ctx, verification, queries.QueryGetKycVerification, userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &KycVerification{UserId: userId, Status: lib.KYC_STATUS_UNVERIFIED}, nil
+		}
+		slog.Error("Failed to get KYC verification", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return verification, nil
+}
+
+// SubmitKyc stores the submission and moves the verification to pending. It
+// returns ErrConflict when the stored status is no longer fromStatus.
+func SubmitKyc(ctx context.Context, db *sqlx.DB, userId, submissionId, fromStatus string, sealed SealedKycDocument) error {
+	var contentType *string
+	if sealed.Document.ImageContentType != "" {
+		contentType = &sealed.Document.ImageContentType
+	}
+
+	result, err := db.ExecContext(ctx, queries.QuerySubmitKyc,
+		userId, submissionId, fromStatus,
+		sealed.Document.DocumentType, sealed.Document.IssuingCountry, sealed.DocumentNumberCiphertext,
+		sealed.Document.DocumentExpires, sealed.ImageCiphertext, contentType)
+	if err != nil {
+		slog.Error("Failed to submit KYC documents", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return expectRow(result, lib.ErrConflict)
+}
+
+func GetKycSubmission(ctx context.Context, db *sqlx.DB, submissionId string) (*KycSubmission, error) {
+	submission := &KycSubmission{}
+	err := db.GetContext(ctx, submission, queries.QueryGetKycSubmission, submissionId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, lib.ErrNotFound
+		}
+		slog.Error("Failed to get KYC submission", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return submission, nil
+}
+
+// DecideKyc records the decision on a pending submission. It returns
+// ErrConflict when the submission is no longer pending.
+func DecideKyc(ctx context.Context, db *sqlx.DB, submissionId string, decision lib.KycDecision, documentExpires time.Time, decidedBy string) error {
+	var reason *string
+	if decision.Reason != "" {
+		reason = &decision.Reason
+	}
+
+	var verifiedAt, expires *time.Time
+	if decision.Status == lib.KYC_STATUS_VERIFIED {
+		now := time.Now()
+		verificationExpires := lib.KycVerificationExpiry(documentExpires, now)
+		verifiedAt, expires = &now, &verificationExpires
+	}
+
+	result, err := db.ExecContext(ctx, queries.QueryDecideKyc, submissionId, decision.Status, reason, verifiedAt, expires, decidedBy)
+	if err != nil {
+		slog.Error("Failed to record KYC decision", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return expectRow(result, lib.ErrConflict)
+}
+
+func DbKycVerificationToPbKycStatus(verification KycVerification, now time.Time) *pb.KycStatus {
+	status := lib.EffectiveKycStatus(verification.Status, verification.Expires, now)
+
+	kycStatus := &pb.KycStatus{
+		Status:         status,
+		SubmissionId:   verification.SubmissionId,
+		Reason:         verification.Reason,
+		PayoutsAllowed: status == lib.KYC_STATUS_VERIFIED,
+	}
+	if verification.VerifiedAt != nil {
+		verifiedAt := verification.VerifiedAt.UTC().Format(time.RFC3339)
+		kycStatus.VerifiedAt = &verifiedAt
+	}
+	if verification.Expires != nil {
+		expires := verification.Expires.UTC().Format(time.RFC3339)
+		kycStatus.Expires = &expires
+	}
+
+	return kycStatus
+}
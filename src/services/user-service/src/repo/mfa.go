@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type TotpFactor struct {
+	UserId           string     `db:"user_id"`
+	SecretCiphertext []byte     `db:"secret_ciphertext"`
+	ConfirmedAt      *time.Time `db:"confirmed_at"`
+	LastUsedStep     int64      `db:"last_used_step"`
+}
+
+type RecoveryCode struct {
+	RecoveryCodeId string `db:"recovery_code_id"`
+	CodeHash       string `db:"code_hash"`
+}
+
+func GetTotpFactor(ctx context.Context, db *sqlx.DB, userId string) (*TotpFactor, error) {
+	factor := &TotpFactor{}
+	err := db.GetContext(ctx, factor, queries.QueryGetTotpFactor, userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, lib.ErrNotFound
+		}
+		slog.Error("Failed to get TOTP factor", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return factor, nil
+}
+
+// StorePendingTotpFactor returns ErrConflict when the user already has a
+// confirmed factor.
+func StorePendingTotpFactor(ctx context.Context, db *sqlx.DB, userId string, secretCiphertext []byte) error {
+	result, err := db.ExecContext(ctx, queries.QueryUpsertPendingTotpFactor, userId, secretCiphertext)
+	if err != nil {
+		slog.Error("Failed to store TOTP factor", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return expectRow(result, lib.ErrConflict)
+}
+
+func ConfirmTotpFactor(ctx context.Context, db *sqlx.DB, userId string, step int64) error {
+	result, err := db.ExecContext(ctx, queries.QueryConfirmTotpFactor, userId, step)
+	if err != nil {
+		slog.Error("Failed to confirm TOTP factor", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return expectRow(result, lib.ErrMfaCodeMismatch)
+}
+
+// UseTotpStep returns ErrMfaCodeMismatch when the step was already used,
+// e.g. by a concurrent request with the same code.
+func UseTotpStep(ctx context.Context, db *sqlx.DB, userId string, step int64) error {
+	result, err := db.ExecContext(ctx, queries.QueryUseTotpStep, userId, step)
+	if err != nil {
+		slog.Error("Failed to use TOTP step", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return expectRow(result, lib.ErrMfaCodeMismatch)
+}
+
+func DeleteTotpFactor(ctx context.Context, db *sqlx.DB, userId string) error {
+	_, err := db.ExecContext(ctx, queries.QueryDeleteTotpFactor, userId)
+	if err != nil {
+		slog.Error("Failed to delete TOTP factor", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return nil
+}
+
+func ReplaceRecoveryCodes(ctx context.Context, db *sqlx.DB, userId string, codeHashes []string) error {
+	_, err := db.ExecContext(ctx, queries.QueryReplaceRecoveryCodes, userId, pq.Array(codeHashes))
+	if err != nil {
+		slog.Error("Failed to store recovery codes", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return nil
+}
+
+func GetUnusedRecoveryCodes(ctx context.Context, db *sqlx.DB, userId string) ([]RecoveryCode, error) {
+	codes := []RecoveryCode{}
+	err := db.SelectContext(ctx, &codes, queries.QueryGetUnusedRecoveryCodes, userId)
+	if err != nil {
+		slog.Error("Failed to get recovery codes", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return codes, nil
+}
+
+func UseRecoveryCode(ctx context.Context, db *sqlx.DB, recoveryCodeId string) error {
+	result, err := db.ExecContext(ctx, queries.QueryUseRecoveryCode, recoveryCodeId)
+	if err != nil {
+		slog.Error("Failed to use recovery code", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return expectRow(result, lib.ErrMfaCodeMismatch)
+}
+
+// expectRow returns errNoRow when the statement affected no rows.
+func expectRow(result sql.Result, errNoRow error) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return lib.ErrUnexpected
+	}
+	if rowsAffected == 0 {
+		return errNoRow
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
+	"time"
 	"user-service/src/lib"
 	"user-service/src/queries"
 
@@ -14,11 +15,40 @@ import (
 )
 
 type OTPCode struct {
-	HashedOTPCode string `db:"one_time_passcode_hash"`
-	UserId        string `db:"user_id"`
+	HashedOTPCode  string `db:"one_time_passcode_hash"`
+	UserId         string `db:"user_id"`
+	FailedAttempts int    `db:"failed_attempts"`
 }
 
-func StoreOTP(db *sqlx.DB, ctx context.Context, phoneNumber, hashedOtpCode string) error {
+type OTPThrottle struct {
+	UserId          string     `db:"user_id"`
+	LastRequestedAt *time.Time `db:"last_requested_at"`
+	RequestCount    int        `db:"request_count"`
+}
+
+type OTPFailure struct {
+	FailedAttempts  int        `db:"failed_attempts"`
+	LastRequestedAt *time.Time `db:"last_requested_at"`
+	RequestCount    int        `db:"request_count"`
+}
+
+func GetOTPThrottle(db *sqlx.DB, ctx context.Context, phoneNumber string) (*OTPThrottle, error) {
+	throttle := &OTPThrottle{}
+	err := db.GetContext(ctx, throttle, queries.QueryGetOtpThrottle, phoneNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, lib.ErrNotFound
+		}
+		slog.Error("Failed to get OTP throttle", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return throttle, nil
+}
+
+// StoreOTP replaces the user's code. It returns ErrNotFound when the
+// throttle state changed since previousRequestedAt was read.
+func StoreOTP(db *sqlx.DB, ctx context.Context, phoneNumber, hashedOtpCode string, requestCount int, previousRequestedAt *time.Time) error {
 	span := trace.SpanFromContext(ctx)
 
 	expiresIn := fmt.Sprintf("%d minutes", lib.OTPExpirationWindowMinutes)
@@ -30,7 +60,7 @@ func StoreOTP(db *sqlx.DB, ctx context.Context, phoneNumber, hashedOtpCode strin
 
 	result, err := db.ExecContext(
 		ctx, queries.QueryInsertOtp,
-		phoneNumber, hashedOtpCode, expiresIn,
+		phoneNumber, hashedOtpCode, expiresIn, requestCount, previousRequestedAt,
 	)
 	if err != nil {
 		span.RecordError(err)
@@ -57,7 +87,7 @@ func StoreOTP(db *sqlx.DB, ctx context.Context, phoneNumber, hashedOtpCode strin
 
 func GetOtp(db *sqlx.DB, ctx context.Context, phoneNumber string) (*OTPCode, error) {
 	otpCode := &OTPCode{}
-	err := db.GetContext(ctx, otpCode, queries.QueryGetOtp, phoneNumber)
+	err := db.GetContext(ctx, otpCode, queries.QueryGetOtp, phoneNumber, lib.MaxOTPAttempts)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			slog.Info("Failed to get OTP",
@@ -74,3 +104,38 @@ func GetOtp(db *sqlx.DB, ctx context.Context, phoneNumber string) (*OTPCode, err
 
 	return otpCode, nil
 }
+
+// RecordOTPFailure counts a wrong guess and invalidates the code once
+// MaxOTPAttempts is reached.
+func RecordOTPFailure(db *sqlx.DB, ctx context.Context, userId string) (*OTPFailure, error) {
+	failure := &OTPFailure{}
+	err := db.GetContext(ctx, failure, queries.QueryRecordOtpFailure, userId, lib.MaxOTPAttempts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, lib.ErrNotFound
+		}
+		slog.Error("Failed to record OTP failure", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return failure, nil
+}
+
+func ConsumeOTP(db *sqlx.DB, ctx context.Context, userId string) error {
+	result, err := db.ExecContext(ctx, queries.QueryConsumeOtp, userId, lib.MaxOTPAttempts)
+	if err != nil {
+		slog.Error("Failed to consume OTP", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to consume OTP", "error", err)
+		return lib.ErrUnexpected
+	}
+	if rowsAffected == 0 {
+		return lib.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type PaymentChallenge struct {
+	ChallengeId    string     `db:"challenge_id"`
+	UserId         string     `db:"user_id"`
+	ToUserId       *string    `db:"to_user_id"`
+	BulkBatchId    *string    `db:"bulk_batch_id"`
+	Amount         string     `db:"amount"`
+	CodeHash       string     `db:"code_hash"`
+	FailedAttempts int        `db:"failed_attempts"`
+	Expires        time.Time  `db:"expires"`
+	ConfirmedAt    *time.Time `db:"confirmed_at"`
+}
+
+// CreatePaymentChallenge stores the challenge and returns when it expires.
+func CreatePaymentChallenge(ctx context.Context, db *sqlx.DB, challenge PaymentChallenge) (time.Time, error) {
+	var expires time.Time
+	err := db.GetContext(ctx, &expires, queries.QueryInsertPaymentChallenge,
+		challenge.ChallengeId, challenge.UserId, challenge.ToUserId, challenge.BulkBatchId, challenge.Amount, challenge.CodeHash, interval(lib.PaymentChallengeTTL))
+	if err != nil {
+		slog.Error("Failed to create payment challenge", "error", err)
+		return expires, lib.ErrUnexpected
+	}
+
+	return expires, nil
+}
+
+func RecordPaymentChallengeFailure(ctx context.Context, db *sqlx.DB, challengeId string) error {
+	_, err := db.ExecContext(ctx, queries.QueryRecordPaymentChallengeFailure, challengeId, lib.MaxPaymentChallengeAttempts)
+	if err != nil {
+		slog.Error("Failed to record payment challenge failure", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return nil
+}
+
+func ConfirmPaymentChallenge(ctx context.Context, db *sqlx.DB, challengeId string) error {
+	result, err := db.ExecContext(ctx, queries.QueryConfirmPaymentChallenge, challengeId, lib.MaxPaymentChallengeAttempts)
+	if err != nil {
+		slog.Error("Failed to confirm payment challenge", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return expectRow(result, lib.ErrNotFound)
+}
+
+// RedeemPaymentConfirmation returns ErrPaymentConfirmationInvalid when the
+// confirmation was already used or does not match the payment.
+func RedeemPaymentConfirmation(ctx context.Context, db *sqlx.DB, claims lib.PaymentConfirmationClaims, amount string) error {
+	result, err := db.ExecContext(ctx, queries.QueryRedeemPaymentChallenge,
+		claims.ChallengeId, claims.UserId, claims.ToUserId, claims.BulkBatchId, amount, interval(lib.PaymentConfirmationTTL))
+	if err != nil {
+		slog.Error("Failed to redeem payment confirmation", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return expectRow(result, lib.ErrPaymentConfirmationInvalid)
+}
+
+// ReleasePaymentConfirmation makes a redeemed confirmation usable again. It
+// returns ErrPaymentConfirmationInvalid when there is no redemption to undo.
+func ReleasePaymentConfirmation(ctx context.Context, db *sqlx.DB, claims lib.PaymentConfirmationClaims, amount string) error {
+	result, err := db.ExecContext(ctx, queries.QueryReleasePaymentChallenge,
+		claims.ChallengeId, claims.UserId, claims.ToUserId, claims.BulkBatchId, amount)
+	if err != nil {
+		slog.Error("Failed to release payment confirmation", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return expectRow(result, lib.ErrPaymentConfirmationInvalid)
+}
@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	tbPb "protobufs/gen/go/tigerbeetle-service"
+	pb "protobufs/gen/go/user-service"
+	"time"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type Pot struct {
+	PotId        string     `db:"pot_id"`
+	UserId       string     `db:"user_id"`
+	Name         string     `db:"name"`
+	TargetAmount *int64     `db:"target_amount"`
+	TargetDate   *time.Time `db:"target_date"`
+	Status       string     `db:"status"`
+	CreatedAt    time.Time  `db:"created_at"`
+	ClosedAt     *time.Time `db:"closed_at"`
+
+	CloseTransferId *string `db:"close_transfer_id"`
+}
+
+func PotBalance(account *tbPb.Account) (*big.Int, error) {
+	return AccountBalance(account.CreditsPosted, account.DebitsPosted, account.CreditsPending)
+}
+
+func DbPotToPbPot(pot Pot, balance *big.Int) *pb.Pot {
+	pbPot := &pb.Pot{
+		PotId:     pot.PotId,
+		UserId:    pot.UserId,
+		Name:      pot.Name,
+		Balance:   balance.Text(16),
+		Status:    pot.Status,
+		CreatedAt: pot.CreatedAt.UTC().Format(time.RFC3339),
+	}
+
+	if pot.TargetAmount != nil {
+		targetAmount := uint64(*pot.TargetAmount)
+		pbPot.TargetAmount = &targetAmount
+
+		progress := uint32(100)
+		if balance.IsUint64() && balance.Uint64() < targetAmount {
+			progress = uint32(balance.Uint64() * 100 / targetAmount)
+		}
+		if balance.Sign() <= 0 {
+			progress = 0
+		}
+		pbPot.ProgressPercent = &progress
+	}
+	if pot.TargetDate != nil {
+		targetDate := pot.TargetDate.UTC().Format(time.RFC3339)
+		pbPot.TargetDate = &targetDate
+	}
+	if pot.ClosedAt != nil {
+		closedAt := pot.ClosedAt.UTC().Format(time.RFC3339)
+		pbPot.ClosedAt = &closedAt
+	}
+
+	return pbPot
+}
+
+type DbPotIdToNameMap struct {
+	PotId string `db:"pot_id"`
+	Name  string `db:"name"`
+}
+
+func MapPotIdsToNames(ctx context.Context, db *sqlx.DB, ids []string) (map[string]string, error) {
+	result := make(map[string]string)
+
+	pots := []DbPotIdToNameMap{}
+	err := db.SelectContext(ctx, &pots, queries.QueryMapPotIdsToNames, pq.Array(ids))
+	if err != nil {
+		slog.Error("Failed to map pot ids to names", "error", err)
+		return result, lib.ErrUnexpected
+	}
+
+	for _, pot := range pots {
+		result[pot.PotId] = pot.Name
+	}
+
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	pb "protobufs/gen/go/user-service"
+	"time"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type ProfileHistoryEntry struct {
+	ChangeId  string    `db:"change_id"`
+	Field     string    `db:"field"`
+	OldValue  string    `db:"old_value"`
+	NewValue  string    `db:"new_value"`
+	ChangedAt time.Time `db:"changed_at"`
+}
+
+type PhoneNumberChange struct {
+	ChangeId       string `db:"change_id"`
+	UserId         string `db:"user_id"`
+	NewPhoneNumber string `db:"new_phone_number"`
+	OldCodeHash    string `db:"old_code_hash"`
+	NewCodeHash    string `db:"new_code_hash"`
+	FailedAttempts int    `db:"failed_attempts"`
+}
+
+// UpdateProfile applies the changes on top of the current profile and records
+// them in the history. It returns ErrConflict when the profile was changed
+// since current was read.
+func UpdateProfile(ctx context.Context, db *sqlx.DB, current User, changes []lib.ProfileChange) error {
+	updated := current
+	fields := make([]string, len(changes))
+	oldValues := make([]string, len(changes))
+	newValues := make([]string, len(changes))
+	for i, change := range changes {
+		fields[i], oldValues[i], newValues[i] = change.Field, change.OldValue, change.NewValue
+		switch change.Field {
+		case lib.PROFILE_FIELD_FIRST_NAME:
+			updated.FirstName = change.NewValue
+		case lib.PROFILE_FIELD_LAST_NAME:
+			updated.LastName = change.NewValue
+		case lib.PROFILE_FIELD_ADDRESS:
+			updated.Address = change.NewValue
+		}
+	}
+
+	result, err := db.ExecContext(ctx, queries.QueryUpdateProfile,
+		current.UserId, updated.FirstName, updated.LastName, updated.Address,
+		current.FirstName, current.LastName, current.Address,
+		pq.Array(fields), pq.Array(oldValues), pq.Array(newValues))
+	if err != nil {
+		slog.Error("Failed to update profile", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return expectRow(result, lib.ErrConflict)
+}
+
+func GetProfileHistory(ctx context.Context, db *sqlx.DB, userId string, limit uint32) ([]ProfileHistoryEntry, error) {
+	entries := []ProfileHistoryEntry{}
+	err := db.SelectContext(ctx, &entries, queries.QueryGetProfileHistory, userId, limit)
+	if err != nil {
+		slog.Error("Failed to get profile history", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return entries, nil
+}
+
+func DbProfileHistoryEntryToPbProfileChange(entry ProfileHistoryEntry) *pb.ProfileChange {
+	return &pb.ProfileChange{
+		ChangeId:  entry.ChangeId,
+		Field:     entry.Field,
+		OldValue:  entry.OldValue,
+		NewValue:  entry.NewValue,
+		ChangedAt: entry.ChangedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// CreatePhoneNumberChange stores the change and returns when it expires.
+func CreatePhoneNumberChange(ctx context.Context, db *sqlx.DB, change PhoneNumberChange) (time.Time, error) {
+	var expires time.Time
+	err := db.GetContext(ctx, &expires, queries.QueryInsertPhoneNumberChange,
+		change.ChangeId, change.UserId, change.NewPhoneNumber, change.OldCodeHash, change.NewCodeHash, interval(lib.PhoneNumberChangeTTL))
+	if err != nil {
+		slog.Error("Failed to create phone number change", "error", err)
+		return expires, lib.ErrUnexpected
+	}
+
+	return expires, nil
+}
+
+func GetPhoneNumberChange(ctx context.Context, db *sqlx.DB, changeId, userId string) (*PhoneNumberChange, error) {
+	change := &PhoneNumberChange{}
+	err := db.GetContext(ctx, change, queries.QueryGetPhoneNumberChange, changeId, userId, lib.MaxPhoneNumberChangeAttempts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, lib.ErrNotFound
+		}
+		slog.Error("Failed to get phone number change", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return change, nil
+}
+
+func RecordPhoneNumberChangeFailure(ctx context.Context, db *sqlx.DB, changeId string) error {
+	_, err := db.ExecContext(ctx, queries.QueryRecordPhoneNumberChangeFailure, changeId, lib.MaxPhoneNumberChangeAttempts)
+	if err != nil {
+		slog.Error("Failed to record phone number change failure", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return nil
+}
+
+// CompletePhoneNumberChange moves the user to the new number. It returns
+// ErrConflict when another user has taken the number since the change was
+// started.
+func CompletePhoneNumberChange(ctx context.Context, db *sqlx.DB, changeId string) error {
+	result, err := db.ExecContext(ctx, queries.QueryCompletePhoneNumberChange, changeId)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return lib.ErrConflict
+		}
+		slog.Error("Failed to complete phone number change", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return expectRow(result, lib.ErrNotFound)
+}
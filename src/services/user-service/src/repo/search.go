@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+	pb "protobufs/gen/go/user-service"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type UserSearchResult struct {
+	UserId      string `db:"user_id"`
+	PhoneNumber string `db:"phone_number"`
+	FirstName   string `db:"first_name"`
+	LastName    string `db:"last_name"`
+}
+
+// SearchQuery returns the name or phone prefix search for a query kind from
+// lib.ParseUserSearchQuery.
+func SearchQuery(kind string) string {
+	if kind == lib.USER_SEARCH_PHONE {
+		return queries.QuerySearchUsersByPhonePrefix
+	}
+	return queries.QuerySearchUsersByName
+}
+
+// SearchUsers runs the search for a query parsed by lib.ParseUserSearchQuery.
+func SearchUsers(ctx context.Context, db *sqlx.DB, userId, kind, term string, limit uint32) ([]UserSearchResult, error) {
+	results := []UserSearchResult{}
+	err := db.SelectContext(ctx, &results, SearchQuery(kind), userId, term, limit)
+	if err != nil {
+		slog.Error("Failed to search users", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return results, nil
+}
+
+func SetDiscoverable(ctx context.Context, db *sqlx.DB, userId string, discoverable bool) error {
+	result, err := db.ExecContext(ctx, queries.QuerySetDiscoverable, userId, discoverable)
+	if err != nil {
+		slog.Error("Failed to set discoverable", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return expectRow(result, lib.ErrNotFound)
+}
+
+// DbUserSearchResultToPb only ever returns the masked phone number, so a
+// search cannot be used to collect numbers. Phone prefix results hide every
+// digit, since showing the last ones would let a caller who knows the start
+// of a number read the rest of it back.
+func DbUserSearchResultToPb(result UserSearchResult, kind string) *pb.UserSearchResult {
+	maskedPhoneNumber := lib.RedactPhoneNumber(result.PhoneNumber)
+	if kind == lib.USER_SEARCH_PHONE {
+		maskedPhoneNumber = lib.MaskPhoneNumber(result.PhoneNumber)
+	}
+
+	return &pb.UserSearchResult{
+		UserId:            result.UserId,
+		MaskedPhoneNumber: maskedPhoneNumber,
+		FirstName:         result.FirstName,
+		LastName:          result.LastName,
+	}
+}
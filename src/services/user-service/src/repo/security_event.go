@@ -0,0 +1,20 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func RecordSecurityEvent(ctx context.Context, db *sqlx.DB, userId string, sessionId *string, kind, details string) error {
+	_, err := db.ExecContext(ctx, queries.QueryInsertSecurityEvent, userId, sessionId, kind, details)
+	if err != nil {
+		slog.Error("Failed to record security event", "kind", kind, "error", err)
+		return lib.ErrUnexpected
+	}
+
+	return nil
+}
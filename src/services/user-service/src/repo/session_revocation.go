@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type RevokedSession struct {
+	SessionId string    `db:"session_id"`
+	Expires   time.Time `db:"expires"`
+}
+
+// SessionRevocations caches the sessions that ended while their access tokens
+// may still be unexpired. It is reloaded from the database in the background,
+// so a session revoked through any instance is seen within the refresh
+// interval, and immediately on the instance that revoked it.
+type SessionRevocations struct {
+	db          *sqlx.DB
+	mu          sync.RWMutex
+	revoked     map[string]time.Time
+	refreshedAt time.Time
+}
+
+func NewSessionRevocations(db *sqlx.DB) *SessionRevocations {
+	return &SessionRevocations{db: db, revoked: map[string]time.Time{}}
+}
+
+func (sr *SessionRevocations) Refresh(ctx context.Context) error {
+	startedAt := time.Now()
+
+	sessions := []RevokedSession{}
+	err := sr.db.SelectContext(ctx, &sessions, queries.QueryGetRevokedSessions, interval(lib.AccessTokenTTL))
+	if err != nil {
+		slog.Error("Failed to get revoked sessions", "error", err)
+		return lib.ErrUnexpected
+	}
+
+	revoked := make(map[string]time.Time, len(sessions))
+	for _, session := range sessions {
+		revoked[session.SessionId] = session.Expires
+	}
+
+	// A session is never reinstated once ended, so entries added locally while
+	// the query ran are kept until they age out.
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	cutoff := startedAt.Add(-lib.AccessTokenTTL)
+	for sessionId, revokedAt := range sr.revoked {
+		if _, ok := revoked[sessionId]; !ok && revokedAt.After(cutoff) {
+			revoked[sessionId] = revokedAt
+		}
+	}
+	sr.revoked = revoked
+	sr.refreshedAt = startedAt
+
+	return nil
+}
+
+func (sr *SessionRevocations) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			sr.Refresh(ctx)
+			cancel()
+		}
+	}()
+}
+
+func (sr *SessionRevocations) Revoke(sessionId string) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	sr.revoked[sessionId] = time.Now()
+}
+
+// IsRevoked reports whether the session has ended. The second result is false
+// when the cache has not been refreshed recently enough to be trusted.
+func (sr *SessionRevocations) IsRevoked(sessionId string, now time.Time) (bool, bool) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	if now.Sub(sr.refreshedAt) > lib.SessionRevocationMaxStaleness {
+		return false, false
+	}
+	_, revoked := sr.revoked[sessionId]
+	return revoked, true
+}
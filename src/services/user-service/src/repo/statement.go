@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"math/big"
+	tbPb "protobufs/gen/go/tigerbeetle-service"
+	pb "protobufs/gen/go/user-service"
+	"time"
+	"user-service/src/lib"
+)
+
+type Statement struct {
+	StatementId    string    `db:"statement_id"`
+	UserId         string    `db:"user_id"`
+	Month          time.Time `db:"month"`
+	OpeningBalance string    `db:"opening_balance"`
+	ClosingBalance string    `db:"closing_balance"`
+	TransferCount  int       `db:"transfer_count"`
+	PdfChecksum    string    `db:"pdf_checksum"`
+	CsvChecksum    string    `db:"csv_checksum"`
+	LedgerChecksum string    `db:"ledger_checksum"`
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+type StatementFiles struct {
+	StatementId string    `db:"statement_id"`
+	Month       time.Time `db:"month"`
+	Pdf         []byte    `db:"pdf"`
+	Csv         []byte    `db:"csv"`
+	PdfChecksum string    `db:"pdf_checksum"`
+	CsvChecksum string    `db:"csv_checksum"`
+}
+
+func DbStatementToPbStatement(statement Statement) *pb.Statement {
+	return &pb.Statement{
+		StatementId:    statement.StatementId,
+		UserId:         statement.UserId,
+		Month:          lib.FormatStatementMonth(statement.Month),
+		OpeningBalance: statement.OpeningBalance,
+		ClosingBalance: statement.ClosingBalance,
+		TransferCount:  uint32(statement.TransferCount),
+		PdfChecksum:    statement.PdfChecksum,
+		CsvChecksum:    statement.CsvChecksum,
+		CreatedAt:      statement.CreatedAt.UTC().Format(time.RFC3339),
+		LedgerChecksum: statement.LedgerChecksum,
+	}
+}
+
+// TransferSettled reports whether the transfer has moved posted funds. Pending
+// transfers only reserve funds, and voids release them again.
+func TransferSettled(transfer *tbPb.Transfer) bool {
+	return !transfer.Pending && !transfer.Voided
+}
+
+// TransferNetAmount is the signed effect of the transfer on the user's
+// balance.
+func TransferNetAmount(transfer *tbPb.Transfer, userId string) (*big.Int, error) {
+	amount, err := HexStringToBigInt(transfer.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.DebitAccountId != userId {
+		amount.Neg(amount)
+	}
+	return amount, nil
+}
+
+// TransferDescription names the other side of the transfer for statements and
+// exports.
+func TransferDescription(transfer *pb.Transfer) string {
+	switch {
+	case transfer.IsFee:
+		return "Fee"
+	case transfer.PotName != nil:
+		return "Pot: " + *transfer.PotName
+	case transfer.IsSystemTransfer && transfer.IsIncreasingTransfer:
+		return "Deposit"
+	case transfer.IsSystemTransfer:
+		return "Payout"
+	case transfer.IsIncreasingTransfer:
+		return lib.FormatName(transfer.CreditUserFirstName, transfer.CreditUserLastName)
+	default:
+		return lib.FormatName(transfer.DebitUserFirstName, transfer.DebitUserLastName)
+	}
+}
@@ -1,11 +1,53 @@
 package repo
 
 import (
+	"context"
+	"log/slog"
 	tbPb "protobufs/gen/go/tigerbeetle-service"
 	pb "protobufs/gen/go/user-service"
+	"user-service/src/lib"
+	"user-service/src/queries"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
-func TbTransferToPbTransfer(transfer *tbPb.Transfer, debitUser, creditUser UserName, requestUserId string) *pb.Transfer {
+type TransferDetails struct {
+	TigerbeetleTransferId string  `db:"tigerbeetle_transfer_id"`
+	Memo                  *string `db:"memo"`
+	Reference             *string `db:"reference"`
+	FeeForTransferId      *string `db:"fee_for_transfer_id"`
+	FeeFlow               *string `db:"fee_flow"`
+}
+
+func MapTransferIdsToDetails(ctx context.Context, db *sqlx.DB, ids []string) (map[string]TransferDetails, error) {
+	result := make(map[string]TransferDetails)
+
+	rows, err := db.QueryxContext(ctx, queries.QueryMapTransferIdsToDetails, pq.Array(ids))
+	if err != nil {
+		slog.Error("Failed to map transfer ids to details", "error", err)
+		return result, lib.ErrUnexpected
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var details TransferDetails
+		if err := rows.StructScan(&details); err != nil {
+			slog.Error("Failed to scan transfer details row", "error", err)
+			return result, lib.ErrUnexpected
+		}
+		result[details.TigerbeetleTransferId] = details
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating rows", "error", err)
+		return result, lib.ErrUnexpected
+	}
+
+	return result, nil
+}
+
+func TbTransferToPbTransfer(transfer *tbPb.Transfer, debitUser, creditUser UserName, details TransferDetails, requestUserId string) *pb.Transfer {
 	return &pb.Transfer{
 		TransferId:           transfer.TransferId,
 		Amount:               transfer.Amount,
@@ -17,9 +59,20 @@ func TbTransferToPbTransfer(transfer *tbPb.Transfer, debitUser, creditUser UserN
 		CreditUserLastName:   creditUser.LastName,
 		Timestamp:            transfer.Timestamp,
 		IsIncreasingTransfer: transfer.DebitAccountId == requestUserId,
-		IsSystemTransfer:     transfer.CreditAccountId == "1" || transfer.DebitAccountId == "1",
+		IsSystemTransfer:     isSystemAccount(transfer.CreditAccountId) || isSystemAccount(transfer.DebitAccountId),
 		Pending:              transfer.Pending,
 		Posted:               transfer.Posted,
 		Voided:               transfer.Voided,
+		Memo:                 details.Memo,
+		Reference:            details.Reference,
+		IsFee:                details.FeeForTransferId != nil,
+		FeeForTransferId:     details.FeeForTransferId,
+		FeeFlow:              details.FeeFlow,
 	}
 }
+
+// The system float account is "1" and fees are collected in the revenue
+// account "2".
+func isSystemAccount(accountId string) bool {
+	return accountId == "1" || accountId == "2"
+}
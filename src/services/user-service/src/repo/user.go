@@ -1,10 +1,14 @@
 package repo
 
 import (
+	"cmp"
 	"context"
+	"database/sql"
 	"log/slog"
 	"math/big"
+	tbPb "protobufs/gen/go/tigerbeetle-service"
 	pb "protobufs/gen/go/user-service"
+	"slices"
 	"time"
 	"user-service/src/lib"
 	"user-service/src/queries"
@@ -15,13 +19,14 @@ import (
 )
 
 type User struct {
-	UserId      string    `db:"user_id"`
-	PhoneNumber string    `db:"phone_number"`
-	FirstName   string    `db:"first_name"`
-	LastName    string    `db:"last_name"`
-	Address     string    `db:"address"`
-	BirthDate   time.Time `db:"birth_date"`
-	CreatedAt   time.Time `db:"created_at"`
+	UserId       string    `db:"user_id"`
+	PhoneNumber  string    `db:"phone_number"`
+	FirstName    string    `db:"first_name"`
+	LastName     string    `db:"last_name"`
+	Address      string    `db:"address"`
+	BirthDate    time.Time `db:"birth_date"`
+	CreatedAt    time.Time `db:"created_at"`
+	Discoverable bool      `db:"discoverable"`
 }
 
 func HexStringToBigInt(str string) (*big.Int, error) {
@@ -33,8 +38,7 @@ func HexStringToBigInt(str string) (*big.Int, error) {
 	return &bigInt, nil
 }
 
-func DbUserToPbUser(dbUser User, credits, debits, pendingDebits, pendingCredits string) (*pb.User, error) {
-
+func AccountBalance(credits, debits, pendingCredits string) (*big.Int, error) {
 	creditsBig, err := HexStringToBigInt(credits)
 	if err != nil {
 		slog.Error("Failed to parse credits hex to bigInt", "error", err)
@@ -54,6 +58,15 @@ func DbUserToPbUser(dbUser User, credits, debits, pendingDebits, pendingCredits
 	balance := big.NewInt(0).Sub(debitsBig, creditsBig)
 	balance = big.NewInt(0).Sub(balance, pendingCreditsBig)
 
+	return balance, nil
+}
+
+func DbUserToPbUser(dbUser User, credits, debits, pendingDebits, pendingCredits string) (*pb.User, error) {
+	balance, err := AccountBalance(credits, debits, pendingCredits)
+	if err != nil {
+		return nil, err
+	}
+
 	return &pb.User{
 		UserId:         dbUser.UserId,
 		PhoneNumber:    dbUser.PhoneNumber,
@@ -65,13 +78,81 @@ func DbUserToPbUser(dbUser User, credits, debits, pendingDebits, pendingCredits
 		Balance:        balance.Text(16),
 		PendingDebits:  pendingDebits,
 		PendingCredits: pendingCredits,
+		TotalBalance:   balance.Text(16),
+		Discoverable:   dbUser.Discoverable,
 	}, nil
 }
 
+// AccountEmpty reports whether the account holds no funds, posted or
+// pending.
+func AccountEmpty(account *tbPb.Account) (bool, error) {
+	amounts := []string{account.CreditsPosted, account.DebitsPosted, account.CreditsPending, account.DebitsPending}
+	values := make([]*big.Int, len(amounts))
+	for i, amount := range amounts {
+		value, err := HexStringToBigInt(amount)
+		if err != nil {
+			slog.Error("Failed to parse account amount hex to bigInt", "error", err)
+			return false, lib.ErrUnexpected
+		}
+		values[i] = value
+	}
+
+	credits, debits, pendingCredits, pendingDebits := values[0], values[1], values[2], values[3]
+	return credits.Cmp(debits) == 0 && pendingCredits.Sign() == 0 && pendingDebits.Sign() == 0, nil
+}
+
+// DeleteUser pseudonymizes the user and returns the sessions it ended. It
+// returns ErrNotFound when the user does not exist or is already deleted.
+func DeleteUser(ctx context.Context, db *sqlx.DB, userId string) ([]string, error) {
+	sessionIds := pq.StringArray{}
+	err := db.GetContext(ctx, &sessionIds, queries.QueryDeleteUser, userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, lib.ErrNotFound
+		}
+		slog.Error("Failed to delete user", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return sessionIds, nil
+}
+
+func GetUserPotIds(ctx context.Context, db *sqlx.DB, userId string) ([]string, error) {
+	potIds := []string{}
+	err := db.SelectContext(ctx, &potIds, queries.QueryGetUserPotIds, userId)
+	if err != nil {
+		slog.Error("Failed to get user pot ids", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return potIds, nil
+}
+
+func CompleteUserDeletion(ctx context.Context, db *sqlx.DB, userId string) error {
+	_, err := db.ExecContext(ctx, queries.QueryCompleteUserDeletion, userId)
+	if err != nil {
+		slog.Error("Failed to complete user deletion", "error", err)
+		return lib.ErrUnexpected
+	}
+	return nil
+}
+
+// GetUnfinishedDeletions returns deleted users whose ledger accounts or
+// payments may still be open, oldest deletion first.
+func GetUnfinishedDeletions(ctx context.Context, db *sqlx.DB, limit int) ([]string, error) {
+	userIds := []string{}
+	err := db.SelectContext(ctx, &userIds, queries.QueryGetUnfinishedDeletions, limit)
+	if err != nil {
+		slog.Error("Failed to get unfinished deletions", "error", err)
+		return nil, lib.ErrUnexpected
+	}
+	return userIds, nil
+}
+
 type DbUserIdToNameMap struct {
 	FirstName string `db:"first_name"`
 	LastName  string `db:"last_name"`
 	UserId    string `db:"user_id"`
+	Deleted   bool   `db:"deleted"`
 }
 
 type UserName struct {
@@ -95,6 +176,10 @@ func MapUserIdsToUsernames(ctx context.Context, db *sqlx.DB, ids []string) (map[
 			slog.Error("Failed to scan user row", "error", err)
 			return result, lib.ErrUnexpected
 		}
+		if user.Deleted {
+			result[user.UserId] = UserName{FirstName: lib.DeletedUserName}
+			continue
+		}
 		result[user.UserId] = UserName{FirstName: user.FirstName, LastName: user.LastName}
 	}
 
@@ -108,39 +193,41 @@ func MapUserIdsToUsernames(ctx context.Context, db *sqlx.DB, ids []string) (map[
 }
 
 type SuggestedUser struct {
-	UserId      string `db:"user_id"`
-	PhoneNumber string `db:"phone_number"`
-	FirstName   string `db:"first_name"`
-	LastName    string `db:"last_name"`
+	UserId         string     `db:"user_id"`
+	PhoneNumber    string     `db:"phone_number"`
+	FirstName      string     `db:"first_name"`
+	LastName       string     `db:"last_name"`
+	Nickname       *string    `db:"nickname"`
+	Favorite       bool       `db:"favorite"`
+	TransferCount  int        `db:"transfer_count"`
+	LastTransferAt *time.Time `db:"last_transfer_at"`
 }
 
-func GetSuggestedUsers(ctx context.Context, db *sqlx.DB, userId string, limit int32) ([]SuggestedUser, error) {
-	var users []SuggestedUser
-
-	rows, err := db.QueryxContext(ctx, queries.QueryGetSuggestedUsers, userId, limit)
+// GetSuggestedUsers ranks favorites and recent counterparties with
+// lib.SuggestionScore. The query returns each user once, so the limit is
+// applied to distinct users.
+func GetSuggestedUsers(ctx context.Context, db *sqlx.DB, userId string, limit int) ([]SuggestedUser, error) {
+	users := []SuggestedUser{}
+	err := db.SelectContext(ctx, &users, queries.QueryGetSuggestedUsers, userId, interval(lib.SuggestionLookback))
 	if err != nil {
 		slog.Error("Failed to get suggested users", "error", err)
 		return nil, lib.ErrUnexpected
 	}
-	defer rows.Close()
 
-	seen := make(map[string]bool)
-	for rows.Next() {
-		var user SuggestedUser
-		if err := rows.StructScan(&user); err != nil {
-			slog.Error("Failed to scan suggested user row", "error", err)
-			return nil, lib.ErrUnexpected
-		}
-		if !seen[user.UserId] {
-			seen[user.UserId] = true
-			users = append(users, user)
-		}
+	now := time.Now()
+	scores := make(map[string]float64, len(users))
+	for _, user := range users {
+		scores[user.UserId] = lib.SuggestionScore(user.Favorite, user.TransferCount, user.LastTransferAt, now)
 	}
+	slices.SortFunc(users, func(a, b SuggestedUser) int {
+		if byScore := cmp.Compare(scores[b.UserId], scores[a.UserId]); byScore != 0 {
+			return byScore
+		}
+		return cmp.Compare(a.UserId, b.UserId)
+	})
 
-	if err := rows.Err(); err != nil {
-		slog.Error("Error iterating suggested users rows", "error", err)
-		return nil, lib.ErrUnexpected
+	if len(users) > limit {
+		users = users[:limit]
 	}
-
 	return users, nil
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+
+	"user-service/src/lib"
+	"user-service/src/queries"
+	"user-service/src/repo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "protobufs/gen/go/user-service"
+)
+
+// limitPhoneSearchTargets counts every user found by phone number against
+// lib.UserSearchPhoneTargetLimit and drops those already found too often, so
+// one number cannot be probed over and over from many accounts.
+func (s *UserServiceServer) limitPhoneSearchTargets(ctx context.Context, tracer trace.Tracer, results []repo.UserSearchResult) ([]repo.UserSearchResult, error) {
+	ctx, targetsSpan := tracer.Start(ctx, lib.EVENT_USER_SEARCH_TARGETS)
+	defer targetsSpan.End()
+
+	targetsSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetAuthLockout),
+	)
+
+	allowed := make([]repo.UserSearchResult, 0, len(results))
+	for _, result := range results {
+		lockedUntil, err := repo.GetAuthLockout(ctx, s.db, []string{lib.UserSearchPhoneTargetLimit.Key(result.UserId)})
+		if err != nil {
+			targetsSpan.RecordError(err)
+			return nil, err
+		}
+		if lockedUntil != nil {
+			targetsSpan.AddEvent(lib.EVENT_USER_SEARCH_TARGET_CAP)
+			continue
+		}
+
+		if err := s.recordAuthAttempt(ctx, tracer, lib.UserSearchPhoneTargetLimit, result.UserId); err != nil {
+			return nil, err
+		}
+		allowed = append(allowed, result)
+	}
+
+	return allowed, nil
+}
+
+// SearchUsers finds recipients by name, tolerating typos, or by phone number
+// prefix. Results only carry masked phone numbers. Every search counts
+// towards lib.UserSearchUserLimit, and phone number searches also count
+// towards lib.UserSearchPhoneTargetLimit for each user found.
+func (s *UserServiceServer) SearchUsers(ctx context.Context, req *pb.SearchUsersRequest) (*pb.SearchUsersResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	limit := uint32(lib.UserSearchDefaultLimit)
+	if req.Limit != nil && *req.Limit > 0 {
+		limit = min(*req.Limit, lib.UserSearchMaxLimit)
+	}
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.Int64(lib.ATTR_USER_SEARCH_LIMIT, int64(limit)),
+	)
+
+	lockoutKeys := []string{lib.UserSearchUserLimit.Key(req.UserId)}
+	if err := s.checkAuthLockout(ctx, tracer, lockoutKeys); err != nil {
+		return nil, err
+	}
+
+	ctx, validateSpan := tracer.Start(ctx, lib.EVENT_USER_SEARCH_VALIDATE)
+	defer validateSpan.End()
+
+	kind, term, err := lib.ParseUserSearchQuery(req.Query)
+	if err != nil {
+		validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "query"),
+		))
+		return nil, err
+	}
+
+	validateSpan.SetAttributes(
+		attribute.String(lib.ATTR_USER_SEARCH_KIND, kind),
+	)
+	validateSpan.End()
+
+	if err := s.recordAuthAttempt(ctx, tracer, lib.UserSearchUserLimit, req.UserId); err != nil {
+		return nil, err
+	}
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_DB_SEARCH_USERS)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, repo.SearchQuery(kind)),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId, "***"}),
+	)
+
+	results, err := repo.SearchUsers(ctx, s.db, req.UserId, kind, term, limit)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	dbSpan.End()
+
+	if kind == lib.USER_SEARCH_PHONE {
+		results, err = s.limitPhoneSearchTargets(ctx, tracer, results)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	span.SetAttributes(
+		attribute.Int(lib.ATTR_USER_SEARCH_RESULT_COUNT, len(results)),
+	)
+
+	pbUsers := make([]*pb.UserSearchResult, len(results))
+	for i, result := range results {
+		pbUsers[i] = repo.DbUserSearchResultToPb(result, kind)
+	}
+
+	return &pb.SearchUsersResponse{Users: pbUsers}, nil
+}
+
+// SetDiscoverable lets users opt out of SearchUsers. Anyone who already knows
+// their full phone number can still pay them.
+func (s *UserServiceServer) SetDiscoverable(ctx context.Context, req *pb.SetDiscoverableRequest) (*pb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.Bool(lib.ATTR_USER_DISCOVERABLE, req.Discoverable),
+	)
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_DB_UPDATE_DISCOVERABLE)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QuerySetDiscoverable),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	err := repo.SetDiscoverable(ctx, s.db, req.UserId, req.Discoverable)
+	if err != nil {
+		if err == lib.ErrNotFound {
+			dbSpan.AddEvent(lib.EVENT_USER_NOT_FOUND)
+			return nil, err
+		}
+		dbSpan.RecordError(err)
+		return nil, err
+	}
+	dbSpan.End()
+
+	return s.GetUserById(ctx, &pb.GetUserByIdRequest{UserId: req.UserId})
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/big"
+	"slices"
+	"time"
+
+	"user-service/src/lib"
+	"user-service/src/queries"
+	"user-service/src/repo"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	tbPb "protobufs/gen/go/tigerbeetle-service"
+	pb "protobufs/gen/go/user-service"
+)
+
+// buildStatement starts from the closing balance of the latest statement
+// before the month and replays the ledger from there up to the end of the
+// month. Without an earlier statement it replays from the start. Balances
+// therefore only depend on immutable transfers and stored statements.
+func (s *UserServiceServer) buildStatement(ctx context.Context, tracer trace.Tracer, user repo.User, month time.Time, previous *repo.Statement) (lib.Statement, error) {
+	statement := lib.Statement{
+		UserId: user.UserId,
+		Name:   lib.FormatName(user.FirstName, user.LastName),
+		Month:  month,
+	}
+
+	replayFrom := time.Unix(0, 0)
+	openingBalance := big.NewInt(0)
+	if previous != nil {
+		closingBalance, ok := new(big.Int).SetString(previous.ClosingBalance, 16)
+		if !ok {
+			return statement, lib.ErrUnexpected
+		}
+		replayFrom = previous.Month.AddDate(0, 1, 0)
+		openingBalance = closingBalance
+	}
+
+	monthEnd := month.AddDate(0, 1, 0)
+	transfers, err := s.getAllAccountTransfers(ctx, tracer, user.UserId, replayFrom, monthEnd.Add(-time.Nanosecond))
+	if err != nil {
+		return statement, err
+	}
+	slices.Reverse(transfers)
+
+	monthTransfers := []*tbPb.Transfer{}
+	for _, transfer := range transfers {
+		if !repo.TransferSettled(transfer) {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, transfer.Timestamp)
+		if err != nil {
+			return statement, lib.ErrUnexpected
+		}
+		if !timestamp.Before(month) {
+			monthTransfers = append(monthTransfers, transfer)
+			continue
+		}
+		amount, err := repo.TransferNetAmount(transfer, user.UserId)
+		if err != nil {
+			return statement, lib.ErrUnexpected
+		}
+		openingBalance.Add(openingBalance, amount)
+	}
+
+	pbTransfers, err := s.transfersWithDetails(ctx, tracer, user.UserId, monthTransfers)
+	if err != nil {
+		return statement, err
+	}
+
+	balance := new(big.Int).Set(openingBalance)
+	statement.Lines = make([]lib.StatementLine, len(monthTransfers))
+	for i, transfer := range monthTransfers {
+		amount, err := repo.TransferNetAmount(transfer, user.UserId)
+		if err != nil {
+			return statement, lib.ErrUnexpected
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, transfer.Timestamp)
+		if err != nil {
+			return statement, lib.ErrUnexpected
+		}
+		balance.Add(balance, amount)
+
+		line := lib.StatementLine{
+			TransferId:  transfer.TransferId,
+			Timestamp:   timestamp,
+			Description: repo.TransferDescription(pbTransfers[i]),
+			Amount:      amount,
+			Balance:     new(big.Int).Set(balance),
+		}
+		if pbTransfers[i].Memo != nil {
+			line.Memo = *pbTransfers[i].Memo
+		}
+		if pbTransfers[i].Reference != nil {
+			line.Reference = *pbTransfers[i].Reference
+		}
+		statement.Lines[i] = line
+	}
+
+	statement.OpeningBalance = openingBalance
+	statement.ClosingBalance = balance
+	return statement, nil
+}
+
+func (s *UserServiceServer) getPreviousStatement(ctx context.Context, tracer trace.Tracer, userId string, month time.Time) (*repo.Statement, error) {
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_DB_GET_STATEMENT)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetPreviousStatement),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{userId, lib.FormatStatementMonth(month)}),
+	)
+
+	previous := repo.Statement{}
+	err := s.db.GetContext(ctx, &previous, queries.QueryGetPreviousStatement, userId, month)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		dbSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+
+	return &previous, nil
+}
+
+// GenerateStatement stores the statement for a completed month. When one is
+// already stored it is regenerated and compared by its ledger checksum
+// instead, and the stored statement is returned with the outcome in verified.
+func (s *UserServiceServer) GenerateStatement(ctx context.Context, req *pb.GenerateStatementRequest) (*pb.Statement, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_STATEMENT_MONTH, req.Month),
+	)
+
+	ctx, validateSpan := tracer.Start(ctx, lib.EVENT_STATEMENT_VALIDATE)
+	defer validateSpan.End()
+
+	month, err := lib.ParseStatementMonth(req.Month, time.Now().UTC())
+	if err != nil {
+		validateSpan.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "month"),
+		))
+		return nil, err
+	}
+	validateSpan.End()
+
+	ctx, dbGetUserSpan := tracer.Start(ctx, lib.EVENT_DB_GET_USER)
+	defer dbGetUserSpan.End()
+
+	dbGetUserSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetUserById),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	user := repo.User{}
+	err = s.db.GetContext(ctx, &user, queries.QueryGetUserById, req.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			dbGetUserSpan.AddEvent(lib.EVENT_USER_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		}
+		dbGetUserSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbGetUserSpan.End()
+
+	previous, err := s.getPreviousStatement(ctx, tracer, req.UserId, month)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	statement, err := s.buildStatement(ctx, tracer, user, month, previous)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	ctx, renderSpan := tracer.Start(ctx, lib.EVENT_STATEMENT_RENDER)
+	defer renderSpan.End()
+
+	pdf := lib.RenderStatementPdf(statement)
+	csv, err := lib.RenderStatementCsv(statement)
+	if err != nil {
+		renderSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	pdfChecksum := lib.Checksum(pdf)
+	csvChecksum := lib.Checksum(csv)
+	ledgerChecksum := lib.LedgerChecksum(statement)
+	renderSpan.End()
+
+	ctx, dbGetStatementSpan := tracer.Start(ctx, lib.EVENT_DB_GET_STATEMENT)
+	defer dbGetStatementSpan.End()
+
+	dbGetStatementSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetStatementForMonth),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId, req.Month}),
+	)
+
+	stored := repo.Statement{}
+	err = s.db.GetContext(ctx, &stored, queries.QueryGetStatementForMonth, req.UserId, month)
+	if err == nil {
+		verified := stored.LedgerChecksum == ledgerChecksum
+		if !verified {
+			dbGetStatementSpan.AddEvent(lib.EVENT_STATEMENT_CHECKSUM_MISMATCH)
+		}
+		dbGetStatementSpan.End()
+
+		pbStatement := repo.DbStatementToPbStatement(stored)
+		pbStatement.Verified = &verified
+		return pbStatement, nil
+	}
+	if err != sql.ErrNoRows {
+		dbGetStatementSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbGetStatementSpan.End()
+
+	ctx, dbCreateStatementSpan := tracer.Start(ctx, lib.EVENT_DB_CREATE_STATEMENT)
+	defer dbCreateStatementSpan.End()
+
+	statementId := uuid.NewString()
+	openingBalance := statement.OpeningBalance.Text(16)
+	closingBalance := statement.ClosingBalance.Text(16)
+
+	dbCreateStatementSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryInsertStatement),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{statementId, req.UserId, req.Month, openingBalance, closingBalance}),
+		attribute.String(lib.ATTR_STATEMENT_ID, statementId),
+	)
+
+	err = s.db.GetContext(ctx, &stored, queries.QueryInsertStatement,
+		statementId, req.UserId, month, openingBalance, closingBalance, len(statement.Lines), pdf, csv, pdfChecksum, csvChecksum, ledgerChecksum)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			dbCreateStatementSpan.AddEvent(lib.EVENT_DB_UNIQUE_CONSTRAINT_VIOLATION)
+			return nil, lib.ErrConflict
+		}
+		dbCreateStatementSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbCreateStatementSpan.End()
+
+	return repo.DbStatementToPbStatement(stored), nil
+}
+
+func (s *UserServiceServer) ListStatements(ctx context.Context, req *pb.ListStatementsRequest) (*pb.ListStatementsResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+	)
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_DB_GET_STATEMENT)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryListStatements),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	statements := []repo.Statement{}
+	err := s.db.SelectContext(ctx, &statements, queries.QueryListStatements, req.UserId)
+	if err != nil {
+		dbSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbSpan.End()
+
+	pbStatements := make([]*pb.Statement, len(statements))
+	for i, statement := range statements {
+		pbStatements[i] = repo.DbStatementToPbStatement(statement)
+	}
+
+	return &pb.ListStatementsResponse{
+		Statements: pbStatements,
+	}, nil
+}
+
+func (s *UserServiceServer) DownloadStatement(ctx context.Context, req *pb.DownloadStatementRequest) (*pb.StatementFile, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer(lib.ServiceName)
+
+	span.SetAttributes(
+		attribute.String(lib.ATTR_USER_ID, req.UserId),
+		attribute.String(lib.ATTR_STATEMENT_ID, req.StatementId),
+		attribute.String(lib.ATTR_STATEMENT_FORMAT, req.Format),
+	)
+
+	if req.Format != lib.STATEMENT_FORMAT_PDF && req.Format != lib.STATEMENT_FORMAT_CSV {
+		span.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "format"),
+		))
+		return nil, lib.ErrUnacceptableRequest
+	}
+
+	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_DB_GET_STATEMENT)
+	defer dbSpan.End()
+
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetStatementFiles),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.StatementId, req.UserId}),
+	)
+
+	files := repo.StatementFiles{}
+	err := s.db.GetContext(ctx, &files, queries.QueryGetStatementFiles, req.StatementId, req.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			dbSpan.AddEvent(lib.EVENT_STATEMENT_NOT_FOUND)
+			return nil, lib.ErrNotFound
+		}
+		dbSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbSpan.End()
+
+	content, checksum := files.Pdf, files.PdfChecksum
+	if req.Format == lib.STATEMENT_FORMAT_CSV {
+		content, checksum = files.Csv, files.CsvChecksum
+	}
+
+	return &pb.StatementFile{
+		StatementId: files.StatementId,
+		Filename:    lib.StatementFilename(files.Month, req.Format),
+		ContentType: lib.StatementContentType(req.Format),
+		Content:     content,
+		Checksum:    checksum,
+	}, nil
+}
@@ -137,7 +137,41 @@ func (s *UserServiceServer) GetUserById(ctx context.Context, req *pb.GetUserById
 	}
 	lookupAccountSpan.End()
 
-	return repo.DbUserToPbUser(user, account.CreditsPosted, account.DebitsPosted, account.DebitsPending, account.CreditsPending)
+	pbUser, err := repo.DbUserToPbUser(user, account.CreditsPosted, account.DebitsPosted, account.DebitsPending, account.CreditsPending)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, dbGetPotsSpan := tracer.Start(ctx, lib.EVENT_DB_GET_POT)
+	defer dbGetPotsSpan.End()
+
+	dbGetPotsSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetActivePots),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	pots := []repo.Pot{}
+	err = s.db.SelectContext(ctx, &pots, queries.QueryGetActivePots, req.UserId)
+	if err != nil {
+		dbGetPotsSpan.RecordError(err)
+		return nil, lib.ErrUnexpected
+	}
+	dbGetPotsSpan.End()
+
+	pbPots, potsTotal, err := s.potsWithBalances(ctx, tracer, pots)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := repo.HexStringToBigInt(pbUser.Balance)
+	if err != nil {
+		return nil, lib.ErrUnexpected
+	}
+
+	pbUser.Pots = pbPots
+	pbUser.TotalBalance = potsTotal.Add(potsTotal, balance).Text(16)
+
+	return pbUser, nil
 }
 
 func (s *UserServiceServer) GetUserByPhoneNumber(ctx context.Context, req *pb.GetUserByPhoneNumberRequest) (*pb.User, error) {
@@ -222,8 +256,65 @@ func (s *UserServiceServer) GetUserTransfers(ctx context.Context, req *pb.GetUse
 	)
 	getTransfersSpan.End()
 
-	userIds := make([]string, len(transfers.Transfers)*2)
-	for i, transfer := range transfers.Transfers {
+	pbTransfers, err := s.transfersWithDetails(ctx, tracer, req.UserId, transfers.Transfers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetUserTransfersResponse{
+		Transfers: pbTransfers,
+	}, nil
+}
+
+// getAllAccountTransfers pages through every transfer of the account between
+// the timestamps, newest first. Each page ends just before the oldest
+// transfer of the previous one.
+func (s *UserServiceServer) getAllAccountTransfers(ctx context.Context, tracer trace.Tracer, userId string, minTimestamp, maxTimestamp time.Time) ([]*tbPb.Transfer, error) {
+	ctx, getTransfersSpan := tracer.Start(ctx, lib.EVENT_TB_GET_TRANSFERS)
+	defer getTransfersSpan.End()
+
+	transfers := []*tbPb.Transfer{}
+	minTimestampStr := minTimestamp.UTC().Format(time.RFC3339Nano)
+	maxTimestampStr := maxTimestamp.UTC().Format(time.RFC3339Nano)
+	limit := uint32(lib.TransfersPageSize)
+	for {
+		page, err := s.tigerbeetleService.GetAccountTransfers(ctx, &tbPb.GetAccountTransfersRequest{
+			UserId:       userId,
+			MinTimestamp: &minTimestampStr,
+			MaxTimestamp: &maxTimestampStr,
+			Limit:        &limit,
+		})
+		if err != nil {
+			getTransfersSpan.RecordError(err)
+			return nil, lib.ErrUnexpected
+		}
+		transfers = append(transfers, page.Transfers...)
+
+		if len(page.Transfers) < lib.TransfersPageSize {
+			break
+		}
+
+		oldest, err := time.Parse(time.RFC3339Nano, page.Transfers[len(page.Transfers)-1].Timestamp)
+		if err != nil {
+			getTransfersSpan.RecordError(err)
+			return nil, lib.ErrUnexpected
+		}
+		maxTimestampStr = oldest.Add(-time.Nanosecond).Format(time.RFC3339Nano)
+	}
+
+	getTransfersSpan.SetAttributes(
+		attribute.Int(lib.ATTR_TB_TRANSFER_COUNT, len(transfers)),
+	)
+	getTransfersSpan.End()
+
+	return transfers, nil
+}
+
+// transfersWithDetails resolves names, memos, pots and categories for the
+// transfers as seen by userId.
+func (s *UserServiceServer) transfersWithDetails(ctx context.Context, tracer trace.Tracer, userId string, transfers []*tbPb.Transfer) ([]*pb.Transfer, error) {
+	userIds := make([]string, len(transfers)*2)
+	for i, transfer := range transfers {
 		userIds[i*2] = transfer.DebitAccountId
 		userIds[i*2+1] = transfer.CreditAccountId
 	}
@@ -239,19 +330,58 @@ func (s *UserServiceServer) GetUserTransfers(ctx context.Context, req *pb.GetUse
 	}
 	mapUserIdsSpan.End()
 
-	pbTransfers := make([]*pb.Transfer, len(transfers.Transfers))
-	for i, transfer := range transfers.Transfers {
+	transferIds := make([]string, len(transfers))
+	for i, transfer := range transfers {
+		transferIds[i] = transfer.TransferId
+	}
+
+	ctx, mapTransferDetailsSpan := tracer.Start(ctx, lib.EVENT_MAP_TRANSFER_DETAILS)
+	defer mapTransferDetailsSpan.End()
+
+	transferIdToDetails, err := repo.MapTransferIdsToDetails(ctx, s.db, transferIds)
+	if err != nil {
+		mapTransferDetailsSpan.RecordError(err)
+		return nil, err
+	}
+	mapTransferDetailsSpan.End()
+
+	ctx, mapPotIdsSpan := tracer.Start(ctx, lib.EVENT_MAP_POT_IDS)
+	defer mapPotIdsSpan.End()
+
+	potIdToName, err := repo.MapPotIdsToNames(ctx, s.db, userIds)
+	if err != nil {
+		mapPotIdsSpan.RecordError(err)
+		return nil, err
+	}
+	mapPotIdsSpan.End()
+
+	categorizer, err := s.transferCategorizer(ctx, tracer, userId, transferIds)
+	if err != nil {
+		return nil, err
+	}
+
+	pbTransfers := make([]*pb.Transfer, len(transfers))
+	for i, transfer := range transfers {
 		debitUser := userIdToName[transfer.DebitAccountId]
 		creditUser := userIdToName[transfer.CreditAccountId]
+		details := transferIdToDetails[transfer.TransferId]
+
+		pbTransfers[i] = repo.TbTransferToPbTransfer(transfer, debitUser, creditUser, details, userId)
+
+		if potName, ok := potIdToName[transfer.DebitAccountId]; ok {
+			pbTransfers[i].PotName = &potName
+		} else if potName, ok := potIdToName[transfer.CreditAccountId]; ok {
+			pbTransfers[i].PotName = &potName
+		}
 
-		pbTransfers[i] = repo.TbTransferToPbTransfer(transfer, debitUser, creditUser, req.UserId)
+		pbTransfers[i].Category = categorizer.Categorize(pbTransfers[i])
 	}
 
-	return &pb.GetUserTransfersResponse{
-		Transfers: pbTransfers,
-	}, nil
+	return pbTransfers, nil
 }
 
+// GetSuggestedUsers returns favorites and recent counterparties, ranked by
+// lib.SuggestionScore. Blocked and deleted users are left out.
 func (s *UserServiceServer) GetSuggestedUsers(ctx context.Context, req *pb.GetSuggestedUsersRequest) (*pb.GetSuggestedUsersResponse, error) {
 	span := trace.SpanFromContext(ctx)
 	tracer := span.TracerProvider().Tracer(lib.ServiceName)
@@ -261,15 +391,30 @@ func (s *UserServiceServer) GetSuggestedUsers(ctx context.Context, req *pb.GetSu
 		attribute.Int64(lib.ATTR_SUGGESTED_USERS_LIMIT, int64(req.Limit)),
 	)
 
+	if req.Limit < 1 || req.Limit > lib.SuggestedUsersMaxLimit {
+		span.AddEvent(lib.EVENT_VALIDATION_FAILED, trace.WithAttributes(
+			attribute.String("field", "limit"),
+		))
+		return nil, lib.ErrUnacceptableRequest
+	}
+
 	ctx, dbSpan := tracer.Start(ctx, lib.EVENT_GET_SUGGESTED_USERS_DB)
 	defer dbSpan.End()
 
-	users, err := repo.GetSuggestedUsers(ctx, s.db, req.UserId, req.Limit)
+	dbSpan.SetAttributes(
+		attribute.String(lib.ATTR_DB_QUERY, queries.QueryGetSuggestedUsers),
+		attribute.StringSlice(lib.ATTR_DB_ARGS, []string{req.UserId}),
+	)
+
+	users, err := repo.GetSuggestedUsers(ctx, s.db, req.UserId, int(req.Limit))
 	if err != nil {
 		dbSpan.RecordError(err)
-		dbSpan.End()
-		return nil, lib.ErrUnexpected
+		return nil, err
 	}
+
+	dbSpan.SetAttributes(
+		attribute.Int(lib.ATTR_SUGGESTED_USERS_COUNT, len(users)),
+	)
 	dbSpan.End()
 
 	pbUsers := make([]*pb.SuggestedUser, len(users))
@@ -279,6 +424,8 @@ func (s *UserServiceServer) GetSuggestedUsers(ctx context.Context, req *pb.GetSu
 			PhoneNumber: user.PhoneNumber,
 			FirstName:   user.FirstName,
 			LastName:    user.LastName,
+			Nickname:    user.Nickname,
+			Favorite:    user.Favorite,
 		}
 	}
 